@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"apibgo/internal/lang"
+	"apibgo/pkg/univenv"
+)
+
+// Usage: go run ./cmd/lang check
+//
+// Reports keys which are missing or extra in the language files
+// compared with the fallback locale.
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: lang check")
+		os.Exit(2)
+	}
+
+	// Load .env files
+	univenv.Load()
+
+	base := lang.Fallback()
+	bundle, err := lang.Load(os.Getenv("LANG_PATH"), base)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	failed := false
+
+	for _, locale := range bundle.Locales() {
+		if locale == base {
+			continue
+		}
+
+		missing, extra := bundle.Diff(base, locale)
+
+		for _, key := range missing {
+			fmt.Printf("%s.yaml: missing key %s\n", locale, key)
+		}
+
+		for _, key := range extra {
+			fmt.Printf("%s.yaml: extra key %s\n", locale, key)
+		}
+
+		if len(missing) > 0 || len(extra) > 0 {
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+
+	fmt.Println("language files are consistent")
+}
@@ -1,15 +1,30 @@
 package app
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
 	"apibgo/internal/app/instance"
 	"apibgo/internal/config"
+	"apibgo/internal/repository"
+	"apibgo/internal/service"
 	"apibgo/internal/storage"
+	"apibgo/internal/storage/pgsql"
+	"apibgo/internal/storage/redis"
 	"apibgo/internal/transport/rest"
 	"apibgo/internal/transport/rest/middleware"
 	"apibgo/internal/transport/rest/routes"
+	"apibgo/internal/utils/request"
+	"apibgo/internal/utils/response"
+	"apibgo/pkg/auth/device"
+	"apibgo/pkg/auth/pswd"
+	"apibgo/pkg/auth/revoke"
+	"apibgo/pkg/clientip"
+	"apibgo/pkg/geoip"
+	aslog "apibgo/pkg/logger/feature/slog"
 
 	"github.com/gorilla/mux"
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -24,30 +39,267 @@ type Instance struct {
 func Run() {
 	instance := instance.GetInstance()
 
+	hasher := setupPassword(instance)
+	setupProxies(instance)
+	request.SetMaxBodyBytes(instance.Config.MaxBodyBytes)
+	response.SetFormat(instance.Config.ErrorFormat, instance.Config.ErrorTypeBase)
+	setupUserAgent(instance)
+
+	// The activity is shared by the requests and the job writing it
+	activity := service.NewActivity()
+	services := []service.Option{
+		service.WithAdminGroups(instance.Config.Permissions.AdminGroups...),
+		service.WithDeletionGrace(instance.Config.Users.GracePeriod),
+		service.WithEmailRevertURL(instance.Config.Users.EmailRevertURL),
+		service.WithEmailRevertTTL(instance.Config.Users.EmailRevertTTL),
+		service.WithActivity(activity),
+		hasher,
+		setupRevocations(instance),
+	}
+	services = append(services, setupLogin(instance)...)
+
 	_routes := []rest.Handler{
-		&routes.Auth{Config: instance.Config, Storage: instance.Storage},
+		&routes.Auth{Config: instance.Config, Storage: instance.Storage, Services: services},
+		&routes.Account{
+			Config:  instance.Config,
+			Storage: instance.Storage,
+			Middlewares: []mux.MiddlewareFunc{
+				middleware.LoggingMiddleware(services...),
+			},
+			Services: services,
+		},
 		&routes.User{
 			Config:  instance.Config,
 			Storage: instance.Storage,
 			Middlewares: []mux.MiddlewareFunc{
-				middleware.LoggingMiddleware,
+				middleware.LoggingMiddleware(services...),
 			},
+			Services: services,
 		},
 	}
 
 	r := mux.NewRouter()
 
 	rest.NewRouter(r, _routes...)
+	r.Use(middleware.ClientIpMiddleware)
 	r.Use(mux.CORSMethodMiddleware(r))
+	r.Use(middleware.ClientHintsMiddleware)
 
 	// Swagger UI
 	r.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
 
+	go purgeUsers(instance, services)
+	go flushActivity(instance, activity)
+
 	instance.Log.Info("starting restapi server at http://" + instance.Config.Address)
 	instance.Log.Info("Swagger URL: http://" + instance.Config.Address + "/swagger/")
 
 	if err := http.ListenAndServe(instance.Config.HTTPServer.Address, r); err != nil {
-		instance.Log.Error("failed to start server", err)
+		instance.Log.Error("failed to start server", aslog.Err(err))
+	}
+
+}
+
+// Anonymizes the users deleted longer than the grace period ago and removes
+// the ones deleted longer than the retention ago, at the start and then
+// every purge interval. A zero interval disables the purge.
+func purgeUsers(instance *instance.Instance, services []service.Option) {
+	cfg := instance.Config.Users
+
+	if cfg.PurgeInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		anonymized, purged, err := purgeUsersOnce(instance, services)
+
+		if err != nil {
+			instance.Log.Error("failed to purge deleted users", aslog.Err(err))
+			continue
+		}
+
+		if anonymized > 0 {
+			instance.Log.Info("deleted users anonymized", slog.Int64("count", anonymized))
+		}
+		if purged > 0 {
+			instance.Log.Info("deleted users purged", slog.Int64("count", purged))
+		}
+	}
+}
+
+func purgeUsersOnce(instance *instance.Instance, services []service.Option) (anonymized int64, purged int64, err error) {
+	ctx := context.Background()
+	pg, err := pgsql.New(instance.Storage, "master")
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer pg.Db.Close(ctx)
+
+	userService := service.NewUserService(repository.NewStore(pg), services...)
+
+	if anonymized, err = userService.AnonymizeUsers(ctx, instance.Config.Users.GracePeriod); err != nil {
+		return 0, 0, err
+	}
+
+	purged, err = userService.PurgeUsers(ctx, instance.Config.Users.Retention)
+
+	return anonymized, purged, err
+}
+
+// Writes the last activity of the users of the requests every activity
+// interval, a zero interval writes nothing
+func flushActivity(instance *instance.Instance, activity *service.Activity) {
+	interval := instance.Config.Users.ActivityInterval
+
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := flushActivityOnce(instance, activity); err != nil {
+			instance.Log.Error("failed to write the activity of users", aslog.Err(err))
+		}
+	}
+}
+
+func flushActivityOnce(instance *instance.Instance, activity *service.Activity) error {
+	ctx := context.Background()
+	pg, err := pgsql.New(instance.Storage, "master")
+
+	if err != nil {
+		return err
+	}
+
+	defer pg.Db.Close(ctx)
+
+	_, err = activity.Flush(ctx, repository.NewStore(pg))
+
+	return err
+}
+
+// The hasher of the passwords is an option of the services, the policy and
+// the breached list are checked by the validation of the requests. The start
+// fails on an invalid hasher, the passwords would not be hashed.
+func setupPassword(instance *instance.Instance) service.Option {
+	cfg := instance.Config.Password
+	hash := instance.Config.PasswordHash
+	passwords := pswd.Hasher{
+		Algorithm:  hash.Algorithm,
+		BcryptCost: hash.BcryptCost,
+		Argon2: pswd.Argon2Params{
+			Memory:      hash.Argon2.Memory,
+			Iterations:  hash.Argon2.Iterations,
+			Parallelism: hash.Argon2.Parallelism,
+			SaltLength:  hash.Argon2.SaltLength,
+			KeyLength:   hash.Argon2.KeyLength,
+		},
+	}
+
+	if err := passwords.Validate(); err != nil {
+		instance.Log.Error("invalid password hash config", aslog.Err(err))
+		os.Exit(1)
+	}
+
+	hasher := service.WithHasher(passwords)
+
+	pswd.SetPolicy(pswd.Policy{
+		MinLength:     cfg.MinLength,
+		RequireUpper:  cfg.RequireUpper,
+		RequireLower:  cfg.RequireLower,
+		RequireDigit:  cfg.RequireDigit,
+		RequireSymbol: cfg.RequireSymbol,
+	})
+
+	if cfg.BreachedList == "" {
+		return hasher
+	}
+
+	list, err := pswd.OpenBreachList(cfg.BreachedList)
+
+	if err != nil {
+		instance.Log.Error("failed to open breached passwords list", aslog.Err(err))
+		return hasher
+	}
+
+	pswd.SetBreachList(list)
+
+	return hasher
+}
+
+// Revoked access tokens are kept in the memory of the process unless redis
+// is configured, it's shared by all the instances
+func setupRevocations(instance *instance.Instance) service.Option {
+	if instance.Config.Revocation.Store != "redis" {
+		return service.WithRevocations(revoke.NewMemory())
+	}
+
+	client, err := redis.New(instance.Storage)
+
+	if err != nil {
+		instance.Log.Error("failed to connect to redis, revoked tokens are kept in memory", aslog.Err(err))
+		return service.WithRevocations(revoke.NewMemory())
+	}
+
+	return service.WithRevocations(revoke.NewRedis(client, "revoked:"))
+}
+
+// Logins from new places are checked by the GeoIP database when its file
+// is set, without it only the devices are compared
+func setupLogin(instance *instance.Instance) []service.Option {
+	cfg := instance.Config.Login
+	opts := []service.Option{service.WithLoginConfirm(cfg.Confirm)}
+
+	if cfg.GeoIPPath == "" {
+		return opts
+	}
+
+	db, err := geoip.Open(cfg.GeoIPPath)
+
+	if err != nil {
+		instance.Log.Error("failed to open geoip database", aslog.Err(err))
+		return opts
+	}
+
+	return append(opts, service.WithGeoIP(db))
+}
+
+// The regexes of the user agents are replaced by the file of the config,
+// the embedded ones are kept when it can't be read
+func setupUserAgent(instance *instance.Instance) {
+	path := instance.Config.UserAgent.Regexes
+
+	if path == "" {
+		return
+	}
+
+	parser, err := device.Open(path)
+
+	if err != nil {
+		instance.Log.Error("failed to read user agent regexes", aslog.Err(err))
+		return
+	}
+
+	device.SetParser(parser)
+}
+
+// Without the trusted proxies the headers of the client address are ignored
+// The server doesn't start with invalid proxies, otherwise the addresses
+// of all the clients would be the ones of the proxies
+func setupProxies(instance *instance.Instance) {
+	proxies, err := clientip.ParseProxies(instance.Config.TrustedProxies, instance.Config.ForwardedHeader)
+
+	if err != nil {
+		instance.Log.Error("failed to parse trusted proxies", aslog.Err(err))
+		os.Exit(1)
 	}
 
+	clientip.SetTrusted(proxies)
 }
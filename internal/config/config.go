@@ -10,15 +10,57 @@ import (
 )
 
 type Config struct {
-	Env         string `yaml:"env" env-default:"local"`
-	StoragePath string `yaml:"storage_path" env-required:"true"`
-	HTTPServer  `yaml:"http_server"`
+	Env          string `yaml:"env" env-default:"local"`
+	StoragePath  string `yaml:"storage_path" env-required:"true"`
+	HTTPServer   `yaml:"http_server"`
+	Password     Password     `yaml:"password"`
+	PasswordHash PasswordHash `yaml:"password_hash"`
+	Permissions  Permissions  `yaml:"permissions"`
+	Users        Users        `yaml:"users"`
+	Revocation   Revocation   `yaml:"revocation"`
+	Login        Login        `yaml:"login"`
+	UserAgent    UserAgent    `yaml:"user_agent"`
 }
 
 type HTTPServer struct {
 	Address     string        `yaml:"address" env-default:"localhost:8080"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// Max size of a request body in bytes
+	MaxBodyBytes int64 `yaml:"max_body_bytes" env-default:"1048576"`
+	// Format of error responses: problem (RFC 7807) or envelope (the old one)
+	ErrorFormat string `yaml:"error_format" env-default:"problem"`
+	// Prefix of the problem type URIs
+	ErrorTypeBase string `yaml:"error_type_base" env-default:"/errors/"`
+	// CIDRs of the proxies, like load balancers, whose forwarded header is trusted
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Header the trusted proxies write the client address to: X-Forwarded-For or Forwarded
+	ForwardedHeader string `yaml:"forwarded_header" env-default:"X-Forwarded-For"`
+}
+
+// Password policy for new passwords
+type Password struct {
+	MinLength     int  `yaml:"min_length" env-default:"8"`
+	RequireUpper  bool `yaml:"require_upper" env-default:"true"`
+	RequireLower  bool `yaml:"require_lower" env-default:"true"`
+	RequireDigit  bool `yaml:"require_digit" env-default:"true"`
+	RequireSymbol bool `yaml:"require_symbol" env-default:"false"`
+	// Path to a local list of SHA-1 hashes of breached passwords, empty disables the check
+	BreachedList string `yaml:"breached_list"`
+}
+
+// Parameters of password hashing, hashes made with other ones
+// are remade after a successful login
+type PasswordHash struct {
+	Algorithm  string `yaml:"algorithm" env-default:"argon2id"`
+	BcryptCost int    `yaml:"bcrypt_cost" env-default:"10"`
+	Argon2     struct {
+		Memory      uint32 `yaml:"memory" env-default:"65536"`
+		Iterations  uint32 `yaml:"iterations" env-default:"3"`
+		Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+		SaltLength  uint32 `yaml:"salt_length" env-default:"16"`
+		KeyLength   uint32 `yaml:"key_length" env-default:"32"`
+	} `yaml:"argon2"`
 }
 
 func MustLoad() *Config {
@@ -47,3 +89,42 @@ func MustLoad() *Config {
 
 	return &cfg
 }
+
+// Permissions of users over other users
+type Permissions struct {
+	// Groups of admins, they change any field of any user
+	AdminGroups []int `yaml:"admin_groups"`
+}
+
+// Deleted users are restorable for the grace period, then they are anonymized
+// and purged after the retention
+type Users struct {
+	GracePeriod   time.Duration `yaml:"grace_period" env-default:"168h"`
+	Retention     time.Duration `yaml:"retention" env-default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env-default:"1h"`
+	// How often the last activity of users is written, requests between the writes are coalesced
+	ActivityInterval time.Duration `yaml:"activity_interval" env-default:"1m"`
+	// Page the mail about a changed email links to, it posts the id and token of its query to /users/email/revert/
+	EmailRevertURL string `yaml:"email_revert_url" env-default:"http://localhost:5200/users/email/revert/"`
+	// How long the link of the mail about a changed email works
+	EmailRevertTTL time.Duration `yaml:"email_revert_ttl" env-default:"168h"`
+}
+
+// Store of the revoked access tokens: memory or redis
+type Revocation struct {
+	Store string `yaml:"store" env-default:"memory"`
+}
+
+// Checks of logins from new devices
+type Login struct {
+	// When a login is confirmed by a mailed code: off, suspicious or new_device
+	Confirm string `yaml:"confirm" env-default:"off"`
+	// Path to a CSV of the IP ranges with locations (DB-IP lite), empty disables the location checks
+	GeoIPPath string `yaml:"geoip_path"`
+}
+
+// Parsing of user agents
+type UserAgent struct {
+	// Path to a regexes file like pkg/auth/device/regexes.yaml, empty uses the embedded one
+	Regexes string `yaml:"regexes"`
+}
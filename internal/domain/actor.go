@@ -0,0 +1,25 @@
+package domain
+
+import "context"
+
+// Actor is the user who makes the request. SessionId is the session
+// of the token, 0 when the session is unknown.
+type Actor struct {
+	UserId    int
+	GroupId   int
+	SessionId int
+}
+
+type actorKey struct{}
+
+// WithActor returns the context of the request of the actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor of the request, false for anonymous requests
+func ActorFrom(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+
+	return actor, ok
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+)
+
+// KnownDevice is a device the user logged in from. The fingerprint is of
+// the browser and OS families, the network and the id the client sent, the
+// location is of the last login by the GeoIP database.
+type KnownDevice struct {
+	Id          uint            `db:"id"`
+	UserId      uint            `db:"user_id"`
+	Fingerprint string          `db:"fingerprint"`
+	Name        string          `db:"name"`
+	Ip          sql.NullString  `db:"ip"`
+	Country     string          `db:"country"`
+	Latitude    sql.NullFloat64 `db:"latitude"`
+	Longitude   sql.NullFloat64 `db:"longitude"`
+	LastSeenAt  time.Time       `db:"last_seen_at"`
+	CreatedAt   time.Time       `db:"created_at"`
+}
+
+func (d *KnownDevice) TableName() string {
+	return "known_devices"
+}
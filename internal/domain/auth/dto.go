@@ -1,24 +1,40 @@
 package auth
 
+import (
+	"apibgo/internal/domain"
+	"apibgo/pkg/auth/device"
+)
+
+// SessionDto is the list of sessions of the user with the id
 type SessionDto struct {
-	Id int `json:"id" validate:"required,number"`
+	domain.PageDto
+	Id     int    `json:"id" validate:"required,number"`
+	Ip     string `json:"ip" query:"ip" validate:"omitempty,ip"`
+	Device string `json:"device" query:"device" validate:"omitempty,max=30"`
 }
 
 type AuthDto struct {
 	Id        int
 	UserId    int
 	Refresh   string
+	Access    string
 	Device    string
 	Ip        string
 	UserAgent string
 }
 
+// LoginDto is the login of the user. DeviceId is an id the client keeps to
+// be known as the same device, Code confirms a login the mail was sent of.
+// Hints are the client hints headers sent with the user agent.
 type LoginDto struct {
-	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password" validate:"required"`
-	Device    string
-	Ip        string
-	UserAgent string
+	Email     string       `json:"email" validate:"required,email"`
+	Password  string       `json:"password" validate:"required"`
+	DeviceId  string       `json:"device_id" validate:"omitempty,max=64"`
+	Code      int          `json:"code" validate:"omitempty,min=0,max=999999"`
+	Device    string       `json:"-"`
+	Ip        string       `json:"-"`
+	UserAgent string       `json:"-"`
+	Hints     device.Hints `json:"-"`
 }
 
 type DestroyDto struct {
@@ -26,10 +42,18 @@ type DestroyDto struct {
 	Token string
 }
 
+// RenameDto names the session with the id of the user, the empty name
+// returns the name of the device
+type RenameDto struct {
+	Id     int    `json:"-" validate:"required,min=1"`
+	UserId int    `json:"-" validate:"required,min=1"`
+	Name   string `json:"name" validate:"max=50"`
+}
+
 type RegistrationDto struct {
 	Email           string `json:"email" validate:"required,email"`
-	Password        string `json:"password" validate:"required"`
-	ConfirmPassword string `json:"confirm_password" validate:"required"`
+	Password        string `json:"password" validate:"required,password,pwd_excludes=Email Name Surname,not_breached"`
+	ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=Password"`
 	Name            string `json:"name" validate:"required,alpha"`
 	Surname         string `json:"surname" validate:"required,alpha"`
 }
@@ -44,15 +68,19 @@ type ForgotDto struct {
 	Email string `json:"email" validate:"required,email"`
 }
 
+type ResendDto struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
 type RecoveryDto struct {
 	Email           string `json:"email" validate:"required,email"`
 	Code            int    `json:"code" validate:"required,numeric"`
-	Password        string `json:"password" validate:"required"`
-	ConfirmPassword string `json:"confirm_password" validate:"required"`
+	Password        string `json:"password" validate:"required,password,pwd_excludes=Email,not_breached"`
+	ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=Password"`
 }
 
 type ConfirmCheckDto struct {
 	Email  string `json:"email" validate:"required,email"`
-	Action string `json:"action" validate:"required,oneof_insensitive=registration forgot"`
+	Action string `json:"action" validate:"required,oneof_insensitive=registration forgot email"`
 	Code   int    `json:"code" validate:"required,numeric"`
 }
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+
+	"apibgo/internal/domain"
+)
+
+// Kinds of the login events
+const (
+	EventLogin   = "login"
+	EventRefresh = "refresh"
+	EventLogout  = "logout"
+)
+
+// LoginEvent is a login, refresh or logout of the user, failed logins are
+// kept too. Events are only appended, the device, OS and browser are of
+// the user agent at the time of the event.
+type LoginEvent struct {
+	Id        uint           `db:"id"`
+	UserId    uint           `db:"user_id"`
+	Kind      string         `db:"kind"`
+	Success   bool           `db:"success"`
+	Ip        sql.NullString `db:"ip"`
+	Device    string         `db:"device"`
+	Os        string         `db:"os"`
+	Browser   string         `db:"browser"`
+	UserAgent sql.NullString `db:"user_agent"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (e *LoginEvent) TableName() string {
+	return "login_events"
+}
+
+// EventDto is the login history of the user with the id
+type EventDto struct {
+	domain.PageDto
+	UserId  int    `json:"-" validate:"required,min=1"`
+	Kind    string `json:"kind" query:"kind" validate:"omitempty,oneof=login refresh logout"`
+	Success *bool  `json:"success" query:"success"`
+}
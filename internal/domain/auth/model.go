@@ -1,18 +1,40 @@
 package auth
 
-import "time"
+import (
+	"database/sql"
+	"time"
+)
 
+// Auth is a session of a user. Name is given by the user, the null one is
+// the name of the device. LastSeenAt and LastIp are of the last request.
 type Auth struct {
-	Id           uint      `db:"id"`
-	UserId       uint      `db:"user_id"`
-	AccessToken  string    `db:"access_token"`
-	RefreshToken string    `db:"refresh_token"`
-	Ip           string    `db:"ip"`
-	Device       string    `db:"device"`
-	UserAgent    string    `db:"user_agent"`
-	CreatedAt    time.Time `db:"created_at"`
+	Id           uint           `db:"id"`
+	UserId       uint           `db:"user_id"`
+	AccessToken  string         `db:"access_token"`
+	RefreshToken string         `db:"refresh_token"`
+	Ip           string         `db:"ip"`
+	Device       string         `db:"device"`
+	UserAgent    string         `db:"user_agent"`
+	Name         sql.NullString `db:"name"`
+	LastSeenAt   sql.NullTime   `db:"last_seen_at"`
+	LastIp       sql.NullString `db:"last_ip"`
+	CreatedAt    time.Time      `db:"created_at"`
 }
 
 func (a *Auth) TableName() string {
 	return "auths"
 }
+
+// Tokens is a result of the login and refresh. RefreshExpiresAt is zero,
+// when the current tokens are still valid and weren't remade.
+type Tokens struct {
+	AccessToken      string
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// Registration is a result of the registration, Key signs the activation
+type Registration struct {
+	Email string
+	Key   string
+}
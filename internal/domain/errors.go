@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"errors"
+)
+
+// Kinds of errors returned by services, transports map them to their own
+// statuses (HTTP, gRPC, exit codes of a CLI)
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrForbidden    = errors.New("forbidden")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrValidation   = errors.New("validation")
+	// The state doesn't allow the action, e.g. an account is not activated
+	ErrPrecondition = errors.New("precondition failed")
+	ErrExpired      = errors.New("expired")
+)
+
+// Reasons clarify the kind of an error, they are stable and
+// can be used by transports to choose a more exact code
+const (
+	ReasonAccountNotActivated     = "account_not_activated"
+	ReasonAccountAlreadyActivated = "account_already_activated"
+	ReasonAccountExists           = "account_exists"
+	ReasonAccountNotCreated       = "account_not_created"
+	ReasonInvalidCredentials      = "invalid_credentials"
+	ReasonInvalidCode             = "invalid_code"
+	ReasonCodeExpired             = "code_expired"
+	ReasonTokenExpired            = "token_expired"
+	ReasonVersionMismatch         = "version_mismatch"
+	ReasonLoginConfirm            = "login_confirm_required"
+	ReasonTooManyAttempts         = "too_many_attempts"
+	ReasonUserBanned              = "user_banned"
+)
+
+// Error is an error of the domain. Kind is one of the Err* values,
+// errors.Is(err, domain.ErrNotFound) works through Unwrap.
+type Error struct {
+	Kind    error
+	Reason  string
+	Message string
+	// Messages by fields for ErrValidation
+	Fields map[string][]string
+}
+
+func NewError(kind error, reason string, message string) *Error {
+	return &Error{
+		Kind:    kind,
+		Reason:  reason,
+		Message: message,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+
+	return e.Kind.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// ReasonOf returns the reason of the domain error or an empty string
+func ReasonOf(err error) string {
+	var domainErr *Error
+
+	if errors.As(err, &domainErr) {
+		return domainErr.Reason
+	}
+
+	return ""
+}
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Optional is a field of a patch with the tracking of its presence. Set tells
+// whether the field was given, Null that it was given as null to clear it.
+type Optional[T any] struct {
+	Value T
+	Set   bool
+	Null  bool
+}
+
+// Some is the set field with the value
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{Value: value, Set: true}
+}
+
+// None is the field set to null
+func None[T any]() Optional[T] {
+	return Optional[T]{Set: true, Null: true}
+}
+
+// Get returns the value and whether it's set and isn't null
+func (o Optional[T]) Get() (T, bool) {
+	return o.Value, o.Set && !o.Null
+}
+
+// IsSet tells whether the field was given, the null too
+func (o Optional[T]) IsSet() bool {
+	return o.Set
+}
+
+// Interface is the value for validators, nil when it's absent or null
+func (o Optional[T]) Interface() any {
+	if value, ok := o.Get(); ok {
+		return value
+	}
+
+	return nil
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		var zero T
+		o.Value, o.Null = zero, true
+
+		return nil
+	}
+
+	o.Null = false
+
+	return json.Unmarshal(data, &o.Value)
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if value, ok := o.Get(); ok {
+		return json.Marshal(value)
+	}
+
+	return []byte("null"), nil
+}
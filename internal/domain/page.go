@@ -0,0 +1,37 @@
+package domain
+
+// Sizes of pages of lists
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// PageDto is the requested part of a list. A page of the Cursor continues
+// the previous one and ignores Offset. Sort is a field of the whitelist of
+// the list, the "-" prefix means the descending order, ties are sorted by id.
+type PageDto struct {
+	Limit  int    `json:"limit" query:"limit" validate:"omitempty,min=1,max=100"`
+	Offset int    `json:"offset" query:"offset" validate:"omitempty,min=0"`
+	Cursor string `json:"cursor" query:"cursor" validate:"omitempty,base64rawurl"`
+	Sort   string `json:"sort" query:"sort" validate:"omitempty,max=64"`
+}
+
+// Size is the limit within the bounds, the default one if it's not set
+func (p PageDto) Size() int {
+	switch {
+	case p.Limit <= 0:
+		return DefaultLimit
+	case p.Limit > MaxLimit:
+		return MaxLimit
+	}
+
+	return p.Limit
+}
+
+// Page is a part of a list. Total is the count of the whole filtered list,
+// Next is the cursor of the next page and it's empty on the last one.
+type Page[T any] struct {
+	Items []T
+	Total int
+	Next  string
+}
@@ -1,5 +1,12 @@
 package user
 
+import (
+	"time"
+
+	"apibgo/internal/domain"
+	"apibgo/pkg/auth/device"
+)
+
 type UserDto struct {
 	Id    int    `json:"id" validate:"omitempty,numeric"`
 	Email string `json:"email" validate:"omitempty,email"`
@@ -7,21 +14,114 @@ type UserDto struct {
 
 type CreateUserDto struct {
 	Email           string `json:"email" validate:"required,email"`
-	Password        string `json:"password" validate:"required"`
-	ConfirmPassword string `json:"confirm_password" validate:"required"`
+	Password        string `json:"password" validate:"required,password,pwd_excludes=Email Name Surname,not_breached"`
+	ConfirmPassword string `json:"confirm_password" validate:"required,eqfield=Password"`
 	Name            string `json:"name" validate:"required,alphaunicode"`
 	Surname         string `json:"surname" validate:"required,alphaunicode"`
 	Activation      bool   `json:"activation" validate:"omitempty,boolean"`
 	ConfirmStatus   string `json:"confirm_status" validate:"omitempty,oneof_insensitive=quest waiting success"`
 }
 
-type UpdateUserDto struct {
-	Id              int    `json:"id" validate:"required,number"`
-	Email           string `json:"email" validate:"required,email"`
-	Password        string `json:"password" validate:"required"`
-	ConfirmPassword string `json:"confirm_password" validate:"required"`
-	Name            string `json:"name" validate:"required,alphaunicode"`
-	Surname         string `json:"surname" validate:"required,alphaunicode"`
-	Activation      bool   `json:"activation" validate:"omitempty,boolean"`
-	ConfirmStatus   string `json:"confirm_status" validate:"omitempty,oneof_insensitive=quest waiting success"`
+// PatchUserDto is a JSON Merge Patch of a user, absent fields are kept
+// and null ones are cleared. Id is the patched user of the path, Versions
+// are the expected versions of the user, none patches any version.
+type PatchUserDto struct {
+	Id              int                     `json:"-" validate:"required,number"`
+	Versions        domain.Versions         `json:"-"`
+	Email           domain.Optional[string] `json:"email" validate:"omitempty,email"`
+	Password        domain.Optional[string] `json:"password" validate:"omitempty,password,pwd_excludes=Email Name Surname,not_breached"`
+	ConfirmPassword domain.Optional[string] `json:"confirm_password" validate:"omitempty,eqfield=Password"`
+	Name            domain.Optional[string] `json:"name" validate:"omitempty,alphaunicode"`
+	Surname         domain.Optional[string] `json:"surname" validate:"omitempty,alphaunicode"`
+	Locale          domain.Optional[string] `json:"locale" validate:"omitempty,bcp47_language_tag"`
+	Timezone        domain.Optional[string] `json:"timezone" validate:"omitempty,timezone"`
+	Activation      domain.Optional[bool]   `json:"activation"`
+	ConfirmStatus   domain.Optional[string] `json:"confirm_status" validate:"omitempty,oneof_insensitive=quest waiting success"`
+	GroupId         domain.Optional[int]    `json:"group_id" validate:"omitempty,min=1"`
+}
+
+// PatchMeDto is a JSON Merge Patch of the own profile by the fields users
+// change without admin rights, the email and the password have own requests
+type PatchMeDto struct {
+	Versions domain.Versions         `json:"-"`
+	Name     domain.Optional[string] `json:"name" validate:"omitempty,alphaunicode"`
+	Surname  domain.Optional[string] `json:"surname" validate:"omitempty,alphaunicode"`
+	Locale   domain.Optional[string] `json:"locale" validate:"omitempty,bcp47_language_tag"`
+	Timezone domain.Optional[string] `json:"timezone" validate:"omitempty,timezone"`
+}
+
+// PatchUserDto is the patch of the user with the id
+func (dto PatchMeDto) PatchUserDto(id int) PatchUserDto {
+	return PatchUserDto{
+		Id:       id,
+		Versions: dto.Versions,
+		Name:     dto.Name,
+		Surname:  dto.Surname,
+		Locale:   dto.Locale,
+		Timezone: dto.Timezone,
+	}
+}
+
+// BanDto bans the user of the path for the reason until the time,
+// the zero time bans forever
+type BanDto struct {
+	UserId    int       `json:"-" validate:"required,min=1"`
+	ReasonId  int       `json:"reason_id" validate:"required,min=1"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+// ListDto filters the list of users, the bounds of created_at are inclusive.
+// Search is a part of the email, name or surname.
+type ListDto struct {
+	domain.PageDto
+	Activation    *bool     `json:"activation" query:"activation"`
+	ConfirmStatus string    `json:"confirm_status" query:"confirm_status" validate:"omitempty,oneof=quest waiting success error unknown"`
+	GroupId       int       `json:"group_id" query:"group_id" validate:"omitempty,min=1"`
+	CreatedFrom   time.Time `json:"created_from" query:"created_from"`
+	CreatedTo     time.Time `json:"created_to" query:"created_to"`
+	Search        string    `json:"search" query:"search" validate:"omitempty,max=150"`
+}
+
+// SearchDto is the text searched in emails, names and surnames
+type SearchDto struct {
+	Query string `json:"q" query:"q" validate:"required,min=2,max=150"`
+	Limit int    `json:"limit" query:"limit" validate:"omitempty,min=1,max=100"`
+}
+
+// Size is the limit of the found users, the default one if it's not set
+func (d SearchDto) Size() int {
+	return domain.PageDto{Limit: d.Limit}.Size()
+}
+
+// ChangeEmailDto stages the new email of the actor, the password is asked again
+type ChangeEmailDto struct {
+	Email    string `json:"email" validate:"required,email,max=150"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ConfirmEmailDto applies the pending email by the code sent to it
+type ConfirmEmailDto struct {
+	Code int `json:"code" validate:"required,numeric"`
+}
+
+// RevertEmailDto returns the previous email of the user by the token of the mail
+type RevertEmailDto struct {
+	Id    int    `json:"id" validate:"required,min=1"`
+	Token string `json:"token" validate:"required"`
+}
+
+// ChangePasswordDto changes the password of the actor by the current one.
+// RotateSecret also replaces the token secret key of the user. Email, Name
+// and Surname are of the user, the new password must not contain them.
+type ChangePasswordDto struct {
+	CurrentPassword string       `json:"current_password" validate:"required"`
+	Password        string       `json:"password" validate:"required,nefield=CurrentPassword,password,pwd_excludes=Email Name Surname,not_breached"`
+	ConfirmPassword string       `json:"confirm_password" validate:"required,eqfield=Password"`
+	RotateSecret    bool         `json:"rotate_secret"`
+	Email           string       `json:"-"`
+	Name            string       `json:"-"`
+	Surname         string       `json:"-"`
+	Ip              string       `json:"-"`
+	UserAgent       string       `json:"-"`
+	Hints           device.Hints `json:"-"`
 }
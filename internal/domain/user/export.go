@@ -0,0 +1,39 @@
+package user
+
+import (
+	"database/sql"
+	"time"
+
+	domainAuth "apibgo/internal/domain/auth"
+)
+
+// Consent is a decision of the user about a document of the kind
+// (e.g. "terms" or "marketing") of the version. Every decision is
+// a new row, the last one of the kind is in force.
+type Consent struct {
+	Id        uint           `db:"id"`
+	UserId    uint           `db:"user_id"`
+	Kind      string         `db:"kind"`
+	Version   string         `db:"version"`
+	Granted   bool           `db:"granted"`
+	Ip        sql.NullString `db:"ip"`
+	CreatedAt time.Time      `db:"created_at"`
+}
+
+func (c *Consent) TableName() string {
+	return "consents"
+}
+
+// Export is the personal data of the user
+type Export struct {
+	User     User
+	Sessions []domainAuth.Auth
+	Logins   []domainAuth.LoginEvent
+	Devices  []domainAuth.KnownDevice
+	Consents []Consent
+}
+
+// DeleteAccountDto deletes the account of the actor, the password is asked again
+type DeleteAccountDto struct {
+	Password string `json:"password" validate:"required"`
+}
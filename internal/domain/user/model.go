@@ -5,28 +5,94 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"time"
+
+	"apibgo/internal/domain"
 )
 
+// User is an account. Version is increased by every update, updates of
+// the stale version are rejected. Deleted users are hidden until they
+// are restored or purged, they are anonymized after the grace period.
+// The null locale and timezone are the defaults of the application.
+// A new email is pending until it's confirmed by the code, then the previous
+// one can revert the change by the token of the EmailRevert hash until
+// EmailRevertUntil. ConfirmAttempts are the failed attempts of the confirm code.
 type User struct {
-	Id             uint              `db:"id"`
-	Email          string            `db:"email"`
-	Password       string            `db:"password"`
-	Activation     bool              `db:"activation"`
-	Name           sql.NullString    `db:"name"`
-	Surname        sql.NullString    `db:"surname"`
-	TokenSecretKey string            `db:"token_secret_key,omitempty"`
-	ConfirmCode    sql.NullString    `db:"confirm_code,omitempty"`
-	ConfirmAction  sql.NullString    `db:"confirm_action,omitempty"`
-	ConfirmedAt    sql.NullTime      `db:"confirmed_at,omitempty"`
-	ConfirmStatus  ConfirmStatusEnum `db:"confirm_status,omitempty"`
-	UpdatedAt      sql.NullTime      `db:"updated_at,omitempty"`
-	CreatedAt      time.Time         `db:"created_at"`
+	Id               uint              `db:"id"`
+	GroupId          uint              `db:"group_id"`
+	Version          int               `db:"version"`
+	Email            string            `db:"email"`
+	PendingEmail     sql.NullString    `db:"pending_email"`
+	PreviousEmail    sql.NullString    `db:"previous_email"`
+	EmailRevert      sql.NullString    `db:"email_revert_token"`
+	EmailRevertUntil sql.NullTime      `db:"email_revert_expires_at"`
+	Password         string            `db:"password"`
+	Activation       bool              `db:"activation"`
+	Name             sql.NullString    `db:"name"`
+	Surname          sql.NullString    `db:"surname"`
+	Locale           sql.NullString    `db:"locale"`
+	Timezone         sql.NullString    `db:"timezone"`
+	TokenSecretKey   string            `db:"token_secret_key,omitempty"`
+	ConfirmCode      sql.NullString    `db:"confirm_code,omitempty"`
+	ConfirmAction    sql.NullString    `db:"confirm_action,omitempty"`
+	ConfirmAttempts  int               `db:"confirm_attempts"`
+	ConfirmedAt      sql.NullTime      `db:"confirmed_at,omitempty"`
+	ConfirmStatus    ConfirmStatusEnum `db:"confirm_status,omitempty"`
+	LastActivityAt   sql.NullTime      `db:"last_activity_at,omitempty"`
+	UpdatedAt        sql.NullTime      `db:"updated_at,omitempty"`
+	DeletedAt        sql.NullTime      `db:"deleted_at,omitempty"`
+	AnonymizedAt     sql.NullTime      `db:"anonymized_at,omitempty"`
+	CreatedAt        time.Time         `db:"created_at"`
 }
 
 func (a *User) TableName() string {
 	return "users"
 }
 
+// Ban blocks the user from logging in until ExpiredAt, the null one is forever
+type Ban struct {
+	Id        uint         `db:"id"`
+	UserId    uint         `db:"user_id"`
+	ReasonId  uint         `db:"reason_id"`
+	IsExpire  bool         `db:"is_expire"`
+	ExpiredAt sql.NullTime `db:"expired_at"`
+	CreatedAt time.Time    `db:"created_at"`
+}
+
+func (b *Ban) TableName() string {
+	return "blocked_users"
+}
+
+// Changes of a user, only the set fields are updated and the null ones are cleared
+type Changes struct {
+	Email            domain.Optional[string]
+	PendingEmail     domain.Optional[string]
+	PreviousEmail    domain.Optional[string]
+	EmailRevert      domain.Optional[string]
+	EmailRevertUntil domain.Optional[time.Time]
+	Password         domain.Optional[string]
+	Name             domain.Optional[string]
+	Surname          domain.Optional[string]
+	Locale           domain.Optional[string]
+	Timezone         domain.Optional[string]
+	Activation       domain.Optional[bool]
+	GroupId          domain.Optional[uint]
+	TokenSecretKey   domain.Optional[string]
+	ConfirmCode      domain.Optional[string]
+	ConfirmAction    domain.Optional[string]
+	ConfirmAttempts  domain.Optional[int]
+	ConfirmedAt      domain.Optional[time.Time]
+	ConfirmStatus    domain.Optional[ConfirmStatusEnum]
+}
+
+// Match is a found user, the better matches have the greater rank.
+// Highlight is the HTML escaped name, surname and email with the matches
+// in <mark> tags.
+type Match struct {
+	User      User
+	Rank      float64
+	Highlight string
+}
+
 type ConfirmStatusEnum string
 
 const (
@@ -0,0 +1,21 @@
+package domain
+
+import "slices"
+
+// Versions are the versions of a resource a change is made on, the ones of
+// the entity tags of the If-Match header. No versions match any version.
+type Versions []int
+
+// Match returns the version of the list which is the current one of the
+// resource, 0 when any version matches, and false when none matches
+func (v Versions) Match(current int) (int, bool) {
+	if len(v) == 0 {
+		return 0, true
+	}
+
+	if slices.Contains(v, current) {
+		return current, true
+	}
+
+	return 0, false
+}
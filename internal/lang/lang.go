@@ -1,67 +1,331 @@
 package lang
 
 import (
-	"apibgo/internal/lang/sections"
-	"apibgo/pkg/univenv"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
+
+	"apibgo/internal/lang/sections"
+	"apibgo/pkg/univenv"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultFallback = "en"
 
-	"github.com/ilyakaznacheev/cleanenv"
+var (
+	defaultBundle *Bundle
+	defaultOnce   sync.Once
 )
 
+type Lang struct {
+	Mail       sections.Mail       `yaml:"mail"`
+	Validation sections.Validation `yaml:"validation"`
+}
+
+// Bundle keeps every language file of LANG_PATH parsed in memory.
+// A key missing in a locale is taken from the fallback locale.
+type Bundle struct {
+	fallback string
+	langs    map[string]Lang
+	messages map[string]map[string]string
+}
+
 func Locale() string {
 	lang := os.Getenv("APP_LANG")
 
 	return lang
 }
 
-func Get(lang string) (Lang, bool) {
-	appLang := mustLoad()
-	value, ok := appLang[lang]
+// Fallback returns the locale used for the keys missing in other locales
+func Fallback() string {
+	if lang := os.Getenv("APP_FALLBACK_LANG"); lang != "" {
+		return lang
+	}
 
-	return value, ok
+	return defaultFallback
 }
 
-type Lang struct {
-	Mail       sections.Mail       `yaml:"mail"`
-	Validation sections.Validation `yaml:"validation"`
+// Default returns the bundle loaded once from LANG_PATH.
+// Broken files are logged and skipped, so the application keeps running.
+func Default() *Bundle {
+	defaultOnce.Do(func() {
+		bundle, err := Load(os.Getenv("LANG_PATH"), Fallback())
+
+		if err != nil {
+			log.Printf("lang: %s", err)
+		}
+
+		defaultBundle = bundle
+	})
+
+	return defaultBundle
+}
+
+func Get(lang string) (Lang, bool) {
+	return Default().Get(lang)
+}
+
+// T returns the message by a dotted key for the application locale
+func T(key string, params map[string]string) string {
+	return Default().T(Locale(), key, params)
 }
 
-func mustLoad() map[string]Lang {
-	langPath := os.Getenv("LANG_PATH")
+// Load reads all *.yaml files of the path. Files which cannot be read are
+// skipped and their errors are returned joined together with the bundle.
+func Load(path string, fallback string) (*Bundle, error) {
+	bundle := &Bundle{
+		fallback: normalize(fallback),
+		langs:    map[string]Lang{},
+		messages: map[string]map[string]string{},
+	}
 
-	if langPath == "" {
-		log.Fatal("LANG_PATH is not set")
+	if path == "" {
+		return bundle, errors.New("LANG_PATH is not set")
 	}
 
-	// check if files exists
-	files, err := os.ReadDir(langPath)
+	files, err := os.ReadDir(path)
 
 	if err != nil {
-		log.Fatalf("There is a problem in the folder: %s", langPath)
+		return bundle, fmt.Errorf("there is a problem in the folder %s: %w", path, err)
 	}
 
-	langs := make(map[string]Lang)
+	var errs []error
 
 	for _, file := range files {
-		withEnv, err := univenv.YamlWithEnv(langPath + file.Name())
+		if file.IsDir() || filepath.Ext(file.Name()) != ".yaml" {
+			continue
+		}
 
-		if err != nil {
-			log.Fatalf("cannot set env variables to yaml a file: %s", err)
+		if err := bundle.loadFile(filepath.Join(path, file.Name())); err != nil {
+			errs = append(errs, fmt.Errorf("%s -> %w", file.Name(), err))
 		}
+	}
+
+	return bundle, errors.Join(errs...)
+}
+
+func (b *Bundle) loadFile(path string) error {
+	withEnv, err := univenv.YamlWithEnv(path)
+
+	if err != nil {
+		return fmt.Errorf("cannot set env variables to yaml a file: %w", err)
+	}
+
+	data, err := io.ReadAll(withEnv)
+
+	if err != nil {
+		return err
+	}
 
-		var langData Lang
+	var langData Lang
+	var raw map[string]interface{}
 
-		if err := cleanenv.ParseYAML(withEnv, &langData); err != nil {
-			log.Fatalf(file.Name()+" -> cannot read language file: %s", err)
+	if err := yaml.Unmarshal(data, &langData); err != nil {
+		return fmt.Errorf("cannot read language file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("cannot read language file: %w", err)
+	}
+
+	lang := normalize(strings.TrimSuffix(filepath.Base(path), ".yaml"))
+	messages := map[string]string{}
+	flatten("", raw, messages)
+
+	b.langs[lang] = langData
+	b.messages[lang] = messages
+
+	return nil
+}
+
+// Get returns the typed sections of a locale, the empty values
+// are filled from the fallback locale
+func (b *Bundle) Get(lang string) (Lang, bool) {
+	lang = normalize(lang)
+	value, ok := b.langs[lang]
+
+	if fallback, has := b.langs[b.fallback]; has && lang != b.fallback {
+		mergeFallback(reflect.ValueOf(&value).Elem(), reflect.ValueOf(fallback))
+	}
+
+	return value, ok
+}
+
+// T returns the message by a dotted key (e.g. "mail.login.subject")
+// with the named parameters replaced
+func (b *Bundle) T(lang string, key string, params map[string]string) string {
+	return Format(b.lookup(normalize(lang), key), params)
+}
+
+// Plural returns the form of the message matching the number by the CLDR
+// rules of the locale. The forms are stored as nested keys (one, few, many, other),
+// the number itself is available as the "count" parameter.
+func (b *Bundle) Plural(lang string, key string, n int, params map[string]string) string {
+	lang = normalize(lang)
+	values := map[string]string{"count": fmt.Sprint(n)}
+
+	for k, v := range params {
+		values[k] = v
+	}
+
+	msg := b.lookup(lang, key+"."+PluralCategory(lang, n))
+
+	if msg == "" {
+		msg = b.lookup(lang, key+"."+PluralOther)
+	}
+
+	return Format(msg, values)
+}
+
+// Locales returns the loaded locales in alphabetical order
+func (b *Bundle) Locales() []string {
+	locales := make([]string, 0, len(b.messages))
+
+	for lang := range b.messages {
+		locales = append(locales, lang)
+	}
+
+	sort.Strings(locales)
+
+	return locales
+}
+
+// Diff compares keys of the locale with the base locale.
+// Plural forms are compared by their parent key, since locales have different sets of forms.
+func (b *Bundle) Diff(base string, lang string) (missing []string, extra []string) {
+	baseKeys := pluralKeys(b.messages[normalize(base)])
+	keys := pluralKeys(b.messages[normalize(lang)])
+
+	for key := range baseKeys {
+		if !keys[key] {
+			missing = append(missing, key)
+		}
+	}
+
+	for key := range keys {
+		if !baseKeys[key] {
+			extra = append(extra, key)
 		}
+	}
+
+	sort.Strings(missing)
+	sort.Strings(extra)
 
-		fileName := strings.Split(file.Name(), ".yaml")
-		lang := strings.ToLower(fileName[0])
+	return missing, extra
+}
 
-		langs[lang] = langData
+func (b *Bundle) lookup(lang string, key string) string {
+	if msg := b.messages[lang][key]; msg != "" {
+		return msg
 	}
 
-	return langs
+	return b.messages[b.fallback][key]
+}
+
+// The named parameters of messages, {{ name }} or :name
+var placeholder = regexp.MustCompile(`{{ *([\w.]+) *}}|:(\w+)\b`)
+
+// Format replaces the named parameters written as {{ name }} or :name.
+// The message is replaced in one pass, so the values are never replaced
+// again and the result doesn't depend on the order of the params.
+func Format(msg string, params map[string]string) string {
+	if len(params) == 0 {
+		return msg
+	}
+
+	return placeholder.ReplaceAllStringFunc(msg, func(match string) string {
+		groups := placeholder.FindStringSubmatch(match)
+		key := groups[1] + groups[2]
+
+		if value, ok := params[key]; ok {
+			return value
+		}
+
+		return match
+	})
+}
+
+func flatten(prefix string, value interface{}, dst map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+
+			flatten(key, item, dst)
+		}
+	case nil:
+		dst[prefix] = ""
+	default:
+		dst[prefix] = fmt.Sprint(v)
+	}
+}
+
+func pluralKeys(messages map[string]string) map[string]bool {
+	keys := make(map[string]bool, len(messages))
+
+	for key := range messages {
+		if i := strings.LastIndex(key, "."); i > 0 {
+			switch key[i+1:] {
+			case "zero", "two", PluralOne, PluralFew, PluralMany, PluralOther:
+				key = key[:i]
+			}
+		}
+
+		keys[key] = true
+	}
+
+	return keys
+}
+
+func mergeFallback(dst reflect.Value, src reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			mergeFallback(dst.Field(i), src.Field(i))
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+
+		// The map is copied, because the loaded one is shared between requests
+		merged := reflect.MakeMap(dst.Type())
+
+		for _, values := range []reflect.Value{src, dst} {
+			iter := values.MapRange()
+
+			for iter.Next() {
+				if !iter.Value().IsZero() {
+					merged.SetMapIndex(iter.Key(), iter.Value())
+				}
+			}
+		}
+
+		dst.Set(merged)
+	case reflect.String:
+		if dst.String() == "" {
+			dst.SetString(src.String())
+		}
+	}
+}
+
+func normalize(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[:i]
+	}
+
+	return lang
 }
@@ -0,0 +1,129 @@
+package lang_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"apibgo/internal/lang"
+)
+
+func TestPluralCategory(t *testing.T) {
+	tests := []struct {
+		lang string
+		n    int
+		want string
+	}{
+		{lang: "en", n: 0, want: lang.PluralOther},
+		{lang: "en", n: 1, want: lang.PluralOne},
+		{lang: "en", n: 2, want: lang.PluralOther},
+		{lang: "en-US", n: 1, want: lang.PluralOne},
+		{lang: "ru", n: 1, want: lang.PluralOne},
+		{lang: "ru", n: 21, want: lang.PluralOne},
+		{lang: "ru", n: 11, want: lang.PluralMany},
+		{lang: "ru", n: 3, want: lang.PluralFew},
+		{lang: "ru", n: 22, want: lang.PluralFew},
+		{lang: "ru", n: 12, want: lang.PluralMany},
+		{lang: "ru", n: 5, want: lang.PluralMany},
+		{lang: "ru_RU", n: 0, want: lang.PluralMany},
+		{lang: "ru", n: -2, want: lang.PluralFew},
+		{lang: "de", n: 1, want: lang.PluralOne},
+	}
+
+	for _, tt := range tests {
+		if got := lang.PluralCategory(tt.lang, tt.n); got != tt.want {
+			t.Errorf("PluralCategory(%q, %d) = %q, want %q", tt.lang, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		msg    string
+		params map[string]string
+		want   string
+	}{
+		{name: "braces", msg: "Code {{ confirmCode }}", params: map[string]string{"confirmCode": "123456"}, want: "Code 123456"},
+		{name: "braces without spaces", msg: "Code {{confirmCode}}", params: map[string]string{"confirmCode": "1"}, want: "Code 1"},
+		{name: "colon", msg: "The :attribute is required", params: map[string]string{"attribute": "email"}, want: "The email is required"},
+		{name: "longer name", msg: ":device_detail on :device", params: map[string]string{"device": "Mobile", "device_detail": "Android"}, want: "Android on Mobile"},
+		{name: "unknown", msg: "At 10:30 :name", params: map[string]string{"other": "x"}, want: "At 10:30 :name"},
+		{name: "values are not replaced", msg: ":a :b", params: map[string]string{"a": ":b", "b": ":a"}, want: ":b :a"},
+		{name: "no params", msg: ":a", want: ":a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lang.Format(tt.msg, tt.params); got != tt.want {
+				t.Fatalf("Format = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func load(t *testing.T) *lang.Bundle {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"en.yaml": "mail:\n  login:\n    subject: 'New login'\n    text: 'Login from :device'\nminutes:\n  one: ':count minute'\n  other: ':count minutes'\nonly_en: 'x'\n",
+		"ru.yaml": "mail:\n  login:\n    subject: 'Новый вход'\nminutes:\n  one: ':count минута'\n  few: ':count минуты'\n  many: ':count минут'\nonly_ru: 'y'\n",
+	}
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bundle, err := lang.Load(dir, "en")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bundle
+}
+
+func TestBundle(t *testing.T) {
+	bundle := load(t)
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "own key", got: bundle.T("ru", "mail.login.subject", nil), want: "Новый вход"},
+		{name: "fallback key", got: bundle.T("ru-RU", "mail.login.text", map[string]string{"device": "Mobile"}), want: "Login from Mobile"},
+		{name: "unknown locale", got: bundle.T("de", "mail.login.subject", nil), want: "New login"},
+		{name: "plural few", got: bundle.Plural("ru", "minutes", 3, nil), want: "3 минуты"},
+		{name: "plural many", got: bundle.Plural("ru", "minutes", 11, nil), want: "11 минут"},
+		{name: "plural other", got: bundle.Plural("en", "minutes", 5, nil), want: "5 minutes"},
+		{name: "missing form", got: bundle.Plural("de", "minutes", 1, nil), want: "1 minute"},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+
+	if got, want := bundle.Locales(), []string{"en", "ru"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Locales = %v, want %v", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	missing, extra := load(t).Diff("en", "ru")
+
+	// The few and many forms of ru aren't extra keys of the plural
+	if want := []string{"mail.login.text", "only_en"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("missing = %v, want %v", missing, want)
+	}
+
+	if want := []string{"only_ru"}; !reflect.DeepEqual(extra, want) {
+		t.Errorf("extra = %v, want %v", extra, want)
+	}
+}
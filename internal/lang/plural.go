@@ -0,0 +1,39 @@
+package lang
+
+// CLDR plural categories
+const (
+	PluralOne   = "one"
+	PluralFew   = "few"
+	PluralMany  = "many"
+	PluralOther = "other"
+)
+
+// PluralCategory returns the CLDR plural category of an integer for the locale.
+// Locales without own rules use the english ones.
+func PluralCategory(lang string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+
+	switch normalize(lang) {
+	case "ru":
+		mod10 := n % 10
+		mod100 := n % 100
+
+		if mod10 == 1 && mod100 != 11 {
+			return PluralOne
+		}
+
+		if mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14) {
+			return PluralFew
+		}
+
+		return PluralMany
+	default:
+		if n == 1 {
+			return PluralOne
+		}
+
+		return PluralOther
+	}
+}
@@ -7,6 +7,11 @@ type Mail struct {
 	Forgot       Forgot       `yaml:"forgot"`
 	Recovery     Recovery     `yaml:"recovery"`
 	Confirm      Confirm      `yaml:"confirm"`
+	Email        Email        `yaml:"email"`
+	EmailChanged EmailChanged `yaml:"email_changed"`
+	Password     Password     `yaml:"password"`
+	Deleted      Deleted      `yaml:"deleted"`
+	LoginConfirm LoginConfirm `yaml:"login_confirm"`
 }
 
 type Registration struct {
@@ -38,3 +43,28 @@ type Confirm struct {
 	Subject string `yaml:"subject"`
 	Body    string `yaml:"body"`
 }
+
+type Email struct {
+	Subject string `yaml:"subject"`
+	Body    string `yaml:"body"`
+}
+
+type EmailChanged struct {
+	Subject string `yaml:"subject"`
+	Body    string `yaml:"body"`
+}
+
+type Password struct {
+	Subject string `yaml:"subject"`
+	Body    string `yaml:"body"`
+}
+
+type Deleted struct {
+	Subject string `yaml:"subject"`
+	Body    string `yaml:"body"`
+}
+
+type LoginConfirm struct {
+	Subject string `yaml:"subject"`
+	Body    string `yaml:"body"`
+}
@@ -1,10 +1,6 @@
 package sections
 
-type Validation struct {
-	Email        string `yaml:"email"`
-	Alpha        string `yaml:"alpha"`
-	AlphaNum     string `yaml:"alphanum"`
-	AlphaUnicode string `yaml:"alphaunicode"`
-	Required     string `yaml:"required"`
-	Oneof        string `yaml:"oneof"`
-}
+// Validation holds messages keyed by a validator tag.
+// Keys with the "_string" and "_array" suffixes are used for the
+// length tags (len, min, max...) applied to strings and slices.
+type Validation map[string]string
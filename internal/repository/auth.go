@@ -2,146 +2,151 @@ package repository
 
 import (
 	"context"
-	"errors"
 
+	"apibgo/internal/domain"
 	domainAuth "apibgo/internal/domain/auth"
 	"apibgo/internal/storage/pgsql"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
-type AuthRI interface {
-	GetAuth(ctx context.Context, dto domainAuth.AuthDto) (domainAuth.Auth, error)
-	DeleteAuth(ctx context.Context, id int) (pgconn.CommandTag, error)
-	InsertAuth(ctx context.Context, args []interface{}) (pgconn.CommandTag, error)
-	GetSessions(ctx context.Context, dto domainAuth.SessionDto) ([]domainAuth.Auth, error)
-	GetCountSessions(ctx context.Context) (int, error)
+// Fields the sessions can be sorted by
+var sessionSorts = Sorts{
+	"created_at": {Column: goqu.C("created_at"), Kind: SortTime},
+	"ip":         {Column: goqu.COALESCE(goqu.C("ip"), goqu.L("''")), Kind: SortString},
+	"device":     {Column: goqu.COALESCE(goqu.C("device"), goqu.L("''")), Kind: SortString},
 }
 
 type AuthRepo struct {
-	db    *pgx.Conn
-	store *pgsql.Storage
+	table *Table[domainAuth.Auth]
 }
 
 func NewAuthRepo(store *pgsql.Storage) *AuthRepo {
+	return newAuthRepo(store.Db)
+}
+
+func newAuthRepo(db DBTX) *AuthRepo {
+	var auth domainAuth.Auth
+
 	return &AuthRepo{
-		db:    store.Db,
-		store: store,
+		table: NewTable[domainAuth.Auth](db, auth.TableName()),
 	}
 }
 
 func (ar *AuthRepo) GetAuth(ctx context.Context, dto domainAuth.AuthDto) (domainAuth.Auth, error) {
-	var auth domainAuth.Auth
-
-	args := []interface{}{}
-	cond := ""
+	var cond goqu.Ex
 
 	if dto.Id > 0 && dto.UserId > 0 {
-		cond = `id = $1 AND user_id = $2`
-		args = append(args, dto.Id, dto.UserId)
+		cond = goqu.Ex{"id": dto.Id, "user_id": dto.UserId}
 	} else {
-		if dto.Refresh == "" {
-			cond = `user_agent = $1 AND ip = $2 AND device = $3`
-			args = append(args, dto.UserAgent, dto.Ip, dto.Device)
-		} else {
-			cond = `refresh_token = $1`
-			args = append(args, dto.Refresh)
+		switch {
+		case dto.Refresh != "":
+			cond = goqu.Ex{"refresh_token": dto.Refresh}
+		case dto.Access != "":
+			cond = goqu.Ex{"access_token": dto.Access}
+		default:
+			cond = goqu.Ex{"user_agent": dto.UserAgent, "ip": dto.Ip, "device": dto.Device}
+
+			// Users share devices, the session of another user isn't the one of the device
+			if dto.UserId > 0 {
+				cond["user_id"] = dto.UserId
+			}
 		}
 	}
 
-	sql := `SELECT * FROM auths WHERE ` + cond + ` LIMIT 1`
-
-	err := ar.db.QueryRow(ctx, sql, args...).Scan(
-		&auth.Id, &auth.UserId, &auth.AccessToken, &auth.RefreshToken,
-		&auth.Ip, &auth.Device, &auth.UserAgent, &auth.CreatedAt,
-	)
-
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return domainAuth.Auth{}, nil
-		}
+	auth, err := ar.table.First(ctx, cond)
 
-		return domainAuth.Auth{}, err
+	if isNoRows(err) {
+		return domainAuth.Auth{}, nil
 	}
 
-	return auth, nil
+	return auth, err
 }
 
-func (ar *AuthRepo) GetSessions(ctx context.Context, dto domainAuth.SessionDto) ([]domainAuth.Auth, error) {
-	var auths []domainAuth.Auth
-
-	authModel := domainAuth.Auth{}
-
-	sql := `SELECT * FROM ` + authModel.TableName() + ` WHERE user_id = $1`
-	rows, err := ar.db.Query(ctx, sql, dto.Id)
+func (ar *AuthRepo) GetSessions(ctx context.Context, dto domainAuth.SessionDto) (domain.Page[domainAuth.Auth], error) {
+	where := []exp.Expression{goqu.C("user_id").Eq(dto.Id)}
 
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, err
-		}
-
-		return nil, err
+	if dto.Ip != "" {
+		where = append(where, goqu.C("ip").Eq(dto.Ip))
+	}
+	if dto.Device != "" {
+		where = append(where, goqu.C("device").Eq(dto.Device))
 	}
 
-	defer rows.Close()
-
-	for rows.Next() {
-		auth := domainAuth.Auth{}
-		err = rows.Scan(
-			&auth.Id, &auth.UserId, &auth.AccessToken, &auth.RefreshToken,
-			&auth.Ip, &auth.Device, &auth.UserAgent, &auth.CreatedAt,
-		)
+	return ar.table.Page(ctx, dto.PageDto, sessionSorts, where...)
+}
 
-		if err != nil {
-			return nil, err
-		}
+func (ar *AuthRepo) DeleteAuth(ctx context.Context, dto domainAuth.DestroyDto) (pgconn.CommandTag, error) {
+	cond := goqu.C("access_token").Eq(dto.Token)
 
-		auths = append(auths, auth)
+	if dto.Id > 0 {
+		cond = goqu.C("id").Eq(dto.Id)
 	}
 
-	return auths, nil
+	return ar.table.Delete(ctx, cond)
 }
 
-func (ar *AuthRepo) GetCountSessions(ctx context.Context, dto domainAuth.SessionDto) (int, error) {
-	var auth domainAuth.Auth
-	var count int
+func (ar *AuthRepo) GetUserAuths(ctx context.Context, userId int, except ...int) ([]domainAuth.Auth, error) {
+	return ar.table.Find(ctx, userAuths(userId, except)...)
+}
 
-	sql := `SELECT COUNT(id) FROM ` + auth.TableName() + ` WHERE user_id = $1`
-	err := ar.db.QueryRow(ctx, sql, dto.Id).Scan(&count)
+func (ar *AuthRepo) DeleteUserAuths(ctx context.Context, userId int, except ...int) (pgconn.CommandTag, error) {
+	return ar.table.Delete(ctx, userAuths(userId, except)...)
+}
 
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, nil
-		}
+// The conditions of the sessions of the user but the excepted ones
+func userAuths(userId int, except []int) []exp.Expression {
+	where := []exp.Expression{goqu.C("user_id").Eq(userId)}
 
-		return 0, err
+	if len(except) > 0 {
+		where = append(where, goqu.C("id").NotIn(except))
 	}
 
-	return count, nil
+	return where
 }
 
-func (ar *AuthRepo) DeleteAuth(ctx context.Context, dto domainAuth.DestroyDto) (pgconn.CommandTag, error) {
-	authModel := domainAuth.Auth{}
-
-	args := []interface{}{}
-	cond := ""
+func (ar *AuthRepo) RenameAuth(ctx context.Context, dto domainAuth.RenameDto) (pgconn.CommandTag, error) {
+	var name any
 
-	if dto.Id > 0 {
-		cond = `id = $1`
-		args = append(args, dto.Id)
-	} else {
-		cond = `access_token = $1`
-		args = append(args, dto.Token)
+	if dto.Name != "" {
+		name = dto.Name
 	}
 
-	sql := `DELETE FROM ` + authModel.TableName() + ` WHERE ` + cond
+	_, cmdtag, err := ar.table.Save(ctx, goqu.Record{"name": name},
+		goqu.C("id").Eq(dto.Id),
+		goqu.C("user_id").Eq(dto.UserId),
+	)
 
-	return ar.db.Exec(ctx, sql, args...)
+	return cmdtag, err
 }
 
-func (ar *AuthRepo) InsertAuth(ctx context.Context, args []interface{}) (pgconn.CommandTag, error) {
-	sql := `INSERT INTO auths (user_id, access_token, refresh_token, ip, device, user_agent, created_at) VALUES ($1, $2, $3, $4, $5, $6, NOW()::timestamp)`
+func (ar *AuthRepo) TouchAuth(ctx context.Context, id int, ip string) (pgconn.CommandTag, error) {
+	_, cmdtag, err := ar.table.Save(ctx, goqu.Record{"last_seen_at": goqu.L("NOW()::timestamp"), "last_ip": ip},
+		goqu.C("id").Eq(id),
+		goqu.Or(
+			goqu.C("last_seen_at").IsNull(),
+			goqu.C("last_seen_at").Lt(goqu.L("NOW() - make_interval(secs => ?)", SeenInterval.Seconds())),
+			goqu.L("last_ip IS DISTINCT FROM ?", ip),
+		),
+	)
+
+	return cmdtag, err
+}
 
-	return ar.db.Exec(ctx, sql, args...)
+func (ar *AuthRepo) InsertAuth(ctx context.Context, auth domainAuth.Auth) (pgconn.CommandTag, error) {
+	_, cmdtag, err := ar.table.Create(ctx, goqu.Record{
+		"user_id":       auth.UserId,
+		"access_token":  auth.AccessToken,
+		"refresh_token": auth.RefreshToken,
+		"ip":            auth.Ip,
+		"device":        auth.Device,
+		"user_agent":    auth.UserAgent,
+		"last_seen_at":  goqu.L("NOW()::timestamp"),
+		"last_ip":       auth.Ip,
+		"created_at":    goqu.L("NOW()::timestamp"),
+	})
+
+	return cmdtag, err
 }
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+
+	"apibgo/internal/domain"
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/storage/pgsql"
+
+	"github.com/doug-martin/goqu/v9"
+)
+
+type BanRepo struct {
+	table *Table[domainUser.Ban]
+}
+
+func NewBanRepo(store *pgsql.Storage) *BanRepo {
+	return newBanRepo(store.Db)
+}
+
+func newBanRepo(db DBTX) *BanRepo {
+	var ban domainUser.Ban
+
+	return &BanRepo{
+		table: NewTable[domainUser.Ban](db, ban.TableName()),
+	}
+}
+
+func (br *BanRepo) InsertBan(ctx context.Context, ban domainUser.Ban) (domainUser.Ban, error) {
+	ban, _, err := br.table.Create(ctx, goqu.Record{
+		"user_id":    ban.UserId,
+		"reason_id":  ban.ReasonId,
+		"is_expire":  ban.ExpiredAt.Valid,
+		"expired_at": ban.ExpiredAt,
+		"created_at": goqu.L("NOW()::timestamp"),
+	})
+
+	// The reason is a row of reasons_bans
+	if isForeignKeyViolation(err) {
+		err := domain.NewError(domain.ErrValidation, "", "validation error")
+		err.Fields = map[string][]string{"reason_id": {"the reason of the ban doesn't exist"}}
+
+		return domainUser.Ban{}, err
+	}
+
+	return ban, err
+}
+
+func (br *BanRepo) IsBanned(ctx context.Context, userId int) (bool, error) {
+	count, err := br.table.Count(ctx,
+		goqu.C("user_id").Eq(userId),
+		goqu.Or(goqu.C("expired_at").IsNull(), goqu.C("expired_at").Gt(goqu.L("NOW()::timestamp"))),
+	)
+
+	return count > 0, err
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/storage/pgsql"
+
+	"github.com/doug-martin/goqu/v9"
+)
+
+type ConsentRepo struct {
+	table *Table[domainUser.Consent]
+}
+
+func NewConsentRepo(store *pgsql.Storage) *ConsentRepo {
+	return newConsentRepo(store.Db)
+}
+
+func newConsentRepo(db DBTX) *ConsentRepo {
+	var consent domainUser.Consent
+
+	return &ConsentRepo{
+		table: NewTable[domainUser.Consent](db, consent.TableName()),
+	}
+}
+
+func (cr *ConsentRepo) GetConsents(ctx context.Context, userId int) ([]domainUser.Consent, error) {
+	return cr.table.Find(ctx, goqu.C("user_id").Eq(userId))
+}
+
+func (cr *ConsentRepo) InsertConsent(ctx context.Context, consent domainUser.Consent) (domainUser.Consent, error) {
+	consent, _, err := cr.table.Create(ctx, goqu.Record{
+		"user_id":    consent.UserId,
+		"kind":       consent.Kind,
+		"version":    consent.Version,
+		"granted":    consent.Granted,
+		"ip":         consent.Ip,
+		"created_at": goqu.L("NOW()::timestamp"),
+	})
+
+	return consent, err
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+
+	domainAuth "apibgo/internal/domain/auth"
+	"apibgo/internal/storage/pgsql"
+
+	"github.com/doug-martin/goqu/v9"
+)
+
+type DeviceRepo struct {
+	table *Table[domainAuth.KnownDevice]
+}
+
+func NewDeviceRepo(store *pgsql.Storage) *DeviceRepo {
+	return newDeviceRepo(store.Db)
+}
+
+func newDeviceRepo(db DBTX) *DeviceRepo {
+	var device domainAuth.KnownDevice
+
+	return &DeviceRepo{
+		table: NewTable[domainAuth.KnownDevice](db, device.TableName()),
+	}
+}
+
+func (dr *DeviceRepo) GetDevices(ctx context.Context, userId int) ([]domainAuth.KnownDevice, error) {
+	return dr.table.Find(ctx, goqu.C("user_id").Eq(userId))
+}
+
+func (dr *DeviceRepo) SaveDevice(ctx context.Context, device domainAuth.KnownDevice) (domainAuth.KnownDevice, error) {
+	seen := goqu.Record{
+		"name":         device.Name,
+		"ip":           device.Ip,
+		"country":      device.Country,
+		"latitude":     device.Latitude,
+		"longitude":    device.Longitude,
+		"last_seen_at": goqu.L("NOW()::timestamp"),
+	}
+	record := goqu.Record{
+		"user_id":     device.UserId,
+		"fingerprint": device.Fingerprint,
+		"created_at":  goqu.L("NOW()::timestamp"),
+	}
+
+	for column, value := range seen {
+		record[column] = value
+	}
+
+	ds := dialect.Insert(dr.table.name).
+		Rows(record).
+		OnConflict(goqu.DoUpdate("user_id, fingerprint", seen)).
+		Returning(dr.table.columns...).
+		Prepared(true)
+
+	device, _, err := dr.table.returning(ctx, ds)
+
+	return device, err
+}
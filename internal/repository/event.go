@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+
+	"apibgo/internal/domain"
+	domainAuth "apibgo/internal/domain/auth"
+	"apibgo/internal/storage/pgsql"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+)
+
+// Fields the login events can be sorted by
+var eventSorts = Sorts{
+	"created_at": {Column: goqu.C("created_at"), Kind: SortTime},
+}
+
+type LoginEventRepo struct {
+	table *Table[domainAuth.LoginEvent]
+}
+
+func NewLoginEventRepo(store *pgsql.Storage) *LoginEventRepo {
+	return newLoginEventRepo(store.Db)
+}
+
+func newLoginEventRepo(db DBTX) *LoginEventRepo {
+	var event domainAuth.LoginEvent
+
+	return &LoginEventRepo{
+		table: NewTable[domainAuth.LoginEvent](db, event.TableName()),
+	}
+}
+
+func (er *LoginEventRepo) GetLoginEvents(ctx context.Context, dto domainAuth.EventDto) (domain.Page[domainAuth.LoginEvent], error) {
+	where := []exp.Expression{goqu.C("user_id").Eq(dto.UserId)}
+
+	if dto.Kind != "" {
+		where = append(where, goqu.C("kind").Eq(dto.Kind))
+	}
+	if dto.Success != nil {
+		where = append(where, goqu.C("success").Eq(*dto.Success))
+	}
+
+	return er.table.Page(ctx, dto.PageDto, eventSorts, where...)
+}
+
+func (er *LoginEventRepo) InsertLoginEvent(ctx context.Context, event domainAuth.LoginEvent) (domainAuth.LoginEvent, error) {
+	event, _, err := er.table.Create(ctx, goqu.Record{
+		"user_id":    event.UserId,
+		"kind":       event.Kind,
+		"success":    event.Success,
+		"ip":         event.Ip,
+		"device":     event.Device,
+		"os":         event.Os,
+		"browser":    event.Browser,
+		"user_agent": event.UserAgent,
+		"created_at": goqu.L("NOW()::timestamp"),
+	})
+
+	return event, err
+}
@@ -0,0 +1,810 @@
+// Package memory keeps users, sessions, consents, login events, known devices and bans in memory. It's thread-safe
+// and made for unit tests of the services, the data is lost on exit.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"apibgo/internal/domain"
+	domainAuth "apibgo/internal/domain/auth"
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/repository"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type data struct {
+	mu        sync.RWMutex
+	users     map[uint]domainUser.User
+	auths     map[uint]domainAuth.Auth
+	consents  map[uint]domainUser.Consent
+	events    map[uint]domainAuth.LoginEvent
+	devices   map[uint]domainAuth.KnownDevice
+	bans      map[uint]domainUser.Ban
+	userId    uint
+	authId    uint
+	consentId uint
+	eventId   uint
+	deviceId  uint
+	banId     uint
+}
+
+// Comparisons of the sort fields, the same as the SQL repositories have
+var userSorts = map[string]func(a, b domainUser.User) int{
+	"email":      func(a, b domainUser.User) int { return strings.Compare(a.Email, b.Email) },
+	"name":       func(a, b domainUser.User) int { return strings.Compare(a.Name.String, b.Name.String) },
+	"surname":    func(a, b domainUser.User) int { return strings.Compare(a.Surname.String, b.Surname.String) },
+	"created_at": func(a, b domainUser.User) int { return a.CreatedAt.Compare(b.CreatedAt) },
+}
+
+var sessionSorts = map[string]func(a, b domainAuth.Auth) int{
+	"created_at": func(a, b domainAuth.Auth) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"ip":         func(a, b domainAuth.Auth) int { return strings.Compare(a.Ip, b.Ip) },
+	"device":     func(a, b domainAuth.Auth) int { return strings.Compare(a.Device, b.Device) },
+}
+
+var eventSorts = map[string]func(a, b domainAuth.LoginEvent) int{
+	"created_at": func(a, b domainAuth.LoginEvent) int { return a.CreatedAt.Compare(b.CreatedAt) },
+}
+
+var errEmailTaken = domain.NewError(domain.ErrConflict, domain.ReasonAccountExists, "user with this email address already exists")
+
+type UserRepo struct {
+	data *data
+}
+
+type AuthRepo struct {
+	data *data
+}
+
+type ConsentRepo struct {
+	data *data
+}
+
+type LoginEventRepo struct {
+	data *data
+}
+
+type DeviceRepo struct {
+	data *data
+}
+
+type BanRepo struct {
+	data *data
+}
+
+func NewStore() repository.Store {
+	d := &data{
+		users:    map[uint]domainUser.User{},
+		auths:    map[uint]domainAuth.Auth{},
+		consents: map[uint]domainUser.Consent{},
+		events:   map[uint]domainAuth.LoginEvent{},
+		devices:  map[uint]domainAuth.KnownDevice{},
+		bans:     map[uint]domainUser.Ban{},
+	}
+
+	return transactor{data: d}.repos()
+}
+
+func (r *UserRepo) GetUser(ctx context.Context, dto domainUser.UserDto) (domainUser.User, error) {
+	r.data.mu.RLock()
+	defer r.data.mu.RUnlock()
+
+	if dto.Email == "" {
+		return r.data.alive(uint(dto.Id)), nil
+	}
+
+	for _, user := range r.data.users {
+		if user.Email == dto.Email && !user.DeletedAt.Valid {
+			return user, nil
+		}
+	}
+
+	return domainUser.User{}, nil
+}
+
+func (r *UserRepo) GetUsers(ctx context.Context, dto domainUser.ListDto) (domain.Page[domainUser.User], error) {
+	r.data.mu.RLock()
+	defer r.data.mu.RUnlock()
+
+	search := strings.ToLower(dto.Search)
+	users := []domainUser.User{}
+
+	for _, user := range r.data.users {
+		switch {
+		case user.DeletedAt.Valid,
+			dto.Activation != nil && user.Activation != *dto.Activation,
+			dto.ConfirmStatus != "" && string(user.ConfirmStatus) != dto.ConfirmStatus,
+			dto.GroupId > 0 && user.GroupId != uint(dto.GroupId),
+			!dto.CreatedFrom.IsZero() && user.CreatedAt.Before(dto.CreatedFrom),
+			!dto.CreatedTo.IsZero() && user.CreatedAt.After(dto.CreatedTo),
+			search != "" && !strings.Contains(strings.ToLower(user.Email+"\n"+user.Name.String+"\n"+user.Surname.String), search):
+			continue
+		}
+
+		users = append(users, user)
+	}
+
+	return page(users, dto.PageDto, func(user domainUser.User) uint { return user.Id }, userSorts)
+}
+
+func (r *UserRepo) InsertUser(ctx context.Context, user domainUser.User) (domainUser.User, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	now := time.Now()
+
+	r.data.userId++
+	user.Id = r.data.userId
+	user.Version = 1
+	user.Name.Valid = true
+	user.Surname.Valid = true
+	user.ConfirmCode.Valid = true
+	user.ConfirmAction.Valid = true
+	user.ConfirmedAt = sql.NullTime{Time: now, Valid: true}
+	user.CreatedAt = now
+
+	r.data.users[user.Id] = user
+
+	return user, nil
+}
+
+func (r *UserRepo) UpdateUser(ctx context.Context, id int, version int, changes domainUser.Changes) (domainUser.User, pgconn.CommandTag, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	user := r.data.alive(uint(id))
+
+	if user.Id == 0 || (version > 0 && user.Version != version) {
+		return domainUser.User{}, pgconn.NewCommandTag("UPDATE 0"), nil
+	}
+
+	// The same columns as the SQL repository changes
+	set(&user.Email, changes.Email)
+	setNull(&user.PendingEmail, changes.PendingEmail)
+	setNull(&user.PreviousEmail, changes.PreviousEmail)
+	setNull(&user.EmailRevert, changes.EmailRevert)
+	setNullTime(&user.EmailRevertUntil, changes.EmailRevertUntil)
+	set(&user.Password, changes.Password)
+	setNull(&user.Name, changes.Name)
+	setNull(&user.Surname, changes.Surname)
+	setNull(&user.Locale, changes.Locale)
+	setNull(&user.Timezone, changes.Timezone)
+	set(&user.Activation, changes.Activation)
+	set(&user.GroupId, changes.GroupId)
+	set(&user.TokenSecretKey, changes.TokenSecretKey)
+	setNull(&user.ConfirmCode, changes.ConfirmCode)
+	setNull(&user.ConfirmAction, changes.ConfirmAction)
+	set(&user.ConfirmAttempts, changes.ConfirmAttempts)
+	setNullTime(&user.ConfirmedAt, changes.ConfirmedAt)
+	set(&user.ConfirmStatus, changes.ConfirmStatus)
+
+	user.Version++
+	user.UpdatedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	r.data.users[user.Id] = user
+
+	return user, pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+// Sets the field to the set value, the null is the zero value
+func set[T any](dst *T, field domain.Optional[T]) {
+	if field.Set {
+		*dst = field.Value
+	}
+}
+
+// Sets the nullable column, the null isn't valid
+func setNull(dst *sql.NullString, field domain.Optional[string]) {
+	if field.Set {
+		*dst = sql.NullString{String: field.Value, Valid: !field.Null}
+	}
+}
+
+// Sets the nullable time column, the null isn't valid
+func setNullTime(dst *sql.NullTime, field domain.Optional[time.Time]) {
+	if field.Set {
+		*dst = sql.NullTime{Time: field.Value, Valid: !field.Null}
+	}
+}
+
+func (r *UserRepo) DeleteUser(ctx context.Context, id int, version int) (pgconn.CommandTag, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	user := r.data.alive(uint(id))
+
+	if user.Id == 0 || (version > 0 && user.Version != version) {
+		return pgconn.NewCommandTag("UPDATE 0"), nil
+	}
+
+	user.Version++
+	user.DeletedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	r.data.users[user.Id] = user
+
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (r *UserRepo) RestoreUser(ctx context.Context, id int) (domainUser.User, pgconn.CommandTag, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	user, ok := r.data.users[uint(id)]
+
+	if !ok || !user.DeletedAt.Valid || user.AnonymizedAt.Valid {
+		return domainUser.User{}, pgconn.NewCommandTag("UPDATE 0"), nil
+	}
+
+	// The same as the unique index of emails of alive users
+	for _, other := range r.data.users {
+		if other.Email == user.Email && !other.DeletedAt.Valid {
+			return domainUser.User{}, pgconn.CommandTag{}, errEmailTaken
+		}
+	}
+
+	user.Version++
+	user.DeletedAt = sql.NullTime{}
+	user.UpdatedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	r.data.users[user.Id] = user
+
+	return user, pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (r *UserRepo) AnonymizeUsers(ctx context.Context, grace time.Duration) (int64, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	var anonymized int64
+	before := time.Now().Add(-grace)
+
+	for id, user := range r.data.users {
+		if !user.DeletedAt.Valid || !user.DeletedAt.Time.Before(before) || user.AnonymizedAt.Valid {
+			continue
+		}
+
+		// The same columns as the SQL repository clears
+		user.Email = fmt.Sprintf("deleted-%d@anonymized.invalid", id)
+		user.Password, user.TokenSecretKey = "", ""
+		user.PendingEmail, user.PreviousEmail, user.EmailRevert = sql.NullString{}, sql.NullString{}, sql.NullString{}
+		user.EmailRevertUntil = sql.NullTime{}
+		user.Name, user.Surname = sql.NullString{}, sql.NullString{}
+		user.ConfirmCode, user.ConfirmAction = sql.NullString{}, sql.NullString{}
+		user.LastActivityAt = sql.NullTime{}
+		user.AnonymizedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		user.Version++
+		r.data.users[id] = user
+		anonymized++
+
+		for consentId, consent := range r.data.consents {
+			if consent.UserId == id {
+				consent.Ip = sql.NullString{}
+				r.data.consents[consentId] = consent
+			}
+		}
+
+		for eventId, event := range r.data.events {
+			if event.UserId == id {
+				event.Ip, event.UserAgent = sql.NullString{}, sql.NullString{}
+				r.data.events[eventId] = event
+			}
+		}
+
+		for deviceId, device := range r.data.devices {
+			if device.UserId == id {
+				delete(r.data.devices, deviceId)
+			}
+		}
+	}
+
+	return anonymized, nil
+}
+
+func (r *UserRepo) PurgeUsers(ctx context.Context, retention time.Duration) (int64, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	var purged int64
+	before := time.Now().Add(-retention)
+
+	for id, user := range r.data.users {
+		if !user.DeletedAt.Valid || !user.DeletedAt.Time.Before(before) {
+			continue
+		}
+
+		delete(r.data.users, id)
+		r.data.deleteAuths(id)
+		purged++
+
+		for consentId, consent := range r.data.consents {
+			if consent.UserId == id {
+				delete(r.data.consents, consentId)
+			}
+		}
+
+		for eventId, event := range r.data.events {
+			if event.UserId == id {
+				delete(r.data.events, eventId)
+			}
+		}
+
+		for deviceId, device := range r.data.devices {
+			if device.UserId == id {
+				delete(r.data.devices, deviceId)
+			}
+		}
+
+		for banId, ban := range r.data.bans {
+			if ban.UserId == id {
+				delete(r.data.bans, banId)
+			}
+		}
+	}
+
+	return purged, nil
+}
+
+func (r *UserRepo) TouchUsers(ctx context.Context, seen map[int]time.Time) (int64, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	var touched int64
+
+	for id, at := range seen {
+		user := r.data.alive(uint(id))
+
+		if user.Id == 0 || (user.LastActivityAt.Valid && !user.LastActivityAt.Time.Before(at)) {
+			continue
+		}
+
+		user.LastActivityAt = sql.NullTime{Time: at, Valid: true}
+		r.data.users[user.Id] = user
+		touched++
+	}
+
+	return touched, nil
+}
+
+// The user which isn't deleted, the zero one otherwise. The caller holds the lock.
+func (d *data) alive(id uint) domainUser.User {
+	if user := d.users[id]; !user.DeletedAt.Valid {
+		return user
+	}
+
+	return domainUser.User{}
+}
+
+// Removes the sessions of the user, the caller holds the lock
+func (d *data) deleteAuths(userId uint, except ...int) int {
+	deleted := 0
+
+	for id, auth := range d.auths {
+		if auth.UserId == userId && !slices.Contains(except, int(auth.Id)) {
+			delete(d.auths, id)
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+func (r *AuthRepo) GetAuth(ctx context.Context, dto domainAuth.AuthDto) (domainAuth.Auth, error) {
+	r.data.mu.RLock()
+	defer r.data.mu.RUnlock()
+
+	for _, auth := range r.sorted() {
+		var match bool
+
+		switch {
+		case dto.Id > 0 && dto.UserId > 0:
+			match = auth.Id == uint(dto.Id) && auth.UserId == uint(dto.UserId)
+		case dto.Refresh != "":
+			match = auth.RefreshToken == dto.Refresh
+		case dto.Access != "":
+			match = auth.AccessToken == dto.Access
+		default:
+			match = auth.UserAgent == dto.UserAgent && auth.Ip == dto.Ip && auth.Device == dto.Device &&
+				(dto.UserId <= 0 || auth.UserId == uint(dto.UserId))
+		}
+
+		if match {
+			return auth, nil
+		}
+	}
+
+	return domainAuth.Auth{}, nil
+}
+
+func (r *AuthRepo) GetSessions(ctx context.Context, dto domainAuth.SessionDto) (domain.Page[domainAuth.Auth], error) {
+	r.data.mu.RLock()
+	defer r.data.mu.RUnlock()
+
+	auths := []domainAuth.Auth{}
+
+	for _, auth := range r.data.auths {
+		if auth.UserId == uint(dto.Id) && (dto.Ip == "" || auth.Ip == dto.Ip) && (dto.Device == "" || auth.Device == dto.Device) {
+			auths = append(auths, auth)
+		}
+	}
+
+	return page(auths, dto.PageDto, func(auth domainAuth.Auth) uint { return auth.Id }, sessionSorts)
+}
+
+func (r *AuthRepo) InsertAuth(ctx context.Context, auth domainAuth.Auth) (pgconn.CommandTag, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	r.data.authId++
+	auth.Id = r.data.authId
+	auth.CreatedAt = time.Now()
+	auth.LastSeenAt = sql.NullTime{Time: auth.CreatedAt, Valid: true}
+	auth.LastIp = sql.NullString{String: auth.Ip, Valid: true}
+
+	r.data.auths[auth.Id] = auth
+
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func (r *AuthRepo) RenameAuth(ctx context.Context, dto domainAuth.RenameDto) (pgconn.CommandTag, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	auth, ok := r.data.auths[uint(dto.Id)]
+
+	if !ok || auth.UserId != uint(dto.UserId) {
+		return pgconn.NewCommandTag("UPDATE 0"), nil
+	}
+
+	auth.Name = sql.NullString{String: dto.Name, Valid: dto.Name != ""}
+	r.data.auths[auth.Id] = auth
+
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (r *AuthRepo) TouchAuth(ctx context.Context, id int, ip string) (pgconn.CommandTag, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	auth, ok := r.data.auths[uint(id)]
+
+	// The same condition as the SQL repository has
+	if !ok || (auth.LastSeenAt.Valid && time.Since(auth.LastSeenAt.Time) < repository.SeenInterval && auth.LastIp.Valid && auth.LastIp.String == ip) {
+		return pgconn.NewCommandTag("UPDATE 0"), nil
+	}
+
+	auth.LastSeenAt = sql.NullTime{Time: time.Now(), Valid: true}
+	auth.LastIp = sql.NullString{String: ip, Valid: true}
+	r.data.auths[auth.Id] = auth
+
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (r *AuthRepo) DeleteAuth(ctx context.Context, dto domainAuth.DestroyDto) (pgconn.CommandTag, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	deleted := 0
+
+	for id, auth := range r.data.auths {
+		if (dto.Id > 0 && auth.Id == uint(dto.Id)) || (dto.Id <= 0 && auth.AccessToken == dto.Token) {
+			delete(r.data.auths, id)
+			deleted++
+		}
+	}
+
+	return pgconn.NewCommandTag(fmt.Sprintf("DELETE %d", deleted)), nil
+}
+
+func (r *AuthRepo) GetUserAuths(ctx context.Context, userId int, except ...int) ([]domainAuth.Auth, error) {
+	r.data.mu.RLock()
+	defer r.data.mu.RUnlock()
+
+	auths := []domainAuth.Auth{}
+
+	for _, auth := range r.sorted() {
+		if auth.UserId == uint(userId) && !slices.Contains(except, int(auth.Id)) {
+			auths = append(auths, auth)
+		}
+	}
+
+	return auths, nil
+}
+
+func (r *AuthRepo) DeleteUserAuths(ctx context.Context, userId int, except ...int) (pgconn.CommandTag, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	return pgconn.NewCommandTag(fmt.Sprintf("DELETE %d", r.data.deleteAuths(uint(userId), except...))), nil
+}
+
+func (r *ConsentRepo) GetConsents(ctx context.Context, userId int) ([]domainUser.Consent, error) {
+	r.data.mu.RLock()
+	defer r.data.mu.RUnlock()
+
+	consents := []domainUser.Consent{}
+
+	for _, consent := range r.data.consents {
+		if consent.UserId == uint(userId) {
+			consents = append(consents, consent)
+		}
+	}
+
+	sort.Slice(consents, func(i, j int) bool { return consents[i].Id < consents[j].Id })
+
+	return consents, nil
+}
+
+func (r *ConsentRepo) InsertConsent(ctx context.Context, consent domainUser.Consent) (domainUser.Consent, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	r.data.consentId++
+	consent.Id = r.data.consentId
+	consent.CreatedAt = time.Now()
+	r.data.consents[consent.Id] = consent
+
+	return consent, nil
+}
+
+func (r *LoginEventRepo) GetLoginEvents(ctx context.Context, dto domainAuth.EventDto) (domain.Page[domainAuth.LoginEvent], error) {
+	r.data.mu.RLock()
+	defer r.data.mu.RUnlock()
+
+	events := []domainAuth.LoginEvent{}
+
+	for _, event := range r.data.events {
+		if event.UserId == uint(dto.UserId) && (dto.Kind == "" || event.Kind == dto.Kind) && (dto.Success == nil || event.Success == *dto.Success) {
+			events = append(events, event)
+		}
+	}
+
+	return page(events, dto.PageDto, func(event domainAuth.LoginEvent) uint { return event.Id }, eventSorts)
+}
+
+func (r *LoginEventRepo) InsertLoginEvent(ctx context.Context, event domainAuth.LoginEvent) (domainAuth.LoginEvent, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	r.data.eventId++
+	event.Id = r.data.eventId
+	event.CreatedAt = time.Now()
+	r.data.events[event.Id] = event
+
+	return event, nil
+}
+
+func (r *DeviceRepo) GetDevices(ctx context.Context, userId int) ([]domainAuth.KnownDevice, error) {
+	r.data.mu.RLock()
+	defer r.data.mu.RUnlock()
+
+	devices := []domainAuth.KnownDevice{}
+
+	for _, device := range r.data.devices {
+		if device.UserId == uint(userId) {
+			devices = append(devices, device)
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Id < devices[j].Id })
+
+	return devices, nil
+}
+
+func (r *DeviceRepo) SaveDevice(ctx context.Context, device domainAuth.KnownDevice) (domainAuth.KnownDevice, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	now := time.Now()
+	device.Id, device.CreatedAt, device.LastSeenAt = 0, now, now
+
+	for _, known := range r.data.devices {
+		if known.UserId == device.UserId && known.Fingerprint == device.Fingerprint {
+			device.Id, device.CreatedAt = known.Id, known.CreatedAt
+		}
+	}
+
+	if device.Id == 0 {
+		r.data.deviceId++
+		device.Id = r.data.deviceId
+	}
+
+	r.data.devices[device.Id] = device
+
+	return device, nil
+}
+
+// Sessions in the order of inserting, the caller holds the lock
+// There are no reasons of bans in memory, any reason is inserted
+func (r *BanRepo) InsertBan(ctx context.Context, ban domainUser.Ban) (domainUser.Ban, error) {
+	r.data.mu.Lock()
+	defer r.data.mu.Unlock()
+
+	r.data.banId++
+	ban.Id = r.data.banId
+	ban.IsExpire = ban.ExpiredAt.Valid
+	ban.CreatedAt = time.Now()
+	r.data.bans[ban.Id] = ban
+
+	return ban, nil
+}
+
+func (r *BanRepo) IsBanned(ctx context.Context, userId int) (bool, error) {
+	r.data.mu.RLock()
+	defer r.data.mu.RUnlock()
+
+	for _, ban := range r.data.bans {
+		if ban.UserId == uint(userId) && (!ban.ExpiredAt.Valid || ban.ExpiredAt.Time.After(time.Now())) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *AuthRepo) sorted() []domainAuth.Auth {
+	auths := make([]domainAuth.Auth, 0, len(r.data.auths))
+
+	for _, auth := range r.data.auths {
+		auths = append(auths, auth)
+	}
+
+	sort.Slice(auths, func(i, j int) bool { return auths[i].Id < auths[j].Id })
+
+	return auths
+}
+
+// Transactions aren't isolated, the changes are applied at once and
+// a snapshot of the data is restored on an error or a panic. Every
+// nested call takes its own snapshot like a savepoint does.
+type transactor struct {
+	data *data
+}
+
+func (t transactor) repos() repository.Repos {
+	return repository.Repos{
+		Users:    &UserRepo{data: t.data},
+		Auths:    &AuthRepo{data: t.data},
+		Consents: &ConsentRepo{data: t.data},
+		Events:   &LoginEventRepo{data: t.data},
+		Devices:  &DeviceRepo{data: t.data},
+		Bans:     &BanRepo{data: t.data},
+		Tx:       t,
+	}
+}
+
+func (t transactor) WithTx(ctx context.Context, fn func(tx repository.Repos) error) (err error) {
+	snapshot := t.data.snapshot()
+
+	defer func() {
+		if p := recover(); p != nil {
+			t.data.restore(snapshot)
+			panic(p)
+		}
+
+		if err != nil {
+			t.data.restore(snapshot)
+		}
+	}()
+
+	return fn(t.repos())
+}
+
+type snapshot struct {
+	users     map[uint]domainUser.User
+	auths     map[uint]domainAuth.Auth
+	consents  map[uint]domainUser.Consent
+	events    map[uint]domainAuth.LoginEvent
+	devices   map[uint]domainAuth.KnownDevice
+	bans      map[uint]domainUser.Ban
+	userId    uint
+	authId    uint
+	consentId uint
+	eventId   uint
+	deviceId  uint
+	banId     uint
+}
+
+func (d *data) snapshot() snapshot {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return snapshot{
+		users:     maps.Clone(d.users),
+		auths:     maps.Clone(d.auths),
+		consents:  maps.Clone(d.consents),
+		events:    maps.Clone(d.events),
+		devices:   maps.Clone(d.devices),
+		bans:      maps.Clone(d.bans),
+		userId:    d.userId,
+		authId:    d.authId,
+		consentId: d.consentId,
+		eventId:   d.eventId,
+		deviceId:  d.deviceId,
+		banId:     d.banId,
+	}
+}
+
+func (d *data) restore(s snapshot) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.users, d.auths, d.consents, d.events, d.devices, d.bans = s.users, s.auths, s.consents, s.events, s.devices, s.bans
+	d.userId, d.authId, d.consentId, d.eventId, d.deviceId, d.banId = s.userId, s.authId, s.consentId, s.eventId, s.deviceId, s.banId
+}
+
+// SearchUsers finds the users by a part of the email, name or surname.
+// Exact fields rank 1, beginnings 0.75 and other parts 0.5, there is
+// no fuzzy matching of misspelled words like the SQL repository has.
+func (r *UserRepo) SearchUsers(ctx context.Context, dto domainUser.SearchDto) ([]domainUser.Match, error) {
+	r.data.mu.RLock()
+	defer r.data.mu.RUnlock()
+
+	text := strings.ToLower(strings.TrimSpace(dto.Query))
+	matches := []domainUser.Match{}
+
+	for _, user := range r.data.users {
+		var rank float64
+
+		if user.DeletedAt.Valid {
+			continue
+		}
+
+		for _, field := range []string{user.Email, user.Name.String, user.Surname.String} {
+			field = strings.ToLower(field)
+
+			switch {
+			case field == text:
+				rank = max(rank, 1)
+			case strings.HasPrefix(field, text):
+				rank = max(rank, 0.75)
+			case strings.Contains(field, text):
+				rank = max(rank, 0.5)
+			}
+		}
+
+		if rank > 0 {
+			matches = append(matches, domainUser.Match{User: user, Rank: rank, Highlight: highlight(user, text)})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Rank != matches[j].Rank {
+			return matches[i].Rank > matches[j].Rank
+		}
+
+		return matches[i].User.Id < matches[j].User.Id
+	})
+
+	return matches[:min(len(matches), dto.Size())], nil
+}
+
+// The escaped name, surname and email with the matches of the text in <mark> tags
+func highlight(user domainUser.User, text string) string {
+	var fields []string
+
+	for _, field := range []string{user.Name.String, user.Surname.String, user.Email} {
+		if field == "" {
+			continue
+		}
+
+		lower := strings.ToLower(field)
+
+		// Indexes of the lower case are the same only for the same length
+		if i := strings.Index(lower, text); i >= 0 && len(lower) == len(field) {
+			field = html.EscapeString(field[:i]) + "<mark>" + html.EscapeString(field[i:i+len(text)]) + "</mark>" + html.EscapeString(field[i+len(text):])
+		} else {
+			field = html.EscapeString(field)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return strings.Join(fields, " ")
+}
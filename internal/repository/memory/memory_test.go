@@ -0,0 +1,120 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/repository"
+	"apibgo/internal/repository/memory"
+)
+
+var errFail = errors.New("fail")
+
+func insert(t *testing.T, repos repository.Repos, email string) {
+	t.Helper()
+
+	if _, err := repos.Users.InsertUser(context.Background(), domainUser.User{Email: email}); err != nil {
+		t.Fatalf("insert %s: %v", email, err)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	tests := []struct {
+		name  string
+		fn    func(t *testing.T, store repository.Store) error
+		err   error
+		users int
+	}{
+		{
+			name: "commit",
+			fn: func(t *testing.T, store repository.Store) error {
+				return store.WithTx(context.Background(), func(tx repository.Repos) error {
+					insert(t, tx, "a@mail.com")
+					return nil
+				})
+			},
+			users: 1,
+		},
+		{
+			name: "rollback on error",
+			fn: func(t *testing.T, store repository.Store) error {
+				return store.WithTx(context.Background(), func(tx repository.Repos) error {
+					insert(t, tx, "a@mail.com")
+					return errFail
+				})
+			},
+			err: errFail,
+		},
+		{
+			name: "savepoint keeps the outer changes",
+			fn: func(t *testing.T, store repository.Store) error {
+				return store.WithTx(context.Background(), func(tx repository.Repos) error {
+					insert(t, tx, "a@mail.com")
+
+					err := tx.WithTx(context.Background(), func(tx repository.Repos) error {
+						insert(t, tx, "b@mail.com")
+						return errFail
+					})
+
+					if !errors.Is(err, errFail) {
+						t.Errorf("nested err = %v, want %v", err, errFail)
+					}
+
+					return nil
+				})
+			},
+			users: 1,
+		},
+		{
+			name: "outer rollback discards the savepoint",
+			fn: func(t *testing.T, store repository.Store) error {
+				return store.WithTx(context.Background(), func(tx repository.Repos) error {
+					tx.WithTx(context.Background(), func(tx repository.Repos) error {
+						insert(t, tx, "b@mail.com")
+						return nil
+					})
+
+					return errFail
+				})
+			},
+			err: errFail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memory.NewStore()
+
+			if err := tt.fn(t, store); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if users, _ := store.Users.GetUsers(context.Background(), domainUser.ListDto{}); users.Total != tt.users {
+				t.Errorf("users = %d, want %d", users.Total, tt.users)
+			}
+		})
+	}
+}
+
+func TestWithTxRollsBackOnPanic(t *testing.T) {
+	store := memory.NewStore()
+
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Fatal("the panic was not propagated")
+			}
+		}()
+
+		store.WithTx(context.Background(), func(tx repository.Repos) error {
+			insert(t, tx, "a@mail.com")
+			panic("boom")
+		})
+	}()
+
+	if users, _ := store.Users.GetUsers(context.Background(), domainUser.ListDto{}); users.Total != 0 {
+		t.Errorf("users = %d, want 0", users.Total)
+	}
+}
@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"apibgo/internal/domain"
+)
+
+// The cursor of the in-memory lists is the id of the last row of a page
+type cursor struct {
+	Sort string `json:"s"`
+	Id   uint   `json:"id"`
+}
+
+// Sorts the items and cuts the page of them like the SQL repositories do
+func page[T any](items []T, dto domain.PageDto, id func(T) uint, sorts map[string]func(a, b T) int) (domain.Page[T], error) {
+	name := strings.TrimPrefix(dto.Sort, "-")
+	desc := strings.HasPrefix(dto.Sort, "-")
+	compare, ok := sorts[name]
+
+	if name == "" || name == "id" {
+		compare, ok = func(a, b T) int { return 0 }, true
+	}
+
+	if !ok {
+		return domain.Page[T]{}, invalidPage("sort", "unknown sort field "+name)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		c := compare(items[i], items[j])
+
+		if c == 0 {
+			c = int(id(items[i])) - int(id(items[j]))
+		}
+
+		if desc {
+			return c > 0
+		}
+
+		return c < 0
+	})
+
+	start := dto.Offset
+
+	if dto.Cursor != "" {
+		var after cursor
+
+		data, err := base64.RawURLEncoding.DecodeString(dto.Cursor)
+
+		if err == nil {
+			err = json.Unmarshal(data, &after)
+		}
+
+		if err != nil || after.Sort != dto.Sort {
+			return domain.Page[T]{}, invalidPage("cursor", "malformed cursor")
+		}
+
+		start = len(items)
+
+		for i, item := range items {
+			if id(item) == after.Id {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	result := domain.Page[T]{Items: []T{}, Total: len(items)}
+
+	if start >= len(items) {
+		return result, nil
+	}
+
+	end := min(start+dto.Size(), len(items))
+	result.Items = items[start:end]
+
+	if end < len(items) {
+		data, _ := json.Marshal(cursor{Sort: dto.Sort, Id: id(items[end-1])})
+		result.Next = base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	return result, nil
+}
+
+func invalidPage(field string, message string) error {
+	err := domain.NewError(domain.ErrValidation, "", message)
+	err.Fields = map[string][]string{field: {message}}
+
+	return err
+}
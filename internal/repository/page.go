@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"apibgo/internal/domain"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Kinds of values of sort fields, they are needed to read values of cursors
+type SortKind int
+
+const (
+	SortInt SortKind = iota
+	SortString
+	SortTime
+)
+
+// Sort is a field of the whitelist of a list. The column must not be NULL,
+// e.g. nullable columns are wrapped in COALESCE.
+type Sort struct {
+	Column sortColumn
+	Kind   SortKind
+}
+
+type sortColumn interface {
+	exp.Comparable
+	exp.Orderable
+	exp.Aliaseable
+}
+
+// Sorts of the whitelist by the names of requests, the id is always allowed
+type Sorts map[string]Sort
+
+// The position of the last row of a page
+type cursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	Id    int64           `json:"id"`
+}
+
+// Page returns the page of the rows matched by the conditions. The total
+// is counted by the window of the same filtered query, so the rows and the
+// count are consistent. Pages of cursors are read by the keyset of the sort.
+func (t *Table[T]) Page(ctx context.Context, page domain.PageDto, sorts Sorts, where ...exp.Expression) (domain.Page[T], error) {
+	name, desc := parseSort(page.Sort)
+	sort, ok := sorts[name]
+
+	if name == "id" {
+		sort, ok = Sort{Column: goqu.C("id"), Kind: SortInt}, true
+	}
+
+	if !ok {
+		return domain.Page[T]{}, invalidPage("sort", "unknown sort field "+name)
+	}
+
+	limit := page.Size()
+	filtered := dialect.From(t.name).
+		Select(t.columnsWith(goqu.COUNT(goqu.Star()).Over(goqu.W()).As("page_total"))...).
+		Where(t.scoped(where)...)
+	ds := dialect.From(filtered.As("page")).
+		Select(t.columnsWith(goqu.C("page_total"), sort.Column.As("page_sort"), goqu.C("id").As("page_id"))...).
+		Limit(uint(limit) + 1)
+
+	if desc {
+		ds = ds.Order(sort.Column.Desc(), goqu.C("id").Desc())
+	} else {
+		ds = ds.Order(sort.Column.Asc(), goqu.C("id").Asc())
+	}
+
+	if page.Cursor != "" {
+		after, err := decodeCursor(page.Cursor, page.Sort, sort.Kind)
+
+		if err != nil {
+			return domain.Page[T]{}, err
+		}
+
+		ds = ds.Where(keyset(sort.Column, desc, after.Value, goqu.C("id"), after.Id))
+	} else if page.Offset > 0 {
+		ds = ds.Offset(uint(page.Offset))
+	}
+
+	sql, args, err := ds.Prepared(true).ToSQL()
+
+	if err != nil {
+		return domain.Page[T]{}, err
+	}
+
+	rows, err := t.db.Query(ctx, sql, args...)
+
+	if err != nil {
+		return domain.Page[T]{}, err
+	}
+
+	var total int
+	var keys []cursor
+
+	items, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (T, error) {
+		var value any
+		var key cursor
+
+		item, err := pgx.RowToStructByName[T](extraColumns{row, []any{&total, &value, &key.Id}})
+
+		if err != nil {
+			return item, err
+		}
+
+		key.Sort = page.Sort
+		key.Value, err = json.Marshal(value)
+		keys = append(keys, key)
+
+		return item, err
+	})
+
+	if err != nil {
+		return domain.Page[T]{}, err
+	}
+
+	result := domain.Page[T]{Items: items, Total: total}
+
+	if len(items) > limit {
+		result.Items = items[:limit]
+		result.Next = encodeCursor(keys[limit-1])
+	}
+
+	// The window isn't there without rows, beyond the last page
+	if len(items) == 0 && (page.Cursor != "" || page.Offset > 0) {
+		result.Total, err = t.Count(ctx, where...)
+	}
+
+	return result, err
+}
+
+// The columns of the table followed by the extra ones
+func (t *Table[T]) columnsWith(extra ...any) []any {
+	columns := make([]any, 0, len(t.columns)+len(extra))
+
+	return append(append(columns, t.columns...), extra...)
+}
+
+// The name of the field and whether the order is descending, "id" by default
+func parseSort(sort string) (string, bool) {
+	desc := strings.HasPrefix(sort, "-")
+	name := strings.TrimPrefix(sort, "-")
+
+	if name == "" {
+		name = "id"
+	}
+
+	return name, desc
+}
+
+// The rows after the position in the order of the sort, ties are ordered by id
+func keyset(column sortColumn, desc bool, after any, id exp.Comparable, afterId int64) exp.Expression {
+	if desc {
+		return goqu.Or(column.Lt(after), goqu.And(column.Eq(after), id.Lt(afterId)))
+	}
+
+	return goqu.Or(column.Gt(after), goqu.And(column.Eq(after), id.Gt(afterId)))
+}
+
+func encodeCursor(key cursor) string {
+	data, _ := json.Marshal(key)
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Returns the value of the cursor with its id, the cursor has to be
+// made for the same sort as the requested one
+func decodeCursor(raw string, sort string, kind SortKind) (keyedValue, error) {
+	var key cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+
+	if err == nil {
+		err = json.Unmarshal(data, &key)
+	}
+
+	if err != nil {
+		return keyedValue{}, invalidPage("cursor", "malformed cursor")
+	}
+
+	if key.Sort != sort {
+		return keyedValue{}, invalidPage("cursor", "cursor was made for another sort")
+	}
+
+	var value any
+
+	switch kind {
+	case SortInt:
+		value = new(int64)
+	case SortTime:
+		value = new(time.Time)
+	default:
+		value = new(string)
+	}
+
+	if err := json.Unmarshal(key.Value, value); err != nil {
+		return keyedValue{}, invalidPage("cursor", "malformed cursor")
+	}
+
+	// The pointer is dereferenced to pass the value as a parameter
+	return keyedValue{Value: reflect.ValueOf(value).Elem().Interface(), Id: key.Id}, nil
+}
+
+type keyedValue struct {
+	Value any
+	Id    int64
+}
+
+func invalidPage(field string, message string) error {
+	err := domain.NewError(domain.ErrValidation, "", message)
+	err.Fields = map[string][]string{field: {message}}
+
+	return err
+}
+
+// The row without the last columns, they're scanned into dest. It lets
+// to scan the columns of the page besides the ones of the struct.
+type extraColumns struct {
+	pgx.CollectableRow
+	dest []any
+}
+
+func (r extraColumns) FieldDescriptions() []pgconn.FieldDescription {
+	fields := r.CollectableRow.FieldDescriptions()
+
+	return fields[:len(fields)-len(r.dest)]
+}
+
+func (r extraColumns) Scan(dest ...any) error {
+	return r.CollectableRow.Scan(append(dest, r.dest...)...)
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"apibgo/internal/domain"
+	domainAuth "apibgo/internal/domain/auth"
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/storage/pgsql"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// UserRepository keeps users. Missing users are returned as
+// an empty User with the zero Id, not as an error. Deleted users
+// are missing for all the methods but RestoreUser and PurgeUsers.
+type UserRepository interface {
+	GetUser(ctx context.Context, dto domainUser.UserDto) (domainUser.User, error)
+	// GetUsers returns the page of the filtered users, an invalid sort or
+	// cursor is a domain.ErrValidation error
+	GetUsers(ctx context.Context, dto domainUser.ListDto) (domain.Page[domainUser.User], error)
+	// SearchUsers finds the users by parts of words and misspelled words
+	// of the email, name and surname, the best matches go first
+	SearchUsers(ctx context.Context, dto domainUser.SearchDto) ([]domainUser.Match, error)
+	InsertUser(ctx context.Context, user domainUser.User) (domainUser.User, error)
+	// UpdateUser changes only the set fields of the changes and clears the null
+	// ones. UpdateUser and DeleteUser affect nothing when the version of the
+	// user isn't the given one, 0 skips the check.
+	UpdateUser(ctx context.Context, id int, version int, changes domainUser.Changes) (domainUser.User, pgconn.CommandTag, error)
+	// DeleteUser marks the user as deleted, the row is kept until the purge
+	DeleteUser(ctx context.Context, id int, version int) (pgconn.CommandTag, error)
+	// RestoreUser returns the deleted user, nothing is affected for the alive
+	// and the anonymized ones
+	RestoreUser(ctx context.Context, id int) (domainUser.User, pgconn.CommandTag, error)
+	// AnonymizeUsers clears the personal data of the users deleted longer than
+	// the grace ago, the number of the anonymized users is returned
+	AnonymizeUsers(ctx context.Context, grace time.Duration) (int64, error)
+	// PurgeUsers removes the users deleted longer than the retention ago with
+	// their sessions, bans, consents and login events, the number of the removed
+	// users is returned
+	PurgeUsers(ctx context.Context, retention time.Duration) (int64, error)
+	// TouchUsers sets the last activity time of the users unless a later one
+	// is set, the number of the updated users is returned
+	TouchUsers(ctx context.Context, seen map[int]time.Time) (int64, error)
+}
+
+// AuthRepository keeps sessions of users
+type AuthRepository interface {
+	GetAuth(ctx context.Context, dto domainAuth.AuthDto) (domainAuth.Auth, error)
+	GetSessions(ctx context.Context, dto domainAuth.SessionDto) (domain.Page[domainAuth.Auth], error)
+	InsertAuth(ctx context.Context, auth domainAuth.Auth) (pgconn.CommandTag, error)
+	DeleteAuth(ctx context.Context, dto domainAuth.DestroyDto) (pgconn.CommandTag, error)
+	// GetUserAuths returns all the sessions of the user but the excepted ones
+	GetUserAuths(ctx context.Context, userId int, except ...int) ([]domainAuth.Auth, error)
+	// DeleteUserAuths revokes all the sessions of the user but the excepted ones
+	DeleteUserAuths(ctx context.Context, userId int, except ...int) (pgconn.CommandTag, error)
+	// RenameAuth names the session of the user, nothing is affected for others
+	RenameAuth(ctx context.Context, dto domainAuth.RenameDto) (pgconn.CommandTag, error)
+	// TouchAuth sets the last seen time and address of the session, the time
+	// is written once in SeenInterval for the same address
+	TouchAuth(ctx context.Context, id int, ip string) (pgconn.CommandTag, error)
+}
+
+// SeenInterval is how often the last seen time of a session is written
+const SeenInterval = time.Minute
+
+// ConsentRepository keeps the consents of users in the order of decisions
+type ConsentRepository interface {
+	GetConsents(ctx context.Context, userId int) ([]domainUser.Consent, error)
+	InsertConsent(ctx context.Context, consent domainUser.Consent) (domainUser.Consent, error)
+}
+
+// LoginEventRepository keeps the login history of users, the events are
+// only appended
+type LoginEventRepository interface {
+	GetLoginEvents(ctx context.Context, dto domainAuth.EventDto) (domain.Page[domainAuth.LoginEvent], error)
+	InsertLoginEvent(ctx context.Context, event domainAuth.LoginEvent) (domainAuth.LoginEvent, error)
+}
+
+// DeviceRepository keeps the devices users logged in from
+type DeviceRepository interface {
+	GetDevices(ctx context.Context, userId int) ([]domainAuth.KnownDevice, error)
+	// SaveDevice inserts the device or updates the last seen time and the
+	// location of the one with the same user and fingerprint
+	SaveDevice(ctx context.Context, device domainAuth.KnownDevice) (domainAuth.KnownDevice, error)
+}
+
+// BanRepository keeps the bans of users
+type BanRepository interface {
+	InsertBan(ctx context.Context, ban domainUser.Ban) (domainUser.Ban, error)
+	// IsBanned reports whether the user has a ban which isn't expired
+	IsBanned(ctx context.Context, userId int) (bool, error)
+}
+
+// DBTX is a connection or a transaction the repositories run on
+type DBTX interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	// Begin starts a transaction, or a savepoint inside a transaction
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Transactor runs the function in a transaction with the repositories bound
+// to it. The transaction is committed if the function returns nil and rolled
+// back on an error or a panic. Nested calls make savepoints.
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(tx Repos) error) error
+}
+
+// Repos groups the repositories which the services are built from
+type Repos struct {
+	Users    UserRepository
+	Auths    AuthRepository
+	Consents ConsentRepository
+	Events   LoginEventRepository
+	Devices  DeviceRepository
+	Bans     BanRepository
+	Tx       Transactor
+}
+
+// Store is the repositories outside of a transaction
+type Store = Repos
+
+func (r Repos) WithTx(ctx context.Context, fn func(tx Repos) error) error {
+	return r.Tx.WithTx(ctx, fn)
+}
+
+func NewStore(store *pgsql.Storage) Store {
+	return newRepos(store.Db)
+}
+
+func newRepos(db DBTX) Repos {
+	return Repos{
+		Users:    newUserRepo(db),
+		Auths:    newAuthRepo(db),
+		Consents: newConsentRepo(db),
+		Events:   newLoginEventRepo(db),
+		Devices:  newDeviceRepo(db),
+		Bans:     newBanRepo(db),
+		Tx:       pgTransactor{db: db},
+	}
+}
+
+type pgTransactor struct {
+	db DBTX
+}
+
+func (t pgTransactor) WithTx(ctx context.Context, fn func(tx Repos) error) (err error) {
+	tx, err := t.db.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+
+		if err != nil {
+			if rbErr := tx.Rollback(ctx); rbErr != nil {
+				err = errors.Join(err, rbErr)
+			}
+
+			return
+		}
+
+		err = tx.Commit(ctx)
+	}()
+
+	return fn(newRepos(tx))
+}
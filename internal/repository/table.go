@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"apibgo/internal/domain"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var dialect = goqu.Dialect("postgres")
+
+// Columns by the types of models, they are read from the db tags once
+var columnsCache sync.Map
+
+// Table is a typed repository of the table, rows are selected by the
+// explicit columns of the db tags of T and scanned by their names.
+// Rows of tables with the deleted_at column are soft deleted, the
+// queries skip them unless the table is Unscoped.
+type Table[T any] struct {
+	db      DBTX
+	name    string
+	columns []any
+	scope   []exp.Expression
+}
+
+func NewTable[T any](db DBTX, name string) *Table[T] {
+	t := &Table[T]{
+		db:      db,
+		name:    name,
+		columns: columnsOf[T](),
+	}
+
+	if slices.Contains(t.columns, any("deleted_at")) {
+		t.scope = []exp.Expression{goqu.C("deleted_at").IsNull()}
+	}
+
+	return t
+}
+
+// Unscoped returns the table which sees the soft deleted rows too
+func (t *Table[T]) Unscoped() *Table[T] {
+	unscoped := *t
+	unscoped.scope = nil
+
+	return &unscoped
+}
+
+// Find returns the rows matched by the conditions in the order of ids
+func (t *Table[T]) Find(ctx context.Context, where ...exp.Expression) ([]T, error) {
+	sql, args, err := t.selectFrom(where).Order(goqu.I("id").Asc()).Prepared(true).ToSQL()
+
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := t.db.Query(ctx, sql, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[T])
+}
+
+// First returns the matched row with the least id or pgx.ErrNoRows
+func (t *Table[T]) First(ctx context.Context, where ...exp.Expression) (T, error) {
+	return t.one(ctx, t.selectFrom(where).Order(goqu.I("id").Asc()).Limit(1))
+}
+
+// Last returns the matched row with the greatest id or pgx.ErrNoRows
+func (t *Table[T]) Last(ctx context.Context, where ...exp.Expression) (T, error) {
+	return t.one(ctx, t.selectFrom(where).Order(goqu.I("id").Desc()).Limit(1))
+}
+
+func (t *Table[T]) Count(ctx context.Context, where ...exp.Expression) (int, error) {
+	var count int
+
+	sql, args, err := dialect.From(t.name).Select(goqu.COUNT("id")).Where(t.scoped(where)...).Prepared(true).ToSQL()
+
+	if err != nil {
+		return 0, err
+	}
+
+	err = t.db.QueryRow(ctx, sql, args...).Scan(&count)
+
+	return count, err
+}
+
+// Create inserts the record and returns the inserted row
+func (t *Table[T]) Create(ctx context.Context, record goqu.Record) (T, pgconn.CommandTag, error) {
+	ds := dialect.Insert(t.name).Rows(record).Returning(t.columns...).Prepared(true)
+
+	return t.returning(ctx, ds)
+}
+
+// Save updates the matched rows by the record and returns the first of them
+func (t *Table[T]) Save(ctx context.Context, record goqu.Record, where ...exp.Expression) (T, pgconn.CommandTag, error) {
+	ds := dialect.Update(t.name).Set(record).Where(t.scoped(where)...).Returning(t.columns...).Prepared(true)
+
+	return t.returning(ctx, ds)
+}
+
+// Delete removes the matched rows, the soft deleted ones too
+func (t *Table[T]) Delete(ctx context.Context, where ...exp.Expression) (pgconn.CommandTag, error) {
+	sql, args, err := dialect.Delete(t.name).Where(where...).Prepared(true).ToSQL()
+
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+
+	return t.db.Exec(ctx, sql, args...)
+}
+
+func (t *Table[T]) selectFrom(where []exp.Expression) *goqu.SelectDataset {
+	return dialect.From(t.name).Select(t.columns...).Where(t.scoped(where)...)
+}
+
+// The conditions with the soft delete scope
+func (t *Table[T]) scoped(where []exp.Expression) []exp.Expression {
+	return append(slices.Clip(t.scope), where...)
+}
+
+func (t *Table[T]) one(ctx context.Context, ds *goqu.SelectDataset) (T, error) {
+	var zero T
+
+	sql, args, err := ds.Prepared(true).ToSQL()
+
+	if err != nil {
+		return zero, err
+	}
+
+	rows, err := t.db.Query(ctx, sql, args...)
+
+	if err != nil {
+		return zero, err
+	}
+
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[T])
+}
+
+// Runs INSERT or UPDATE with RETURNING, the zero row is returned
+// with the command tag when nothing was affected
+func (t *Table[T]) returning(ctx context.Context, ds interface {
+	ToSQL() (string, []any, error)
+}) (T, pgconn.CommandTag, error) {
+	var zero T
+
+	sql, args, err := ds.ToSQL()
+
+	if err != nil {
+		return zero, pgconn.CommandTag{}, err
+	}
+
+	rows, err := t.db.Query(ctx, sql, args...)
+
+	if err != nil {
+		return zero, pgconn.CommandTag{}, err
+	}
+
+	found, err := pgx.CollectRows(rows, pgx.RowToStructByName[T])
+
+	if err != nil {
+		return zero, pgconn.CommandTag{}, err
+	}
+
+	if len(found) == 0 {
+		return zero, rows.CommandTag(), nil
+	}
+
+	return found[0], rows.CommandTag(), nil
+}
+
+// The columns of the db tags, fields without the tag or with "-" are skipped
+func columnsOf[T any]() []any {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+
+	if columns, ok := columnsCache.Load(typ); ok {
+		return columns.([]any)
+	}
+
+	var columns []any
+
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("db"), ",")
+
+		if name != "" && name != "-" {
+			columns = append(columns, name)
+		}
+	}
+
+	columnsCache.Store(typ, columns)
+
+	return columns
+}
+
+// Adds the set field to the record, NULL for the null one
+func setColumn[T any](record goqu.Record, column string, field domain.Optional[T]) {
+	if !field.Set {
+		return
+	}
+
+	if field.Null {
+		record[column] = nil
+		return
+	}
+
+	record[column] = field.Value
+}
+
+// Missing rows are not errors of the repositories
+func isNoRows(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows)
+}
+
+// The error of a duplicate key of a unique index, SQLSTATE 23505
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// The error of a missing row of a foreign key, SQLSTATE 23503
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
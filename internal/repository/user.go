@@ -2,219 +2,384 @@ package repository
 
 import (
 	"context"
-	"errors"
+	"database/sql/driver"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
+	"apibgo/internal/domain"
 	domainUser "apibgo/internal/domain/user"
 	"apibgo/internal/storage/pgsql"
-	"apibgo/pkg/utils"
 
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
-type UserRI interface {
-	GetUser(ctx context.Context, dto domainUser.UserDto) (domainUser.User, error)
-	InsertUser(ctx context.Context, args []interface{}) (domainUser.User, error)
-	UpdateUser(ctx context.Context, id int, args []interface{}) (domainUser.User, error)
-	DeleteUser(ctx context.Context, id int) (pgconn.CommandTag, error)
+// Fields the users can be sorted by
+var userSorts = Sorts{
+	"email":      {Column: goqu.C("email"), Kind: SortString},
+	"name":       {Column: goqu.COALESCE(goqu.C("name"), goqu.L("''")), Kind: SortString},
+	"surname":    {Column: goqu.COALESCE(goqu.C("surname"), goqu.L("''")), Kind: SortString},
+	"created_at": {Column: goqu.C("created_at"), Kind: SortTime},
 }
 
+var errEmailTaken = domain.NewError(domain.ErrConflict, domain.ReasonAccountExists, "user with this email address already exists")
+
+// Escapes the wildcards of LIKE in a searched text
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 type UserRepo struct {
-	db    *pgx.Conn
-	store *pgsql.Storage
+	table *Table[domainUser.User]
 }
 
 func NewUserRepo(store *pgsql.Storage) *UserRepo {
+	return newUserRepo(store.Db)
+}
+
+func newUserRepo(db DBTX) *UserRepo {
+	var user domainUser.User
+
 	return &UserRepo{
-		db:    store.Db,
-		store: store,
+		table: NewTable[domainUser.User](db, user.TableName()),
 	}
 }
 
 func (ar *UserRepo) GetUser(ctx context.Context, dto domainUser.UserDto) (domainUser.User, error) {
-	var user domainUser.User
-
-	args := []interface{}{}
-	cond := ""
+	cond := goqu.C("id").Eq(dto.Id)
 
-	if dto.Email == "" {
-		cond = `id = $1`
-		args = append(args, dto.Id)
-	} else {
-		cond = `email = $1`
-		args = append(args, dto.Email)
+	if dto.Email != "" {
+		cond = goqu.C("email").Eq(dto.Email)
 	}
 
-	sql := `SELECT * FROM ` + user.TableName() + ` WHERE ` + cond + ` LIMIT 1`
+	user, err := ar.table.First(ctx, cond)
 
-	err := ar.db.QueryRow(ctx, sql, args...).Scan(
-		&user.Id, &user.Email, &user.Password, &user.Activation,
-		&user.Name, &user.Surname, &user.TokenSecretKey,
-		&user.UpdatedAt, &user.CreatedAt, &user.ConfirmCode,
-		&user.ConfirmedAt, &user.ConfirmStatus, &user.ConfirmAction,
-	)
+	if isNoRows(err) {
+		return domainUser.User{}, nil
+	}
 
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return domainUser.User{}, nil
-		}
+	return user, err
+}
 
-		return domainUser.User{}, err
+func (ar *UserRepo) DeleteUser(ctx context.Context, id int, version int) (pgconn.CommandTag, error) {
+	record := goqu.Record{
+		"version":    goqu.L("version + 1"),
+		"deleted_at": goqu.L("NOW()"),
 	}
 
-	return user, nil
+	_, cmdtag, err := ar.table.Save(ctx, record, versionOf(id, version)...)
+
+	return cmdtag, err
 }
 
-func (ar *UserRepo) DeleteUser(ctx context.Context, id int) (pgconn.CommandTag, error) {
-	sql := `DELETE FROM users WHERE id = $1`
+func (ar *UserRepo) RestoreUser(ctx context.Context, id int) (domainUser.User, pgconn.CommandTag, error) {
+	record := goqu.Record{
+		"version":    goqu.L("version + 1"),
+		"deleted_at": nil,
+		"updated_at": goqu.L("NOW()"),
+	}
+
+	user, cmdtag, err := ar.table.Unscoped().Save(ctx, record,
+		goqu.C("id").Eq(id),
+		goqu.C("deleted_at").IsNotNull(),
+		goqu.C("anonymized_at").IsNull(),
+	)
+
+	// The email was registered again after the deleting
+	if isUniqueViolation(err) {
+		return domainUser.User{}, pgconn.CommandTag{}, errEmailTaken
+	}
 
-	return ar.db.Exec(ctx, sql, id)
+	return user, cmdtag, err
 }
 
-func (ar *UserRepo) InsertUser(ctx context.Context, args []interface{}) (domainUser.User, error) {
-	sql := `INSERT INTO users (email, password, name, surname, confirm_code, confirm_action, confirm_status, token_secret_key, confirmed_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW()::timestamp, NOW()::timestamp) RETURNING id;`
-	id := 0
+func (ar *UserRepo) AnonymizeUsers(ctx context.Context, grace time.Duration) (int64, error) {
+	where := []exp.Expression{
+		goqu.C("deleted_at").Lt(goqu.L("NOW() - make_interval(secs => ?)", grace.Seconds())),
+		goqu.C("anonymized_at").IsNull(),
+	}
+	anonymized := dialect.From(ar.table.name).Select("id").Where(where...)
+
+	// Addresses of the consents and the login events are personal data too
+	cleared := map[string]goqu.Record{
+		"consents":     {"ip": nil},
+		"login_events": {"ip": nil, "user_agent": nil},
+	}
 
-	err := ar.db.QueryRow(ctx, sql, args...).Scan(&id)
+	for _, table := range []string{"consents", "login_events"} {
+		sql, args, err := dialect.Update(table).Set(cleared[table]).Where(goqu.C("user_id").In(anonymized)).Prepared(true).ToSQL()
+
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := ar.table.db.Exec(ctx, sql, args...); err != nil {
+			return 0, err
+		}
+	}
+
+	// Known devices are the addresses and locations of the user
+	sql, args, err := dialect.Delete("known_devices").Where(goqu.C("user_id").In(anonymized)).Prepared(true).ToSQL()
 
 	if err != nil {
-		return domainUser.User{}, err
+		return 0, err
 	}
 
-	user, err := ar.GetUser(ctx, domainUser.UserDto{Id: id})
+	if _, err := ar.table.db.Exec(ctx, sql, args...); err != nil {
+		return 0, err
+	}
+
+	// The email stays unique and can't receive mails by the reserved domain
+	sql, args, err = dialect.Update(ar.table.name).Set(goqu.Record{
+		"email":                   goqu.L("CONCAT('deleted-', id, '@anonymized.invalid')"),
+		"password":                "",
+		"pending_email":           nil,
+		"previous_email":          nil,
+		"email_revert_token":      nil,
+		"email_revert_expires_at": nil,
+		"name":                    nil,
+		"surname":                 nil,
+		"token_secret_key":        "",
+		"confirm_code":            nil,
+		"confirm_action":          nil,
+		"last_activity_at":        nil,
+		"anonymized_at":           goqu.L("NOW()"),
+		"version":                 goqu.L("version + 1"),
+	}).Where(where...).Prepared(true).ToSQL()
 
 	if err != nil {
-		return domainUser.User{}, err
+		return 0, err
 	}
 
-	return user, nil
+	cmdtag, err := ar.table.db.Exec(ctx, sql, args...)
+
+	return cmdtag.RowsAffected(), err
 }
 
-func (ar *UserRepo) UpdateUser(ctx context.Context, id int, user *domainUser.User) (domainUser.User, pgconn.CommandTag, error) {
-	// SQL-query
-	sql := "UPDATE users SET "
+func (ar *UserRepo) PurgeUsers(ctx context.Context, retention time.Duration) (int64, error) {
+	// The time is counted by the clock of the database which deleted_at is set by
+	before := goqu.L("NOW() - make_interval(secs => ?)", retention.Seconds())
+	purged := dialect.From(ar.table.name).Select("id").Where(goqu.C("deleted_at").Lt(before))
 
-	var args []interface{} = []interface{}{id}
+	// Rows of the users are referenced by the foreign keys of these tables
+	for _, table := range []string{"auths", "blocked_users", "consents", "login_events", "known_devices"} {
+		sql, args, err := dialect.Delete(table).Where(goqu.C("user_id").In(purged)).Prepared(true).ToSQL()
 
-	// Checking every field in struct, and if don't empty then add to SQL-query
-	if utils.IsFieldInitialized(user, "Email") {
-		sql += "email = $" + strconv.Itoa(len(args)+1) + ", "
-		args = append(args, user.Email)
-	}
-	if utils.IsFieldInitialized(user, "Password") {
-		sql += "password = $" + strconv.Itoa(len(args)+1) + ", "
-		args = append(args, user.Password)
-	}
-	if utils.IsFieldInitialized(user, "Name") {
-		sql += "name = $" + strconv.Itoa(len(args)+1) + ", "
-		args = append(args, user.Name.String)
-	}
-	if utils.IsFieldInitialized(user, "Surname") {
-		sql += "surname = $" + strconv.Itoa(len(args)+1) + ", "
-		args = append(args, user.Surname.String)
-	}
-	if utils.IsFieldInitialized(user, "Activation") {
-		sql += "activation = $" + strconv.Itoa(len(args)+1) + ", "
-		args = append(args, user.Activation)
-	}
-	if utils.IsFieldInitialized(user, "TokenSecretKey") {
-		sql += "token_secret_key = $" + strconv.Itoa(len(args)+1) + ", "
-		args = append(args, user.TokenSecretKey)
-	}
-	if utils.IsFieldInitialized(user, "ConfirmCode") {
-		sql += "confirm_code = $" + strconv.Itoa(len(args)+1) + ", "
-		args = append(args, user.ConfirmCode.String)
-	}
-	if utils.IsFieldInitialized(user, "ConfirmedAt") {
-		sql += "confirmed_at = $" + strconv.Itoa(len(args)+1) + ", "
-		args = append(args, user.ConfirmedAt.Time.Format("2006-01-02 15:04:05"))
-	}
-	if utils.IsFieldInitialized(user, "ConfirmStatus") {
-		sql += "confirm_status = $" + strconv.Itoa(len(args)+1) + ", "
-		args = append(args, user.ConfirmStatus)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := ar.table.db.Exec(ctx, sql, args...); err != nil {
+			return 0, err
+		}
 	}
-	if utils.IsFieldInitialized(user, "ConfirmAction") {
-		sql += "confirm_action = $" + strconv.Itoa(len(args)+1) + ", "
-		args = append(args, user.ConfirmAction.String)
+
+	cmdtag, err := ar.table.Unscoped().Delete(ctx, goqu.C("deleted_at").Lt(before))
+
+	return cmdtag.RowsAffected(), err
+}
+
+func (ar *UserRepo) TouchUsers(ctx context.Context, seen map[int]time.Time) (int64, error) {
+	if len(seen) == 0 {
+		return 0, nil
 	}
 
-	// Removing extra the comma and space in SQL-query ends
-	sql = strings.TrimSuffix(sql, ", ")
-	sql += ", updated_at = NOW()"
+	ids := make(pgArray, 0, len(seen))
+	times := make(pgArray, 0, len(seen))
 
-	// Adding condition of WHERE for to update a specific record
-	sql += " WHERE id = $1"
+	for id, at := range seen {
+		ids = append(ids, strconv.Itoa(id))
+		times = append(times, at.Format(time.DateTime+".999999"))
+	}
 
-	// Execute SQL-query
-	commandTag, err := ar.db.Exec(ctx, sql, args...)
+	// All the users are updated by one query joined with the pairs
+	sql, args, err := dialect.Update(ar.table.name).
+		Set(goqu.Record{"last_activity_at": goqu.I("seen.seen_at")}).
+		From(goqu.L("unnest(?::int[], ?::timestamp[]) AS seen(user_id, seen_at)", ids, times)).
+		Where(ar.table.scoped([]exp.Expression{
+			goqu.C("id").Eq(goqu.I("seen.user_id")),
+			goqu.Or(goqu.C("last_activity_at").IsNull(), goqu.C("last_activity_at").Lt(goqu.I("seen.seen_at"))),
+		})...).
+		Prepared(true).
+		ToSQL()
 
 	if err != nil {
-		return domainUser.User{}, pgconn.CommandTag{}, err
+		return 0, err
 	}
 
-	updUser, err := ar.GetUser(ctx, domainUser.UserDto{Id: id})
+	cmdtag, err := ar.table.db.Exec(ctx, sql, args...)
 
 	if err != nil {
-		return domainUser.User{}, pgconn.CommandTag{}, err
+		return 0, err
 	}
 
-	return updUser, commandTag, nil
+	return cmdtag.RowsAffected(), nil
 }
 
-func (ar *UserRepo) GetUsers(ctx context.Context) ([]domainUser.User, error) {
-	var users []domainUser.User
+// Array literal of Postgres, goqu would expand a slice into a list of values
+type pgArray []string
 
-	userModel := domainUser.User{}
-	args := []interface{}{}
+func (a pgArray) Value() (driver.Value, error) {
+	return `{"` + strings.Join(a, `","`) + `"}`, nil
+}
 
-	sql := `SELECT * FROM ` + userModel.TableName()
-	rows, err := ar.db.Query(ctx, sql, args...)
+func (ar *UserRepo) InsertUser(ctx context.Context, user domainUser.User) (domainUser.User, error) {
+	record := goqu.Record{
+		"email":            user.Email,
+		"password":         user.Password,
+		"name":             user.Name.String,
+		"surname":          user.Surname.String,
+		"confirm_code":     user.ConfirmCode.String,
+		"confirm_action":   user.ConfirmAction.String,
+		"confirm_status":   user.ConfirmStatus,
+		"token_secret_key": user.TokenSecretKey,
+		"confirmed_at":     goqu.L("NOW()::timestamp"),
+		"created_at":       goqu.L("NOW()::timestamp"),
+	}
 
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, err
-		}
+	if user.GroupId > 0 {
+		record["group_id"] = user.GroupId
+	}
 
-		return nil, err
+	user, _, err := ar.table.Create(ctx, record)
+
+	return user, err
+}
+
+func (ar *UserRepo) UpdateUser(ctx context.Context, id int, version int, changes domainUser.Changes) (domainUser.User, pgconn.CommandTag, error) {
+	record := goqu.Record{
+		"version":    goqu.L("version + 1"),
+		"updated_at": goqu.L("NOW()"),
 	}
 
-	defer rows.Close()
+	setColumn(record, "email", changes.Email)
+	setColumn(record, "pending_email", changes.PendingEmail)
+	setColumn(record, "previous_email", changes.PreviousEmail)
+	setColumn(record, "email_revert_token", changes.EmailRevert)
+	setColumn(record, "email_revert_expires_at", changes.EmailRevertUntil)
+	setColumn(record, "password", changes.Password)
+	setColumn(record, "name", changes.Name)
+	setColumn(record, "surname", changes.Surname)
+	setColumn(record, "locale", changes.Locale)
+	setColumn(record, "timezone", changes.Timezone)
+	setColumn(record, "activation", changes.Activation)
+	setColumn(record, "group_id", changes.GroupId)
+	setColumn(record, "token_secret_key", changes.TokenSecretKey)
+	setColumn(record, "confirm_code", changes.ConfirmCode)
+	setColumn(record, "confirm_action", changes.ConfirmAction)
+	setColumn(record, "confirm_attempts", changes.ConfirmAttempts)
+	setColumn(record, "confirmed_at", changes.ConfirmedAt)
+	setColumn(record, "confirm_status", changes.ConfirmStatus)
+
+	return ar.table.Save(ctx, record, versionOf(id, version)...)
+}
 
-	for rows.Next() {
-		user := domainUser.User{}
-		err = rows.Scan(
-			&user.Id, &user.Email, &user.Password, &user.Activation,
-			&user.Name, &user.Surname, &user.TokenSecretKey,
-			&user.UpdatedAt, &user.CreatedAt, &user.ConfirmCode,
-			&user.ConfirmedAt, &user.ConfirmStatus, &user.ConfirmAction,
-		)
+// Conditions of the user of the version, 0 is any version
+func versionOf(id int, version int) []exp.Expression {
+	where := []exp.Expression{goqu.C("id").Eq(id)}
 
-		if err != nil {
-			return nil, err
-		}
+	if version > 0 {
+		where = append(where, goqu.C("version").Eq(version))
+	}
+
+	return where
+}
+
+func (ar *UserRepo) GetUsers(ctx context.Context, dto domainUser.ListDto) (domain.Page[domainUser.User], error) {
+	var where []exp.Expression
 
-		users = append(users, user)
+	if dto.Activation != nil {
+		where = append(where, goqu.C("activation").Eq(*dto.Activation))
+	}
+	if dto.ConfirmStatus != "" {
+		where = append(where, goqu.C("confirm_status").Eq(dto.ConfirmStatus))
+	}
+	if dto.GroupId > 0 {
+		where = append(where, goqu.C("group_id").Eq(dto.GroupId))
+	}
+	if !dto.CreatedFrom.IsZero() {
+		where = append(where, goqu.C("created_at").Gte(dto.CreatedFrom))
+	}
+	if !dto.CreatedTo.IsZero() {
+		where = append(where, goqu.C("created_at").Lte(dto.CreatedTo))
+	}
+	if dto.Search != "" {
+		pattern := "%" + likeEscaper.Replace(dto.Search) + "%"
+		where = append(where, goqu.Or(
+			goqu.C("email").ILike(pattern),
+			goqu.C("name").ILike(pattern),
+			goqu.C("surname").ILike(pattern),
+		))
 	}
 
-	return users, nil
+	return ar.table.Page(ctx, dto.PageDto, userSorts, where...)
 }
 
-func (ar *UserRepo) GetCountUsers(ctx context.Context) (int, error) {
-	var user domainUser.User
-	var count int
+func (ar *UserRepo) SearchUsers(ctx context.Context, dto domainUser.SearchDto) ([]domainUser.Match, error) {
+	text := strings.TrimSpace(dto.Query)
+	pattern := "%" + likeEscaper.Replace(text) + "%"
+	// The highlight is HTML, so the fields are escaped before the matches are marked
+	fields := goqu.L(`replace(replace(replace(replace(replace(concat_ws(' ', name, surname, email),
+		'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;')`)
+	rank := goqu.L("GREATEST(similarity(email, ?), similarity(COALESCE(name, ''), ?), similarity(COALESCE(surname, ''), ?))", text, text, text)
+	highlight := exp.Expression(fields)
+
+	conds := []exp.Expression{
+		goqu.C("email").ILike(pattern),
+		goqu.C("name").ILike(pattern),
+		goqu.C("surname").ILike(pattern),
+		goqu.L("email % ?", text),
+		goqu.L("name % ?", text),
+		goqu.L("surname % ?", text),
+	}
+
+	// Whole and begun words are found by the full-text search
+	if query := prefixQuery(text); query != "" {
+		tsquery := goqu.L("to_tsquery('simple', ?)", query)
+		conds = append(conds, goqu.L("search_vector @@ ?", tsquery))
+		rank = goqu.L("? + ts_rank(search_vector, ?)", rank, tsquery)
+		highlight = goqu.L("ts_headline('simple', ?, ?, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true')", fields, tsquery)
+	}
 
-	sql := `SELECT COUNT(id) FROM ` + user.TableName()
-	err := ar.db.QueryRow(ctx, sql).Scan(&count)
+	sql, args, err := dialect.From(ar.table.name).
+		Select(ar.table.columnsWith(rank.As("search_rank"), goqu.L("?", highlight).As("search_highlight"))...).
+		Where(ar.table.scoped([]exp.Expression{goqu.Or(conds...)})...).
+		Order(goqu.C("search_rank").Desc(), goqu.C("id").Asc()).
+		Limit(uint(dto.Size())).
+		Prepared(true).
+		ToSQL()
 
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, nil
-		}
+		return nil, err
+	}
 
-		return 0, err
+	rows, err := ar.table.db.Query(ctx, sql, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (domainUser.Match, error) {
+		var match domainUser.Match
+
+		user, err := pgx.RowToStructByName[domainUser.User](extraColumns{row, []any{&match.Rank, &match.Highlight}})
+		match.User = user
+
+		return match, err
+	})
+}
+
+// Words of the text as a prefix tsquery, "ann smi" is "ann:* & smi:*"
+func prefixQuery(text string) string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i := range terms {
+		terms[i] += ":*"
 	}
 
-	return count, nil
+	return strings.Join(terms, " & ")
 }
@@ -0,0 +1,543 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"apibgo/internal/domain"
+	domainAuth "apibgo/internal/domain/auth"
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/repository"
+	"apibgo/internal/templates/mails"
+	"apibgo/internal/utils/auth/generate"
+	"apibgo/pkg/auth/device"
+	"apibgo/pkg/mail"
+)
+
+const defaultDeletionGrace = 7 * 24 * time.Hour
+
+const defaultEmailRevertURL = "http://localhost:5200/users/email/revert/"
+
+const defaultEmailRevertTTL = 7 * 24 * time.Hour
+
+// Wrong codes a sent code is checked with, then it's dropped
+const maxConfirmAttempts = 5
+
+// The revert link of the user with the token
+func (o options) revertLink(userId int, token string) string {
+	link, err := url.Parse(o.emailRevertURL)
+
+	if err != nil {
+		return o.emailRevertURL
+	}
+
+	query := link.Query()
+	query.Set("id", strconv.Itoa(userId))
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String()
+}
+
+// Account is the self-service of the user of the request (the actor)
+type Account interface {
+	Export(ctx context.Context) (domainUser.Export, error)
+	DeleteAccount(ctx context.Context, dto domainUser.DeleteAccountDto) error
+	ChangeEmail(ctx context.Context, dto domainUser.ChangeEmailDto) error
+	ConfirmEmail(ctx context.Context, dto domainUser.ConfirmEmailDto) (domainUser.User, error)
+	RevertEmail(ctx context.Context, dto domainUser.RevertEmailDto) error
+	ChangePassword(ctx context.Context, dto domainUser.ChangePasswordDto) error
+}
+
+var _ Account = (*AccountService)(nil)
+
+var (
+	errSameEmail      = domain.NewError(domain.ErrConflict, "", "it's the current email")
+	errNoPendingEmail = domain.NewError(domain.ErrNotFound, "", "no email waits for the confirm")
+	errInvalidRevert  = domain.NewError(domain.ErrNotFound, "", "the change of the email can't be reverted")
+	errManyAttempts   = domain.NewError(domain.ErrExpired, domain.ReasonTooManyAttempts, "too many wrong confirm codes, request a new one")
+)
+
+// The error of the wrong password of the field
+func wrongPassword(field string) error {
+	err := domain.NewError(domain.ErrForbidden, "", "the password is wrong")
+	err.Fields = map[string][]string{field: {"the password is wrong"}}
+
+	return err
+}
+
+type AccountService struct {
+	store  repository.Store
+	mailer mail.Sender
+	opts   options
+}
+
+func NewAccountService(store repository.Store, mailer mail.Sender, opts ...Option) *AccountService {
+	return &AccountService{
+		store:  store,
+		mailer: mailer,
+		opts:   newOptions(opts),
+	}
+}
+
+// Export returns the personal data of the actor: the profile,
+// all the sessions, the login history, the known devices and the consents
+func (as *AccountService) Export(ctx context.Context) (domainUser.Export, error) {
+	user, err := as.actorUser(ctx, as.store)
+
+	if err != nil {
+		return domainUser.Export{}, err
+	}
+
+	export := domainUser.Export{User: user}
+	full := domain.PageDto{Limit: domain.MaxLimit}
+
+	export.Sessions, err = allPages(full, func(page domain.PageDto) (domain.Page[domainAuth.Auth], error) {
+		return as.store.Auths.GetSessions(ctx, domainAuth.SessionDto{Id: int(user.Id), PageDto: page})
+	})
+
+	if err != nil {
+		return domainUser.Export{}, err
+	}
+
+	export.Logins, err = allPages(full, func(page domain.PageDto) (domain.Page[domainAuth.LoginEvent], error) {
+		return as.store.Events.GetLoginEvents(ctx, domainAuth.EventDto{UserId: int(user.Id), PageDto: page})
+	})
+
+	if err != nil {
+		return domainUser.Export{}, err
+	}
+
+	if export.Devices, err = as.store.Devices.GetDevices(ctx, int(user.Id)); err != nil {
+		return domainUser.Export{}, err
+	}
+
+	if export.Consents, err = as.store.Consents.GetConsents(ctx, int(user.Id)); err != nil {
+		return domainUser.Export{}, err
+	}
+
+	return export, nil
+}
+
+// Collects the items of all the pages from the first one, every page is
+// fetched by the cursor of the previous one
+func allPages[T any](page domain.PageDto, fetch func(page domain.PageDto) (domain.Page[T], error)) ([]T, error) {
+	items := []T{}
+
+	for {
+		result, err := fetch(page)
+
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, result.Items...)
+
+		if result.Next == "" {
+			return items, nil
+		}
+
+		page.Cursor = result.Next
+	}
+}
+
+// DeleteAccount deletes the account of the actor after the password is
+// confirmed, revokes the sessions and sends the mail about the deleting.
+// Admins can restore the account during the grace, then it's anonymized.
+func (as *AccountService) DeleteAccount(ctx context.Context, dto domainUser.DeleteAccountDto) error {
+	var user domainUser.User
+	var revoked []string
+
+	err := as.store.WithTx(ctx, func(tx repository.Repos) (err error) {
+		if user, err = as.actorUser(ctx, tx); err != nil {
+			return err
+		}
+
+		if isValid, _, _ := as.opts.hasher.Verify(dto.Password, user.Password); !isValid {
+			return wrongPassword("password")
+		}
+
+		cmdtag, err := tx.Users.DeleteUser(ctx, int(user.Id), 0)
+
+		if err != nil {
+			return err
+		}
+
+		if cmdtag.RowsAffected() <= 0 {
+			return errNotAffected
+		}
+
+		revoked, err = deleteUserAuths(ctx, tx, int(user.Id))
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := as.opts.revokeTokens(ctx, revoked); err != nil {
+		return err
+	}
+
+	subject, text := mails.Deleted(map[string]string{
+		"email": user.Email,
+		"days":  strconv.Itoa(int(as.opts.deletionGrace.Hours() / 24)),
+	})
+
+	// TODO: recommendation use RabbitMQ
+	go as.mailer.SendMail([]string{user.Email}, subject, text)
+
+	return nil
+}
+
+// ChangeEmail keeps the new email of the actor as pending and sends the
+// confirm code to it. The email is changed only by ConfirmEmail.
+func (as *AccountService) ChangeEmail(ctx context.Context, dto domainUser.ChangeEmailDto) error {
+	var user domainUser.User
+	confirmCode := generate.RandomNumbers(6)
+
+	err := as.store.WithTx(ctx, func(tx repository.Repos) (err error) {
+		if user, err = as.actorUser(ctx, tx); err != nil {
+			return err
+		}
+
+		if isValid, _, _ := as.opts.hasher.Verify(dto.Password, user.Password); !isValid {
+			return wrongPassword("password")
+		}
+
+		if strings.EqualFold(dto.Email, user.Email) {
+			return errSameEmail
+		}
+
+		if err := emailFree(ctx, tx, dto.Email); err != nil {
+			return err
+		}
+
+		user, err = as.updateActor(ctx, tx, user, domainUser.Changes{
+			PendingEmail:    domain.Some(dto.Email),
+			ConfirmCode:     domain.Some(confirmCode),
+			ConfirmedAt:     domain.Some(time.Now()),
+			ConfirmAction:   domain.Some(string(CONFIRM_EMAIL)),
+			ConfirmAttempts: domain.Some(0),
+		})
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	subject, text := mails.Email(map[string]string{
+		"confirmCode":  confirmCode,
+		"confirmed_at": user.ConfirmedAt.Time.Format("02-01-2006 15:04:05"),
+	})
+
+	// TODO: recommendation use RabbitMQ
+	go as.mailer.SendMail([]string{dto.Email}, subject, text)
+
+	return nil
+}
+
+// ConfirmEmail replaces the email of the actor by the pending one if the code
+// matches, the previous email is sent the link which reverts the change
+func (as *AccountService) ConfirmEmail(ctx context.Context, dto domainUser.ConfirmEmailDto) (domainUser.User, error) {
+	var previous, updated domainUser.User
+	var failure error
+
+	token, err := generate.RandomStringBytes(32)
+
+	if err != nil {
+		return domainUser.User{}, err
+	}
+
+	err = as.store.WithTx(ctx, func(tx repository.Repos) (err error) {
+		if previous, err = as.actorUser(ctx, tx); err != nil {
+			return err
+		}
+
+		if !previous.PendingEmail.Valid || previous.ConfirmAction.String != string(CONFIRM_EMAIL) || !previous.ConfirmedAt.Valid {
+			return errNoPendingEmail
+		}
+
+		if codeExpired(previous.ConfirmedAt.Time) {
+			return errCodeExpired
+		}
+
+		// The failed attempt is counted, so the transaction is committed
+		if !codeMatches(dto.Code, previous.ConfirmCode.String) {
+			failure, err = failedAttempt(ctx, tx.Users, previous)
+
+			return err
+		}
+
+		// The email could be registered while it was pending
+		if err := emailFree(ctx, tx, previous.PendingEmail.String); err != nil {
+			return err
+		}
+
+		updated, err = as.updateActor(ctx, tx, previous, domainUser.Changes{
+			Email:            domain.Some(previous.PendingEmail.String),
+			PendingEmail:     domain.None[string](),
+			PreviousEmail:    domain.Some(previous.Email),
+			EmailRevert:      domain.Some(hashToken(token)),
+			EmailRevertUntil: domain.Some(time.Now().Add(as.opts.emailRevertTTL)),
+			ConfirmCode:      domain.None[string](),
+			ConfirmAction:    domain.None[string](),
+			ConfirmAttempts:  domain.Some(0),
+		})
+
+		return err
+	})
+
+	if err != nil {
+		return domainUser.User{}, err
+	}
+
+	if failure != nil {
+		return domainUser.User{}, failure
+	}
+
+	subject, text := mails.EmailChanged(map[string]string{
+		"email": updated.Email,
+		"link":  as.opts.revertLink(int(updated.Id), token),
+	})
+
+	// TODO: recommendation use RabbitMQ
+	go as.mailer.SendMail([]string{previous.Email}, subject, text)
+
+	return updated, nil
+}
+
+// RevertEmail returns the previous email of the user by the token of the
+// mail about the change and revokes all the sessions, the token works once
+// and until it expires
+func (as *AccountService) RevertEmail(ctx context.Context, dto domainUser.RevertEmailDto) error {
+	var revoked []string
+
+	err := as.store.WithTx(ctx, func(tx repository.Repos) error {
+		user, err := tx.Users.GetUser(ctx, domainUser.UserDto{Id: dto.Id})
+
+		if err != nil {
+			return err
+		}
+
+		if user.Id <= 0 || !user.PreviousEmail.Valid || !user.EmailRevert.Valid ||
+			!user.EmailRevertUntil.Valid || time.Now().After(user.EmailRevertUntil.Time) ||
+			subtle.ConstantTimeCompare([]byte(hashToken(dto.Token)), []byte(user.EmailRevert.String)) != 1 {
+			return errInvalidRevert
+		}
+
+		if err := emailFree(ctx, tx, user.PreviousEmail.String); err != nil {
+			return err
+		}
+
+		if _, err := as.updateActor(ctx, tx, user, domainUser.Changes{
+			Email:            domain.Some(user.PreviousEmail.String),
+			PendingEmail:     domain.None[string](),
+			PreviousEmail:    domain.None[string](),
+			EmailRevert:      domain.None[string](),
+			EmailRevertUntil: domain.None[time.Time](),
+			ConfirmCode:      domain.None[string](),
+			ConfirmAction:    domain.None[string](),
+			ConfirmAttempts:  domain.Some(0),
+		}); err != nil {
+			return err
+		}
+
+		// The sessions of the one who changed the email
+		revoked, err = deleteUserAuths(ctx, tx, int(user.Id))
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return as.opts.revokeTokens(ctx, revoked)
+}
+
+// ChangePassword replaces the password of the actor if the current one is
+// right, revokes all the other sessions and sends the security mail
+func (as *AccountService) ChangePassword(ctx context.Context, dto domainUser.ChangePasswordDto) error {
+	actor, ok := domain.ActorFrom(ctx)
+
+	if !ok {
+		return domain.NewError(domain.ErrUnauthorized, "", "unknown actor")
+	}
+
+	hash, err := as.opts.hasher.Hash(dto.Password)
+
+	if err != nil {
+		return err
+	}
+
+	changes := domainUser.Changes{Password: domain.Some(hash)}
+
+	if dto.RotateSecret {
+		secret, err := generate.RandomStringBytes(32)
+
+		if err != nil {
+			return err
+		}
+
+		changes.TokenSecretKey = domain.Some(secret)
+	}
+
+	var user domainUser.User
+	var revoked []string
+
+	err = as.store.WithTx(ctx, func(tx repository.Repos) (err error) {
+		if user, err = as.actorUser(ctx, tx); err != nil {
+			return err
+		}
+
+		if isValid, _, _ := as.opts.hasher.Verify(dto.CurrentPassword, user.Password); !isValid {
+			return wrongPassword("current_password")
+		}
+
+		if user, err = as.updateActor(ctx, tx, user, changes); err != nil {
+			return err
+		}
+
+		// The session of the request is kept, an unknown one isn't
+		var except []int
+
+		if actor.SessionId > 0 {
+			except = append(except, actor.SessionId)
+		}
+
+		revoked, err = deleteUserAuths(ctx, tx, int(user.Id), except...)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := as.opts.revokeTokens(ctx, revoked); err != nil {
+		return err
+	}
+
+	info := device.Parse(dto.UserAgent, dto.Hints)
+
+	subject, text := mails.Password(map[string]string{
+		"email":         user.Email,
+		"device_detail": strings.Join([]string{info.OSName(), info.BrowserName(), dto.Ip}, ","),
+		"time":          time.Now().Format("02 Jan, 15:04"),
+	})
+
+	// TODO: recommendation use RabbitMQ
+	go as.mailer.SendMail([]string{user.Email}, subject, text)
+
+	return nil
+}
+
+// Updates the user of the read version
+func (as *AccountService) updateActor(ctx context.Context, tx repository.Repos, user domainUser.User, changes domainUser.Changes) (domainUser.User, error) {
+	updated, cmdtag, err := tx.Users.UpdateUser(ctx, int(user.Id), user.Version, changes)
+
+	if err != nil {
+		return domainUser.User{}, err
+	}
+
+	if cmdtag.RowsAffected() <= 0 {
+		return domainUser.User{}, errUserChanged
+	}
+
+	return updated, nil
+}
+
+// Checks nobody uses the email
+func emailFree(ctx context.Context, tx repository.Repos, email string) error {
+	user, err := tx.Users.GetUser(ctx, domainUser.UserDto{Email: email})
+
+	if err != nil {
+		return err
+	}
+
+	if user.Id > 0 {
+		return errUserExists
+	}
+
+	return nil
+}
+
+// Codes are kept as 6 digits, leading zeros included
+func codeMatches(code int, confirmCode string) bool {
+	return confirmCode != "" && fmt.Sprintf("%06d", code) == confirmCode
+}
+
+// Counts the wrong code of the user and returns the error for the client,
+// the code is dropped after the last attempt
+func failedAttempt(ctx context.Context, users repository.UserRepository, user domainUser.User) (failure error, err error) {
+	changes := domainUser.Changes{ConfirmAttempts: domain.Some(user.ConfirmAttempts + 1)}
+	failure = errInvalidCode
+
+	if user.ConfirmAttempts+1 >= maxConfirmAttempts {
+		changes = domainUser.Changes{
+			ConfirmCode:     domain.None[string](),
+			ConfirmAction:   domain.None[string](),
+			ConfirmAttempts: domain.Some(0),
+		}
+		failure = errManyAttempts
+	}
+
+	_, cmdtag, err := users.UpdateUser(ctx, int(user.Id), user.Version, changes)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cmdtag.RowsAffected() <= 0 {
+		return nil, errUserChanged
+	}
+
+	return failure, nil
+}
+
+// Whether the code sent at the time is older than the confirm time
+func codeExpired(sentAt time.Time) bool {
+	limit, _ := strconv.ParseInt(os.Getenv("APP_CONFIRM_TIME"), 10, 64)
+
+	return time.Now().Unix()-sentAt.Unix() >= limit
+}
+
+// Only the hash of a token is kept, the token is in the mail
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// The user of the actor of the request
+func (as *AccountService) actorUser(ctx context.Context, repos repository.Repos) (domainUser.User, error) {
+	actor, ok := domain.ActorFrom(ctx)
+
+	if !ok {
+		return domainUser.User{}, domain.NewError(domain.ErrUnauthorized, "", "unknown actor")
+	}
+
+	user, err := repos.Users.GetUser(ctx, domainUser.UserDto{Id: actor.UserId})
+
+	if err != nil {
+		return domainUser.User{}, err
+	}
+
+	if user.Id <= 0 {
+		return domainUser.User{}, domain.NewError(domain.ErrUnauthorized, "", "unknown actor")
+	}
+
+	return user, nil
+}
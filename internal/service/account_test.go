@@ -0,0 +1,409 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"apibgo/internal/domain"
+	domainAuth "apibgo/internal/domain/auth"
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/service"
+)
+
+func TestExport(t *testing.T) {
+	f := newFixture()
+	user := f.addUser(t, "ann@example.com", nil)
+	bob := f.addUser(t, "bob@example.com", nil)
+	login(t, f, user)
+	insertSession(t, f, bob, time.Now().Add(time.Hour))
+
+	_, err := f.store.Consents.InsertConsent(context.Background(), domainUser.Consent{
+		UserId:  user.Id,
+		Kind:    "terms",
+		Version: "1.0",
+		Granted: true,
+		Ip:      sql.NullString{String: "10.0.0.1", Valid: true},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := f.accounts()
+
+	if _, err := accounts.Export(context.Background()); !errors.Is(err, domain.ErrUnauthorized) {
+		t.Fatalf("err = %v, want %v", err, domain.ErrUnauthorized)
+	}
+
+	export, err := accounts.Export(domain.WithActor(context.Background(), domain.Actor{UserId: int(user.Id)}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if export.User.Email != "ann@example.com" {
+		t.Errorf("user = %s, want ann@example.com", export.User.Email)
+	}
+
+	// Only the own session and consent
+	if len(export.Sessions) != 1 || export.Sessions[0].UserId != user.Id {
+		t.Errorf("sessions = %+v, want the one of ann", export.Sessions)
+	}
+
+	if len(export.Logins) != 1 || export.Logins[0].Kind != domainAuth.EventLogin {
+		t.Errorf("logins = %+v, want the login of ann", export.Logins)
+	}
+
+	if len(export.Devices) != 1 || export.Devices[0].UserId != user.Id {
+		t.Errorf("devices = %+v, want the device of ann", export.Devices)
+	}
+
+	if len(export.Consents) != 1 || export.Consents[0].Kind != "terms" {
+		t.Errorf("consents = %+v, want the terms", export.Consents)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	tests := []struct {
+		name     string
+		actor    *domain.Actor
+		password string
+		err      error
+	}{
+		{name: "deleted", actor: &domain.Actor{UserId: 1}, password: testPassword},
+		{name: "wrong password", actor: &domain.Actor{UserId: 1}, password: "wrong", err: domain.ErrForbidden},
+		{name: "unknown actor", password: testPassword, err: domain.ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			user := f.addUser(t, "ann@example.com", nil)
+			login(t, f, user)
+
+			ctx := context.Background()
+
+			if tt.actor != nil {
+				ctx = domain.WithActor(ctx, *tt.actor)
+			}
+
+			err := f.accounts().DeleteAccount(ctx, domainUser.DeleteAccountDto{Password: tt.password})
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			sessions, err := f.store.Auths.GetSessions(context.Background(), domainAuth.SessionDto{Id: int(user.Id)})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.err != nil {
+				if f.user(t, user.Email).Id != user.Id || len(sessions.Items) != 1 {
+					t.Fatal("account was changed by the failed deleting")
+				}
+
+				return
+			}
+
+			if f.user(t, user.Email).Id != 0 || len(sessions.Items) != 0 {
+				t.Fatalf("user or %d sessions are left", len(sessions.Items))
+			}
+
+			f.mailer.wait(t, user.Email)
+		})
+	}
+}
+
+func TestAnonymizeUsers(t *testing.T) {
+	f := newFixture(service.WithAdminGroups(adminGroup))
+	users := f.users()
+	user := f.addUser(t, "ann@example.com", func(user *domainUser.User) {
+		user.Name = sql.NullString{String: "Ann", Valid: true}
+	})
+
+	if err := users.DeleteUser(adminContext(), int(user.Id), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The user is deleted less than the grace ago
+	if anonymized, err := users.AnonymizeUsers(context.Background(), time.Hour); err != nil || anonymized != 0 {
+		t.Fatalf("anonymized = %d, %v, want 0", anonymized, err)
+	}
+
+	if anonymized, err := users.AnonymizeUsers(context.Background(), -time.Second); err != nil || anonymized != 1 {
+		t.Fatalf("anonymized = %d, %v, want 1", anonymized, err)
+	}
+
+	// The email is free and the anonymized user can't be restored
+	f.addUser(t, "ann@example.com", nil)
+
+	admin := domain.WithActor(context.Background(), domain.Actor{UserId: 2, GroupId: adminGroup})
+
+	if _, err := users.RestoreUser(admin, int(user.Id)); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("err = %v, want %v", err, domain.ErrNotFound)
+	}
+}
+
+func TestChangeEmail(t *testing.T) {
+	tests := []struct {
+		name string
+		dto  domainUser.ChangeEmailDto
+		err  error
+	}{
+		{name: "staged", dto: domainUser.ChangeEmailDto{Email: "anna@example.com", Password: testPassword}},
+		{name: "wrong password", dto: domainUser.ChangeEmailDto{Email: "anna@example.com", Password: "wrong"}, err: domain.ErrForbidden},
+		{name: "current email", dto: domainUser.ChangeEmailDto{Email: "ANN@example.com", Password: testPassword}, err: domain.ErrConflict},
+		{name: "email of another user", dto: domainUser.ChangeEmailDto{Email: "bob@example.com", Password: testPassword}, err: domain.ErrConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			user := f.addUser(t, "ann@example.com", nil)
+			f.addUser(t, "bob@example.com", nil)
+
+			ctx := domain.WithActor(context.Background(), domain.Actor{UserId: int(user.Id)})
+			err := f.accounts().ChangeEmail(ctx, tt.dto)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			// The email is kept until the confirm
+			user = f.user(t, "ann@example.com")
+
+			if tt.err != nil {
+				if user.PendingEmail.Valid {
+					t.Errorf("pending email = %q, want none", user.PendingEmail.String)
+				}
+
+				return
+			}
+
+			if user.PendingEmail.String != tt.dto.Email || user.ConfirmAction.String != string(service.CONFIRM_EMAIL) {
+				t.Errorf("pending email = %q, action = %q", user.PendingEmail.String, user.ConfirmAction.String)
+			}
+
+			f.mailer.wait(t, tt.dto.Email)
+		})
+	}
+}
+
+func TestConfirmAndRevertEmail(t *testing.T) {
+	f := newFixture()
+	user := f.addUser(t, "ann@example.com", nil)
+	accounts := f.accounts()
+	ctx := domain.WithActor(context.Background(), domain.Actor{UserId: int(user.Id)})
+
+	if _, err := accounts.ConfirmEmail(ctx, domainUser.ConfirmEmailDto{Code: testCode}); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("confirm without a pending email: err = %v, want %v", err, domain.ErrNotFound)
+	}
+
+	if err := accounts.ChangeEmail(ctx, domainUser.ChangeEmailDto{Email: "anna@example.com", Password: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mailer.wait(t, "anna@example.com")
+	code, _ := strconv.Atoi(f.user(t, "ann@example.com").ConfirmCode.String)
+
+	if _, err := accounts.ConfirmEmail(ctx, domainUser.ConfirmEmailDto{Code: code + 1}); !errors.Is(err, domain.ErrValidation) {
+		t.Fatalf("wrong code: err = %v, want %v", err, domain.ErrValidation)
+	}
+
+	updated, err := accounts.ConfirmEmail(ctx, domainUser.ConfirmEmailDto{Code: code})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.Email != "anna@example.com" || updated.PendingEmail.Valid {
+		t.Fatalf("email = %q, pending %q, want the confirmed one", updated.Email, updated.PendingEmail.String)
+	}
+
+	// The previous email gets the revert link
+	sent := f.mailer.wait(t, "ann@example.com")
+	link := regexp.MustCompile(`href="([^"]+)"`).FindStringSubmatch(sent.message)
+
+	if link == nil {
+		t.Fatalf("no revert link in %q", sent.message)
+	}
+
+	query, err := url.Parse(link[1])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login(t, f, updated)
+	revert := domainUser.RevertEmailDto{Id: int(user.Id), Token: query.Query().Get("token")}
+
+	if err := accounts.RevertEmail(context.Background(), domainUser.RevertEmailDto{Id: revert.Id, Token: "wrong"}); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("wrong token: err = %v, want %v", err, domain.ErrNotFound)
+	}
+
+	if err := accounts.RevertEmail(context.Background(), revert); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := f.store.Auths.GetSessions(context.Background(), domainAuth.SessionDto{Id: int(user.Id)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.user(t, "ann@example.com").Id != user.Id || len(sessions.Items) != 0 {
+		t.Fatalf("email isn't reverted or %d sessions are left", len(sessions.Items))
+	}
+
+	// The token works once
+	if err := accounts.RevertEmail(context.Background(), revert); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("second revert: err = %v, want %v", err, domain.ErrNotFound)
+	}
+}
+
+func TestConfirmEmailAttempts(t *testing.T) {
+	f := newFixture()
+	user := f.addUser(t, "ann@example.com", nil)
+	accounts := f.accounts()
+	ctx := domain.WithActor(context.Background(), domain.Actor{UserId: int(user.Id)})
+
+	if err := accounts.ChangeEmail(ctx, domainUser.ChangeEmailDto{Email: "anna@example.com", Password: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mailer.wait(t, "anna@example.com")
+	code, _ := strconv.Atoi(f.user(t, "ann@example.com").ConfirmCode.String)
+
+	for i := 1; i < 5; i++ {
+		if _, err := accounts.ConfirmEmail(ctx, domainUser.ConfirmEmailDto{Code: code + 1}); !errors.Is(err, domain.ErrValidation) {
+			t.Fatalf("wrong code %d: err = %v, want %v", i, err, domain.ErrValidation)
+		}
+	}
+
+	if _, err := accounts.ConfirmEmail(ctx, domainUser.ConfirmEmailDto{Code: code + 1}); domain.ReasonOf(err) != domain.ReasonTooManyAttempts {
+		t.Fatalf("last wrong code: err = %v, want %s", err, domain.ReasonTooManyAttempts)
+	}
+
+	// The right code doesn't work after the last attempt
+	if _, err := accounts.ConfirmEmail(ctx, domainUser.ConfirmEmailDto{Code: code}); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("right code: err = %v, want %v", err, domain.ErrNotFound)
+	}
+
+	if got := f.user(t, "ann@example.com"); got.ConfirmCode.Valid || got.ConfirmAttempts != 0 {
+		t.Fatalf("code %q with %d attempts is kept", got.ConfirmCode.String, got.ConfirmAttempts)
+	}
+}
+
+func TestRevertEmailExpired(t *testing.T) {
+	f := newFixture(service.WithEmailRevertTTL(time.Hour))
+	user := f.addUser(t, "ann@example.com", nil)
+	accounts := f.accounts()
+	ctx := domain.WithActor(context.Background(), domain.Actor{UserId: int(user.Id)})
+
+	if err := accounts.ChangeEmail(ctx, domainUser.ChangeEmailDto{Email: "anna@example.com", Password: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mailer.wait(t, "anna@example.com")
+	code, _ := strconv.Atoi(f.user(t, "ann@example.com").ConfirmCode.String)
+	updated, err := accounts.ConfirmEmail(ctx, domainUser.ConfirmEmailDto{Code: code})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if until := updated.EmailRevertUntil.Time; time.Until(until) <= 0 || time.Until(until) > time.Hour {
+		t.Fatalf("revert until %v, want in an hour", until)
+	}
+
+	sent := f.mailer.wait(t, "ann@example.com")
+	link := regexp.MustCompile(`token=([^"&]+)`).FindStringSubmatch(sent.message)
+
+	if link == nil {
+		t.Fatalf("no revert link in %q", sent.message)
+	}
+
+	if _, _, err := f.store.Users.UpdateUser(context.Background(), int(user.Id), 0, domainUser.Changes{
+		EmailRevertUntil: domain.Some(time.Now().Add(-time.Minute)),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := accounts.RevertEmail(context.Background(), domainUser.RevertEmailDto{Id: int(user.Id), Token: link[1]}); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("expired token: err = %v, want %v", err, domain.ErrNotFound)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	const newPassword = "N3w-Passw0rd"
+
+	tests := []struct {
+		name string
+		dto  domainUser.ChangePasswordDto
+		err  error
+	}{
+		{name: "changed", dto: domainUser.ChangePasswordDto{CurrentPassword: testPassword, Password: newPassword}},
+		{name: "secret is rotated", dto: domainUser.ChangePasswordDto{CurrentPassword: testPassword, Password: newPassword, RotateSecret: true}},
+		{name: "wrong current password", dto: domainUser.ChangePasswordDto{CurrentPassword: "wrong", Password: newPassword}, err: domain.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			user := f.addUser(t, "ann@example.com", nil)
+			insertSession(t, f, user, time.Now().Add(time.Hour))
+			tokens := login(t, f, user)
+
+			// The actor of the request is resolved from the token with its session
+			actor, err := f.auth.Actor(context.Background(), tokens.AccessToken)
+
+			if err != nil || actor.SessionId == 0 {
+				t.Fatalf("actor = %+v, %v, want the session of the login", actor, err)
+			}
+
+			err = f.accounts().ChangePassword(domain.WithActor(context.Background(), actor), tt.dto)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			changed := f.user(t, user.Email)
+			sessions, err := f.store.Auths.GetSessions(context.Background(), domainAuth.SessionDto{Id: int(user.Id)})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.err != nil {
+				if changed.Password != user.Password || len(sessions.Items) != 2 {
+					t.Fatal("account was changed by the failed change")
+				}
+
+				return
+			}
+
+			if isValid, _, _ := testHasher.Verify(newPassword, changed.Password); !isValid {
+				t.Error("new password doesn't match")
+			}
+
+			// Only the session of the request is left
+			if len(sessions.Items) != 1 || int(sessions.Items[0].Id) != actor.SessionId {
+				t.Errorf("sessions = %+v, want only %d", sessions.Items, actor.SessionId)
+			}
+
+			if rotated := changed.TokenSecretKey != user.TokenSecretKey; rotated != tt.dto.RotateSecret {
+				t.Errorf("secret rotated = %v, want %v", rotated, tt.dto.RotateSecret)
+			}
+
+			f.mailer.wait(t, user.Email)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	domainAuth "apibgo/internal/domain/auth"
+	"apibgo/internal/repository"
+	"apibgo/pkg/auth/device"
+)
+
+// Activity keeps the times of the last requests of users until they are
+// written, so requests don't write them one by one
+type Activity struct {
+	mu   sync.Mutex
+	seen map[int]time.Time
+}
+
+func NewActivity() *Activity {
+	return &Activity{seen: map[int]time.Time{}}
+}
+
+// Touch notes a request of the user, the time is written by Flush
+func (a *Activity) Touch(userId int) {
+	if userId <= 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.seen[userId] = time.Now()
+}
+
+// Flush writes the noted activity of users as their last_activity_at,
+// the times which failed to be written are noted again. The number of the
+// updated users is returned.
+func (a *Activity) Flush(ctx context.Context, store repository.Store) (int64, error) {
+	a.mu.Lock()
+	seen := a.seen
+	a.seen = map[int]time.Time{}
+	a.mu.Unlock()
+
+	if len(seen) == 0 {
+		return 0, nil
+	}
+
+	touched, err := store.Users.TouchUsers(ctx, seen)
+
+	if err != nil {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		for userId, at := range seen {
+			if a.seen[userId].Before(at) {
+				a.seen[userId] = at
+			}
+		}
+	}
+
+	return touched, err
+}
+
+// Appends the event of the user with the device of the user agent of the dto
+func recordEvent(ctx context.Context, events repository.LoginEventRepository, userId uint, kind string, success bool, dto domainAuth.LoginDto) error {
+	info := device.Parse(dto.UserAgent, dto.Hints)
+
+	_, err := events.InsertLoginEvent(ctx, domainAuth.LoginEvent{
+		UserId:    userId,
+		Kind:      kind,
+		Success:   success,
+		Ip:        sql.NullString{String: dto.Ip, Valid: dto.Ip != ""},
+		Device:    info.TypeName(),
+		Os:        info.OSName(),
+		Browser:   info.BrowserName(),
+		UserAgent: sql.NullString{String: dto.UserAgent, Valid: dto.UserAgent != ""},
+	})
+
+	return err
+}
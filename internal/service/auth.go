@@ -4,42 +4,39 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
+	"apibgo/internal/domain"
 	domainAuth "apibgo/internal/domain/auth"
 	domainUser "apibgo/internal/domain/user"
 	"apibgo/internal/repository"
-	"apibgo/internal/storage/pgsql"
 	"apibgo/internal/templates/mails"
 	"apibgo/internal/utils/auth/generate"
-	"apibgo/internal/utils/response"
 	"apibgo/pkg/auth/ajwt"
 	"apibgo/pkg/auth/device"
-	"apibgo/pkg/auth/pswd"
 	"apibgo/pkg/mail"
-	"apibgo/pkg/utils"
-
-	"github.com/jackc/pgx/v5"
 )
 
 type Auths interface {
-	Login(ctx context.Context, dto domainAuth.LoginDto) (*response.Response, error)
-	Registration(ctx context.Context, dto domainAuth.RegistrationDto) (*response.Response, error)
-	Activation(ctx context.Context, dto domainAuth.ActivationDto) (*response.Response, error)
-	Logout(ctx context.Context, header_auth []string) (*response.Response, error)
-	Forgot(ctx context.Context, dto domainAuth.ForgotDto) (*response.Response, error)
-	Recovery(ctx context.Context, dto domainAuth.RecoveryDto) (*response.Response, error)
-	VerifyToken(ctx context.Context, header_auth []string) (bool, error)
-	Refresh(ctx context.Context, tokenCookie *http.Cookie, dto domainAuth.LoginDto)
-	Resend(ctx context.Context, section string, body []byte) (*response.Response, error)
+	Login(ctx context.Context, dto domainAuth.LoginDto) (domainAuth.Tokens, error)
+	Registration(ctx context.Context, dto domainAuth.RegistrationDto) (domainAuth.Registration, error)
+	Activation(ctx context.Context, dto domainAuth.ActivationDto) error
+	Logout(ctx context.Context, token string, dto domainAuth.LoginDto) error
+	Forgot(ctx context.Context, dto domainAuth.ForgotDto) error
+	Recovery(ctx context.Context, dto domainAuth.RecoveryDto) error
+	ConfirmCheck(ctx context.Context, dto domainAuth.ConfirmCheckDto) error
+	VerifyToken(ctx context.Context, token string) (bool, error)
+	TokenUserId(token string) (int, error)
+	Refresh(ctx context.Context, refreshToken string, dto domainAuth.LoginDto) (domainAuth.Tokens, error)
+	Resend(ctx context.Context, section SectionSend, dto domainAuth.ResendDto) error
 }
 
+var _ Auths = (*AuthService)(nil)
+
 type SectionSend string
 
 const (
@@ -52,869 +49,759 @@ type SectionConfirm string
 const (
 	CONFIRM_REGISTRATION SectionConfirm = "registration"
 	CONFIRM_FORGOT       SectionConfirm = "forgot"
+	CONFIRM_EMAIL        SectionConfirm = "email"
+	CONFIRM_LOGIN        SectionConfirm = "login"
+)
+
+// Lifetime of a refresh token and its cookie
+const refreshLifetime = time.Minute * 43830
+
+// Returned when a query which must change a row didn't do it
+var errNotAffected = errors.New("service: no rows affected")
+
+var (
+	errInvalidCredentials  = domain.NewError(domain.ErrUnauthorized, domain.ReasonInvalidCredentials, "invalid email or password for the account")
+	errAccountNotActivated = domain.NewError(domain.ErrPrecondition, domain.ReasonAccountNotActivated, "account not activated")
+	errInvalidCode         = domain.NewError(domain.ErrValidation, domain.ReasonInvalidCode, "don't match of confirm code")
+	errCodeExpired         = domain.NewError(domain.ErrExpired, domain.ReasonCodeExpired, "this confirm code time out")
+	errLoginConfirm        = domain.NewError(domain.ErrUnauthorized, domain.ReasonLoginConfirm, "login must be confirmed by the code sent to the email")
+	errActionPending       = domain.NewError(domain.ErrConflict, "", "another action waits for the code sent to the email, try again later")
+	errUserBanned          = domain.NewError(domain.ErrForbidden, domain.ReasonUserBanned, "user is banned")
 )
 
 type AuthService struct {
-	db *pgsql.Storage
+	store  repository.Store
+	mailer mail.Sender
+	opts   options
 }
 
-func NewAuthService(store *pgsql.Storage) *AuthService {
+func NewAuthService(store repository.Store, mailer mail.Sender, opts ...Option) *AuthService {
 	return &AuthService{
-		db: store,
+		store:  store,
+		mailer: mailer,
+		opts:   newOptions(opts),
 	}
-
 }
 
-func (ar *AuthService) Login(ctx context.Context, dto domainAuth.LoginDto) (*response.Response, error) {
+func (ar *AuthService) Login(ctx context.Context, dto domainAuth.LoginDto) (domainAuth.Tokens, error) {
 	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ar.db)
-	repoAuth := repository.NewAuthRepo(ar.db)
-	dto.Device = strings.ToLower(device.DetectDevice(dto.UserAgent))
+	repoUser := ar.store.Users
+	dto.Device = device.Parse(dto.UserAgent, dto.Hints).Type
 	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
 
 	if err != nil {
-		return nil, err
-	}
-
-	// If valid data
-	if user.Id > 0 && pswd.CheckPasswordHash(dto.Password, user.Password) {
-		// If don't activated the user
-		if !user.Activation {
-			return &response.Response{
-				Code:    response.ErrorAccountActivate,
-				Status:  response.StatusError,
-				Message: "account not activated",
-			}, nil
+		return domainAuth.Tokens{}, err
+	}
+
+	// Values which are not a hash are rejected as a wrong password
+	isValid, rehash, _ := ar.opts.hasher.Verify(dto.Password, user.Password)
+
+	if user.Id <= 0 {
+		return domainAuth.Tokens{}, errInvalidCredentials
+	}
+
+	banned, err := ar.store.Bans.IsBanned(ctx, int(user.Id))
+
+	if err != nil {
+		return domainAuth.Tokens{}, err
+	}
+
+	// The failed logins of the known users are in their history, the ban
+	// is told only to the one who knows the password
+	if !isValid || !user.Activation || banned {
+		if err := recordEvent(ctx, ar.store.Events, user.Id, domainAuth.EventLogin, false, dto); err != nil {
+			return domainAuth.Tokens{}, err
+		}
+
+		if !isValid {
+			return domainAuth.Tokens{}, errInvalidCredentials
+		}
+
+		if banned {
+			return domainAuth.Tokens{}, errUserBanned
+		}
+
+		return domainAuth.Tokens{}, errAccountNotActivated
+	}
+
+	check, err := ar.opts.checkDevice(ctx, ar.store.Devices, user.Id, dto)
+
+	if err != nil {
+		return domainAuth.Tokens{}, err
+	}
+
+	// Logins from new or suspicious devices wait for the mailed code,
+	// the code is mailed when the login is tried without it
+	confirmed := false
+
+	if check.needsConfirm(ar.opts.loginConfirm) {
+		if err := ar.confirmLogin(ctx, user, check, dto); err != nil {
+			return domainAuth.Tokens{}, err
+		}
+
+		confirmed = true
+	}
+
+	// Remaking the hash made with outdated parameters, the login
+	// doesn't fail if it didn't work out, it's tried next time
+	if rehash {
+		if pwd_hash, err := ar.opts.hasher.Hash(dto.Password); err == nil {
+			repoUser.UpdateUser(ctx, int(user.Id), 0, domainUser.Changes{
+				Password: domain.Some(pwd_hash),
+			})
 		}
+	}
+
+	var tokens domainAuth.Tokens
+	var revoked []string
 
+	// The session of the device is replaced by the new one
+	err = ar.store.WithTx(ctx, func(tx repository.Repos) error {
 		// Checking exist already authentication a user
-		auth, err := repoAuth.GetAuth(ctx, domainAuth.AuthDto{
+		auth, err := tx.Auths.GetAuth(ctx, domainAuth.AuthDto{
+			UserId:    int(user.Id),
 			Device:    dto.Device,
 			Ip:        dto.Ip,
 			UserAgent: dto.UserAgent,
 		})
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		// If exists, then we delete the record
 		if auth.Id > 0 {
-			cmdtag, err := repoAuth.DeleteAuth(ctx, domainAuth.DestroyDto{Id: int(auth.Id)})
+			cmdtag, err := tx.Auths.DeleteAuth(ctx, domainAuth.DestroyDto{Id: int(auth.Id)})
 
 			if err != nil {
-				return nil, err
+				return err
 			}
 
 			if cmdtag.RowsAffected() <= 0 {
-				return nil, err
+				return errNotAffected
 			}
-		}
 
-		// Creating pair tokens of jwt
-		myjwt := ajwt.JWT{
-			Secret: os.Getenv("APP_JWT_SECRET"),
-			UserId: int(user.Id),
+			revoked = append(revoked, auth.AccessToken)
 		}
-		access, refresh := myjwt.NewPairTokens()
 
-		// Inserting in sessions
-		args := []interface{}{user.Id, access, refresh, dto.Ip, dto.Device, dto.UserAgent}
-		cmdtag, err := repoAuth.InsertAuth(ctx, args)
+		tokens, err = newSession(ctx, tx.Auths, int(user.Id), dto)
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		// If successfully, then we return the Response
-		if cmdtag.RowsAffected() > 0 {
-			var _cookies []*http.Cookie
+		// The code is used once
+		if confirmed {
+			if _, _, err := tx.Users.UpdateUser(ctx, int(user.Id), 0, domainUser.Changes{
+				ConfirmCode:     domain.None[string](),
+				ConfirmAction:   domain.None[string](),
+				ConfirmAttempts: domain.Some(0),
+			}); err != nil {
+				return err
+			}
+		}
 
-			_cookies = append(_cookies, &http.Cookie{
-				Name:     "refresh_token",
-				Value:    refresh,
-				Path:     "/",
-				HttpOnly: true,
-				Expires:  time.Now().AddDate(0, 1, 0),
-			})
+		if _, err := tx.Devices.SaveDevice(ctx, check.device); err != nil {
+			return err
+		}
 
-			// Prepare message for send to mailbox
-			// Get template message
-			subject, text := mails.Login(map[string]string{
-				"email":         user.Email,
-				"device":        device.DetectDevice(dto.UserAgent),
-				"device_detail": strings.Join([]string{device.DetectOS(dto.UserAgent), device.DetectBrowser(dto.UserAgent), dto.Ip}, ","),
-				"time":          time.Now().Format("02 Jan, 15:04"),
-			})
+		return recordEvent(ctx, tx.Events, user.Id, domainAuth.EventLogin, true, dto)
+	})
 
-			// TODO: recommendation use RabbitMQ
-			go func() {
-				smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
-				m := mail.Mailer{
-					SmtpHost:     os.Getenv("SMTP_HOST"),
-					SmtpPort:     smtpPort,
-					SmtpUser:     os.Getenv("SMTP_USER"),
-					SmtpPassword: os.Getenv("SMTP_PASSWORD"),
-				}
-				// Sends message to emails address
-				m.SendMail([]string{user.Email}, subject, text)
-			}()
-
-			return &response.Response{
-				Code:    response.ErrorEmpty,
-				Status:  response.StatusSuccess,
-				Message: "Data is got",
-				Result: map[string]interface{}{
-					"access_token":  access,
-					"refresh_token": refresh,
-				},
-				Cookies: _cookies,
-			}, nil
-		}
+	if err != nil {
+		return domainAuth.Tokens{}, err
 	}
 
-	return &response.Response{
-		Code:    response.ErrorAccountNotFound,
-		Status:  response.StatusError,
-		Message: "invalid email or password for the account",
-	}, nil
-}
-
-func (ar *AuthService) Registration(ctx context.Context, dto domainAuth.RegistrationDto) (*response.Response, error) {
-	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ar.db)
-	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
+	if err := ar.opts.revokeTokens(ctx, revoked); err != nil {
+		return domainAuth.Tokens{}, err
+	}
 
-	if err != nil {
-		return nil, err
+	// Known devices and the confirmed ones, which got the mail with
+	// the code, aren't told of
+	if check.known || confirmed {
+		return tokens, nil
 	}
 
-	// If valid data
-	if user.Id <= 0 {
-		// If don't match passwords
-		if dto.Password != dto.ConfirmPassword {
-			return &response.Response{
-				Code:    response.ErrorAccountConfirmPassword,
-				Status:  response.StatusError,
-				Message: "don't match passwords",
-			}, nil
+	// Prepare message for send to mailbox
+	// Get template message
+	subject, text := mails.Login(map[string]string{
+		"email":         user.Email,
+		"device":        device.Parse(dto.UserAgent, dto.Hints).TypeName(),
+		"device_detail": check.detail(dto),
+		"time":          time.Now().Format("02 Jan, 15:04"),
+	})
+
+	// TODO: recommendation use RabbitMQ
+	go ar.mailer.SendMail([]string{user.Email}, subject, text)
+
+	return tokens, nil
+}
+
+// Checks the code of the login or mails a new one when there is no code,
+// failed tries are in the login history and counted. The code of another
+// action isn't replaced while it's valid.
+func (ar *AuthService) confirmLogin(ctx context.Context, user domainUser.User, check deviceCheck, dto domainAuth.LoginDto) error {
+	if dto.Code == 0 {
+		if actionPending(user) {
+			return errActionPending
 		}
 
-		// Generate codes and strings
-		pwd_hash, err := pswd.HashPassword(dto.Password)
-		confirmCode := generate.RandomNumbers(6)
-		tokenSecret, err2 := generate.RandomStringBytes(32)
+		err := ar.sendCode(ctx, user, CONFIRM_LOGIN, func(replace map[string]string) (string, string) {
+			replace["device"] = device.Parse(dto.UserAgent, dto.Hints).TypeName()
+			replace["device_detail"] = check.detail(dto)
+
+			return mails.LoginConfirm(replace)
+		})
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		if err2 != nil {
-			return nil, err2
+		return errLoginConfirm
+	}
+
+	var failure error
+	var err error
+
+	switch {
+	case user.ConfirmAction.String != string(CONFIRM_LOGIN) || !user.ConfirmedAt.Valid || codeExpired(user.ConfirmedAt.Time):
+		failure = errCodeExpired
+	case !codeMatches(dto.Code, user.ConfirmCode.String):
+		if failure, err = failedAttempt(ctx, ar.store.Users, user); err != nil {
+			return err
 		}
+	default:
+		return nil
+	}
+
+	if err := recordEvent(ctx, ar.store.Events, user.Id, domainAuth.EventLogin, false, dto); err != nil {
+		return err
+	}
+
+	return failure
+}
 
-		// start transaction
-		tx, err := ar.db.Db.BeginTx(ctx, pgx.TxOptions{})
+// Whether the code of the change of the email or of the recovery still
+// waits for the user, the codes of done actions may be left
+func actionPending(user domainUser.User) bool {
+	if !user.ConfirmCode.Valid || user.ConfirmCode.String == "" || !user.ConfirmedAt.Valid || codeExpired(user.ConfirmedAt.Time) {
+		return false
+	}
+
+	switch SectionConfirm(user.ConfirmAction.String) {
+	case CONFIRM_EMAIL:
+		return user.PendingEmail.Valid
+	case CONFIRM_FORGOT:
+		return true
+	}
+
+	return false
+}
+
+func (ar *AuthService) Registration(ctx context.Context, dto domainAuth.RegistrationDto) (domainAuth.Registration, error) {
+	// Generate codes and strings
+	pwd_hash, err := ar.opts.hasher.Hash(dto.Password)
+	confirmCode := generate.RandomNumbers(6)
+	tokenSecret, err2 := generate.RandomStringBytes(32)
+
+	if err != nil {
+		return domainAuth.Registration{}, err
+	}
+
+	if err2 != nil {
+		return domainAuth.Registration{}, err2
+	}
+
+	var user domainUser.User
+
+	err = ar.store.WithTx(ctx, func(tx repository.Repos) error {
+		// Trying find a user in the users table
+		exists, err := tx.Users.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		defer func() {
-			if err != nil {
-				tx.Rollback(ctx)
-			}
-		}()
+		if exists.Id > 0 {
+			return domain.NewError(domain.ErrConflict, domain.ReasonAccountExists, "user with this email address already exists")
+		}
 
 		// Inserting in users
-		args := []interface{}{dto.Email, pwd_hash, dto.Name, dto.Surname, confirmCode, CONFIRM_REGISTRATION, domainUser.ConfirmStatus_WAIT, tokenSecret}
-		user, err := repoUser.InsertUser(ctx, args)
+		user, err = tx.Users.InsertUser(ctx, domainUser.User{
+			Email:          dto.Email,
+			Password:       pwd_hash,
+			Name:           sql.NullString{String: dto.Name},
+			Surname:        sql.NullString{String: dto.Surname},
+			ConfirmCode:    sql.NullString{String: confirmCode},
+			ConfirmAction:  sql.NullString{String: string(CONFIRM_REGISTRATION)},
+			ConfirmStatus:  domainUser.ConfirmStatus_WAIT,
+			TokenSecretKey: tokenSecret,
+		})
 
 		if err != nil {
-			tx.Rollback(ctx)
+			return err
+		}
 
-			return nil, err
+		if user.Id <= 0 {
+			return errors.New("service: the user was not created")
 		}
 
-		// If successfully, then we return the Response
-		if user.Id > 0 {
-			// Prepare message for send to mailbox
-			// Get template message
-			subject, text := mails.Registration(map[string]string{
-				"confirmCode":  confirmCode,
-				"confirmed_at": user.ConfirmedAt.Time.Format("02-01-2006 15:04:05"),
-			})
+		return nil
+	})
 
-			// TODO: recommendation use RabbitMQ
-			go func() {
-				smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
-				m := mail.Mailer{
-					SmtpHost:     os.Getenv("SMTP_HOST"),
-					SmtpPort:     smtpPort,
-					SmtpUser:     os.Getenv("SMTP_USER"),
-					SmtpPassword: os.Getenv("SMTP_PASSWORD"),
-				}
-				// Sends message to emails address
-				m.SendMail([]string{user.Email}, subject, text)
-			}()
-
-			// generate key for activation
-			key := ar.generateToken(user.TokenSecretKey, user.Email)
-
-			tx.Commit(ctx)
-
-			return &response.Response{
-				Code:    response.ErrorEmpty,
-				Status:  response.StatusSuccess,
-				Message: "Data is got",
-				Result: map[string]interface{}{
-					"email": user.Email,
-					"key":   key,
-				},
-				HttpCode: http.StatusCreated,
-			}, nil
-		} else {
-			tx.Rollback(ctx)
-
-			return &response.Response{
-				Code:    response.ErrorAccountNotCreated,
-				Status:  response.StatusError,
-				Message: "failed, the user was not created",
-			}, nil
-		}
+	if err != nil {
+		return domainAuth.Registration{}, err
 	}
 
-	return &response.Response{
-		Code:    response.ErrorAccountExists,
-		Status:  response.StatusError,
-		Message: "user with this email address already exists",
+	// Prepare message for send to mailbox
+	// Get template message
+	subject, text := mails.Registration(map[string]string{
+		"confirmCode":  confirmCode,
+		"confirmed_at": user.ConfirmedAt.Time.Format("02-01-2006 15:04:05"),
+	})
+
+	// TODO: recommendation use RabbitMQ
+	go ar.mailer.SendMail([]string{user.Email}, subject, text)
+
+	return domainAuth.Registration{
+		Email: user.Email,
+		// generate key for activation
+		Key: ar.generateToken(user.TokenSecretKey, user.Email),
 	}, nil
 }
 
-func (ar *AuthService) Logout(ctx context.Context, header_auth []string) (*response.Response, error) {
-	// Parse header Authorization and get token
-	split := strings.Split(header_auth[0], " ")
-	token := split[1]
-
+func (ar *AuthService) Logout(ctx context.Context, token string, dto domainAuth.LoginDto) error {
 	// Checking on correct JWT
-	_, err := ajwt.IsJWT(token, os.Getenv("APP_JWT_SECRET"))
+	if isVerify, err := ar.VerifyToken(ctx, token); err != nil || !isVerify {
+		return domain.NewError(domain.ErrUnauthorized, "", "invalid token")
+	}
 
-	if err != nil {
-		return nil, err
+	// The token is rejected at once, not when it expires
+	if err := ar.opts.revokeToken(ctx, token); err != nil {
+		return err
 	}
 
 	// Deleting session
-	repoAuth := repository.NewAuthRepo(ar.db)
+	repoAuth := ar.store.Auths
 	cmdtag, err := repoAuth.DeleteAuth(ctx, domainAuth.DestroyDto{Token: token})
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// If whole successfully, then resets refresh token
 	if cmdtag.RowsAffected() <= 0 {
-		return nil, err
-	} else {
-		var _cookies []*http.Cookie
-
-		_cookies = append(_cookies, &http.Cookie{
-			Name:     "refresh_token",
-			Value:    "empty",
-			Path:     "/",
-			MaxAge:   -1,
-			HttpOnly: true,
-		})
+		return domain.NewError(domain.ErrNotFound, "", "session not found")
+	}
 
-		return &response.Response{
-			Code:    response.ErrorEmpty,
-			Status:  response.StatusSuccess,
-			Message: "Session successfully destroyed",
-			Result:  nil,
-			Cookies: _cookies,
-		}, nil
+	userId, err := ar.TokenUserId(token)
+
+	if err != nil {
+		return err
 	}
+
+	return recordEvent(ctx, ar.store.Events, uint(userId), domainAuth.EventLogout, true, dto)
 }
 
-func (ar *AuthService) Refresh(ctx context.Context, tokenCookie *http.Cookie, dto domainAuth.LoginDto) (*response.Response, error) {
+func (ar *AuthService) Refresh(ctx context.Context, refreshToken string, dto domainAuth.LoginDto) (domainAuth.Tokens, error) {
 	// Prepare data
-	dto.Device = strings.ToLower(device.DetectDevice(dto.UserAgent))
+	dto.Device = device.Parse(dto.UserAgent, dto.Hints).Type
 
 	// Checking on verify Refresh token
-	isVerify, err := ar.VerifyToken(ctx, tokenCookie.Value)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if !isVerify {
-		return &response.Response{
-			Code:    response.ErrorTokenExpired,
-			Status:  response.StatusError,
-			Message: "token is expired",
-		}, nil
+	if isVerify, err := ar.verifyToken(ctx, refreshToken, ajwt.TypeRefresh); err != nil || !isVerify {
+		return domainAuth.Tokens{}, domain.NewError(domain.ErrUnauthorized, domain.ReasonTokenExpired, "token is expired")
 	}
 
 	// Get session
-	repoAuth := repository.NewAuthRepo(ar.db)
+	repoAuth := ar.store.Auths
 	auth, err := repoAuth.GetAuth(ctx, domainAuth.AuthDto{
-		Refresh: tokenCookie.Value,
+		Refresh: refreshToken,
 	})
 
 	if err != nil {
-		return nil, err
+		return domainAuth.Tokens{}, err
 	}
 
-	// Checking on verify Access token
-	isVerify, _ = ar.VerifyToken(ctx, auth.AccessToken)
-
-	if !isVerify {
-		tx, err := ar.db.Db.BeginTx(ctx, pgx.TxOptions{})
+	if auth.Id <= 0 {
+		return domainAuth.Tokens{}, domain.NewError(domain.ErrUnauthorized, "", "session not found")
+	}
 
-		if err != nil {
-			return nil, err
+	// While the access token is valid, the same pair is returned
+	if isVerify, _ := ar.VerifyToken(ctx, auth.AccessToken); isVerify {
+		if err := recordEvent(ctx, ar.store.Events, auth.UserId, domainAuth.EventRefresh, true, dto); err != nil {
+			return domainAuth.Tokens{}, err
 		}
 
-		defer func() {
-			if err != nil {
-				tx.Rollback(ctx)
-			}
-		}()
+		return domainAuth.Tokens{
+			AccessToken:  auth.AccessToken,
+			RefreshToken: auth.RefreshToken,
+		}, nil
+	}
 
+	var tokens domainAuth.Tokens
+
+	err = ar.store.WithTx(ctx, func(tx repository.Repos) error {
 		// Deleting session
-		cmdtag, err := repoAuth.DeleteAuth(ctx, domainAuth.DestroyDto{Id: int(auth.Id)})
+		cmdtag, err := tx.Auths.DeleteAuth(ctx, domainAuth.DestroyDto{Id: int(auth.Id)})
+
+		if err != nil {
+			return err
+		}
 
-		// If whole successfully, then resets refresh token
 		if cmdtag.RowsAffected() <= 0 {
-			tx.Rollback(ctx)
-
-			return nil, err
-		} else {
-			// Creating pair tokens of jwt
-			myjwt := ajwt.JWT{
-				Secret: os.Getenv("APP_JWT_SECRET"),
-				UserId: int(auth.UserId),
-			}
-			access, refresh := myjwt.NewPairTokens()
+			return errNotAffected
+		}
 
-			// Inserting in sessions
-			args := []interface{}{auth.UserId, access, refresh, dto.Ip, dto.Device, dto.UserAgent}
-			cmdtag, err := repoAuth.InsertAuth(ctx, args)
+		tokens, err = newSession(ctx, tx.Auths, int(auth.UserId), dto)
 
-			if err != nil {
-				tx.Rollback(ctx)
+		if err != nil {
+			return err
+		}
 
-				return nil, err
-			}
+		return recordEvent(ctx, tx.Events, auth.UserId, domainAuth.EventRefresh, true, dto)
+	})
 
-			// If successfully, then we return the Response
-			if cmdtag.RowsAffected() > 0 {
-				var _cookies []*http.Cookie
-
-				_cookies = append(_cookies, &http.Cookie{
-					Name:     "refresh_token",
-					Value:    refresh,
-					Path:     "/",
-					HttpOnly: true,
-					Expires:  time.Now().AddDate(0, 1, 0),
-				})
-
-				tx.Commit(ctx)
-
-				return &response.Response{
-					Code:    response.ErrorEmpty,
-					Status:  response.StatusSuccess,
-					Message: "Data is got",
-					Result: map[string]interface{}{
-						"access_token":  access,
-						"refresh_token": refresh,
-					},
-					Cookies: _cookies,
-				}, nil
-			} else {
-				tx.Rollback(ctx)
-
-				return nil, nil
-			}
-		}
-	} else {
-		return &response.Response{
-			Code:    response.ErrorEmpty,
-			Status:  response.StatusSuccess,
-			Message: "Data is got",
-			Result: map[string]interface{}{
-				"access_token":  auth.AccessToken,
-				"refresh_token": auth.RefreshToken,
-			},
-		}, nil
+	if err != nil {
+		return domainAuth.Tokens{}, err
 	}
+
+	return tokens, nil
 }
 
 func (ar *AuthService) VerifyToken(ctx context.Context, token string) (bool, error) {
-	// Checking on correct JWT
-	isVerify, err := ajwt.IsJWT(token, os.Getenv("APP_JWT_SECRET"))
+	return ar.VerifyAccessToken(ctx, token)
+}
+
+// TokenUserId returns the id of the user the valid token was issued to
+func (ar *AuthService) TokenUserId(token string) (int, error) {
+	payload, err := ajwt.GetClaims(token, os.Getenv("APP_JWT_SECRET"))
 
 	if err != nil {
-		return false, err
+		return 0, domain.NewError(domain.ErrUnauthorized, "", "invalid token")
 	}
 
-	if !isVerify {
-		return false, nil
+	user_id, _ := strconv.Atoi(fmt.Sprintf("%v", payload["user_id"]))
+
+	if user_id <= 0 {
+		return 0, domain.NewError(domain.ErrUnauthorized, "", "invalid token")
 	}
 
-	return true, nil
+	return user_id, nil
 }
 
-func (ar *AuthService) Activation(ctx context.Context, dto domainAuth.ActivationDto) (*response.Response, error) {
-	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ar.db)
-	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
+// Actor returns the user of the token with the group for permission checks
+// and the session of the token
+func (ar *AuthService) Actor(ctx context.Context, token string) (domain.Actor, error) {
+	userId, err := ar.TokenUserId(token)
 
 	if err != nil {
-		return nil, err
-	}
-
-	// If valid data
-	if user.Id > 0 && user.ConfirmAction.String == string(CONFIRM_REGISTRATION) && ar.checkToken(user.TokenSecretKey, dto.Email, dto.Key) {
-		// If a user activated
-		if user.Activation {
-			return &response.Response{
-				Code:    response.ErrorAccountAlreadyActivate,
-				Status:  response.StatusError,
-				Message: "account already activated",
-			}, nil
-		}
+		return domain.Actor{}, err
+	}
 
-		// if confirmed_at valid
-		if user.ConfirmedAt.Valid {
-			confirmExpired := time.Now().Unix() - user.ConfirmedAt.Time.Unix()
-			limitExprTime, _ := strconv.ParseInt(os.Getenv("APP_CONFIRM_TIME"), 10, 64)
-
-			// if it hasn't been 5 minutes
-			if confirmExpired < limitExprTime {
-				// if don't match of confirm codes
-				if strconv.Itoa(dto.Code) != user.ConfirmCode.String {
-					return &response.Response{
-						Code:    response.ErrorAccountInvalidCode,
-						Status:  response.StatusError,
-						Message: "don't match of confirm code",
-					}, nil
-				}
-
-				// Begin transaction
-				tx, err := ar.db.Db.BeginTx(ctx, pgx.TxOptions{})
-
-				if err != nil {
-					return nil, err
-				}
-
-				defer func() {
-					if err != nil {
-						tx.Rollback(ctx)
-					}
-				}()
-
-				// Activating account
-				_, cmdtag, err := repoUser.UpdateUser(ctx, int(user.Id), &domainUser.User{
-					Activation: true,
-				})
-
-				if err != nil {
-					tx.Rollback(ctx)
-
-					return nil, err
-				}
-
-				if cmdtag.RowsAffected() <= 0 {
-					tx.Rollback(ctx)
-
-					return nil, err
-				} else {
-					tx.Commit(ctx)
-
-					// Prepare message for send to mailbox
-					// Get template message
-					subject, text := mails.Activation(map[string]string{})
-
-					// TODO: recommendation use RabbitMQ
-					go func() {
-						smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
-						m := mail.Mailer{
-							SmtpHost:     os.Getenv("SMTP_HOST"),
-							SmtpPort:     smtpPort,
-							SmtpUser:     os.Getenv("SMTP_USER"),
-							SmtpPassword: os.Getenv("SMTP_PASSWORD"),
-						}
-						// Sends message to emails address
-						m.SendMail([]string{user.Email}, subject, text)
-					}()
-
-					return &response.Response{
-						Code:    response.ErrorEmpty,
-						Status:  response.StatusSuccess,
-						Message: "your account successfully activated",
-					}, nil
-				}
-			} else {
-				return &response.Response{
-					Code:    response.ErrorAccountActivateTimeout,
-					Status:  response.StatusError,
-					Message: "this confirm code time out",
-				}, nil
-			}
-		}
+	user, err := ar.store.Users.GetUser(ctx, domainUser.UserDto{Id: userId})
+
+	if err != nil {
+		return domain.Actor{}, err
+	}
+
+	if user.Id <= 0 {
+		return domain.Actor{}, domain.NewError(domain.ErrUnauthorized, "", "invalid token")
+	}
+
+	// Tokens of revoked sessions are still valid JWTs, their session is unknown
+	auth, err := ar.store.Auths.GetAuth(ctx, domainAuth.AuthDto{Access: token})
+
+	if err != nil {
+		return domain.Actor{}, err
 	}
 
-	return nil, nil
+	return domain.Actor{UserId: int(user.Id), GroupId: int(user.GroupId), SessionId: int(auth.Id)}, nil
 }
 
-func (ar *AuthService) Forgot(ctx context.Context, dto domainAuth.ForgotDto) (*response.Response, error) {
+// TouchSession marks the session of the actor as seen now from the address
+func (ar *AuthService) TouchSession(ctx context.Context, actor domain.Actor, ip string) error {
+	if actor.SessionId <= 0 {
+		return nil
+	}
+
+	_, err := ar.store.Auths.TouchAuth(ctx, actor.SessionId, ip)
+
+	return err
+}
+
+// TouchActivity notes the request of the actor, the time is written to the
+// user by the flush of the activity
+func (ar *AuthService) TouchActivity(actor domain.Actor) {
+	ar.opts.activity.Touch(actor.UserId)
+}
+
+func (ar *AuthService) Activation(ctx context.Context, dto domainAuth.ActivationDto) error {
 	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ar.db)
+	repoUser := ar.store.Users
 	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
 
 	if err != nil {
-		return nil, err
-	}
-
-	// If valid data
-	if user.Id > 0 {
-		// If don't activated the user
-		if !user.Activation {
-			return &response.Response{
-				Code:    response.ErrorAccountActivate,
-				Status:  response.StatusError,
-				Message: "account not activated",
-			}, nil
-		}
+		return err
+	}
 
-		// Generate code
-		confirmCode := generate.RandomNumbers(6)
-		user, cmdtag, err := repoUser.UpdateUser(ctx, int(user.Id), &domainUser.User{
-			ConfirmCode: sql.NullString{
-				String: confirmCode,
-			},
-			ConfirmedAt: sql.NullTime{
-				Time: time.Now(),
-			},
-			ConfirmAction: sql.NullString{
-				String: string(CONFIRM_FORGOT),
-			},
-		})
+	if user.Id <= 0 || user.ConfirmAction.String != string(CONFIRM_REGISTRATION) || !ar.checkToken(user.TokenSecretKey, dto.Email, dto.Key) {
+		return domain.NewError(domain.ErrNotFound, "", "account not found")
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	// If a user activated
+	if user.Activation {
+		return domain.NewError(domain.ErrConflict, domain.ReasonAccountAlreadyActivated, "account already activated")
+	}
 
-		if cmdtag.RowsAffected() <= 0 {
-			return nil, err
-		} else {
-			subject, text := mails.Forgot(map[string]string{
-				"confirmCode":  confirmCode,
-				"confirmed_at": user.ConfirmedAt.Time.Format("02-01-2006 15:04:05"),
-			})
+	if err := ar.checkCode(ctx, user, CONFIRM_REGISTRATION, dto.Code); err != nil {
+		return err
+	}
 
-			// TODO: recommendation use RabbitMQ
-			go func() {
-				smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
-				m := mail.Mailer{
-					SmtpHost:     os.Getenv("SMTP_HOST"),
-					SmtpPort:     smtpPort,
-					SmtpUser:     os.Getenv("SMTP_USER"),
-					SmtpPassword: os.Getenv("SMTP_PASSWORD"),
-				}
-				// Sends message to emails address
-				m.SendMail([]string{user.Email}, subject, text)
-			}()
-
-			return &response.Response{
-				Code:    response.ErrorEmpty,
-				Status:  response.StatusSuccess,
-				Message: "a code was sent to your email",
-			}, nil
-		}
+	// Activating account
+	_, cmdtag, err := repoUser.UpdateUser(ctx, int(user.Id), 0, domainUser.Changes{
+		Activation: domain.Some(true),
+	})
+
+	if err != nil {
+		return err
 	}
 
-	return nil, nil
+	if cmdtag.RowsAffected() <= 0 {
+		return errNotAffected
+	}
+
+	// Prepare message for send to mailbox
+	// Get template message
+	subject, text := mails.Activation(map[string]string{})
+
+	// TODO: recommendation use RabbitMQ
+	go ar.mailer.SendMail([]string{user.Email}, subject, text)
+
+	return nil
 }
 
-func (ar *AuthService) ConfirmCheck(ctx context.Context, dto domainAuth.ConfirmCheckDto) (*response.Response, error) {
+func (ar *AuthService) Forgot(ctx context.Context, dto domainAuth.ForgotDto) error {
 	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ar.db)
+	repoUser := ar.store.Users
 	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
 
 	if err != nil {
-		return nil, err
-	}
-
-	// If valid data
-	if user.Id > 0 && user.ConfirmAction.String == dto.Action {
-		// If don't activated the user
-		if !user.Activation {
-			return &response.Response{
-				Code:    response.ErrorAccountActivate,
-				Status:  response.StatusError,
-				Message: "account not activated",
-			}, nil
-		}
+		return err
+	}
 
-		// if confirmed_at valid
-		if user.ConfirmedAt.Valid {
-			// if don't match of confirm codes
-			if strconv.Itoa(dto.Code) != user.ConfirmCode.String {
-				return &response.Response{
-					Code:    response.ErrorAccountInvalidCode,
-					Status:  response.StatusError,
-					Message: "don't match of confirm code",
-				}, nil
-			}
+	if user.Id <= 0 {
+		return domain.NewError(domain.ErrNotFound, "", "account not found")
+	}
 
-			// TODO: Fix timezone (Windows)
-			tz, _ := utils.GetTimezone()
-			confirmExpired := time.Now().In(tz).Unix() - user.ConfirmedAt.Time.In(tz).Unix()
-			limitExprTime, _ := strconv.ParseInt(os.Getenv("APP_CONFIRM_TIME"), 10, 64)
-
-			// if it hasn't been 5 minutes
-			if confirmExpired < limitExprTime {
-				return &response.Response{
-					Code:    response.ErrorEmpty,
-					Status:  response.StatusSuccess,
-					Message: "the code is relevant",
-				}, nil
-			} else {
-				return &response.Response{
-					Code:    response.ErrorAccountActivateTimeout,
-					Status:  response.StatusError,
-					Message: "this confirm code time out",
-				}, nil
-			}
-		}
+	// If don't activated the user
+	if !user.Activation {
+		return errAccountNotActivated
 	}
 
-	return nil, nil
+	return ar.sendCode(ctx, user, CONFIRM_FORGOT, mails.Forgot)
 }
 
-func (ar *AuthService) Recovery(ctx context.Context, dto domainAuth.RecoveryDto) (*response.Response, error) {
+func (ar *AuthService) ConfirmCheck(ctx context.Context, dto domainAuth.ConfirmCheckDto) error {
 	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ar.db)
+	repoUser := ar.store.Users
 	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
 
 	if err != nil {
-		return nil, err
-	}
-
-	// If valid data
-	if user.Id > 0 && user.ConfirmAction.String == string(CONFIRM_FORGOT) {
-		// If don't activated the user
-		if !user.Activation {
-			return &response.Response{
-				Code:    response.ErrorAccountActivate,
-				Status:  response.StatusError,
-				Message: "account not activated",
-			}, nil
-		}
+		return err
+	}
 
-		// if confirmed_at valid
-		if user.ConfirmedAt.Valid {
-			// if don't match of confirm codes
-			if strconv.Itoa(dto.Code) != user.ConfirmCode.String {
-				return &response.Response{
-					Code:    response.ErrorAccountInvalidCode,
-					Status:  response.StatusError,
-					Message: "don't match of confirm code",
-				}, nil
-			}
+	if user.Id <= 0 || user.ConfirmAction.String != dto.Action || !user.ConfirmedAt.Valid {
+		return domain.NewError(domain.ErrNotFound, "", "confirm code not found")
+	}
 
-			// If don't match passwords
-			if dto.Password != dto.ConfirmPassword {
-				return &response.Response{
-					Code:    response.ErrorAccountConfirmPassword,
-					Status:  response.StatusError,
-					Message: "don't match passwords",
-				}, nil
-			}
+	// If don't activated the user
+	if !user.Activation {
+		return errAccountNotActivated
+	}
 
-			// Begin transaction
-			tx, err := ar.db.Db.BeginTx(ctx, pgx.TxOptions{})
+	return ar.checkCode(ctx, user, SectionConfirm(dto.Action), dto.Code)
+}
 
-			if err != nil {
-				return nil, err
-			}
+func (ar *AuthService) Recovery(ctx context.Context, dto domainAuth.RecoveryDto) error {
+	// Trying find a user in the users table
+	repoUser := ar.store.Users
+	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
 
-			defer func() {
-				if err != nil {
-					tx.Rollback(ctx)
-				}
-			}()
+	if err != nil {
+		return err
+	}
 
-			// Generate codes and strings
-			pwd_hash, err := pswd.HashPassword(dto.Password)
+	if user.Id <= 0 || user.ConfirmAction.String != string(CONFIRM_FORGOT) || !user.ConfirmedAt.Valid {
+		return domain.NewError(domain.ErrNotFound, "", "confirm code not found")
+	}
 
-			if err != nil {
-				return nil, err
-			}
+	// If don't activated the user
+	if !user.Activation {
+		return errAccountNotActivated
+	}
 
-			// Activating account
-			_, cmdtag, err := repoUser.UpdateUser(ctx, int(user.Id), &domainUser.User{
-				Password: pwd_hash,
-			})
+	if err := ar.checkCode(ctx, user, CONFIRM_FORGOT, dto.Code); err != nil {
+		return err
+	}
 
-			if err != nil {
-				tx.Rollback(ctx)
+	// Generate codes and strings
+	pwd_hash, err := ar.opts.hasher.Hash(dto.Password)
 
-				return nil, err
-			}
+	if err != nil {
+		return err
+	}
 
-			if cmdtag.RowsAffected() <= 0 {
-				tx.Rollback(ctx)
-
-				return nil, err
-			} else {
-				tx.Commit(ctx)
-
-				// Prepare message for send to mailbox
-				// Get template message
-				subject, text := mails.Recovery(map[string]string{})
-
-				// TODO: recommendation use RabbitMQ
-				go func() {
-					smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
-					m := mail.Mailer{
-						SmtpHost:     os.Getenv("SMTP_HOST"),
-						SmtpPort:     smtpPort,
-						SmtpUser:     os.Getenv("SMTP_USER"),
-						SmtpPassword: os.Getenv("SMTP_PASSWORD"),
-					}
-					// Sends message to emails address
-					m.SendMail([]string{user.Email}, subject, text)
-				}()
-
-				return &response.Response{
-					Code:    response.ErrorEmpty,
-					Status:  response.StatusSuccess,
-					Message: "your account password successfully changed",
-				}, nil
-			}
+	var revoked []string
+
+	// Changing the password, the code is used once, and closing all the sessions
+	err = ar.store.WithTx(ctx, func(tx repository.Repos) error {
+		_, cmdtag, err := tx.Users.UpdateUser(ctx, int(user.Id), 0, domainUser.Changes{
+			Password:        domain.Some(pwd_hash),
+			ConfirmCode:     domain.None[string](),
+			ConfirmAction:   domain.None[string](),
+			ConfirmAttempts: domain.Some(0),
+		})
+
+		if err != nil {
+			return err
 		}
+
+		if cmdtag.RowsAffected() <= 0 {
+			return errNotAffected
+		}
+
+		revoked, err = deleteUserAuths(ctx, tx, int(user.Id))
+
+		return err
+	})
+
+	if err != nil {
+		return err
 	}
 
-	return nil, nil
+	if err := ar.opts.revokeTokens(ctx, revoked); err != nil {
+		return err
+	}
+
+	// Prepare message for send to mailbox
+	// Get template message
+	subject, text := mails.Recovery(map[string]string{})
+
+	// TODO: recommendation use RabbitMQ
+	go ar.mailer.SendMail([]string{user.Email}, subject, text)
+
+	return nil
 }
 
-func (ar *AuthService) Resend(ctx context.Context, section SectionSend, body []byte) (*response.Response, error) {
-	confirmCode := generate.RandomNumbers(6)
+func (ar *AuthService) Resend(ctx context.Context, section SectionSend, dto domainAuth.ResendDto) error {
+	var action SectionConfirm
 
 	switch section {
 	case ACTIVATION:
-		dto := domainAuth.ActivationDto{}
-		_ = json.Unmarshal(body, &dto)
+		action = CONFIRM_REGISTRATION
+	case RECOVERY:
+		action = CONFIRM_FORGOT
+	default:
+		return domain.NewError(domain.ErrNotFound, "", "unknown section "+string(section))
+	}
 
-		repoUser := repository.NewUserRepo(ar.db)
-		user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
+	repoUser := ar.store.Users
+	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
 
-		if err != nil {
-			return nil, err
-		}
+	if err != nil {
+		return err
+	}
 
-		user, cmdtag, err := repoUser.UpdateUser(ctx, int(user.Id), &domainUser.User{
-			ConfirmCode: sql.NullString{
-				String: confirmCode,
-			},
-			ConfirmedAt: sql.NullTime{
-				Time: time.Now(),
-			},
-			ConfirmAction: sql.NullString{
-				String: string(CONFIRM_REGISTRATION),
-			},
-		})
+	if user.Id <= 0 {
+		return domain.NewError(domain.ErrNotFound, "", "account not found")
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	return ar.sendCode(ctx, user, action, mails.Confirm)
+}
 
-		if cmdtag.RowsAffected() <= 0 {
-			return nil, err
-		} else {
-			subject, text := mails.Confirm(map[string]string{
-				"confirmCode":  confirmCode,
-				"confirmed_at": user.ConfirmedAt.Time.Format("02-01-2006 15:04:05"),
-			})
+// Checks the code of the action is sent in the confirm time and matches,
+// wrong codes are counted and the code is dropped after the last attempt
+func (ar *AuthService) checkCode(ctx context.Context, user domainUser.User, action SectionConfirm, code int) error {
+	if user.ConfirmAction.String != string(action) || !user.ConfirmedAt.Valid || codeExpired(user.ConfirmedAt.Time) {
+		return errCodeExpired
+	}
 
-			// TODO: recommendation use RabbitMQ
-			go func() {
-				smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
-				m := mail.Mailer{
-					SmtpHost:     os.Getenv("SMTP_HOST"),
-					SmtpPort:     smtpPort,
-					SmtpUser:     os.Getenv("SMTP_USER"),
-					SmtpPassword: os.Getenv("SMTP_PASSWORD"),
-				}
-				// Sends message to emails address
-				m.SendMail([]string{user.Email}, subject, text)
-			}()
-
-			return &response.Response{
-				Code:    response.ErrorEmpty,
-				Status:  response.StatusSuccess,
-				Message: "a code was sent to your email",
-			}, nil
-		}
-	case RECOVERY:
-		dto := domainAuth.ForgotDto{}
-		_ = json.Unmarshal(body, &dto)
+	if codeMatches(code, user.ConfirmCode.String) {
+		return nil
+	}
 
-		repoUser := repository.NewUserRepo(ar.db)
-		user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
+	failure, err := failedAttempt(ctx, ar.store.Users, user)
 
-		if err != nil {
-			return nil, err
-		}
+	if err != nil {
+		return err
+	}
 
-		user, cmdtag, err := repoUser.UpdateUser(ctx, int(user.Id), &domainUser.User{
-			ConfirmCode: sql.NullString{
-				String: confirmCode,
-			},
-			ConfirmedAt: sql.NullTime{
-				Time: time.Now(),
-			},
-			ConfirmAction: sql.NullString{
-				String: string(CONFIRM_FORGOT),
-			},
-		})
+	return failure
+}
 
-		if err != nil {
-			return nil, err
-		}
+// Generates a new confirm code for the action and sends it by the mail template
+func (ar *AuthService) sendCode(ctx context.Context, user domainUser.User, action SectionConfirm, template func(map[string]string) (string, string)) error {
+	repoUser := ar.store.Users
+	confirmCode := generate.RandomNumbers(6)
 
-		if cmdtag.RowsAffected() <= 0 {
-			return nil, err
-		} else {
-			subject, text := mails.Confirm(map[string]string{
-				"confirmCode":  confirmCode,
-				"confirmed_at": user.ConfirmedAt.Time.Format("02-01-2006 15:04:05"),
-			})
+	user, cmdtag, err := repoUser.UpdateUser(ctx, int(user.Id), 0, domainUser.Changes{
+		ConfirmCode:     domain.Some(confirmCode),
+		ConfirmedAt:     domain.Some(time.Now()),
+		ConfirmAction:   domain.Some(string(action)),
+		ConfirmAttempts: domain.Some(0),
+	})
 
-			// TODO: recommendation use RabbitMQ
-			go func() {
-				smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
-				m := mail.Mailer{
-					SmtpHost:     os.Getenv("SMTP_HOST"),
-					SmtpPort:     smtpPort,
-					SmtpUser:     os.Getenv("SMTP_USER"),
-					SmtpPassword: os.Getenv("SMTP_PASSWORD"),
-				}
-				// Sends message to emails address
-				m.SendMail([]string{user.Email}, subject, text)
-			}()
-
-			return &response.Response{
-				Code:    response.ErrorEmpty,
-				Status:  response.StatusSuccess,
-				Message: "a code was sent to your email",
-			}, nil
-		}
+	if err != nil {
+		return err
+	}
+
+	if cmdtag.RowsAffected() <= 0 {
+		return errNotAffected
 	}
 
-	return nil, nil
+	subject, text := template(map[string]string{
+		"confirmCode":  confirmCode,
+		"confirmed_at": user.ConfirmedAt.Time.Format("02-01-2006 15:04:05"),
+	})
+
+	// TODO: recommendation use RabbitMQ
+	go ar.mailer.SendMail([]string{user.Email}, subject, text)
+
+	return nil
+}
+
+// Creates a pair of tokens and stores them as a new session
+func newSession(ctx context.Context, auths repository.AuthRepository, userId int, dto domainAuth.LoginDto) (domainAuth.Tokens, error) {
+	// Creating pair tokens of jwt
+	myjwt := ajwt.JWT{
+		Secret:           os.Getenv("APP_JWT_SECRET"),
+		UserId:           userId,
+		RefreshExpiresAt: time.Now().Add(refreshLifetime),
+	}
+	access, refresh := myjwt.NewPairTokens()
+
+	// Inserting in sessions
+	cmdtag, err := auths.InsertAuth(ctx, domainAuth.Auth{
+		UserId:       uint(userId),
+		AccessToken:  access,
+		RefreshToken: refresh,
+		Ip:           dto.Ip,
+		Device:       dto.Device,
+		UserAgent:    dto.UserAgent,
+	})
+
+	if err != nil {
+		return domainAuth.Tokens{}, err
+	}
+
+	if cmdtag.RowsAffected() <= 0 {
+		return domainAuth.Tokens{}, errNotAffected
+	}
+
+	return domainAuth.Tokens{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: myjwt.RefreshExpiresAt,
+	}, nil
 }
 
 func (ar *AuthService) generateToken(secret string, email string) string {
@@ -0,0 +1,1107 @@
+package service_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"apibgo/internal/domain"
+	domainAuth "apibgo/internal/domain/auth"
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/repository"
+	"apibgo/internal/repository/memory"
+	"apibgo/internal/service"
+	"apibgo/pkg/auth/ajwt"
+	"apibgo/pkg/auth/pswd"
+	"apibgo/pkg/auth/revoke"
+	"apibgo/pkg/geoip"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	testSecret   = "test-secret"
+	testPassword = "Str0ng-Passw0rd"
+	testCode     = 123456
+	userAgent    = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	firefoxAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0"
+)
+
+func TestMain(m *testing.M) {
+	os.Setenv("APP_JWT_SECRET", testSecret)
+	os.Setenv("APP_CONFIRM_TIME", "300")
+	os.Setenv("LANG_PATH", "../../langs")
+
+	os.Exit(m.Run())
+}
+
+type sentMail struct {
+	to      []string
+	subject string
+	message string
+}
+
+// Collects the messages instead of sending them
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []sentMail
+	ch   chan struct{}
+}
+
+func newFakeMailer() *fakeMailer {
+	return &fakeMailer{ch: make(chan struct{}, 16)}
+}
+
+func (f *fakeMailer) SendMail(to []string, subject string, message string) bool {
+	f.mu.Lock()
+	f.sent = append(f.sent, sentMail{to: to, subject: subject, message: message})
+	f.mu.Unlock()
+
+	f.ch <- struct{}{}
+
+	return true
+}
+
+// Waits for a message, the services send them in the background
+func (f *fakeMailer) wait(t *testing.T, to string) sentMail {
+	t.Helper()
+
+	select {
+	case <-f.ch:
+	case <-time.After(time.Second):
+		t.Fatalf("no mail was sent to %s", to)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	last := f.sent[len(f.sent)-1]
+
+	if len(last.to) != 1 || last.to[0] != to {
+		t.Fatalf("mail was sent to %v, want %s", last.to, to)
+	}
+
+	return last
+}
+
+// Fails if a message is sent in a while
+func (f *fakeMailer) none(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-f.ch:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		t.Fatalf("unexpected mail %q", f.sent[len(f.sent)-1].subject)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// The cheapest hash keeps the tests fast
+var testHasher = pswd.Hasher{Algorithm: pswd.Bcrypt, BcryptCost: bcrypt.MinCost}
+
+type fixture struct {
+	store    repository.Store
+	mailer   *fakeMailer
+	activity *service.Activity
+	opts     []service.Option
+	auth     *service.AuthService
+}
+
+// The services of the fixture share the revoked tokens and the activity
+// like the ones of the application, the options are added to the test ones
+func newFixture(opts ...service.Option) *fixture {
+	store := memory.NewStore()
+	mailer := newFakeMailer()
+	activity := service.NewActivity()
+	opts = append([]service.Option{
+		service.WithHasher(testHasher),
+		service.WithRevocations(revoke.NewMemory()),
+		service.WithActivity(activity),
+	}, opts...)
+
+	return &fixture{
+		store:    store,
+		mailer:   mailer,
+		activity: activity,
+		opts:     opts,
+		auth:     service.NewAuthService(store, mailer, opts...),
+	}
+}
+
+// Whether the hash is of the password
+func checkPassword(passwd, hash string) bool {
+	ok, _, _ := testHasher.Verify(passwd, hash)
+
+	return ok
+}
+
+func (f *fixture) users() *service.UserService {
+	return service.NewUserService(f.store, f.opts...)
+}
+
+func (f *fixture) accounts() *service.AccountService {
+	return service.NewAccountService(f.store, f.mailer, f.opts...)
+}
+
+// Adds a user with the test password, the change function adjusts the user before inserting
+func (f *fixture) addUser(t *testing.T, email string, change func(*domainUser.User)) domainUser.User {
+	t.Helper()
+
+	hash, err := testHasher.Hash(testPassword)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user := domainUser.User{
+		Email:          email,
+		Password:       hash,
+		Activation:     true,
+		TokenSecretKey: "secret-of-" + email,
+		ConfirmCode:    sql.NullString{String: fmt.Sprint(testCode)},
+		ConfirmAction:  sql.NullString{String: string(service.CONFIRM_REGISTRATION)},
+	}
+
+	if change != nil {
+		change(&user)
+	}
+
+	inserted, err := f.store.Users.InsertUser(context.Background(), user)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The insert doesn't store the activation and the confirm time
+	upd := domainUser.Changes{Activation: domain.Some(user.Activation)}
+
+	if user.ConfirmedAt.Valid {
+		upd.ConfirmedAt = domain.Some(user.ConfirmedAt.Time)
+	}
+
+	inserted, _, err = f.store.Users.UpdateUser(context.Background(), int(inserted.Id), 0, upd)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return inserted
+}
+
+func (f *fixture) user(t *testing.T, email string) domainUser.User {
+	t.Helper()
+
+	user, err := f.store.Users.GetUser(context.Background(), domainUser.UserDto{Email: email})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func activationKey(user domainUser.User) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(user.TokenSecretKey+"::"+user.Email)))
+}
+
+// Checks the kind and the reason of a domain error, a nil kind expects no error
+func assertError(t *testing.T, err error, kind error, reason string) {
+	t.Helper()
+
+	if kind == nil {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return
+	}
+
+	if !errors.Is(err, kind) {
+		t.Fatalf("error = %v, want kind %v", err, kind)
+	}
+
+	if got := domain.ReasonOf(err); got != reason {
+		t.Fatalf("reason = %q, want %q", got, reason)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     func(*domainUser.User)
+		email    string
+		password string
+		kind     error
+		reason   string
+	}{
+		{name: "valid credentials", email: "user@example.com", password: testPassword},
+		{name: "wrong password", email: "user@example.com", password: "wrong", kind: domain.ErrUnauthorized, reason: domain.ReasonInvalidCredentials},
+		{name: "unknown email", email: "nobody@example.com", password: testPassword, kind: domain.ErrUnauthorized, reason: domain.ReasonInvalidCredentials},
+		{name: "not activated", email: "user@example.com", password: testPassword, kind: domain.ErrPrecondition, reason: domain.ReasonAccountNotActivated,
+			user: func(u *domainUser.User) { u.Activation = false }},
+		{name: "plain text password", email: "user@example.com", password: testPassword, kind: domain.ErrUnauthorized, reason: domain.ReasonInvalidCredentials,
+			user: func(u *domainUser.User) { u.Password = testPassword }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			f.addUser(t, "user@example.com", tt.user)
+
+			tokens, err := f.auth.Login(context.Background(), domainAuth.LoginDto{
+				Email:     tt.email,
+				Password:  tt.password,
+				Ip:        "127.0.0.1",
+				UserAgent: userAgent,
+			})
+
+			assertError(t, err, tt.kind, tt.reason)
+
+			if tt.kind != nil {
+				return
+			}
+
+			if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.RefreshExpiresAt.IsZero() {
+				t.Fatalf("incomplete tokens: %+v", tokens)
+			}
+
+			auth, _ := f.store.Auths.GetAuth(context.Background(), domainAuth.AuthDto{Refresh: tokens.RefreshToken})
+
+			if auth.Id == 0 {
+				t.Fatal("session was not stored")
+			}
+
+			f.mailer.wait(t, tt.email)
+		})
+	}
+}
+
+func TestLoginReplacesSessionOfDevice(t *testing.T) {
+	f := newFixture()
+	user := f.addUser(t, "user@example.com", nil)
+	dto := domainAuth.LoginDto{Email: user.Email, Password: testPassword, Ip: "127.0.0.1", UserAgent: userAgent}
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.auth.Login(context.Background(), dto); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessions, _ := f.store.Auths.GetSessions(context.Background(), domainAuth.SessionDto{Id: int(user.Id)})
+
+	if sessions.Total != 1 {
+		t.Fatalf("sessions = %d, want 1", sessions.Total)
+	}
+}
+
+func TestLoginKeepsSessionsOfOtherUsers(t *testing.T) {
+	f := newFixture()
+	ann := f.addUser(t, "ann@example.com", nil)
+	bob := f.addUser(t, "bob@example.com", nil)
+
+	// Both users log in on the same device
+	login(t, f, ann)
+	login(t, f, bob)
+
+	for _, user := range []domainUser.User{ann, bob} {
+		sessions, _ := f.store.Auths.GetSessions(context.Background(), domainAuth.SessionDto{Id: int(user.Id)})
+
+		if sessions.Total != 1 {
+			t.Fatalf("sessions of %s = %d, want 1", user.Email, sessions.Total)
+		}
+	}
+}
+
+func TestTouchSession(t *testing.T) {
+	f := newFixture()
+	user := f.addUser(t, "user@example.com", nil)
+	actor, err := f.auth.Actor(context.Background(), login(t, f, user).AccessToken)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The session without an id isn't touched
+	if err := f.auth.TouchSession(context.Background(), domain.Actor{UserId: actor.UserId}, "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.auth.TouchSession(context.Background(), actor, "10.0.0.2"); err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, _ := f.store.Auths.GetSessions(context.Background(), domainAuth.SessionDto{Id: int(user.Id)})
+
+	if len(sessions.Items) != 1 || sessions.Items[0].LastIp.String != "10.0.0.2" || !sessions.Items[0].LastSeenAt.Valid {
+		t.Fatalf("sessions = %+v, want the one seen from 10.0.0.2", sessions.Items)
+	}
+}
+
+func TestLoginRehashesOutdatedHash(t *testing.T) {
+	f := newFixture()
+	user := f.addUser(t, "user@example.com", func(u *domainUser.User) {
+		hash, _ := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost+1)
+		u.Password = string(hash)
+	})
+
+	_, err := f.auth.Login(context.Background(), domainAuth.LoginDto{Email: user.Email, Password: testPassword, UserAgent: userAgent})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hash := f.user(t, user.Email).Password; testHasher.NeedsRehash(hash) {
+		t.Fatalf("hash %s was not remade", hash)
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		email    string
+		kind     error
+		reason   string
+	}{
+		{name: "new account", email: "new@example.com"},
+		{name: "existing account", existing: "new@example.com", email: "new@example.com", kind: domain.ErrConflict, reason: domain.ReasonAccountExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+
+			if tt.existing != "" {
+				f.addUser(t, tt.existing, nil)
+			}
+
+			result, err := f.auth.Registration(context.Background(), domainAuth.RegistrationDto{
+				Email:           tt.email,
+				Password:        testPassword,
+				ConfirmPassword: testPassword,
+				Name:            "John",
+				Surname:         "Smith",
+			})
+
+			assertError(t, err, tt.kind, tt.reason)
+
+			if tt.kind != nil {
+				return
+			}
+
+			user := f.user(t, tt.email)
+
+			switch {
+			case user.Id == 0:
+				t.Fatal("user was not stored")
+			case user.Activation:
+				t.Fatal("new user must not be activated")
+			case user.ConfirmAction.String != string(service.CONFIRM_REGISTRATION) || len(user.ConfirmCode.String) != 6:
+				t.Fatalf("confirm code %q for %q", user.ConfirmCode.String, user.ConfirmAction.String)
+			case !checkPassword(testPassword, user.Password):
+				t.Fatal("password is not hashed")
+			case result.Email != tt.email || result.Key != activationKey(user):
+				t.Fatalf("result = %+v", result)
+			}
+
+			f.mailer.wait(t, tt.email)
+		})
+	}
+}
+
+func TestActivation(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   func(*domainUser.User)
+		code   int
+		key    func(domainUser.User) string
+		kind   error
+		reason string
+	}{
+		{name: "valid code", code: testCode},
+		{name: "wrong code", code: 654321, kind: domain.ErrValidation, reason: domain.ReasonInvalidCode},
+		{name: "wrong key", code: testCode, kind: domain.ErrNotFound,
+			key: func(domainUser.User) string { return fmt.Sprintf("%x", sha256.Sum256([]byte("other"))) }},
+		{name: "expired code", code: testCode, kind: domain.ErrExpired, reason: domain.ReasonCodeExpired,
+			user: func(u *domainUser.User) { u.ConfirmedAt = sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true} }},
+		{name: "already activated", code: testCode, kind: domain.ErrConflict, reason: domain.ReasonAccountAlreadyActivated,
+			user: func(u *domainUser.User) { u.Activation = true }},
+		{name: "code of another action", code: testCode, kind: domain.ErrNotFound,
+			user: func(u *domainUser.User) { u.ConfirmAction.String = string(service.CONFIRM_FORGOT) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			user := f.addUser(t, "user@example.com", func(u *domainUser.User) {
+				u.Activation = false
+
+				if tt.user != nil {
+					tt.user(u)
+				}
+			})
+
+			key := activationKey(user)
+
+			if tt.key != nil {
+				key = tt.key(user)
+			}
+
+			err := f.auth.Activation(context.Background(), domainAuth.ActivationDto{Email: user.Email, Key: key, Code: tt.code})
+
+			assertError(t, err, tt.kind, tt.reason)
+
+			if tt.kind != nil {
+				return
+			}
+
+			if !f.user(t, user.Email).Activation {
+				t.Fatal("user was not activated")
+			}
+
+			f.mailer.wait(t, user.Email)
+		})
+	}
+}
+
+func TestForgot(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   func(*domainUser.User)
+		email  string
+		kind   error
+		reason string
+	}{
+		{name: "activated account", email: "user@example.com"},
+		{name: "unknown account", email: "nobody@example.com", kind: domain.ErrNotFound},
+		{name: "not activated", email: "user@example.com", kind: domain.ErrPrecondition, reason: domain.ReasonAccountNotActivated,
+			user: func(u *domainUser.User) { u.Activation = false }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			before := f.addUser(t, "user@example.com", tt.user)
+
+			err := f.auth.Forgot(context.Background(), domainAuth.ForgotDto{Email: tt.email})
+
+			assertError(t, err, tt.kind, tt.reason)
+
+			if tt.kind != nil {
+				return
+			}
+
+			user := f.user(t, tt.email)
+
+			if user.ConfirmAction.String != string(service.CONFIRM_FORGOT) || !user.ConfirmedAt.Valid {
+				t.Fatalf("confirm action = %q", user.ConfirmAction.String)
+			}
+
+			if user.ConfirmCode.String == before.ConfirmCode.String && user.ConfirmedAt.Time.Equal(before.ConfirmedAt.Time) {
+				t.Fatal("confirm code was not renewed")
+			}
+
+			f.mailer.wait(t, tt.email)
+		})
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	const newPassword = "N3w-Passw0rd!"
+
+	forgot := func(u *domainUser.User) {
+		u.ConfirmAction.String = string(service.CONFIRM_FORGOT)
+		u.ConfirmedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+
+	tests := []struct {
+		name   string
+		user   func(*domainUser.User)
+		code   int
+		kind   error
+		reason string
+	}{
+		{name: "valid code", user: forgot, code: testCode},
+		{name: "wrong code", user: forgot, code: 654321, kind: domain.ErrValidation, reason: domain.ReasonInvalidCode},
+		{name: "no code was requested", code: testCode, kind: domain.ErrNotFound},
+		{name: "expired code", code: testCode, kind: domain.ErrExpired, reason: domain.ReasonCodeExpired,
+			user: func(u *domainUser.User) { forgot(u); u.ConfirmedAt.Time = time.Now().Add(-time.Hour) }},
+		{name: "not activated", code: testCode, kind: domain.ErrPrecondition, reason: domain.ReasonAccountNotActivated,
+			user: func(u *domainUser.User) { forgot(u); u.Activation = false }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			user := f.addUser(t, "user@example.com", tt.user)
+
+			err := f.auth.Recovery(context.Background(), domainAuth.RecoveryDto{
+				Email:           user.Email,
+				Code:            tt.code,
+				Password:        newPassword,
+				ConfirmPassword: newPassword,
+			})
+
+			assertError(t, err, tt.kind, tt.reason)
+
+			changed := checkPassword(newPassword, f.user(t, user.Email).Password)
+
+			if changed != (tt.kind == nil) {
+				t.Fatalf("password changed = %v", changed)
+			}
+
+			if tt.kind == nil {
+				f.mailer.wait(t, user.Email)
+			}
+		})
+	}
+}
+
+func TestConfirmCodeAttempts(t *testing.T) {
+	const newPassword = "N3w-Passw0rd!"
+
+	tests := []struct {
+		name      string
+		action    service.SectionConfirm
+		activated bool
+		check     func(f *fixture, user domainUser.User, code int) error
+	}{
+		{name: "activation", action: service.CONFIRM_REGISTRATION, check: func(f *fixture, user domainUser.User, code int) error {
+			return f.auth.Activation(context.Background(), domainAuth.ActivationDto{Email: user.Email, Key: activationKey(user), Code: code})
+		}},
+		{name: "confirm check", action: service.CONFIRM_FORGOT, activated: true, check: func(f *fixture, user domainUser.User, code int) error {
+			return f.auth.ConfirmCheck(context.Background(), domainAuth.ConfirmCheckDto{Email: user.Email, Action: string(service.CONFIRM_FORGOT), Code: code})
+		}},
+		{name: "recovery", action: service.CONFIRM_FORGOT, activated: true, check: func(f *fixture, user domainUser.User, code int) error {
+			return f.auth.Recovery(context.Background(), domainAuth.RecoveryDto{
+				Email: user.Email, Code: code, Password: newPassword, ConfirmPassword: newPassword,
+			})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			user := f.addUser(t, "user@example.com", func(u *domainUser.User) {
+				u.Activation = tt.activated
+				u.ConfirmAction.String = string(tt.action)
+				u.ConfirmedAt = sql.NullTime{Time: time.Now(), Valid: true}
+			})
+
+			for i := 1; i < 5; i++ {
+				assertError(t, tt.check(f, user, testCode+1), domain.ErrValidation, domain.ReasonInvalidCode)
+			}
+
+			assertError(t, tt.check(f, user, testCode+1), domain.ErrExpired, domain.ReasonTooManyAttempts)
+
+			// The right code doesn't work after the last attempt
+			if err := tt.check(f, user, testCode); err == nil {
+				t.Fatal("the code works after the last attempt")
+			}
+		})
+	}
+}
+
+func TestRevokedTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		revoke func(f *fixture, actor domain.Actor, token string) error
+	}{
+		{name: "logout", revoke: func(f *fixture, actor domain.Actor, token string) error {
+			return f.auth.Logout(context.Background(), token, domainAuth.LoginDto{UserAgent: userAgent})
+		}},
+		{name: "session destroyed", revoke: func(f *fixture, actor domain.Actor, token string) error {
+			return f.users().DestroySession(domain.WithActor(context.Background(), actor), actor.UserId, actor.SessionId)
+		}},
+		{name: "other sessions destroyed", revoke: func(f *fixture, actor domain.Actor, token string) error {
+			_, err := f.users().DestroyOtherSessions(domain.WithActor(context.Background(), actor), actor.UserId, 0)
+			return err
+		}},
+		{name: "user deleted", revoke: func(f *fixture, actor domain.Actor, token string) error {
+			return f.users().DeleteUser(domain.WithActor(context.Background(), actor), actor.UserId, nil)
+		}},
+		{name: "password recovered", revoke: func(f *fixture, actor domain.Actor, token string) error {
+			if _, _, err := f.store.Users.UpdateUser(context.Background(), actor.UserId, 0, domainUser.Changes{
+				ConfirmCode:   domain.Some(fmt.Sprint(testCode)),
+				ConfirmAction: domain.Some(string(service.CONFIRM_FORGOT)),
+				ConfirmedAt:   domain.Some(time.Now()),
+			}); err != nil {
+				return err
+			}
+
+			return f.auth.Recovery(context.Background(), domainAuth.RecoveryDto{
+				Email: "user@example.com", Code: testCode, Password: "N3w-Passw0rd!", ConfirmPassword: "N3w-Passw0rd!",
+			})
+		}},
+		{name: "password patched by an admin", revoke: func(f *fixture, actor domain.Actor, token string) error {
+			_, err := f.users().PatchUser(adminContext(), domainUser.PatchUserDto{
+				Id:              actor.UserId,
+				Password:        domain.Some("N3w-Passw0rd!"),
+				ConfirmPassword: domain.Some("N3w-Passw0rd!"),
+			})
+			return err
+		}},
+		{name: "user banned", revoke: func(f *fixture, actor domain.Actor, token string) error {
+			_, err := f.users().BanUser(adminContext(), domainUser.BanDto{UserId: actor.UserId, ReasonId: 1})
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(service.WithAdminGroups(adminGroup))
+			user := f.addUser(t, "user@example.com", nil)
+			token := login(t, f, user).AccessToken
+			actor, err := f.auth.Actor(context.Background(), token)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if isVerify, err := f.auth.VerifyAccessToken(context.Background(), token); !isVerify {
+				t.Fatalf("token isn't valid before the revoke: %v", err)
+			}
+
+			if err := tt.revoke(f, actor, token); err != nil {
+				t.Fatal(err)
+			}
+
+			// The token is still a valid JWT but the session is closed
+			if isVerify, _ := f.auth.VerifyAccessToken(context.Background(), token); isVerify {
+				t.Fatal("revoked token is valid")
+			}
+		})
+	}
+}
+
+func TestVerifyAccessTokenType(t *testing.T) {
+	f := newFixture()
+	user := f.addUser(t, "user@example.com", nil)
+	tokens := login(t, f, user)
+
+	if isVerify, err := f.auth.VerifyAccessToken(context.Background(), tokens.AccessToken); !isVerify {
+		t.Fatalf("access token isn't valid: %v", err)
+	}
+
+	if isVerify, _ := f.auth.VerifyAccessToken(context.Background(), tokens.RefreshToken); isVerify {
+		t.Fatal("refresh token is valid as an access token")
+	}
+}
+
+func TestLoginHistory(t *testing.T) {
+	f := newFixture()
+	user := f.addUser(t, "user@example.com", nil)
+	dto := domainAuth.LoginDto{Email: user.Email, Password: "wrong", Ip: "10.0.0.1", UserAgent: userAgent}
+
+	if _, err := f.auth.Login(context.Background(), dto); err == nil {
+		t.Fatal("login with the wrong password")
+	}
+
+	dto.Password = testPassword
+	tokens, err := f.auth.Login(context.Background(), dto)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.auth.Refresh(context.Background(), tokens.RefreshToken, dto); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.auth.Logout(context.Background(), tokens.AccessToken, dto); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := f.users().LoginHistory(domain.WithActor(context.Background(), domain.Actor{UserId: int(user.Id)}), domainAuth.EventDto{UserId: int(user.Id)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		kind    string
+		success bool
+	}{
+		{domainAuth.EventLogin, false},
+		{domainAuth.EventLogin, true},
+		{domainAuth.EventRefresh, true},
+		{domainAuth.EventLogout, true},
+	}
+
+	if len(history.Items) != len(want) {
+		t.Fatalf("events = %+v, want %d", history.Items, len(want))
+	}
+
+	for i, event := range history.Items {
+		if event.Kind != want[i].kind || event.Success != want[i].success || event.Ip.String != "10.0.0.1" || event.Browser == "" {
+			t.Errorf("event %d = %+v, want %s success %v", i, event, want[i].kind, want[i].success)
+		}
+	}
+}
+
+func TestFlushActivity(t *testing.T) {
+	f := newFixture()
+	user := f.addUser(t, "user@example.com", nil)
+
+	// Requests of the user are written at once
+	f.auth.TouchActivity(domain.Actor{UserId: int(user.Id)})
+	f.auth.TouchActivity(domain.Actor{UserId: int(user.Id)})
+
+	if touched, err := f.activity.Flush(context.Background(), f.store); err != nil || touched != 1 {
+		t.Fatalf("touched = %d, %v, want 1", touched, err)
+	}
+
+	if !f.user(t, user.Email).LastActivityAt.Valid {
+		t.Fatal("last activity isn't written")
+	}
+
+	if touched, err := f.activity.Flush(context.Background(), f.store); err != nil || touched != 0 {
+		t.Fatalf("touched = %d, %v, want nothing to write", touched, err)
+	}
+}
+
+// Networks of the test GeoIP database
+const (
+	moscowIp       = "10.0.0.1"
+	moscowOtherIp  = "10.0.1.1"
+	sanFranciscoIp = "10.0.2.1"
+	newYorkIp      = "10.0.3.1"
+)
+
+const testCities = `10.0.0.0,10.0.1.255,EU,RU,Moscow,Moscow,55.7558,37.6173
+10.0.2.0,10.0.2.255,NA,US,California,San Francisco,37.7749,-122.4194
+10.0.3.0,10.0.3.255,NA,US,New York,New York,40.7128,-74.006
+`
+
+func TestLoginConfirmKeepsPendingAction(t *testing.T) {
+	f := newFixture(loginOptions(t, service.LoginConfirmNewDevice)...)
+	user := f.addUser(t, "user@example.com", nil)
+	dto := domainAuth.LoginDto{Email: user.Email, Password: testPassword, Ip: moscowIp, UserAgent: userAgent}
+
+	if _, err := f.auth.Login(context.Background(), dto); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mailer.wait(t, user.Email)
+	ctx := domain.WithActor(context.Background(), domain.Actor{UserId: int(user.Id)})
+
+	if err := f.accounts().ChangeEmail(ctx, domainUser.ChangeEmailDto{Email: "new@example.com", Password: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mailer.wait(t, "new@example.com")
+	pending := f.user(t, user.Email)
+	dto.UserAgent = firefoxAgent
+	_, err := f.auth.Login(context.Background(), dto)
+
+	assertError(t, err, domain.ErrConflict, "")
+
+	if got := f.user(t, user.Email); got.ConfirmCode != pending.ConfirmCode || got.ConfirmAction != pending.ConfirmAction {
+		t.Fatalf("code of %q is replaced by %q", pending.ConfirmAction.String, got.ConfirmAction.String)
+	}
+
+	f.mailer.none(t)
+}
+
+func TestLoginConfirmAttempts(t *testing.T) {
+	f := newFixture(loginOptions(t, service.LoginConfirmNewDevice)...)
+	user := f.addUser(t, "user@example.com", nil)
+	dto := domainAuth.LoginDto{Email: user.Email, Password: testPassword, Ip: moscowIp, UserAgent: userAgent}
+
+	if _, err := f.auth.Login(context.Background(), dto); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mailer.wait(t, user.Email)
+	dto.UserAgent = firefoxAgent
+	_, err := f.auth.Login(context.Background(), dto)
+
+	assertError(t, err, domain.ErrUnauthorized, domain.ReasonLoginConfirm)
+
+	f.mailer.wait(t, user.Email)
+	code, _ := strconv.Atoi(f.user(t, user.Email).ConfirmCode.String)
+	dto.Code = code%999999 + 1
+
+	for i := 1; i < 5; i++ {
+		_, err := f.auth.Login(context.Background(), dto)
+
+		assertError(t, err, domain.ErrValidation, domain.ReasonInvalidCode)
+	}
+
+	_, err = f.auth.Login(context.Background(), dto)
+
+	assertError(t, err, domain.ErrExpired, domain.ReasonTooManyAttempts)
+
+	// The right code doesn't work after the last attempt
+	dto.Code = code
+	_, err = f.auth.Login(context.Background(), dto)
+
+	assertError(t, err, domain.ErrExpired, domain.ReasonCodeExpired)
+}
+
+// The options of the test GeoIP database and the confirmation mode
+func loginOptions(t *testing.T, mode string) []service.Option {
+	t.Helper()
+
+	db, err := geoip.Read(strings.NewReader(testCities))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []service.Option{service.WithGeoIP(db), service.WithLoginConfirm(mode)}
+}
+
+func TestLoginDevices(t *testing.T) {
+	f := newFixture(loginOptions(t, service.LoginConfirmOff)...)
+	user := f.addUser(t, "user@example.com", nil)
+	logins := []struct {
+		ip        string
+		userAgent string
+		deviceId  string
+		mail      bool
+	}{
+		{ip: moscowIp, userAgent: userAgent, mail: true},
+		{ip: moscowIp, userAgent: userAgent},
+		// The same browser and network
+		{ip: "10.0.0.200", userAgent: userAgent},
+		{ip: moscowIp, userAgent: firefoxAgent, mail: true},
+		{ip: moscowOtherIp, userAgent: userAgent, mail: true},
+		{ip: moscowIp, userAgent: userAgent, deviceId: "phone", mail: true},
+		{ip: moscowIp, userAgent: userAgent, deviceId: "phone"},
+	}
+
+	for i, login := range logins {
+		_, err := f.auth.Login(context.Background(), domainAuth.LoginDto{
+			Email:     user.Email,
+			Password:  testPassword,
+			DeviceId:  login.deviceId,
+			Ip:        login.ip,
+			UserAgent: login.userAgent,
+		})
+
+		if err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+
+		if !login.mail {
+			f.mailer.none(t)
+			continue
+		}
+
+		if sent := f.mailer.wait(t, user.Email); !strings.Contains(sent.message, "Moscow") {
+			t.Errorf("login %d: no place in the mail %q", i, sent.message)
+		}
+	}
+
+	devices, err := f.store.Devices.GetDevices(context.Background(), int(user.Id))
+
+	if err != nil || len(devices) != 4 {
+		t.Fatalf("devices = %+v, %v, want 4", devices, err)
+	}
+
+	if devices[0].Country != "RU" || !devices[0].Latitude.Valid || devices[0].Name != "Chrome on Linux" {
+		t.Fatalf("device = %+v", devices[0])
+	}
+}
+
+func TestLoginConfirm(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		first   string
+		ip      string
+		agent   string
+		confirm bool
+	}{
+		{name: "off", mode: service.LoginConfirmOff, first: moscowIp, ip: sanFranciscoIp, agent: firefoxAgent},
+		{name: "new device", mode: service.LoginConfirmNewDevice, first: moscowIp, ip: moscowIp, agent: firefoxAgent, confirm: true},
+		{name: "known device", mode: service.LoginConfirmNewDevice, first: moscowIp, ip: moscowIp, agent: userAgent},
+		{name: "new country", mode: service.LoginConfirmSuspicious, first: moscowIp, ip: sanFranciscoIp, agent: userAgent, confirm: true},
+		{name: "impossible travel", mode: service.LoginConfirmSuspicious, first: sanFranciscoIp, ip: newYorkIp, agent: userAgent, confirm: true},
+		{name: "nearby network", mode: service.LoginConfirmSuspicious, first: moscowIp, ip: moscowOtherIp, agent: firefoxAgent},
+		{name: "unknown place", mode: service.LoginConfirmSuspicious, first: moscowIp, ip: "192.0.2.1", agent: userAgent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(loginOptions(t, tt.mode)...)
+			user := f.addUser(t, "user@example.com", nil)
+			dto := domainAuth.LoginDto{Email: user.Email, Password: testPassword, Ip: tt.first, UserAgent: userAgent}
+
+			// The first device is trusted
+			if _, err := f.auth.Login(context.Background(), dto); err != nil {
+				t.Fatal(err)
+			}
+
+			f.mailer.wait(t, user.Email)
+			dto.Ip, dto.UserAgent = tt.ip, tt.agent
+			_, err := f.auth.Login(context.Background(), dto)
+
+			if !tt.confirm {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			assertError(t, err, domain.ErrUnauthorized, domain.ReasonLoginConfirm)
+
+			if sent := f.mailer.wait(t, user.Email); !strings.Contains(sent.message, f.user(t, user.Email).ConfirmCode.String) {
+				t.Fatalf("no code in the mail %q", sent.message)
+			}
+
+			code, _ := strconv.Atoi(f.user(t, user.Email).ConfirmCode.String)
+			dto.Code = code%999999 + 1
+			_, err = f.auth.Login(context.Background(), dto)
+
+			assertError(t, err, domain.ErrValidation, domain.ReasonInvalidCode)
+
+			dto.Code = code
+
+			if _, err := f.auth.Login(context.Background(), dto); err != nil {
+				t.Fatal(err)
+			}
+
+			f.mailer.none(t)
+
+			if f.user(t, user.Email).ConfirmCode.Valid {
+				t.Fatal("confirm code is left")
+			}
+
+			// The device is known now
+			dto.Code = 0
+
+			if _, err := f.auth.Login(context.Background(), dto); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	tests := []struct {
+		name string
+		// Returns the refresh token sent by the client
+		session func(t *testing.T, f *fixture, user domainUser.User) string
+		renewed bool
+		kind    error
+		reason  string
+	}{
+		{
+			name: "access token is still valid",
+			session: func(t *testing.T, f *fixture, user domainUser.User) string {
+				return login(t, f, user).RefreshToken
+			},
+		},
+		{
+			name:    "access token is expired",
+			renewed: true,
+			session: func(t *testing.T, f *fixture, user domainUser.User) string {
+				return insertSession(t, f, user, time.Now().Add(-time.Minute))
+			},
+		},
+		{
+			name:   "invalid refresh token",
+			kind:   domain.ErrUnauthorized,
+			reason: domain.ReasonTokenExpired,
+			session: func(t *testing.T, f *fixture, user domainUser.User) string {
+				return "invalid"
+			},
+		},
+		{
+			name:   "access token",
+			kind:   domain.ErrUnauthorized,
+			reason: domain.ReasonTokenExpired,
+			session: func(t *testing.T, f *fixture, user domainUser.User) string {
+				return login(t, f, user).AccessToken
+			},
+		},
+		{
+			name: "refresh token without session",
+			kind: domain.ErrUnauthorized,
+			session: func(t *testing.T, f *fixture, user domainUser.User) string {
+				_, refresh := (&ajwt.JWT{Secret: testSecret, UserId: int(user.Id)}).NewPairTokens()
+				return refresh
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture()
+			user := f.addUser(t, "user@example.com", nil)
+			refresh := tt.session(t, f, user)
+
+			tokens, err := f.auth.Refresh(context.Background(), refresh, domainAuth.LoginDto{Ip: "127.0.0.1", UserAgent: userAgent})
+
+			assertError(t, err, tt.kind, tt.reason)
+
+			if tt.kind != nil {
+				return
+			}
+
+			if renewed := !tokens.RefreshExpiresAt.IsZero(); renewed != tt.renewed {
+				t.Fatalf("renewed = %v, want %v", renewed, tt.renewed)
+			}
+
+			old, _ := f.store.Auths.GetAuth(context.Background(), domainAuth.AuthDto{Refresh: refresh})
+
+			if tt.renewed && (old.Id != 0 || tokens.RefreshToken == refresh) {
+				t.Fatal("old session was not replaced")
+			}
+
+			if !tt.renewed && tokens.RefreshToken != refresh {
+				t.Fatal("valid session was replaced")
+			}
+		})
+	}
+}
+
+func login(t *testing.T, f *fixture, user domainUser.User) domainAuth.Tokens {
+	t.Helper()
+
+	tokens, err := f.auth.Login(context.Background(), domainAuth.LoginDto{Email: user.Email, Password: testPassword, UserAgent: userAgent})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tokens
+}
+
+// Stores a session with the access token expiring at the time
+func insertSession(t *testing.T, f *fixture, user domainUser.User, accessExpiresAt time.Time) string {
+	t.Helper()
+
+	access, refresh := (&ajwt.JWT{
+		Secret:           testSecret,
+		UserId:           int(user.Id),
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshExpiresAt: time.Now().Add(time.Hour),
+	}).NewPairTokens()
+
+	_, err := f.store.Auths.InsertAuth(context.Background(), domainAuth.Auth{
+		UserId:       user.Id,
+		AccessToken:  access,
+		RefreshToken: refresh,
+		UserAgent:    userAgent,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return refresh
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	domainAuth "apibgo/internal/domain/auth"
+	"apibgo/internal/repository"
+	"apibgo/pkg/auth/device"
+	"apibgo/pkg/geoip"
+)
+
+// Modes of the login confirmation by a mailed code
+const (
+	// Logins aren't confirmed, new devices are only told of by a mail
+	LoginConfirmOff = "off"
+	// Logins from a new country or too far from the last one are confirmed
+	LoginConfirmSuspicious = "suspicious"
+	// Logins from every new device are confirmed
+	LoginConfirmNewDevice = "new_device"
+)
+
+// Faster than an airliner the user can't get from the last place
+const maxTravelSpeed = 1000.0 // km/h
+
+// Nearer places are skipped, the locations of the GeoIP are inexact
+const minTravelDistance = 100.0 // km
+
+// The device of a login compared with the devices the user logged in from
+type deviceCheck struct {
+	// The device to remember after the login
+	device domainAuth.KnownDevice
+	// Where the login is from, empty when it's unknown
+	location geoip.Location
+	// The device is remembered already
+	known bool
+	// The user has no remembered devices, it's the first login
+	first bool
+	// The login is from a country the user never logged in from or
+	// the user couldn't get there since the last login
+	suspicious bool
+}
+
+// Compares the device and the place of the login with the known devices of the user
+func (o options) checkDevice(ctx context.Context, devices repository.DeviceRepository, userId uint, dto domainAuth.LoginDto) (deviceCheck, error) {
+	known, err := devices.GetDevices(ctx, int(userId))
+
+	if err != nil {
+		return deviceCheck{}, err
+	}
+
+	location, _ := o.geoDB.Lookup(dto.Ip)
+
+	check := deviceCheck{
+		device: domainAuth.KnownDevice{
+			UserId:      userId,
+			Fingerprint: device.Fingerprint(dto.UserAgent, dto.Ip, dto.DeviceId),
+			Name:        device.Parse(dto.UserAgent, dto.Hints).Name(),
+			Ip:          sql.NullString{String: dto.Ip, Valid: dto.Ip != ""},
+			Country:     location.Country,
+			Latitude:    sql.NullFloat64{Float64: location.Latitude, Valid: location.Located},
+			Longitude:   sql.NullFloat64{Float64: location.Longitude, Valid: location.Located},
+		},
+		location: location,
+		first:    len(known) == 0,
+	}
+
+	var last *domainAuth.KnownDevice
+	newCountry := location.Country != ""
+
+	for i, kd := range known {
+		if kd.Fingerprint == check.device.Fingerprint {
+			check.known = true
+		}
+
+		if kd.Country == location.Country {
+			newCountry = false
+		}
+
+		if kd.Latitude.Valid && (last == nil || kd.LastSeenAt.After(last.LastSeenAt)) {
+			last = &known[i]
+		}
+	}
+
+	if check.known || check.first {
+		return check, nil
+	}
+
+	check.suspicious = newCountry || (last != nil && location.Located && impossibleTravel(*last, location))
+
+	return check, nil
+}
+
+// Whether the user got from the place of the device to the location too fast
+func impossibleTravel(from domainAuth.KnownDevice, to geoip.Location) bool {
+	distance := geoip.Distance(geoip.Location{Latitude: from.Latitude.Float64, Longitude: from.Longitude.Float64}, to)
+
+	if distance < minTravelDistance {
+		return false
+	}
+
+	hours := time.Since(from.LastSeenAt).Hours()
+
+	return hours <= 0 || distance/hours > maxTravelSpeed
+}
+
+// Whether the login is confirmed by a mailed code in the mode, the first
+// device of the user is trusted as the email was confirmed by the activation
+func (c deviceCheck) needsConfirm(mode string) bool {
+	switch mode {
+	case LoginConfirmNewDevice:
+		return !c.known && !c.first
+	case LoginConfirmSuspicious:
+		return c.suspicious
+	default:
+		return false
+	}
+}
+
+// The details of the device in mails, the place is added when it's known
+func (c deviceCheck) detail(dto domainAuth.LoginDto) string {
+	info := device.Parse(dto.UserAgent, dto.Hints)
+	detail := []string{info.OSName(), info.BrowserName(), dto.Ip}
+
+	if c.location.City != "" {
+		detail = append(detail, c.location.City)
+	}
+
+	if c.location.Country != "" {
+		detail = append(detail, c.location.Country)
+	}
+
+	return strings.Join(detail, ",")
+}
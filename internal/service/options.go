@@ -0,0 +1,144 @@
+package service
+
+import (
+	"time"
+
+	"apibgo/internal/domain"
+	"apibgo/pkg/auth/pswd"
+	"apibgo/pkg/auth/revoke"
+	"apibgo/pkg/geoip"
+)
+
+// Option configures a service. The services are made for every request,
+// so the application makes the options once and the shared state, like
+// the revocation store and the activity, is passed to all of them.
+type Option func(*options)
+
+// Settings of the services, the zero options of the constructors are
+// the defaults
+type options struct {
+	adminGroups    map[int]bool
+	deletionGrace  time.Duration
+	emailRevertURL string
+	emailRevertTTL time.Duration
+	loginConfirm   string
+	geoDB          *geoip.DB
+	revocations    revoke.Store
+	activity       *Activity
+	hasher         pswd.Hasher
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		adminGroups:    map[int]bool{},
+		deletionGrace:  defaultDeletionGrace,
+		emailRevertURL: defaultEmailRevertURL,
+		emailRevertTTL: defaultEmailRevertTTL,
+		loginConfirm:   LoginConfirmOff,
+		hasher:         pswd.DefaultHasher(),
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// Tokens revoked by a service without the store are seen only by it
+	if o.revocations == nil {
+		o.revocations = revoke.NewMemory()
+	}
+
+	if o.activity == nil {
+		o.activity = NewActivity()
+	}
+
+	return o
+}
+
+// WithAdminGroups sets the groups of users who manage other users
+func WithAdminGroups(groups ...int) Option {
+	return func(o *options) {
+		o.adminGroups = make(map[int]bool, len(groups))
+
+		for _, group := range groups {
+			o.adminGroups[group] = true
+		}
+	}
+}
+
+// WithDeletionGrace sets the time a deleted account can be restored in,
+// then it's anonymized. It's told to the user in the mail of the deleting.
+func WithDeletionGrace(grace time.Duration) Option {
+	return func(o *options) {
+		if grace > 0 {
+			o.deletionGrace = grace
+		}
+	}
+}
+
+// WithEmailRevertURL sets the page the mail about a changed email links to,
+// the id of the user and the token are added to its query
+func WithEmailRevertURL(link string) Option {
+	return func(o *options) {
+		if link != "" {
+			o.emailRevertURL = link
+		}
+	}
+}
+
+// WithEmailRevertTTL sets how long the link of the mail about a changed
+// email reverts the change
+func WithEmailRevertTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		if ttl > 0 {
+			o.emailRevertTTL = ttl
+		}
+	}
+}
+
+// WithLoginConfirm sets which logins are confirmed by a mailed code,
+// unknown modes turn the confirmation off
+func WithLoginConfirm(mode string) Option {
+	return func(o *options) {
+		switch mode {
+		case LoginConfirmSuspicious, LoginConfirmNewDevice:
+			o.loginConfirm = mode
+		default:
+			o.loginConfirm = LoginConfirmOff
+		}
+	}
+}
+
+// WithGeoIP sets the database the locations of logins are found by,
+// nil turns the location checks off
+func WithGeoIP(db *geoip.DB) Option {
+	return func(o *options) {
+		o.geoDB = db
+	}
+}
+
+// WithRevocations sets the store of the revoked access tokens, it must be
+// shared by all the services of the application
+func WithRevocations(store revoke.Store) Option {
+	return func(o *options) {
+		o.revocations = store
+	}
+}
+
+// WithActivity sets the activity the requests of users are noted in
+func WithActivity(activity *Activity) Option {
+	return func(o *options) {
+		o.activity = activity
+	}
+}
+
+// WithHasher sets the hasher of new passwords, hashes of other
+// parameters are remade on login
+func WithHasher(hasher pswd.Hasher) Option {
+	return func(o *options) {
+		o.hasher = hasher
+	}
+}
+
+func (o options) isAdmin(actor domain.Actor) bool {
+	return actor.GroupId > 0 && o.adminGroups[actor.GroupId]
+}
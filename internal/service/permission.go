@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"apibgo/internal/domain"
+)
+
+// Fields of users which only admins change, users change the rest of their own
+// fields. Users change their email by the confirm code sent to the new one.
+var adminFields = map[string]bool{
+	"email":          true,
+	"activation":     true,
+	"confirm_status": true,
+	"group_id":       true,
+}
+
+// Whether the actor manages the user with the id: admins manage any user,
+// users only themselves. The zero id is of no user, only admins pass.
+func (o options) manages(actor domain.Actor, userId int) bool {
+	return o.isAdmin(actor) || (userId > 0 && actor.UserId == userId)
+}
+
+// Checks the actor of the context manages the user with the id, the
+// endpoints of all the users are checked with the zero id
+func (o options) checkUser(ctx context.Context, userId int) error {
+	if actor, ok := domain.ActorFrom(ctx); !ok || !o.manages(actor, userId) {
+		return domain.NewError(domain.ErrForbidden, "", "forbidden")
+	}
+
+	return nil
+}
+
+// Checks the actor may change the fields of the user, the forbidden
+// fields are listed in the error
+func (o options) checkPatch(actor domain.Actor, userId int, fields []string) error {
+	if !o.manages(actor, userId) {
+		return domain.NewError(domain.ErrForbidden, "", "forbidden")
+	}
+
+	if o.isAdmin(actor) {
+		return nil
+	}
+
+	forbidden := map[string][]string{}
+
+	for _, field := range fields {
+		if adminFields[field] {
+			forbidden[field] = append(forbidden[field], "only admins change the field")
+		}
+	}
+
+	if len(forbidden) > 0 {
+		err := domain.NewError(domain.ErrForbidden, "", "some fields can't be changed")
+		err.Fields = forbidden
+
+		return err
+	}
+
+	return nil
+}
+
+type presence interface {
+	IsSet() bool
+}
+
+// JSON names of the fields given in the patch
+func patchFields(patch any) []string {
+	var fields []string
+
+	v := reflect.ValueOf(patch)
+
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+
+		if field, ok := v.Field(i).Interface().(presence); ok && field.IsSet() && name != "-" {
+			fields = append(fields, name)
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"apibgo/internal/repository"
+	"apibgo/pkg/auth/ajwt"
+)
+
+// VerifyAccessToken checks the signature, the type and the expiry of the token
+// and that it isn't revoked. It doesn't use the storage of the service, so
+// requests with logged out tokens are rejected before a connection is opened.
+func (ar *AuthService) VerifyAccessToken(ctx context.Context, token string) (bool, error) {
+	return ar.verifyToken(ctx, token, ajwt.TypeAccess)
+}
+
+// Checks the token is valid, of the type and not revoked
+func (ar *AuthService) verifyToken(ctx context.Context, token string, typ string) (bool, error) {
+	claims, err := ajwt.Parse(token, os.Getenv("APP_JWT_SECRET"))
+
+	if err != nil {
+		return false, err
+	}
+
+	if claims.Type != typ {
+		return false, nil
+	}
+
+	// Tokens issued before the ids can't be revoked, they live 15 minutes
+	if claims.ID == "" {
+		return true, nil
+	}
+
+	revoked, err := ar.opts.revocations.IsRevoked(ctx, claims.ID)
+
+	if err != nil {
+		return false, err
+	}
+
+	return !revoked, nil
+}
+
+// Revokes the token for the rest of its lifetime, invalid and expired
+// tokens are valid nowhere already
+func (o options) revokeToken(ctx context.Context, token string) error {
+	claims, err := ajwt.Parse(token, os.Getenv("APP_JWT_SECRET"))
+
+	if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	ttl := time.Until(claims.ExpiresAt.Time)
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	return o.revocations.Revoke(ctx, claims.ID, ttl)
+}
+
+// Revokes the tokens of the deleted sessions. The sessions are deleted in
+// transactions, so it's called after the commit: the tokens of a rolled
+// back deleting stay valid.
+func (o options) revokeTokens(ctx context.Context, tokens []string) error {
+	for _, token := range tokens {
+		if err := o.revokeToken(ctx, token); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Deletes the sessions of the user but the excepted ones, the access tokens
+// of the deleted sessions are returned for revokeTokens
+func deleteUserAuths(ctx context.Context, repos repository.Repos, userId int, except ...int) ([]string, error) {
+	auths, err := repos.Auths.GetUserAuths(ctx, userId, except...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := repos.Auths.DeleteUserAuths(ctx, userId, except...); err != nil {
+		return nil, err
+	}
+
+	tokens := make([]string, 0, len(auths))
+
+	for _, auth := range auths {
+		tokens = append(tokens, auth.AccessToken)
+	}
+
+	return tokens, nil
+}
@@ -3,517 +3,592 @@ package service
 import (
 	"context"
 	"database/sql"
-	"fmt"
-	"net/http"
-	"os"
-	"strconv"
+	"errors"
 	"strings"
+	"time"
 
+	"apibgo/internal/domain"
 	domainAuth "apibgo/internal/domain/auth"
 	domainUser "apibgo/internal/domain/user"
 	"apibgo/internal/repository"
-	"apibgo/internal/storage/pgsql"
 	"apibgo/internal/utils/auth/generate"
-	"apibgo/internal/utils/response"
-	"apibgo/pkg/auth/ajwt"
-	"apibgo/pkg/auth/device"
-	"apibgo/pkg/auth/pswd"
-
-	"github.com/jackc/pgx/v5"
 )
 
 type Users interface {
-	GetUser(ctx context.Context, dto domainUser.UserDto) (*response.Response, error)
-	GetUsers(ctx context.Context) (*response.Response, error)
-	CreateUser(ctx context.Context, dto domainUser.UserDto) (*response.Response, error)
-	UpdateUser(ctx context.Context, dto domainUser.UserDto) (*response.Response, error)
-	DeleteUser(ctx context.Context, user_id int) (*response.Response, error)
-	Sessions(ctx context.Context, header_auth []string) (*response.Response, error)
+	GetUser(ctx context.Context, dto domainUser.UserDto) (domainUser.User, error)
+	GetUsers(ctx context.Context, dto domainUser.ListDto) (domain.Page[domainUser.User], error)
+	SearchUsers(ctx context.Context, dto domainUser.SearchDto) ([]domainUser.Match, error)
+	CreateUser(ctx context.Context, dto domainUser.CreateUserDto) (domainUser.User, error)
+	PatchUser(ctx context.Context, dto domainUser.PatchUserDto) (domainUser.User, error)
+	DeleteUser(ctx context.Context, user_id int, versions domain.Versions) error
+	RestoreUser(ctx context.Context, user_id int) (domainUser.User, error)
+	BanUser(ctx context.Context, dto domainUser.BanDto) (domainUser.Ban, error)
+	AnonymizeUsers(ctx context.Context, grace time.Duration) (int64, error)
+	PurgeUsers(ctx context.Context, retention time.Duration) (int64, error)
+	Sessions(ctx context.Context, dto domainAuth.SessionDto) (domain.Page[domainAuth.Auth], error)
+	LoginHistory(ctx context.Context, dto domainAuth.EventDto) (domain.Page[domainAuth.LoginEvent], error)
+	DestroySession(ctx context.Context, user_id int, session_id int) error
+	DestroyOtherSessions(ctx context.Context, user_id int, session_id int) (int64, error)
+	RenameSession(ctx context.Context, dto domainAuth.RenameDto) error
 }
 
+var _ Users = (*UserService)(nil)
+
+var (
+	errUserNotFound = domain.NewError(domain.ErrNotFound, "", "user not found")
+	errUserExists   = domain.NewError(domain.ErrConflict, domain.ReasonAccountExists, "user with this email address already exists")
+	errUserChanged  = domain.NewError(domain.ErrPrecondition, domain.ReasonVersionMismatch, "user was changed by another request")
+	errUserAlive    = domain.NewError(domain.ErrConflict, "", "user is not deleted")
+)
+
 type UserService struct {
-	db *pgsql.Storage
+	store repository.Store
+	opts  options
 }
 
-func NewUserService(store *pgsql.Storage) *UserService {
+func NewUserService(store repository.Store, opts ...Option) *UserService {
 	return &UserService{
-		db: store,
+		store: store,
+		opts:  newOptions(opts),
 	}
-
 }
 
-func (ur *UserService) GetUser(ctx context.Context, dto domainUser.UserDto) (*response.Response, error) {
+// GetUser returns the user to admins and to the user
+func (ur *UserService) GetUser(ctx context.Context, dto domainUser.UserDto) (domainUser.User, error) {
+	if err := ur.opts.checkUser(ctx, dto.Id); err != nil {
+		return domainUser.User{}, err
+	}
+
 	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ur.db)
+	repoUser := ur.store.Users
 	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Id: dto.Id})
 
 	if err != nil {
-		return nil, err
+		return domainUser.User{}, err
 	}
 
-	if user.Id > 0 {
-		return &response.Response{
-			Code:    response.ErrorEmpty,
-			Status:  response.StatusSuccess,
-			Message: "data is got",
-			Result: map[string]interface{}{
-				"email":      user.Email,
-				"name":       user.Name.String,
-				"surname":    user.Surname.String,
-				"activation": user.Activation,
-				"status":     user.ConfirmStatus,
-			},
-		}, nil
+	if user.Id <= 0 {
+		return domainUser.User{}, errUserNotFound
 	}
 
-	return nil, nil
+	return user, nil
 }
 
-func (ur *UserService) GetUsers(ctx context.Context) (*response.Response, error) {
-	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ur.db)
-	users, err := repoUser.GetUsers(ctx)
+// GetUsers returns the page of the filtered users to admins, an empty page isn't an error
+func (ur *UserService) GetUsers(ctx context.Context, dto domainUser.ListDto) (domain.Page[domainUser.User], error) {
+	if err := ur.opts.checkUser(ctx, 0); err != nil {
+		return domain.Page[domainUser.User]{}, err
+	}
 
-	if err != nil {
+	return ur.store.Users.GetUsers(ctx, dto)
+}
+
+// SearchUsers returns the best matches of the text to admins, nothing found isn't an error
+func (ur *UserService) SearchUsers(ctx context.Context, dto domainUser.SearchDto) ([]domainUser.Match, error) {
+	if err := ur.opts.checkUser(ctx, 0); err != nil {
 		return nil, err
 	}
 
-	count, err := repoUser.GetCountUsers(ctx)
+	return ur.store.Users.SearchUsers(ctx, dto)
+}
+
+// CreateUser adds the user, only admins create users
+func (ur *UserService) CreateUser(ctx context.Context, dto domainUser.CreateUserDto) (domainUser.User, error) {
+	if err := ur.opts.checkUser(ctx, 0); err != nil {
+		return domainUser.User{}, err
+	}
+
+	// Generate codes and strings
+	pwd_hash, err := ur.opts.hasher.Hash(dto.Password)
+	tokenSecret, err2 := generate.RandomStringBytes(32)
 
 	if err != nil {
-		return nil, err
+		return domainUser.User{}, err
+	}
+
+	if err2 != nil {
+		return domainUser.User{}, err2
 	}
 
-	if len(users) > 0 {
-		var respUsers []map[string]interface{}
+	var user domainUser.User
+
+	err = ur.store.WithTx(ctx, func(tx repository.Repos) error {
+		// Trying find a user in the users table
+		exists, err := tx.Users.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
+
+		if err != nil {
+			return err
+		}
+
+		if exists.Id > 0 {
+			return errUserExists
+		}
+
+		// Inserting in users
+		user, err = tx.Users.InsertUser(ctx, domainUser.User{
+			Email:          dto.Email,
+			Password:       pwd_hash,
+			Name:           sql.NullString{String: dto.Name},
+			Surname:        sql.NullString{String: dto.Surname},
+			ConfirmStatus:  domainUser.ConfirmStatusEnum(dto.ConfirmStatus),
+			TokenSecretKey: tokenSecret,
+		})
+
+		if err != nil {
+			return err
+		}
 
-		for _, user := range users {
-			respUsers = append(respUsers, map[string]interface{}{
-				"id":         user.Id,
-				"email":      user.Email,
-				"name":       user.Name.String,
-				"surname":    user.Surname.String,
-				"activation": user.Activation,
-				"status":     user.ConfirmStatus,
-			})
+		if user.Id <= 0 {
+			return errors.New("service: the user was not created")
 		}
 
-		return &response.Response{
-			Code:    response.ErrorEmpty,
-			Status:  response.StatusSuccess,
-			Message: "data is got",
-			Result: map[string]interface{}{
-				"count": count,
-				"data":  respUsers,
-			},
-		}, nil
+		return nil
+	})
+
+	if err != nil {
+		return domainUser.User{}, err
 	}
 
-	return nil, nil
+	return user, nil
 }
 
-func (ur *UserService) CreateUser(ctx context.Context, dto domainUser.CreateUserDto) (*response.Response, error) {
-	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ur.db)
-	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
+// PatchUser applies the patch of the actor of the context and returns the
+// updated user. Users patch themselves, admins patch anyone and all the fields.
+func (ur *UserService) PatchUser(ctx context.Context, dto domainUser.PatchUserDto) (domainUser.User, error) {
+	actor, ok := domain.ActorFrom(ctx)
+
+	if !ok {
+		return domainUser.User{}, domain.NewError(domain.ErrUnauthorized, "", "unknown actor")
+	}
+
+	if err := ur.opts.checkPatch(actor, dto.Id, patchFields(dto)); err != nil {
+		return domainUser.User{}, err
+	}
+
+	changes, err := ur.opts.userChanges(dto)
 
 	if err != nil {
-		return nil, err
+		return domainUser.User{}, err
 	}
 
-	if user.Id <= 0 {
-		// If don't match passwords
-		if dto.Password != dto.ConfirmPassword {
-			return &response.Response{
-				Code:    response.ErrorAccountConfirmPassword,
-				Status:  response.StatusError,
-				Message: "don't match passwords",
-			}, nil
+	var updUser domainUser.User
+	var revoked []string
+
+	err = ur.store.WithTx(ctx, func(tx repository.Repos) error {
+		// Trying find a user in the users table
+		if email, ok := dto.Email.Get(); ok {
+			user, err := tx.Users.GetUser(ctx, domainUser.UserDto{Email: email})
+
+			if err != nil {
+				return err
+			}
+
+			if user.Id > 0 && user.Id != uint(dto.Id) {
+				return errUserExists
+			}
 		}
 
-		// Generate codes and strings
-		pwd_hash, err := pswd.HashPassword(dto.Password)
-		tokenSecret, err2 := generate.RandomStringBytes(32)
+		user, err := tx.Users.GetUser(ctx, domainUser.UserDto{Id: dto.Id})
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		if err2 != nil {
-			return nil, err2
+		if user.Id <= 0 {
+			return errUserNotFound
 		}
 
-		// start transaction
-		tx, err := ur.db.Db.BeginTx(ctx, pgx.TxOptions{})
+		version, ok := dto.Versions.Match(user.Version)
 
-		if err != nil {
-			return nil, err
+		if !ok {
+			return errUserChanged
 		}
 
-		defer func() {
-			if err != nil {
-				tx.Rollback(ctx)
-			}
-		}()
+		// An empty patch changes nothing
+		if changes == (domainUser.Changes{}) {
+			updUser = user
+			return nil
+		}
 
-		// Inserting in users
-		args := []interface{}{dto.Email, pwd_hash, dto.Name, dto.Surname, "", "", domainUser.ConfirmStatusEnum(dto.ConfirmStatus), tokenSecret}
-		user, err := repoUser.InsertUser(ctx, args)
+		updated, cmdtag, err := tx.Users.UpdateUser(ctx, int(user.Id), version, changes)
 
 		if err != nil {
-			tx.Rollback(ctx)
-
-			return nil, err
+			return err
 		}
 
-		// If successfully, then we return the Response
-		if user.Id > 0 {
-			tx.Commit(ctx)
-
-			return &response.Response{
-				Code:    response.ErrorEmpty,
-				Status:  response.StatusSuccess,
-				Message: "user created successfully",
-				Result: map[string]interface{}{
-					"id":         user.Id,
-					"email":      user.Email,
-					"name":       user.Name.String,
-					"surname":    user.Surname.String,
-					"activation": user.Activation,
-					"status":     user.ConfirmStatus,
-				},
-				HttpCode: http.StatusCreated,
-			}, nil
-		} else {
-			tx.Rollback(ctx)
-
-			return &response.Response{
-				Code:    response.ErrorAccountNotCreated,
-				Status:  response.StatusError,
-				Message: "failed, the user was not created",
-			}, nil
-		}
-	}
-
-	return &response.Response{
-		Code:    response.ErrorAccountExists,
-		Status:  response.StatusError,
-		Message: "user with this email address already exists",
-	}, nil
-}
+		// The user was changed after it was read
+		if cmdtag.RowsAffected() <= 0 && version > 0 {
+			return errUserChanged
+		}
 
-func (ur *UserService) UpdateUser(ctx context.Context, dto domainUser.UpdateUserDto) (*response.Response, error) {
-	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ur.db)
+		if cmdtag.RowsAffected() <= 0 {
+			return errNotAffected
+		}
 
-	if dto.Email != "" {
-		user, err := repoUser.GetUser(ctx, domainUser.UserDto{Email: dto.Email})
+		updUser = updated
 
-		if err != nil {
-			return nil, err
+		if !changes.Password.IsSet() {
+			return nil
 		}
 
-		if user.Id > 0 && user.Id != uint(dto.Id) {
-			return &response.Response{
-				Code:    response.ErrorAccountExists,
-				Status:  response.StatusError,
-				Message: "user with this email address already exists",
-			}, nil
+		// A new password closes the sessions, the own one of the actor is kept
+		var except []int
+
+		if actor.UserId == dto.Id && actor.SessionId > 0 {
+			except = append(except, actor.SessionId)
 		}
-	}
 
-	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Id: dto.Id})
+		revoked, err = deleteUserAuths(ctx, tx, int(user.Id), except...)
+
+		return err
+	})
 
 	if err != nil {
-		return nil, err
+		return domainUser.User{}, err
 	}
 
-	if user.Id > 0 {
-		var pwd_hash string
+	if err := ur.opts.revokeTokens(ctx, revoked); err != nil {
+		return domainUser.User{}, err
+	}
 
-		if dto.Password != "" && dto.ConfirmPassword != "" {
-			// If don't match passwords
-			if dto.Password != dto.ConfirmPassword {
-				return &response.Response{
-					Code:    response.ErrorAccountConfirmPassword,
-					Status:  response.StatusError,
-					Message: "don't match passwords",
-				}, nil
-			}
+	return updUser, nil
+}
 
-			// Generate password
-			pwd_hash, err = pswd.HashPassword(dto.Password)
+// The changes of the patch, fields which can't be null are checked
+// here as the validation of the request can't tell null from absence
+func (o options) userChanges(dto domainUser.PatchUserDto) (domainUser.Changes, error) {
+	invalid := map[string][]string{}
+	required := map[string]bool{
+		"email":          dto.Email.Null,
+		"password":       dto.Password.Null,
+		"activation":     dto.Activation.Null,
+		"confirm_status": dto.ConfirmStatus.Null,
+		"group_id":       dto.GroupId.Null || (dto.GroupId.Set && dto.GroupId.Value <= 0),
+	}
 
-			if err != nil {
-				return nil, err
-			}
+	for field, isNull := range required {
+		if isNull {
+			invalid[field] = append(invalid[field], "the "+field+" field must not be empty")
 		}
+	}
+
+	if dto.Password.Set && !dto.ConfirmPassword.Set {
+		invalid["confirm_password"] = append(invalid["confirm_password"], "the confirm_password field is required when password is present")
+	}
+
+	if len(invalid) > 0 {
+		err := domain.NewError(domain.ErrValidation, "", "validation error")
+		err.Fields = invalid
+
+		return domainUser.Changes{}, err
+	}
+
+	changes := domainUser.Changes{
+		Email:      dto.Email,
+		Name:       dto.Name,
+		Surname:    dto.Surname,
+		Locale:     dto.Locale,
+		Timezone:   dto.Timezone,
+		Activation: dto.Activation,
+	}
 
-		// start transaction
-		tx, err := ur.db.Db.BeginTx(ctx, pgx.TxOptions{})
+	if status, ok := dto.ConfirmStatus.Get(); ok {
+		changes.ConfirmStatus = domain.Some(domainUser.ConfirmStatusEnum(strings.ToLower(status)))
+	}
+
+	if group, ok := dto.GroupId.Get(); ok {
+		changes.GroupId = domain.Some(uint(group))
+	}
+
+	if password, ok := dto.Password.Get(); ok {
+		// Generate password
+		pwd_hash, err := o.hasher.Hash(password)
 
 		if err != nil {
-			return nil, err
+			return domainUser.Changes{}, err
 		}
 
-		defer func() {
-			if err != nil {
-				tx.Rollback(ctx)
-			}
-		}()
+		changes.Password = domain.Some(pwd_hash)
+	}
+
+	return changes, nil
+}
+
+// DeleteUser deletes the user of one of the versions, none deletes any version.
+// Admins delete any user, users only themselves. The user is kept for the
+// restoring until the purge, the sessions are revoked at once.
+func (ur *UserService) DeleteUser(ctx context.Context, user_id int, versions domain.Versions) error {
+	if err := ur.opts.checkUser(ctx, user_id); err != nil {
+		return err
+	}
+
+	var revoked []string
+
+	err := ur.store.WithTx(ctx, func(tx repository.Repos) error {
+		// Trying find a user in the users table
+		user, err := tx.Users.GetUser(ctx, domainUser.UserDto{Id: user_id})
 
-		modelUser := &domainUser.User{
-			Activation: dto.Activation,
+		if err != nil {
+			return err
 		}
 
-		if dto.Email != "" {
-			modelUser.Email = dto.Email
+		if user.Id <= 0 {
+			return errUserNotFound
 		}
 
-		if len(pwd_hash) > 5 {
-			modelUser.Password = pwd_hash
+		version, ok := versions.Match(user.Version)
+
+		if !ok {
+			return errUserChanged
 		}
 
-		if dto.Name != "" {
-			modelUser.Name = sql.NullString{String: dto.Name}
+		cmdtag, err := tx.Users.DeleteUser(ctx, int(user.Id), version)
+
+		if err != nil {
+			return err
 		}
 
-		if dto.Surname != "" {
-			modelUser.Surname = sql.NullString{String: dto.Surname}
+		if cmdtag.RowsAffected() <= 0 && version > 0 {
+			return errUserChanged
 		}
 
-		if dto.ConfirmStatus != "" {
-			modelUser.ConfirmStatus = domainUser.ConfirmStatusEnum(dto.ConfirmStatus)
+		if cmdtag.RowsAffected() <= 0 {
+			return errNotAffected
 		}
 
-		updUser, cmdtag, err := repoUser.UpdateUser(ctx, int(user.Id), modelUser)
+		revoked, err = deleteUserAuths(ctx, tx, int(user.Id))
 
-		if err != nil {
-			tx.Rollback(ctx)
+		return err
+	})
 
-			return nil, err
+	if err != nil {
+		return err
+	}
+
+	return ur.opts.revokeTokens(ctx, revoked)
+}
+
+// RestoreUser returns the deleted user, only admins restore users
+func (ur *UserService) RestoreUser(ctx context.Context, user_id int) (domainUser.User, error) {
+	if err := ur.opts.checkUser(ctx, 0); err != nil {
+		return domainUser.User{}, err
+	}
+
+	var restored domainUser.User
+
+	err := ur.store.WithTx(ctx, func(tx repository.Repos) error {
+		user, cmdtag, err := tx.Users.RestoreUser(ctx, user_id)
+
+		if err != nil {
+			return err
 		}
 
-		if cmdtag.RowsAffected() <= 0 {
-			tx.Rollback(ctx)
+		if cmdtag.RowsAffected() > 0 {
+			restored = user
+			return nil
+		}
 
-			return nil, err
-		} else {
-			tx.Commit(ctx)
+		// Nothing is restored for the alive or missing user
+		if user, err = tx.Users.GetUser(ctx, domainUser.UserDto{Id: user_id}); err != nil {
+			return err
+		}
 
-			return &response.Response{
-				Code:    response.ErrorEmpty,
-				Status:  response.StatusSuccess,
-				Message: "user data updated successfully",
-				Result: map[string]interface{}{
-					// "id":         updUser.Id,
-					"email":      updUser.Email,
-					"name":       updUser.Name.String,
-					"surname":    updUser.Surname.String,
-					"activation": updUser.Activation,
-					"status":     updUser.ConfirmStatus,
-				},
-			}, nil
+		if user.Id > 0 {
+			return errUserAlive
 		}
+
+		return errUserNotFound
+	})
+
+	if err != nil {
+		return domainUser.User{}, err
 	}
 
-	return nil, nil
+	return restored, nil
 }
 
-func (ur *UserService) DeleteUser(ctx context.Context, user_id int) (*response.Response, error) {
-	// Trying find a user in the users table
-	repoUser := repository.NewUserRepo(ur.db)
-	user, err := repoUser.GetUser(ctx, domainUser.UserDto{Id: user_id})
+// BanUser bans the user, closes all the sessions and revokes their tokens,
+// only admins ban users
+func (ur *UserService) BanUser(ctx context.Context, dto domainUser.BanDto) (domainUser.Ban, error) {
+	if err := ur.opts.checkUser(ctx, 0); err != nil {
+		return domainUser.Ban{}, err
+	}
 
-	if err != nil {
-		return nil, err
+	if !dto.ExpiredAt.IsZero() && !dto.ExpiredAt.After(time.Now()) {
+		err := domain.NewError(domain.ErrValidation, "", "validation error")
+		err.Fields = map[string][]string{"expired_at": {"the expired_at field must be in the future"}}
+
+		return domainUser.Ban{}, err
 	}
 
-	if user.Id > 0 {
-		// start transaction
-		tx, err := ur.db.Db.BeginTx(ctx, pgx.TxOptions{})
+	var ban domainUser.Ban
+	var revoked []string
+
+	err := ur.store.WithTx(ctx, func(tx repository.Repos) error {
+		user, err := tx.Users.GetUser(ctx, domainUser.UserDto{Id: dto.UserId})
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		defer func() {
-			if err != nil {
-				tx.Rollback(ctx)
-			}
-		}()
+		if user.Id <= 0 {
+			return errUserNotFound
+		}
 
-		cmdtag, err := repoUser.DeleteUser(ctx, int(user.Id))
+		ban, err = tx.Bans.InsertBan(ctx, domainUser.Ban{
+			UserId:    user.Id,
+			ReasonId:  uint(dto.ReasonId),
+			ExpiredAt: sql.NullTime{Time: dto.ExpiredAt, Valid: !dto.ExpiredAt.IsZero()},
+		})
 
 		if err != nil {
-			tx.Rollback(ctx)
-
-			return nil, err
+			return err
 		}
 
-		if cmdtag.RowsAffected() <= 0 {
-			tx.Rollback(ctx)
+		revoked, err = deleteUserAuths(ctx, tx, int(user.Id))
 
-			return nil, err
-		} else {
-			tx.Commit(ctx)
+		return err
+	})
 
-			return &response.Response{
-				Code:    response.ErrorEmpty,
-				Status:  response.StatusSuccess,
-				Message: "user deleted successfully",
-			}, nil
-		}
+	if err != nil {
+		return domainUser.Ban{}, err
 	}
 
-	return nil, nil
+	if err := ur.opts.revokeTokens(ctx, revoked); err != nil {
+		return domainUser.Ban{}, err
+	}
+
+	return ban, nil
 }
 
-func (ur *UserService) Sessions(ctx context.Context, header_auth []string) (*response.Response, error) {
-	// Parse header Authorization and get token
-	split := strings.Split(header_auth[0], " ")
-	token := split[1]
+// AnonymizeUsers clears the personal data of the users deleted longer than
+// the grace ago, they can't be restored after that
+func (ur *UserService) AnonymizeUsers(ctx context.Context, grace time.Duration) (int64, error) {
+	var anonymized int64
 
-	// Checking on correct JWT
-	if _, err := ajwt.IsJWT(token, os.Getenv("APP_JWT_SECRET")); err != nil {
-		return nil, err
+	err := ur.store.WithTx(ctx, func(tx repository.Repos) (err error) {
+		anonymized, err = tx.Users.AnonymizeUsers(ctx, grace)
+		return err
+	})
+
+	return anonymized, err
+}
+
+// PurgeUsers removes the users deleted longer than the retention ago
+func (ur *UserService) PurgeUsers(ctx context.Context, retention time.Duration) (int64, error) {
+	var purged int64
+
+	err := ur.store.WithTx(ctx, func(tx repository.Repos) (err error) {
+		purged, err = tx.Users.PurgeUsers(ctx, retention)
+		return err
+	})
+
+	return purged, err
+}
+
+// Sessions returns the page of the sessions of the user with the dto id
+func (ur *UserService) Sessions(ctx context.Context, dto domainAuth.SessionDto) (domain.Page[domainAuth.Auth], error) {
+	if err := ur.opts.checkUser(ctx, dto.Id); err != nil {
+		return domain.Page[domainAuth.Auth]{}, err
 	}
 
-	payload, err := ajwt.GetClaims(token, os.Getenv("APP_JWT_SECRET"))
+	return ur.store.Auths.GetSessions(ctx, dto)
+}
 
-	if err != nil {
-		return nil, err
+// LoginHistory returns the page of the login events of the user with the dto id
+func (ur *UserService) LoginHistory(ctx context.Context, dto domainAuth.EventDto) (domain.Page[domainAuth.LoginEvent], error) {
+	if err := ur.opts.checkUser(ctx, dto.UserId); err != nil {
+		return domain.Page[domainAuth.LoginEvent]{}, err
 	}
 
-	user_id, _ := strconv.Atoi(fmt.Sprintf("%v", payload["user_id"]))
+	return ur.store.Events.GetLoginEvents(ctx, dto)
+}
 
-	if user_id > 0 {
-		repoAuth := repository.NewAuthRepo(ur.db)
-		auths, err := repoAuth.GetSessions(context.Background(), domainAuth.SessionDto{
-			Id: user_id,
-		})
+func (ur *UserService) DestroySession(ctx context.Context, user_id int, session_id int) error {
+	if err := ur.opts.checkUser(ctx, user_id); err != nil {
+		return err
+	}
+
+	var revoked []string
+
+	err := ur.store.WithTx(ctx, func(tx repository.Repos) error {
+		// Trying find the session of the user
+		auth, err := tx.Auths.GetAuth(ctx, domainAuth.AuthDto{Id: session_id, UserId: user_id})
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		count, err := repoAuth.GetCountSessions(context.Background(), domainAuth.SessionDto{
-			Id: user_id,
-		})
+		if auth.Id <= 0 {
+			return domain.NewError(domain.ErrForbidden, "", "forbidden")
+		}
+
+		// Deleting session
+		cmdtag, err := tx.Auths.DeleteAuth(ctx, domainAuth.DestroyDto{Id: int(auth.Id)})
 
 		if err != nil {
-			return nil, err
-		}
-
-		if len(auths) > 0 {
-			var respAuths []map[string]interface{}
-
-			for _, auth := range auths {
-				respAuths = append(respAuths, map[string]interface{}{
-					"id": auth.Id,
-					"ip": auth.Ip,
-					"device": map[string]string{
-						"name": auth.Device,
-						"info": strings.Join([]string{device.DetectOS(auth.UserAgent), device.DetectBrowser(auth.UserAgent)}, ","),
-					},
-					"time": auth.CreatedAt.Format("02-01-2006 15:04:05"),
-				})
-			}
+			return err
+		}
 
-			return &response.Response{
-				Code:    response.ErrorEmpty,
-				Status:  response.StatusSuccess,
-				Message: "data is got",
-				Result: map[string]interface{}{
-					"count": count,
-					"data":  respAuths,
-				},
-			}, nil
-		} else {
-			return &response.Response{
-				Code:     response.ErrorPermissionForbidden,
-				Status:   response.StatusError,
-				Message:  "forbidden",
-				HttpCode: http.StatusForbidden,
-			}, nil
-		}
-	}
-
-	return nil, nil
-}
+		if cmdtag.RowsAffected() <= 0 {
+			return errNotAffected
+		}
 
-func (ur *UserService) DestroySession(ctx context.Context, header_auth []string, session_id int) (*response.Response, error) {
-	// Parse header Authorization and get token
-	split := strings.Split(header_auth[0], " ")
-	token := split[1]
+		revoked = []string{auth.AccessToken}
 
-	// Checking on correct JWT
-	if _, err := ajwt.IsJWT(token, os.Getenv("APP_JWT_SECRET")); err != nil {
-		return nil, err
+		return nil
+	})
+
+	if err != nil {
+		return err
 	}
 
-	payload, err := ajwt.GetClaims(token, os.Getenv("APP_JWT_SECRET"))
+	return ur.opts.revokeTokens(ctx, revoked)
+}
 
-	if err != nil {
-		return nil, err
+// DestroyOtherSessions revokes all the sessions of the user but the one
+// with the id, 0 revokes all. The number of the revoked sessions is returned.
+func (ur *UserService) DestroyOtherSessions(ctx context.Context, user_id int, session_id int) (int64, error) {
+	if err := ur.opts.checkUser(ctx, user_id); err != nil {
+		return 0, err
 	}
 
-	user_id, _ := strconv.Atoi(fmt.Sprintf("%v", payload["user_id"]))
+	var except []int
 
-	if user_id > 0 {
-		// Trying find a user in the users table
-		repoAuth := repository.NewAuthRepo(ur.db)
-		auth, err := repoAuth.GetAuth(ctx, domainAuth.AuthDto{Id: session_id, UserId: user_id})
+	if session_id > 0 {
+		except = append(except, session_id)
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	var revoked []string
 
-		if auth.Id > 0 {
-			// start transaction
-			tx, err := ur.db.Db.BeginTx(ctx, pgx.TxOptions{})
+	err := ur.store.WithTx(ctx, func(tx repository.Repos) (err error) {
+		revoked, err = deleteUserAuths(ctx, tx, user_id, except...)
 
-			if err != nil {
-				return nil, err
-			}
+		return err
+	})
 
-			defer func() {
-				if err != nil {
-					tx.Rollback(ctx)
-				}
-			}()
+	if err != nil {
+		return 0, err
+	}
 
-			// Deleting session
-			cmdtag, err := repoAuth.DeleteAuth(ctx, domainAuth.DestroyDto{Id: int(auth.Id)})
+	return int64(len(revoked)), ur.opts.revokeTokens(ctx, revoked)
+}
 
-			if err != nil {
-				return nil, err
-			}
+// RenameSession names the session of the user
+func (ur *UserService) RenameSession(ctx context.Context, dto domainAuth.RenameDto) error {
+	if err := ur.opts.checkUser(ctx, dto.UserId); err != nil {
+		return err
+	}
 
-			// If whole successfully, then resets refresh token
-			if cmdtag.RowsAffected() <= 0 {
-				tx.Rollback(ctx)
+	cmdtag, err := ur.store.Auths.RenameAuth(ctx, dto)
 
-				return nil, err
-			} else {
-				tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
 
-				return &response.Response{
-					Code:    response.ErrorEmpty,
-					Status:  response.StatusSuccess,
-					Message: "Session successfully destroyed",
-					Result:  nil,
-				}, nil
-			}
-		} else {
-			return &response.Response{
-				Code:     response.ErrorPermissionForbidden,
-				Status:   response.StatusError,
-				Message:  "forbidden",
-				HttpCode: http.StatusForbidden,
-			}, nil
-		}
+	if cmdtag.RowsAffected() <= 0 {
+		return domain.NewError(domain.ErrForbidden, "", "forbidden")
 	}
 
-	return nil, nil
+	return nil
 }
@@ -0,0 +1,724 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"apibgo/internal/domain"
+	domainAuth "apibgo/internal/domain/auth"
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/service"
+)
+
+// Emails of the users of the page
+func emails(page domain.Page[domainUser.User]) []string {
+	list := []string{}
+
+	for _, user := range page.Items {
+		list = append(list, user.Email)
+	}
+
+	return list
+}
+
+// The group of the admins of the fixtures made with it
+const adminGroup = 7
+
+// The context of a request of an admin, the admin isn't one of the users
+func adminContext() context.Context {
+	return domain.WithActor(context.Background(), domain.Actor{UserId: 1000, GroupId: adminGroup})
+}
+
+func TestGetUsers(t *testing.T) {
+	active, inactive := true, false
+
+	tests := []struct {
+		name   string
+		dto    domainUser.ListDto
+		emails []string
+		total  int
+		next   bool
+		err    error
+	}{
+		{
+			name:   "default page",
+			emails: []string{"ann@example.com", "bob@example.com", "cid@example.com"},
+			total:  3,
+		},
+		{
+			name:   "limit",
+			dto:    domainUser.ListDto{PageDto: domain.PageDto{Limit: 2}},
+			emails: []string{"ann@example.com", "bob@example.com"},
+			total:  3,
+			next:   true,
+		},
+		{
+			name:   "offset",
+			dto:    domainUser.ListDto{PageDto: domain.PageDto{Limit: 2, Offset: 2}},
+			emails: []string{"cid@example.com"},
+			total:  3,
+		},
+		{
+			name:   "descending sort",
+			dto:    domainUser.ListDto{PageDto: domain.PageDto{Sort: "-name"}},
+			emails: []string{"ann@example.com", "cid@example.com", "bob@example.com"},
+			total:  3,
+		},
+		{
+			name:   "activation",
+			dto:    domainUser.ListDto{Activation: &inactive},
+			emails: []string{"cid@example.com"},
+			total:  1,
+		},
+		{
+			name:   "search counts the filtered users",
+			dto:    domainUser.ListDto{PageDto: domain.PageDto{Limit: 1}, Activation: &active, Search: "ZED"},
+			emails: []string{"bob@example.com"},
+			total:  1,
+		},
+		{
+			name:   "empty list isn't an error",
+			dto:    domainUser.ListDto{Search: "nobody"},
+			emails: []string{},
+		},
+		{
+			name: "unknown sort",
+			dto:  domainUser.ListDto{PageDto: domain.PageDto{Sort: "password"}},
+			err:  domain.ErrValidation,
+		},
+		{
+			name: "malformed cursor",
+			dto:  domainUser.ListDto{PageDto: domain.PageDto{Cursor: "bm9wZQ"}},
+			err:  domain.ErrValidation,
+		},
+	}
+
+	f := newFixture(service.WithAdminGroups(adminGroup))
+	f.addUser(t, "ann@example.com", func(u *domainUser.User) { u.Name = sql.NullString{String: "Zoe"} })
+	f.addUser(t, "bob@example.com", func(u *domainUser.User) { u.Name = sql.NullString{String: "Ann"}; u.Surname.String = "Zed" })
+	f.addUser(t, "cid@example.com", func(u *domainUser.User) { u.Name = sql.NullString{String: "Max"}; u.Activation = false })
+
+	users := f.users()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := users.GetUsers(adminContext(), tt.dto)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if tt.err != nil {
+				return
+			}
+
+			if got := emails(page); !equal(got, tt.emails) {
+				t.Errorf("emails = %v, want %v", got, tt.emails)
+			}
+
+			if page.Total != tt.total {
+				t.Errorf("total = %d, want %d", page.Total, tt.total)
+			}
+
+			if (page.Next != "") != tt.next {
+				t.Errorf("next = %q, want next %v", page.Next, tt.next)
+			}
+		})
+	}
+}
+
+func TestGetUsersForAdmins(t *testing.T) {
+	f := newFixture(service.WithAdminGroups(adminGroup))
+	user := f.addUser(t, "ann@example.com", nil)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+	}{
+		{name: "admin", ctx: adminContext()},
+		{name: "user", ctx: domain.WithActor(context.Background(), domain.Actor{UserId: int(user.Id)}), err: domain.ErrForbidden},
+		{name: "no actor", ctx: context.Background(), err: domain.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		if _, err := f.users().GetUsers(tt.ctx, domainUser.ListDto{}); !errors.Is(err, tt.err) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+// Admins call every endpoint of the users, users only the ones of themselves
+func TestUserPermissions(t *testing.T) {
+	f := newFixture(service.WithAdminGroups(adminGroup))
+	ann := f.addUser(t, "ann@example.com", nil)
+	bob := f.addUser(t, "bob@example.com", nil)
+	users := f.users()
+
+	calls := []struct {
+		name string
+		self bool
+		call func(ctx context.Context) error
+	}{
+		{name: "get user", self: true, call: func(ctx context.Context) error {
+			_, err := users.GetUser(ctx, domainUser.UserDto{Id: int(ann.Id)})
+			return err
+		}},
+		{name: "sessions", self: true, call: func(ctx context.Context) error {
+			_, err := users.Sessions(ctx, domainAuth.SessionDto{Id: int(ann.Id)})
+			return err
+		}},
+		{name: "login history", self: true, call: func(ctx context.Context) error {
+			_, err := users.LoginHistory(ctx, domainAuth.EventDto{UserId: int(ann.Id)})
+			return err
+		}},
+		{name: "other sessions destroyed", self: true, call: func(ctx context.Context) error {
+			_, err := users.DestroyOtherSessions(ctx, int(ann.Id), 0)
+			return err
+		}},
+		{name: "list users", call: func(ctx context.Context) error {
+			_, err := users.GetUsers(ctx, domainUser.ListDto{})
+			return err
+		}},
+		{name: "search users", call: func(ctx context.Context) error {
+			_, err := users.SearchUsers(ctx, domainUser.SearchDto{Query: "ann"})
+			return err
+		}},
+		{name: "create user", call: func(ctx context.Context) error {
+			_, err := users.CreateUser(ctx, domainUser.CreateUserDto{Email: "cid@example.com", Password: testPassword, Name: "Cid", Surname: "Doe"})
+			return err
+		}},
+		{name: "ban user", call: func(ctx context.Context) error {
+			_, err := users.BanUser(ctx, domainUser.BanDto{UserId: int(bob.Id), ReasonId: 1})
+			return err
+		}},
+	}
+
+	actors := []struct {
+		name  string
+		ctx   context.Context
+		admin bool
+		self  bool
+	}{
+		{name: "admin", ctx: adminContext(), admin: true},
+		{name: "self", ctx: domain.WithActor(context.Background(), domain.Actor{UserId: int(ann.Id)}), self: true},
+		{name: "other user", ctx: domain.WithActor(context.Background(), domain.Actor{UserId: int(bob.Id)})},
+		{name: "no actor", ctx: context.Background()},
+	}
+
+	for _, call := range calls {
+		for _, actor := range actors {
+			t.Run(call.name+"/"+actor.name, func(t *testing.T) {
+				allowed := actor.admin || (actor.self && call.self)
+
+				if err := call.call(actor.ctx); errors.Is(err, domain.ErrForbidden) == allowed {
+					t.Fatalf("err = %v, want allowed %v", err, allowed)
+				}
+			})
+		}
+	}
+}
+
+func TestGetUsersFollowsCursor(t *testing.T) {
+	f := newFixture(service.WithAdminGroups(adminGroup))
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+		f.addUser(t, email, nil)
+	}
+
+	users := f.users()
+	dto := domainUser.ListDto{PageDto: domain.PageDto{Limit: 2, Sort: "-email"}}
+	got := []string{}
+
+	for i := 0; i < 5; i++ {
+		page, err := users.GetUsers(adminContext(), dto)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got = append(got, emails(page)...)
+
+		if page.Next == "" {
+			break
+		}
+
+		dto.Cursor = page.Next
+	}
+
+	want := []string{"e@example.com", "d@example.com", "c@example.com", "b@example.com", "a@example.com"}
+
+	if !equal(got, want) {
+		t.Fatalf("emails = %v, want %v", got, want)
+	}
+
+	// The cursor is bound to the sort it was made for
+	dto.Sort = "email"
+
+	if _, err := users.GetUsers(adminContext(), dto); !errors.Is(err, domain.ErrValidation) {
+		t.Fatalf("err = %v, want %v", err, domain.ErrValidation)
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	f := newFixture(service.WithAdminGroups(adminGroup))
+	f.addUser(t, "smith@example.com", func(u *domainUser.User) { u.Name = sql.NullString{String: "John"} })
+	f.addUser(t, "ann@example.com", func(u *domainUser.User) { u.Name = sql.NullString{String: "Ann"}; u.Surname.String = "Smithson" })
+	f.addUser(t, "bob@example.com", func(u *domainUser.User) { u.Name = sql.NullString{String: "Bob"} })
+	f.addUser(t, "eve@example.com", func(u *domainUser.User) { u.Name = sql.NullString{String: `<img src=x onerror="alert('eve')">`} })
+
+	tests := []struct {
+		name      string
+		query     string
+		emails    []string
+		highlight string
+	}{
+		{
+			name:      "beginnings rank above parts",
+			query:     "smith",
+			emails:    []string{"smith@example.com", "ann@example.com"},
+			highlight: "John <mark>smith</mark>@example.com",
+		},
+		{
+			name:      "case insensitive",
+			query:     "BOB",
+			emails:    []string{"bob@example.com"},
+			highlight: "<mark>Bob</mark> <mark>bob</mark>@example.com",
+		},
+		{
+			name:      "names are escaped",
+			query:     "eve@",
+			emails:    []string{"eve@example.com"},
+			highlight: "&lt;img src=x onerror=&#34;alert(&#39;eve&#39;)&#34;&gt; <mark>eve@</mark>example.com",
+		},
+		{
+			name:   "nothing found",
+			query:  "zzz",
+			emails: []string{},
+		},
+	}
+
+	users := f.users()
+
+	// Only admins search users
+	if _, err := users.SearchUsers(context.Background(), domainUser.SearchDto{Query: "smith"}); !errors.Is(err, domain.ErrForbidden) {
+		t.Fatalf("err = %v, want %v", err, domain.ErrForbidden)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, err := users.SearchUsers(adminContext(), domainUser.SearchDto{Query: tt.query})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+
+			for _, match := range matches {
+				got = append(got, match.User.Email)
+			}
+
+			if !equal(got, tt.emails) {
+				t.Fatalf("emails = %v, want %v", got, tt.emails)
+			}
+
+			if len(matches) > 0 && matches[0].Highlight != tt.highlight {
+				t.Errorf("highlight = %q, want %q", matches[0].Highlight, tt.highlight)
+			}
+		})
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	tests := []struct {
+		name  string
+		actor domain.Actor
+		dto   domainUser.PatchUserDto
+		check func(t *testing.T, user domainUser.User)
+		err   error
+	}{
+		{
+			name:  "own name is cleared by null",
+			actor: domain.Actor{UserId: 1},
+			dto:   domainUser.PatchUserDto{Id: 1, Name: domain.None[string]()},
+			check: func(t *testing.T, user domainUser.User) {
+				if user.Name.Valid || user.Surname.String != "Doe" {
+					t.Errorf("name = %+v, surname = %+v, want a null name and the kept surname", user.Name, user.Surname)
+				}
+			},
+		},
+		{
+			name:  "empty patch returns the user",
+			actor: domain.Actor{UserId: 1},
+			dto:   domainUser.PatchUserDto{Id: 1},
+			check: func(t *testing.T, user domainUser.User) {
+				if user.Email != "ann@example.com" {
+					t.Errorf("email = %q, want ann@example.com", user.Email)
+				}
+			},
+		},
+		{
+			name:  "own preferences without admin rights",
+			actor: domain.Actor{UserId: 1},
+			dto:   domainUser.PatchMeDto{Locale: domain.Some("ru-RU"), Timezone: domain.Some("Europe/Moscow")}.PatchUserDto(1),
+			check: func(t *testing.T, user domainUser.User) {
+				if user.Locale.String != "ru-RU" || user.Timezone.String != "Europe/Moscow" || user.Name.String != "Ann" {
+					t.Errorf("locale = %+v, timezone = %+v, name = %+v", user.Locale, user.Timezone, user.Name)
+				}
+			},
+		},
+		{
+			name:  "other user is forbidden",
+			actor: domain.Actor{UserId: 2},
+			dto:   domainUser.PatchUserDto{Id: 1, Name: domain.Some("Bob")},
+			err:   domain.ErrForbidden,
+		},
+		{
+			name:  "admin fields are forbidden to the user",
+			actor: domain.Actor{UserId: 1},
+			dto:   domainUser.PatchUserDto{Id: 1, Activation: domain.Some(false)},
+			err:   domain.ErrForbidden,
+		},
+		{
+			name:  "own email is changed only by the confirm code",
+			actor: domain.Actor{UserId: 1},
+			dto:   domainUser.PatchUserDto{Id: 1, Email: domain.Some("anna@example.com")},
+			err:   domain.ErrForbidden,
+		},
+		{
+			name:  "admin deactivates the user",
+			actor: domain.Actor{UserId: 2, GroupId: adminGroup},
+			dto:   domainUser.PatchUserDto{Id: 1, Activation: domain.Some(false), ConfirmStatus: domain.Some("WAITING")},
+			check: func(t *testing.T, user domainUser.User) {
+				if user.Activation || user.ConfirmStatus != domainUser.ConfirmStatus_WAIT {
+					t.Errorf("activation = %v, status = %q, want false and waiting", user.Activation, user.ConfirmStatus)
+				}
+			},
+		},
+		{
+			name:  "email can't be null",
+			actor: domain.Actor{UserId: 2, GroupId: adminGroup},
+			dto:   domainUser.PatchUserDto{Id: 1, Email: domain.None[string]()},
+			err:   domain.ErrValidation,
+		},
+		{
+			name:  "email of another user",
+			actor: domain.Actor{UserId: 2, GroupId: adminGroup},
+			dto:   domainUser.PatchUserDto{Id: 1, Email: domain.Some("bob@example.com")},
+			err:   domain.ErrConflict,
+		},
+		{
+			name:  "missing user",
+			actor: domain.Actor{UserId: 2, GroupId: adminGroup},
+			dto:   domainUser.PatchUserDto{Id: 99, Name: domain.Some("Nobody")},
+			err:   domain.ErrNotFound,
+		},
+		{
+			// Users of the fixture are inserted and updated, so they have the version 2
+			name:  "current version is increased",
+			actor: domain.Actor{UserId: 1},
+			dto:   domainUser.PatchUserDto{Id: 1, Versions: domain.Versions{2}, Name: domain.Some("Anna")},
+			check: func(t *testing.T, user domainUser.User) {
+				if user.Version != 3 {
+					t.Errorf("version = %d, want 3", user.Version)
+				}
+			},
+		},
+		{
+			name:  "stale version",
+			actor: domain.Actor{UserId: 1},
+			dto:   domainUser.PatchUserDto{Id: 1, Versions: domain.Versions{3}, Name: domain.Some("Anna")},
+			err:   domain.ErrPrecondition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(service.WithAdminGroups(adminGroup))
+			f.addUser(t, "ann@example.com", func(u *domainUser.User) {
+				u.Name = sql.NullString{String: "Ann", Valid: true}
+				u.Surname = sql.NullString{String: "Doe", Valid: true}
+			})
+			f.addUser(t, "bob@example.com", nil)
+
+			ctx := domain.WithActor(context.Background(), tt.actor)
+			user, err := f.users().PatchUser(ctx, tt.dto)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if tt.check != nil {
+				tt.check(t, user)
+			}
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	self := domain.Actor{UserId: 1}
+
+	tests := []struct {
+		name     string
+		actor    domain.Actor
+		versions domain.Versions
+		err      error
+	}{
+		{name: "any version", actor: self},
+		{name: "current version", actor: self, versions: domain.Versions{2}},
+		{name: "one of the versions", actor: self, versions: domain.Versions{1, 2}},
+		{name: "stale version", actor: self, versions: domain.Versions{1}, err: domain.ErrPrecondition},
+		{name: "admin", actor: domain.Actor{UserId: 2, GroupId: adminGroup}},
+		{name: "other user", actor: domain.Actor{UserId: 2}, err: domain.ErrForbidden},
+		{name: "no actor", err: domain.ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(service.WithAdminGroups(adminGroup))
+			user := f.addUser(t, "ann@example.com", nil)
+			f.addUser(t, "bob@example.com", nil)
+
+			f.store.Auths.InsertAuth(context.Background(), domainAuth.Auth{UserId: user.Id, AccessToken: "token"})
+
+			ctx := context.Background()
+
+			if tt.actor.UserId > 0 {
+				ctx = domain.WithActor(ctx, tt.actor)
+			}
+
+			if err := f.users().DeleteUser(ctx, int(user.Id), tt.versions); !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if tt.err != nil {
+				return
+			}
+
+			if found, _ := f.store.Users.GetUser(context.Background(), domainUser.UserDto{Id: int(user.Id)}); found.Id != 0 {
+				t.Errorf("the deleted user is found")
+			}
+
+			sessions, _ := f.store.Auths.GetSessions(context.Background(), domainAuth.SessionDto{Id: int(user.Id)})
+
+			if sessions.Total != 0 {
+				t.Errorf("sessions = %d, want 0", sessions.Total)
+			}
+		})
+	}
+}
+
+func TestRestoreUser(t *testing.T) {
+	admin := domain.Actor{UserId: 3, GroupId: adminGroup}
+
+	tests := []struct {
+		name  string
+		actor domain.Actor
+		// Prepares the store after ann is deleted
+		prepare func(t *testing.T, f *fixture)
+		id      int
+		err     error
+	}{
+		{name: "admin restores", actor: admin, id: 1},
+		{name: "users don't restore", actor: domain.Actor{UserId: 1}, id: 1, err: domain.ErrForbidden},
+		{name: "alive user", actor: admin, id: 2, err: domain.ErrConflict},
+		{name: "missing user", actor: admin, id: 99, err: domain.ErrNotFound},
+		{
+			name:    "email is registered again",
+			actor:   admin,
+			prepare: func(t *testing.T, f *fixture) { f.addUser(t, "ann@example.com", nil) },
+			id:      1,
+			err:     domain.ErrConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(service.WithAdminGroups(adminGroup))
+			f.addUser(t, "ann@example.com", nil)
+			f.addUser(t, "bob@example.com", nil)
+			users := f.users()
+
+			if err := users.DeleteUser(adminContext(), 1, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(t, f)
+			}
+
+			user, err := users.RestoreUser(domain.WithActor(context.Background(), tt.actor), tt.id)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if tt.err == nil && (user.Email != "ann@example.com" || user.DeletedAt.Valid) {
+				t.Errorf("user = %s deleted %v, want the alive ann@example.com", user.Email, user.DeletedAt.Valid)
+			}
+		})
+	}
+}
+
+func TestBanUser(t *testing.T) {
+	admin := domain.Actor{UserId: 3, GroupId: adminGroup}
+
+	tests := []struct {
+		name   string
+		actor  domain.Actor
+		dto    domainUser.BanDto
+		err    error
+		banned bool
+	}{
+		{name: "forever", actor: admin, dto: domainUser.BanDto{UserId: 1, ReasonId: 1}, banned: true},
+		{name: "until the time", actor: admin, dto: domainUser.BanDto{UserId: 1, ReasonId: 1, ExpiredAt: time.Now().Add(time.Hour)}, banned: true},
+		{name: "expired time", actor: admin, dto: domainUser.BanDto{UserId: 1, ReasonId: 1, ExpiredAt: time.Now().Add(-time.Hour)}, err: domain.ErrValidation},
+		{name: "users don't ban", actor: domain.Actor{UserId: 2}, dto: domainUser.BanDto{UserId: 1, ReasonId: 1}, err: domain.ErrForbidden},
+		{name: "missing user", actor: admin, dto: domainUser.BanDto{UserId: 99, ReasonId: 1}, err: domain.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(service.WithAdminGroups(adminGroup))
+			ann := f.addUser(t, "ann@example.com", nil)
+			f.addUser(t, "bob@example.com", nil)
+			token := login(t, f, ann).AccessToken
+
+			_, err := f.users().BanUser(domain.WithActor(context.Background(), tt.actor), tt.dto)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			// The sessions of the banned user are closed
+			if isVerify, _ := f.auth.VerifyAccessToken(context.Background(), token); isVerify == tt.banned {
+				t.Fatalf("token valid = %v, want %v", isVerify, !tt.banned)
+			}
+
+			_, err = f.auth.Login(context.Background(), domainAuth.LoginDto{Email: ann.Email, Password: testPassword, UserAgent: userAgent})
+
+			if tt.banned {
+				assertError(t, err, domain.ErrForbidden, domain.ReasonUserBanned)
+			} else if err != nil {
+				t.Fatalf("login of the not banned user: %v", err)
+			}
+		})
+	}
+}
+
+func TestBanExpires(t *testing.T) {
+	f := newFixture()
+	user := f.addUser(t, "user@example.com", nil)
+
+	if _, err := f.store.Bans.InsertBan(context.Background(), domainUser.Ban{
+		UserId:    user.Id,
+		ReasonId:  1,
+		ExpiredAt: sql.NullTime{Time: time.Now().Add(-time.Minute), Valid: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	login(t, f, user)
+}
+
+func TestPurgeUsers(t *testing.T) {
+	f := newFixture(service.WithAdminGroups(adminGroup))
+	users := f.users()
+
+	for _, email := range []string{"ann@example.com", "bob@example.com"} {
+		f.addUser(t, email, nil)
+	}
+
+	if err := users.DeleteUser(adminContext(), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The user is deleted less than the retention ago
+	if purged, err := users.PurgeUsers(context.Background(), time.Hour); err != nil || purged != 0 {
+		t.Fatalf("purged = %d, %v, want 0", purged, err)
+	}
+
+	if purged, err := users.PurgeUsers(context.Background(), -time.Second); err != nil || purged != 1 {
+		t.Fatalf("purged = %d, %v, want 1", purged, err)
+	}
+
+	// The purged user can't be restored
+	admin := domain.WithActor(context.Background(), domain.Actor{UserId: 2, GroupId: 7})
+
+	if _, err := users.RestoreUser(admin, 1); !errors.Is(err, domain.ErrNotFound) {
+		t.Fatalf("err = %v, want %v", err, domain.ErrNotFound)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestSessions(t *testing.T) {
+	f := newFixture(service.WithAdminGroups(adminGroup))
+	users := f.users()
+	ann := f.addUser(t, "ann@example.com", nil)
+	bob := f.addUser(t, "bob@example.com", nil)
+	ctx := domain.WithActor(context.Background(), domain.Actor{UserId: int(ann.Id)})
+
+	// The list without sessions is empty but isn't an error
+	page, err := users.Sessions(ctx, domainAuth.SessionDto{Id: int(ann.Id)})
+
+	if err != nil || page.Total != 0 {
+		t.Fatalf("sessions = %d, %v, want none", page.Total, err)
+	}
+
+	insertSession(t, f, ann, time.Now().Add(time.Hour))
+	insertSession(t, f, ann, time.Now().Add(time.Hour))
+	insertSession(t, f, bob, time.Now().Add(time.Hour))
+
+	page, _ = users.Sessions(ctx, domainAuth.SessionDto{Id: int(ann.Id)})
+	current := int(page.Items[0].Id)
+	other, _ := users.Sessions(adminContext(), domainAuth.SessionDto{Id: int(bob.Id)})
+
+	renames := []struct {
+		name string
+		dto  domainAuth.RenameDto
+		err  error
+	}{
+		{name: "own session", dto: domainAuth.RenameDto{Id: current, UserId: int(ann.Id), Name: "Work laptop"}},
+		{name: "session of another user", dto: domainAuth.RenameDto{Id: int(other.Items[0].Id), UserId: int(ann.Id), Name: "Mine"}, err: domain.ErrForbidden},
+	}
+
+	for _, tt := range renames {
+		if err := users.RenameSession(ctx, tt.dto); !errors.Is(err, tt.err) {
+			t.Fatalf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+
+	destroyed, err := users.DestroyOtherSessions(ctx, int(ann.Id), current)
+
+	if err != nil || destroyed != 1 {
+		t.Fatalf("destroyed = %d, %v, want 1", destroyed, err)
+	}
+
+	page, _ = users.Sessions(ctx, domainAuth.SessionDto{Id: int(ann.Id)})
+
+	if len(page.Items) != 1 || int(page.Items[0].Id) != current || page.Items[0].Name.String != "Work laptop" {
+		t.Fatalf("sessions = %+v, want only the renamed current one", page.Items)
+	}
+
+	// The sessions of other users are kept
+	if other, _ = users.Sessions(adminContext(), domainAuth.SessionDto{Id: int(bob.Id)}); other.Total != 1 {
+		t.Fatalf("sessions of bob = %d, want 1", other.Total)
+	}
+}
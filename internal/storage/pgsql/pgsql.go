@@ -1,23 +1,19 @@
 package pgsql
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"reflect"
 	"regexp"
 	"strconv"
 
-	domainAuth "apibgo/internal/domain/auth"
 	"apibgo/internal/storage"
 	"apibgo/pkg/db/pgsql"
 
-	"github.com/doug-martin/goqu/v9"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type Storage struct {
@@ -80,58 +76,3 @@ func New(cfg *storage.Config, conn string) (*Storage, error) {
 
 	return &Storage{Db: db}, nil
 }
-
-func (s *Storage) Create(ctx context.Context, au domainAuth.Auth) (pgconn.CommandTag, error) {
-	ds := goqu.Insert(au.TableName()).Rows(au)
-	sql, args, _ := ds.ToSQL()
-	cmmtag, err := s.Db.Exec(ctx, sql, args...)
-
-	return cmmtag, err
-}
-
-func (s *Storage) Save(ctx context.Context, au domainAuth.Auth, sql string, args ...interface{}) (pgconn.CommandTag, error) {
-	ds := goqu.Update(au.TableName()).Set(au).Where(goqu.L(sql, args...))
-	_sql, _args, _ := ds.ToSQL()
-	cmmtag, err := s.Db.Exec(ctx, _sql, _args...)
-
-	return cmmtag, err
-}
-
-func (s *Storage) Delete(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
-	au := domainAuth.Auth{}
-	ds := goqu.Delete(au.TableName()).Where(goqu.L(sql, args...))
-	_sql, _args, _ := ds.ToSQL()
-	cmmtag, err := s.Db.Exec(ctx, _sql, _args...)
-
-	return cmmtag, err
-}
-
-func (s *Storage) Find(ctx context.Context, table string, sql string, args ...interface{}) (pgx.Rows, error) {
-	ds := goqu.From(table).Where(goqu.L(sql, args...))
-	_sql, _args, _ := ds.ToSQL()
-	rows, err := s.Db.Query(ctx, _sql, _args...)
-
-	return rows, err
-}
-
-func (s *Storage) First(ctx context.Context, table string, sql string, args ...interface{}) (pgx.Rows, error) {
-	ds := goqu.From(table).
-		Where(goqu.L(sql, args...)).
-		Limit(1).
-		Order(goqu.I("id").Asc())
-	_sql, _args, _ := ds.ToSQL()
-	rows, err := s.Db.Query(ctx, _sql, _args...)
-
-	return rows, err
-}
-
-func (s *Storage) Last(ctx context.Context, table string, sql string, args ...interface{}) (pgx.Rows, error) {
-	ds := goqu.From(table).
-		Where(goqu.L(sql, args...)).
-		Limit(1).
-		Order(goqu.I("id").Desc())
-	_sql, _args, _ := ds.ToSQL()
-	rows, err := s.Db.Query(ctx, _sql, _args...)
-
-	return rows, err
-}
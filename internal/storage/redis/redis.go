@@ -0,0 +1,29 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"apibgo/internal/storage"
+	"apibgo/pkg/db/redis"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// New connects to the redis of the config and checks the connection
+func New(cfg *storage.Config) (*goredis.Client, error) {
+	const op = "storage.redis.New()"
+
+	client := redis.Conn(&goredis.Options{
+		Addr:     cfg.Redis.Address,
+		Password: cfg.Redis.Password,
+		DB:       cfg.Redis.Database,
+	})
+
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return client, nil
+}
@@ -11,6 +11,7 @@ import (
 type Config struct {
 	PgSql Clusters `yaml:"pgsql"`
 	MySql Clusters `yaml:"mysql"`
+	Redis Redis    `yaml:"redis"`
 }
 
 type Clusters struct {
@@ -27,6 +28,12 @@ type Cluster struct {
 	Migrate  bool   `yaml:"migrate"`
 }
 
+type Redis struct {
+	Address  string `yaml:"address"`
+	Password string `yaml:"password"`
+	Database int    `yaml:"database"`
+}
+
 func MustLoad() *Config {
 	configPath := os.Getenv("CONFIG_PATH")
 
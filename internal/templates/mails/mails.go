@@ -1,127 +1,93 @@
 package mails
 
 import (
+	"os"
+	"strconv"
+
 	"apibgo/internal/lang"
-	"log"
-	"regexp"
 )
 
 func Registration(replace map[string]string) (string, string) {
-	appLang, _ := lang.Get(lang.Locale())
-
-	subject := appLang.Mail.Registration.Subject
-	body := appLang.Mail.Registration.Body
-
-	for key, value := range replace {
-		re, err := regexp.Compile(`{{ *` + key + ` *}}`)
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		subject = string(re.ReplaceAll([]byte(subject), []byte(value)))
-		body = string(re.ReplaceAll([]byte(body), []byte(value)))
-	}
-
-	return subject, body
+	return render("registration", withConfirmTime(replace))
 }
 
 func Login(replace map[string]string) (string, string) {
-	appLang, _ := lang.Get(lang.Locale())
-
-	subject := appLang.Mail.Login.Subject
-	body := appLang.Mail.Login.Body
-
-	for key, value := range replace {
-		re, err := regexp.Compile(`{{ *` + key + ` *}}`)
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		subject = string(re.ReplaceAll([]byte(subject), []byte(value)))
-		body = string(re.ReplaceAll([]byte(body), []byte(value)))
-	}
-
-	return subject, body
+	return render("login", replace)
 }
 
 func Activation(replace map[string]string) (string, string) {
-	appLang, _ := lang.Get(lang.Locale())
+	return render("activation", replace)
+}
 
-	subject := appLang.Mail.Activation.Subject
-	body := appLang.Mail.Activation.Body
+func Forgot(replace map[string]string) (string, string) {
+	return render("forgot", withConfirmTime(replace))
+}
 
-	for key, value := range replace {
-		re, err := regexp.Compile(`{{ *` + key + ` *}}`)
+func Recovery(replace map[string]string) (string, string) {
+	return render("recovery", replace)
+}
 
-		if err != nil {
-			log.Fatal(err)
-		}
+func Confirm(replace map[string]string) (string, string) {
+	return render("confirm", withConfirmTime(replace))
+}
 
-		subject = string(re.ReplaceAll([]byte(subject), []byte(value)))
-		body = string(re.ReplaceAll([]byte(body), []byte(value)))
-	}
+func Email(replace map[string]string) (string, string) {
+	return render("email", withConfirmTime(replace))
+}
 
-	return subject, body
+// EmailChanged expects the new email as "email" and the revert link as "link"
+func EmailChanged(replace map[string]string) (string, string) {
+	return render("email_changed", replace)
 }
 
-func Forgot(replace map[string]string) (string, string) {
-	appLang, _ := lang.Get(lang.Locale())
+// LoginConfirm expects the device as "device" and its details as "device_detail"
+func LoginConfirm(replace map[string]string) (string, string) {
+	return render("login_confirm", withConfirmTime(replace))
+}
 
-	subject := appLang.Mail.Forgot.Subject
-	body := appLang.Mail.Forgot.Body
+func Password(replace map[string]string) (string, string) {
+	return render("password", replace)
+}
 
-	for key, value := range replace {
-		re, err := regexp.Compile(`{{ *` + key + ` *}}`)
+// Deleted expects the number of days of the grace as the "days" parameter
+func Deleted(replace map[string]string) (string, string) {
+	values := map[string]string{}
 
-		if err != nil {
-			log.Fatal(err)
-		}
+	for key, value := range replace {
+		values[key] = value
+	}
 
-		subject = string(re.ReplaceAll([]byte(subject), []byte(value)))
-		body = string(re.ReplaceAll([]byte(body), []byte(value)))
+	if days, err := strconv.Atoi(replace["days"]); err == nil {
+		values["days"] = lang.Default().Plural(lang.Locale(), "plural.days", days, nil)
 	}
 
-	return subject, body
+	return render("deleted", values)
 }
 
-func Recovery(replace map[string]string) (string, string) {
-	appLang, _ := lang.Get(lang.Locale())
+func render(section string, replace map[string]string) (string, string) {
+	bundle := lang.Default()
+	locale := lang.Locale()
 
-	subject := appLang.Mail.Recovery.Subject
-	body := appLang.Mail.Recovery.Body
-
-	for key, value := range replace {
-		re, err := regexp.Compile(`{{ *` + key + ` *}}`)
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		subject = string(re.ReplaceAll([]byte(subject), []byte(value)))
-		body = string(re.ReplaceAll([]byte(body), []byte(value)))
-	}
+	subject := bundle.T(locale, "mail."+section+".subject", replace)
+	body := bundle.T(locale, "mail."+section+".body", replace)
 
 	return subject, body
 }
 
-func Confirm(replace map[string]string) (string, string) {
-	appLang, _ := lang.Get(lang.Locale())
+// Adds the lifetime of a confirm code as the "minutes" parameter
+func withConfirmTime(replace map[string]string) map[string]string {
+	if _, ok := replace["minutes"]; ok {
+		return replace
+	}
 
-	subject := appLang.Mail.Confirm.Subject
-	body := appLang.Mail.Confirm.Body
+	seconds, _ := strconv.Atoi(os.Getenv("APP_CONFIRM_TIME"))
+	values := map[string]string{
+		"minutes": lang.Default().Plural(lang.Locale(), "plural.minutes", seconds/60, nil),
+	}
 
 	for key, value := range replace {
-		re, err := regexp.Compile(`{{ *` + key + ` *}}`)
-
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		subject = string(re.ReplaceAll([]byte(subject), []byte(value)))
-		body = string(re.ReplaceAll([]byte(body), []byte(value)))
+		values[key] = value
 	}
 
-	return subject, body
+	return values
 }
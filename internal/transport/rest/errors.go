@@ -0,0 +1,88 @@
+package rest
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"apibgo/internal/domain"
+	"apibgo/internal/utils/response"
+	"apibgo/pkg/clientip"
+	aslog "apibgo/pkg/logger/feature/slog"
+)
+
+// Codes of the catalog by reasons of domain errors
+var reasonCodes = map[string]response.Code{
+	domain.ReasonAccountNotActivated:     response.ErrorAccountActivate,
+	domain.ReasonAccountAlreadyActivated: response.ErrorAccountAlreadyActivate,
+	domain.ReasonAccountExists:           response.ErrorAccountExists,
+	domain.ReasonInvalidCredentials:      response.ErrorAccountNotFound,
+	domain.ReasonInvalidCode:             response.ErrorAccountInvalidCode,
+	domain.ReasonCodeExpired:             response.ErrorAccountActivateTimeout,
+	domain.ReasonTokenExpired:            response.ErrorTokenExpired,
+	domain.ReasonVersionMismatch:         response.ErrorPreconditionFailed,
+	domain.ReasonLoginConfirm:            response.ErrorLoginConfirmRequired,
+	domain.ReasonTooManyAttempts:         response.ErrorTooManyAttempts,
+	domain.ReasonUserBanned:              response.ErrorUserBanned,
+}
+
+// Codes of the catalog by kinds, used when the reason is unknown
+var kindCodes = []struct {
+	kind error
+	code response.Code
+}{
+	{domain.ErrNotFound, response.ErrorNotFound},
+	{domain.ErrConflict, response.ErrorConflict},
+	{domain.ErrForbidden, response.ErrorPermissionForbidden},
+	{domain.ErrUnauthorized, response.ErrorUnauthorized},
+	{domain.ErrValidation, response.ErrorValidation},
+	{domain.ErrPrecondition, response.ErrorInvalidState},
+	{domain.ErrExpired, response.ErrorAccountActivateTimeout},
+}
+
+// ErrorResponse maps an error of a service to the error response.
+// False is returned for errors which are not domain ones.
+func ErrorResponse(err error) (response.Response, bool) {
+	var domainErr *domain.Error
+
+	if !errors.As(err, &domainErr) {
+		return response.Response{}, false
+	}
+
+	code, ok := reasonCodes[domainErr.Reason]
+
+	for i := 0; !ok && i < len(kindCodes); i++ {
+		if errors.Is(domainErr.Kind, kindCodes[i].kind) {
+			code, ok = kindCodes[i].code, true
+		}
+	}
+
+	if !ok {
+		return response.Response{}, false
+	}
+
+	_response := response.Response{
+		Code:     code,
+		Status:   response.StatusError,
+		Message:  domainErr.Message,
+		HttpCode: response.Lookup(code).Status,
+	}
+
+	if domainErr.Fields != nil {
+		_response.Result = domainErr.Fields
+	}
+
+	return _response, true
+}
+
+// WriteError writes the error of a service. Unknown errors
+// are logged and hidden behind the internal error.
+func WriteError(w http.ResponseWriter, r *http.Request, log *slog.Logger, err error) {
+	if _response, ok := ErrorResponse(err); ok {
+		_response.Send(w, r)
+		return
+	}
+
+	log.Error("failed to execute service", aslog.Err(err), slog.String("ip", clientip.FromRequest(r)))
+	response.Fail(w, r, response.ErrorInternal, "")
+}
@@ -0,0 +1,62 @@
+package rest_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"apibgo/internal/domain"
+	"apibgo/internal/transport/rest"
+	"apibgo/internal/utils/response"
+)
+
+func TestErrorResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   response.Code
+		status int
+	}{
+		{name: "reason", err: domain.NewError(domain.ErrConflict, domain.ReasonAccountExists, "exists"), code: response.ErrorAccountExists, status: http.StatusConflict},
+		{name: "reason of another kind", err: domain.NewError(domain.ErrUnauthorized, domain.ReasonInvalidCredentials, ""), code: response.ErrorAccountNotFound, status: http.StatusUnauthorized},
+		{name: "version mismatch", err: domain.NewError(domain.ErrPrecondition, domain.ReasonVersionMismatch, ""), code: response.ErrorPreconditionFailed, status: http.StatusPreconditionFailed},
+		{name: "conflict without a reason", err: domain.NewError(domain.ErrConflict, "", "user is not deleted"), code: response.ErrorConflict, status: http.StatusConflict},
+		{name: "precondition without a reason", err: domain.NewError(domain.ErrPrecondition, "", "not allowed"), code: response.ErrorInvalidState, status: http.StatusConflict},
+		{name: "not found", err: domain.NewError(domain.ErrNotFound, "", "user not found"), code: response.ErrorNotFound, status: http.StatusNotFound},
+		{name: "forbidden", err: domain.NewError(domain.ErrForbidden, "", ""), code: response.ErrorPermissionForbidden, status: http.StatusForbidden},
+		{name: "expired", err: domain.NewError(domain.ErrExpired, "", ""), code: response.ErrorAccountActivateTimeout, status: http.StatusGone},
+		{name: "wrapped", err: fmt.Errorf("patch: %w", domain.NewError(domain.ErrNotFound, "", "")), code: response.ErrorNotFound, status: http.StatusNotFound},
+		{name: "unknown reason", err: domain.NewError(domain.ErrForbidden, "other", ""), code: response.ErrorPermissionForbidden, status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := rest.ErrorResponse(tt.err)
+
+			if !ok || got.Code != tt.code || got.HttpCode != tt.status || got.Status != response.StatusError {
+				t.Fatalf("ErrorResponse = %+v, %v, want the code %d and the status %d", got, ok, tt.code, tt.status)
+			}
+		})
+	}
+}
+
+func TestErrorResponseFields(t *testing.T) {
+	fields := map[string][]string{"email": {"taken"}}
+	err := &domain.Error{Kind: domain.ErrValidation, Message: "invalid", Fields: fields}
+
+	got, ok := rest.ErrorResponse(err)
+
+	if !ok || got.Code != response.ErrorValidation || got.Message != "invalid" || !reflect.DeepEqual(got.Result, fields) {
+		t.Fatalf("ErrorResponse = %+v, %v", got, ok)
+	}
+}
+
+func TestErrorResponseNotDomain(t *testing.T) {
+	for _, err := range []error{errors.New("connection refused"), domain.NewError(errors.New("other kind"), "", "")} {
+		if _, ok := rest.ErrorResponse(err); ok {
+			t.Errorf("%v is mapped", err)
+		}
+	}
+}
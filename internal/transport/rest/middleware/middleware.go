@@ -1,48 +1,108 @@
 package middleware
 
 import (
-	"context"
 	"net/http"
 	"strings"
 
 	"apibgo/internal/app/instance"
+	"apibgo/internal/domain"
+	"apibgo/internal/repository"
 	"apibgo/internal/service"
 	"apibgo/internal/storage/pgsql"
+	"apibgo/internal/utils/response"
+	"apibgo/pkg/auth/device"
+	"apibgo/pkg/clientip"
 	"apibgo/pkg/logger/feature/slog"
+	"apibgo/pkg/mail"
+
+	"github.com/gorilla/mux"
 )
 
-func LoggingMiddleware(next http.Handler) http.Handler {
+// ClientHintsMiddleware asks browsers for the client hints of the device,
+// they are sent with the requests after the first one
+func ClientHintsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-CH", device.AcceptCH)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientIpMiddleware stores the address of the client, resolved by the
+// trusted proxies, in the context of the request
+func ClientIpMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if _, ok := r.Header["Authorization"]; !ok {
-			w.WriteHeader(http.StatusBadRequest)
+		r = r.WithContext(clientip.WithIp(r.Context(), clientip.Resolve(r)))
 
-			return
-		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-		instance := instance.GetInstance()
-		pg, err := pgsql.New(instance.Storage, "master")
+// LoggingMiddleware authorizes the requests by the access token, the
+// services of the actor are made with the options
+func LoggingMiddleware(opts ...service.Option) mux.MiddlewareFunc {
+	// The tokens are verified without the storage
+	tokens := service.NewAuthService(repository.Store{}, nil, opts...)
 
-		if err != nil {
-			instance.Log.Error("failed to init storage", slog.Err(err))
-			return
-		}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Header["Authorization"]; !ok {
+				response.Fail(w, r, response.ErrorUnauthorized, "the Authorization header is required")
 
-		instance.Log.Info("starting database middleware")
+				return
+			}
 
-		authService := service.NewAuthService(pg)
-		split := strings.Split(r.Header["Authorization"][0], " ")
-		token := split[1]
-		isVerify, err := authService.VerifyToken(context.Background(), token)
+			instance := instance.GetInstance()
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			token = strings.TrimSpace(token)
 
-		if err != nil {
-			instance.Log.Error("failed to execute VerifyToken service", slog.Err(err))
-		}
+			if !strings.EqualFold(scheme, "Bearer") || token == "" {
+				response.Fail(w, r, response.ErrorUnauthorized, "")
+				return
+			}
 
-		if !isVerify {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
+			// Invalid, expired and revoked tokens are rejected before the storage is opened
+			isVerify, err := tokens.VerifyAccessToken(r.Context(), token)
 
-		next.ServeHTTP(w, r)
-	})
+			if err != nil {
+				instance.Log.Error("failed to execute VerifyAccessToken service", slog.Err(err))
+			}
+
+			if !isVerify {
+				response.Fail(w, r, response.ErrorUnauthorized, "")
+				return
+			}
+
+			pg, err := pgsql.New(instance.Storage, "master")
+
+			if err != nil {
+				instance.Log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			instance.Log.Info("starting database middleware")
+
+			authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), opts...)
+			actor, err := authService.Actor(r.Context(), token)
+
+			if err != nil {
+				response.Fail(w, r, response.ErrorUnauthorized, "")
+				return
+			}
+
+			// The request goes on if the last seen time isn't written
+			if err := authService.TouchSession(r.Context(), actor, clientip.FromRequest(r)); err != nil {
+				instance.Log.Error("failed to touch the session", slog.Err(err))
+			}
+
+			authService.TouchActivity(actor)
+
+			r = r.WithContext(domain.WithActor(r.Context(), actor))
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
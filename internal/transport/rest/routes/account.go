@@ -0,0 +1,512 @@
+package routes
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"apibgo/internal/config"
+	"apibgo/internal/domain"
+	domainAuth "apibgo/internal/domain/auth"
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/repository"
+	"apibgo/internal/service"
+	"apibgo/internal/storage"
+	"apibgo/internal/storage/pgsql"
+	"apibgo/internal/transport/rest"
+	"apibgo/internal/utils/request"
+	"apibgo/internal/utils/response"
+	"apibgo/pkg/auth/device"
+	"apibgo/pkg/clientip"
+	"apibgo/pkg/logger"
+	"apibgo/pkg/logger/feature/slog"
+	"apibgo/pkg/mail"
+
+	"github.com/gorilla/mux"
+)
+
+// Account is the self-service of the authorized user, it's registered
+// before User so "/users/me/" isn't taken for the id of a user
+type Account struct {
+	Config      *config.Config
+	Storage     *storage.Config
+	Middlewares []mux.MiddlewareFunc
+	// Options of the services made for the requests
+	Services []service.Option
+}
+
+// The files of the archive of the export in the order of writing
+var exportFiles = []string{"profile", "sessions", "logins", "devices", "consents"}
+
+func (a *Account) NewHandler(r *mux.Router) {
+	// route: get the own profile
+	r.HandleFunc("/users/me/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(a.Config.Env)
+			actor, ok := requestActor(w, r)
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(a.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database")
+
+			userService := service.NewUserService(repository.NewStore(pg), a.Services...)
+			user, err := userService.GetUser(r.Context(), domainUser.UserDto{Id: actor.UserId})
+
+			if err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			etag := response.ETag(user.Version)
+
+			if request.NoneMatch(r, etag) {
+				response.NotModified(w, etag)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "data is got",
+				Result:  userResult(user),
+				Headers: http.Header{"ETag": {etag}},
+			}
+			_response.Send(w, r)
+		}),
+		a.Middlewares...,
+	).ServeHTTP).Methods(http.MethodGet)
+
+	// route: patch the own profile
+	r.HandleFunc("/users/me/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(a.Config.Env)
+			actor, ok := requestActor(w, r)
+
+			if !ok {
+				return
+			}
+
+			versions, ok := request.IfMatch(w, r)
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(a.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database")
+
+			userService := service.NewUserService(repository.NewStore(pg), a.Services...)
+
+			// The document a JSON Patch is applied to
+			current := func() (map[string]any, bool) {
+				user, err := userService.GetUser(r.Context(), domainUser.UserDto{Id: actor.UserId})
+
+				if err != nil {
+					rest.WriteError(w, r, log, err)
+					return nil, false
+				}
+
+				return meDocument(user), true
+			}
+
+			dto, ok := request.DecodePatch(w, r, current, func(dto *domainUser.PatchMeDto) {
+				dto.Versions = versions
+			})
+
+			if !ok {
+				return
+			}
+
+			user, err := userService.PatchUser(r.Context(), dto.PatchUserDto(actor.UserId))
+
+			if err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "user data updated successfully",
+				Result:  userResult(user),
+				Headers: http.Header{"ETag": {response.ETag(user.Version)}},
+			}
+			_response.Send(w, r)
+		}),
+		a.Middlewares...,
+	).ServeHTTP).Methods(http.MethodPatch)
+
+	// route: export the personal data
+	r.HandleFunc("/users/me/export/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(a.Config.Env)
+			pg, err := pgsql.New(a.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database")
+
+			accountService := service.NewAccountService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
+			export, err := accountService.Export(r.Context())
+
+			if err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			result := exportResult(export)
+
+			if r.URL.Query().Get("format") == "json" {
+				_response := response.Response{
+					Code:    response.ErrorEmpty,
+					Status:  response.StatusSuccess,
+					Message: "data is got",
+					Result:  result,
+				}
+				_response.Send(w, r)
+				return
+			}
+
+			name := "export-" + strconv.Itoa(int(export.User.Id)) + ".zip"
+
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+			w.WriteHeader(http.StatusOK)
+
+			if err := writeExport(w, result); err != nil {
+				log.Error("failed to write the export", slog.Err(err))
+			}
+		}),
+		a.Middlewares...,
+	).ServeHTTP).Methods(http.MethodGet)
+
+	// route: the own login history
+	r.HandleFunc("/users/me/logins/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(a.Config.Env)
+			actor, ok := requestActor(w, r)
+
+			if !ok {
+				return
+			}
+
+			dto, ok := request.DecodeQuery(w, r, func(dto *domainAuth.EventDto) {
+				dto.UserId = actor.UserId
+
+				// The newest events go first unless the sort is asked
+				if dto.Sort == "" {
+					dto.Sort = "-id"
+				}
+			})
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(a.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database")
+
+			userService := service.NewUserService(repository.NewStore(pg), a.Services...)
+			events, err := userService.LoginHistory(r.Context(), dto)
+
+			if err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := pageResponse(r, dto.PageDto, events, eventResult)
+			_response.Send(w, r)
+		}),
+		a.Middlewares...,
+	).ServeHTTP).Methods(http.MethodGet)
+
+	// route: stage a new email
+	r.HandleFunc("/users/me/email/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(a.Config.Env)
+			dto, ok := request.Decode[domainUser.ChangeEmailDto](w, r)
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(a.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database")
+
+			accountService := service.NewAccountService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
+
+			if err := accountService.ChangeEmail(r.Context(), dto); err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := response.Response{
+				Code:     response.ErrorEmpty,
+				Status:   response.StatusSuccess,
+				Message:  "the confirm code is sent to the new email",
+				HttpCode: http.StatusAccepted,
+			}
+			_response.Send(w, r)
+		}),
+		a.Middlewares...,
+	).ServeHTTP).Methods(http.MethodPost)
+
+	// route: confirm the new email
+	r.HandleFunc("/users/me/email/confirm/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(a.Config.Env)
+			dto, ok := request.Decode[domainUser.ConfirmEmailDto](w, r)
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(a.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database")
+
+			accountService := service.NewAccountService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
+			user, err := accountService.ConfirmEmail(r.Context(), dto)
+
+			if err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "email changed successfully",
+				Result:  userResult(user),
+				Headers: http.Header{"ETag": {response.ETag(user.Version)}},
+			}
+			_response.Send(w, r)
+		}),
+		a.Middlewares...,
+	).ServeHTTP).Methods(http.MethodPost)
+
+	// route: revert the change of the email, the token of the mail is
+	// the authorization since the one who changed the email may own the sessions
+	r.HandleFunc("/users/email/revert/", func(w http.ResponseWriter, r *http.Request) {
+		log := logger.Setup(a.Config.Env)
+		dto, ok := request.Decode[domainUser.RevertEmailDto](w, r)
+
+		if !ok {
+			return
+		}
+
+		pg, err := pgsql.New(a.Storage, "master")
+
+		if err != nil {
+			log.Error("failed to init storage", slog.Err(err))
+			response.Fail(w, r, response.ErrorInternal, "")
+			return
+		}
+
+		defer pg.Db.Close(r.Context())
+
+		log.Info("starting database")
+
+		accountService := service.NewAccountService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
+
+		if err := accountService.RevertEmail(r.Context(), dto); err != nil {
+			rest.WriteError(w, r, log, err)
+			return
+		}
+
+		_response := response.Response{
+			Code:    response.ErrorEmpty,
+			Status:  response.StatusSuccess,
+			Message: "email reverted successfully, all the sessions are closed",
+		}
+		_response.Send(w, r)
+	}).Methods(http.MethodPost)
+
+	// route: change the password
+	r.HandleFunc("/users/me/password/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(a.Config.Env)
+			actor, ok := requestActor(w, r)
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(a.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database")
+
+			// The new password must not contain the profile of the user
+			user, err := service.NewUserService(repository.NewStore(pg), a.Services...).GetUser(r.Context(), domainUser.UserDto{Id: actor.UserId})
+
+			if err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			dto, ok := request.Decode(w, r, func(dto *domainUser.ChangePasswordDto) {
+				dto.Email = user.Email
+				dto.Name = user.Name.String
+				dto.Surname = user.Surname.String
+				dto.Ip = clientip.FromRequest(r)
+				dto.UserAgent = r.UserAgent()
+				dto.Hints = device.HintsOf(r.Header)
+			})
+
+			if !ok {
+				return
+			}
+
+			accountService := service.NewAccountService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
+
+			if err := accountService.ChangePassword(r.Context(), dto); err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "password changed successfully, the other sessions are closed",
+			}
+			_response.Send(w, r)
+		}),
+		a.Middlewares...,
+	).ServeHTTP).Methods(http.MethodPost)
+
+	// route: delete the account
+	r.HandleFunc("/users/me/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(a.Config.Env)
+			dto, ok := request.Decode[domainUser.DeleteAccountDto](w, r)
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(a.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database")
+
+			accountService := service.NewAccountService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
+
+			if err := accountService.DeleteAccount(r.Context(), dto); err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "account deleted successfully",
+			}
+			_response.Send(w, r)
+		}),
+		a.Middlewares...,
+	).ServeHTTP).Methods(http.MethodDelete)
+}
+
+// Returns the user of the request, the actor is set by the auth middleware
+func requestActor(w http.ResponseWriter, r *http.Request) (domain.Actor, bool) {
+	actor, ok := domain.ActorFrom(r.Context())
+
+	if !ok {
+		response.Fail(w, r, response.ErrorUnauthorized, "")
+		return domain.Actor{}, false
+	}
+
+	return actor, true
+}
+
+// Writes the parts of the export as the JSON files of the ZIP archive
+func writeExport(w io.Writer, result map[string]interface{}) error {
+	archive := zip.NewWriter(w)
+
+	for _, name := range exportFiles {
+		file, err := archive.Create(name + ".json")
+
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+
+		if err := encoder.Encode(result[name]); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
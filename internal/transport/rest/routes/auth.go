@@ -1,23 +1,23 @@
 package routes
 
 import (
-	myhttp "apibgo/internal/utils/http"
 	"context"
-	"encoding/json"
-	"io"
 	"net/http"
-	"strings"
 
 	"apibgo/internal/config"
 	domainAuth "apibgo/internal/domain/auth"
+	"apibgo/internal/repository"
 	"apibgo/internal/service"
 	"apibgo/internal/storage"
 	"apibgo/internal/storage/pgsql"
+	"apibgo/internal/transport/rest"
 	"apibgo/internal/utils/request"
 	"apibgo/internal/utils/response"
+	"apibgo/pkg/auth/device"
+	"apibgo/pkg/clientip"
 	"apibgo/pkg/logger"
 	"apibgo/pkg/logger/feature/slog"
-	"apibgo/pkg/utils"
+	"apibgo/pkg/mail"
 
 	_ "apibgo/docs/swagger"
 
@@ -27,6 +27,8 @@ import (
 type Auth struct {
 	Config  *config.Config
 	Storage *storage.Config
+	// Options of the services made for the requests
+	Services []service.Option
 }
 
 func (a *Auth) NewHandler(r *mux.Router) {
@@ -58,61 +60,44 @@ func (a *Auth) NewHandler(r *mux.Router) {
 // @Param email body string true "Email"
 // @Param password body string true "Password"
 // @Success 200 {object} response.DocSuccessResponse
-// @Failure 400 {object} response.DocErrorResponse
+// @Failure 400 {object} response.DocProblemResponse
 // @Router /auth/login [post]
 func (a *Auth) AuthLogin(w http.ResponseWriter, r *http.Request) {
 	log := logger.Setup(a.Config.Env)
+	dto, ok := request.Decode[domainAuth.LoginDto](w, r)
+
+	if !ok {
+		return
+	}
+
 	pg, err := pgsql.New(a.Storage, "master")
 
 	if err != nil {
 		log.Error("failed to init storage", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		response.Fail(w, r, response.ErrorInternal, "")
 		return
 	}
 
+	defer pg.Db.Close(r.Context())
+
 	log.Info("starting database")
 
-	authService := service.NewAuthService(pg)
-	b, _ := io.ReadAll(r.Body)
-	dto := domainAuth.LoginDto{}
-	_ = json.Unmarshal(b, &dto)
-
-	validator := request.NewValidator()
-	isValid, failMessages := validator.Validate(dto)
-
-	if !isValid {
-		_response := response.Response{
-			Code:    response.ErrorValidation,
-			Message: "validation error",
-			Result:  failMessages,
-			Status:  response.StatusError,
-		}
-		w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-		w.Write(_response.CreateResponseData())
-		return
-	}
+	authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
 
-	dto.Ip = utils.RealIp(r)
+	dto.Ip = clientip.FromRequest(r)
 	dto.UserAgent = r.UserAgent()
+	dto.Hints = device.HintsOf(r.Header)
 
-	_response, err := authService.Login(context.Background(), dto)
+	tokens, err := authService.Login(context.Background(), dto)
 
 	if err != nil {
-		log.Error("failed to execute Login service", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		rest.WriteError(w, r, log, err)
 		return
-	} else {
-		if _response == nil {
-			log.Error("response is empty")
-			w.WriteHeader(http.StatusInternalServerError)
-
-			return
-		}
 	}
 
+	_response := tokensResponse(tokens)
 	_response.SetCookies(&w, log)
-	w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-	w.Write(_response.CreateResponseData())
+	_response.Send(w, r)
 }
 
 // HandleAuthLogin handles registration user.
@@ -125,55 +110,48 @@ func (a *Auth) AuthLogin(w http.ResponseWriter, r *http.Request) {
 // @Param name body string true "Name"
 // @Param surname body string true "Surname"
 // @Success 200 {object} response.DocSuccessResponse
-// @Failure 400 {object} response.DocErrorResponse
+// @Failure 400 {object} response.DocProblemResponse
 // @Router /auth/registration [post]
 func (a *Auth) AuthRegistration(w http.ResponseWriter, r *http.Request) {
 	log := logger.Setup(a.Config.Env)
+	dto, ok := request.Decode[domainAuth.RegistrationDto](w, r)
+
+	if !ok {
+		return
+	}
+
 	pg, err := pgsql.New(a.Storage, "master")
 
 	if err != nil {
 		log.Error("failed to init storage", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		response.Fail(w, r, response.ErrorInternal, "")
 		return
 	}
 
+	defer pg.Db.Close(r.Context())
+
 	log.Info("starting database")
 
-	authService := service.NewAuthService(pg)
-	b, _ := io.ReadAll(r.Body)
-	dto := domainAuth.RegistrationDto{}
-	_ = json.Unmarshal(b, &dto)
-
-	validator := request.NewValidator()
-	isValid, failMessages := validator.Validate(dto)
-
-	if !isValid {
-		_response := response.Response{
-			Code:    response.ErrorValidation,
-			Message: "validation error",
-			Result:  failMessages,
-			Status:  response.StatusError,
-		}
-		w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-		w.Write(_response.CreateResponseData())
-		return
-	}
+	authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
 
-	_response, err := authService.Registration(context.Background(), dto)
+	registration, err := authService.Registration(context.Background(), dto)
 
 	if err != nil {
-		log.Error("failed to execute Registration service", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		rest.WriteError(w, r, log, err)
 		return
 	}
 
-	if _response.HttpCode == 0 {
-		_response.HttpCode = http.StatusOK
+	_response := response.Response{
+		Code:    response.ErrorEmpty,
+		Status:  response.StatusSuccess,
+		Message: "Data is got",
+		Result: map[string]interface{}{
+			"email": registration.Email,
+			"key":   registration.Key,
+		},
+		HttpCode: http.StatusCreated,
 	}
-
-	w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-	w.Write(_response.CreateResponseData())
-	w.WriteHeader(_response.HttpCode)
+	_response.Send(w, r)
 }
 
 // HandleAuthLogin handles logout user.
@@ -182,11 +160,13 @@ func (a *Auth) AuthRegistration(w http.ResponseWriter, r *http.Request) {
 // @Tags Auth
 // @Param Authorization header string true "Bearer token"
 // @Success 200 {object} response.DocSuccessResponse
-// @Failure 422 {object} response.DocErrorResponse
+// @Failure 422 {object} response.DocProblemResponse
 // @Router /auth/logout [post]
 func (a *Auth) AuthLogout(w http.ResponseWriter, r *http.Request) {
-	if _, ok := r.Header["Authorization"]; !ok {
-		w.WriteHeader(http.StatusBadRequest)
+	token, ok := bearerToken(r)
+
+	if !ok {
+		response.Fail(w, r, response.ErrorBadRequest, "the Authorization header is required")
 
 		return
 	}
@@ -196,24 +176,42 @@ func (a *Auth) AuthLogout(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Error("failed to init storage", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		response.Fail(w, r, response.ErrorInternal, "")
 		return
 	}
 
+	defer pg.Db.Close(r.Context())
+
 	log.Info("starting database")
 
-	authService := service.NewAuthService(pg)
-	_response, err := authService.Logout(context.Background(), r.Header["Authorization"])
+	authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
 
-	if err != nil {
-		log.Error("failed to execute Logout service", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	dto := domainAuth.LoginDto{
+		Ip:        clientip.FromRequest(r),
+		UserAgent: r.UserAgent(),
+		Hints:     device.HintsOf(r.Header),
+	}
+
+	if err := authService.Logout(context.Background(), token, dto); err != nil {
+		rest.WriteError(w, r, log, err)
 		return
 	}
 
+	// Resets the refresh token
+	_response := response.Response{
+		Code:    response.ErrorEmpty,
+		Status:  response.StatusSuccess,
+		Message: "Session successfully destroyed",
+		Cookies: []*http.Cookie{{
+			Name:     "refresh_token",
+			Value:    "empty",
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+		}},
+	}
 	_response.SetCookies(&w, log)
-	w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-	w.Write(_response.CreateResponseData())
+	_response.Send(w, r)
 }
 
 // HandleAuthLogin handles refresh jwt tokens.
@@ -222,7 +220,7 @@ func (a *Auth) AuthLogout(w http.ResponseWriter, r *http.Request) {
 // @Tags Auth
 // @Param Authorization header string true "Bearer token"
 // @Success 200 {object} response.DocSuccessResponse
-// @Failure 422 {object} response.DocErrorResponse
+// @Failure 422 {object} response.DocProblemResponse
 // @Router /auth/refresh [get]
 func (a *Auth) AuthRefresh(w http.ResponseWriter, r *http.Request) {
 	log := logger.Setup(a.Config.Env)
@@ -230,7 +228,7 @@ func (a *Auth) AuthRefresh(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Error("failed to get cookie", slog.Err(err))
-		w.WriteHeader(http.StatusBadRequest)
+		response.Fail(w, r, response.ErrorBadRequest, "the refresh_token cookie is required")
 
 		return
 	}
@@ -239,29 +237,31 @@ func (a *Auth) AuthRefresh(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Error("failed to init storage", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		response.Fail(w, r, response.ErrorInternal, "")
 		return
 	}
 
+	defer pg.Db.Close(r.Context())
+
 	log.Info("starting database")
 
 	dto := domainAuth.LoginDto{
-		Ip:        utils.RealIp(r),
+		Ip:        clientip.FromRequest(r),
 		UserAgent: r.UserAgent(),
+		Hints:     device.HintsOf(r.Header),
 	}
 
-	authService := service.NewAuthService(pg)
-	_response, err := authService.Refresh(context.Background(), cookie, dto)
+	authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
+	tokens, err := authService.Refresh(context.Background(), cookie.Value, dto)
 
 	if err != nil {
-		log.Error("failed to execute Refresh service", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		rest.WriteError(w, r, log, err)
 		return
 	}
 
+	_response := tokensResponse(tokens)
 	_response.SetCookies(&w, log)
-	w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-	w.Write(_response.CreateResponseData())
+	_response.Send(w, r)
 }
 
 // HandleAuthLogin handles verify jwt token.
@@ -275,9 +275,11 @@ func (a *Auth) AuthRefresh(w http.ResponseWriter, r *http.Request) {
 func (a *Auth) AuthVerify(w http.ResponseWriter, r *http.Request) {
 	log := logger.Setup(a.Config.Env)
 
-	if _, ok := r.Header["Authorization"]; !ok {
+	token, ok := bearerToken(r)
+
+	if !ok {
 		log.Error("failed to get header of the Authorization")
-		w.WriteHeader(http.StatusBadRequest)
+		response.Fail(w, r, response.ErrorBadRequest, "the Authorization header is required")
 
 		return
 	}
@@ -286,16 +288,15 @@ func (a *Auth) AuthVerify(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Error("failed to init storage", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		response.Fail(w, r, response.ErrorInternal, "")
 		return
 	}
 
+	defer pg.Db.Close(r.Context())
+
 	log.Info("starting database")
 
-	authService := service.NewAuthService(pg)
-	// Parse header Authorization and get token
-	split := strings.Split(r.Header["Authorization"][0], " ")
-	token := split[1]
+	authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
 	isVerify, err := authService.VerifyToken(context.Background(), token)
 
 	if err != nil {
@@ -303,7 +304,8 @@ func (a *Auth) AuthVerify(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !isVerify {
-		w.WriteHeader(http.StatusUnauthorized)
+		response.Fail(w, r, response.ErrorUnauthorized, "")
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -317,40 +319,41 @@ func (a *Auth) AuthVerify(w http.ResponseWriter, r *http.Request) {
 // @Param code body string true "Code"
 // @Param key body string true "Signed key"
 // @Success 200 {object} response.DocSuccessResponse
-// @Failure 422 {object} response.DocErrorResponse
+// @Failure 422 {object} response.DocProblemResponse
 // @Router /auth/activation [patch]
 func (a *Auth) AuthActivation(w http.ResponseWriter, r *http.Request) {
 	log := logger.Setup(a.Config.Env)
+	dto, ok := request.Decode[domainAuth.ActivationDto](w, r)
+
+	if !ok {
+		return
+	}
+
 	pg, err := pgsql.New(a.Storage, "master")
 
 	if err != nil {
 		log.Error("failed to init storage", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		response.Fail(w, r, response.ErrorInternal, "")
 		return
 	}
 
-	log.Info("starting database")
+	defer pg.Db.Close(r.Context())
 
-	authService := service.NewAuthService(pg)
-	b, _ := io.ReadAll(r.Body)
-	dto := domainAuth.ActivationDto{}
-	_ = json.Unmarshal(b, &dto)
+	log.Info("starting database")
 
-	_response, err := authService.Activation(context.Background(), dto)
+	authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
 
-	if err != nil {
-		log.Error("failed to execute Activation service", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := authService.Activation(context.Background(), dto); err != nil {
+		rest.WriteError(w, r, log, err)
 		return
-	} else {
-		if _response == nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
 	}
 
-	w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-	w.Write(_response.CreateResponseData())
+	_response := response.Response{
+		Code:    response.ErrorEmpty,
+		Status:  response.StatusSuccess,
+		Message: "your account successfully activated",
+	}
+	_response.Send(w, r)
 }
 
 // HandleAuthLogin handles account forgot password.
@@ -359,40 +362,41 @@ func (a *Auth) AuthActivation(w http.ResponseWriter, r *http.Request) {
 // @Tags Auth
 // @Param email body string true "Email"
 // @Success 200 {object} response.DocSuccessResponse
-// @Failure 422 {object} response.DocErrorResponse
+// @Failure 422 {object} response.DocProblemResponse
 // @Router /auth/forgot [post]
 func (a *Auth) AuthForgot(w http.ResponseWriter, r *http.Request) {
 	log := logger.Setup(a.Config.Env)
+	dto, ok := request.Decode[domainAuth.ForgotDto](w, r)
+
+	if !ok {
+		return
+	}
+
 	pg, err := pgsql.New(a.Storage, "master")
 
 	if err != nil {
 		log.Error("failed to init storage", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		response.Fail(w, r, response.ErrorInternal, "")
 		return
 	}
 
-	log.Info("starting database")
+	defer pg.Db.Close(r.Context())
 
-	authService := service.NewAuthService(pg)
-	b, _ := io.ReadAll(r.Body)
-	dto := domainAuth.ForgotDto{}
-	_ = json.Unmarshal(b, &dto)
+	log.Info("starting database")
 
-	_response, err := authService.Forgot(context.Background(), dto)
+	authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
 
-	if err != nil {
-		log.Error("failed to execute Forgot service", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := authService.Forgot(context.Background(), dto); err != nil {
+		rest.WriteError(w, r, log, err)
 		return
-	} else {
-		if _response == nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
 	}
 
-	w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-	w.Write(_response.CreateResponseData())
+	_response := response.Response{
+		Code:    response.ErrorEmpty,
+		Status:  response.StatusSuccess,
+		Message: "a code was sent to your email",
+	}
+	_response.Send(w, r)
 }
 
 // HandleAuthLogin handles account recovery password.
@@ -404,40 +408,41 @@ func (a *Auth) AuthForgot(w http.ResponseWriter, r *http.Request) {
 // @Param password body string true "Password"
 // @Param confirm_password body string true "Confirm Password"
 // @Success 200 {object} response.DocSuccessResponse
-// @Failure 422 {object} response.DocErrorResponse
+// @Failure 422 {object} response.DocProblemResponse
 // @Router /auth/recovery [post]
 func (a *Auth) AuthRecovery(w http.ResponseWriter, r *http.Request) {
 	log := logger.Setup(a.Config.Env)
+	dto, ok := request.Decode[domainAuth.RecoveryDto](w, r)
+
+	if !ok {
+		return
+	}
+
 	pg, err := pgsql.New(a.Storage, "master")
 
 	if err != nil {
 		log.Error("failed to init storage", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		response.Fail(w, r, response.ErrorInternal, "")
 		return
 	}
 
-	log.Info("starting database")
+	defer pg.Db.Close(r.Context())
 
-	authService := service.NewAuthService(pg)
-	b, _ := io.ReadAll(r.Body)
-	dto := domainAuth.RecoveryDto{}
-	_ = json.Unmarshal(b, &dto)
+	log.Info("starting database")
 
-	_response, err := authService.Recovery(context.Background(), dto)
+	authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
 
-	if err != nil {
-		log.Error("failed to execute Recovery service", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := authService.Recovery(context.Background(), dto); err != nil {
+		rest.WriteError(w, r, log, err)
 		return
-	} else {
-		if _response == nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
 	}
 
-	w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-	w.Write(_response.CreateResponseData())
+	_response := response.Response{
+		Code:    response.ErrorEmpty,
+		Status:  response.StatusSuccess,
+		Message: "your account password successfully changed",
+	}
+	_response.Send(w, r)
 }
 
 // HandleAuthLogin handles checks confirm code.
@@ -448,40 +453,41 @@ func (a *Auth) AuthRecovery(w http.ResponseWriter, r *http.Request) {
 // @Param action body service.SectionConfirm true "Action"
 // @Param code body string true "Code"
 // @Success 200 {object} response.DocSuccessResponse
-// @Failure 422 {object} response.DocErrorResponse
+// @Failure 422 {object} response.DocProblemResponse
 // @Router /auth/confirm-check [post]
 func (a *Auth) AuthConfirmCheck(w http.ResponseWriter, r *http.Request) {
 	log := logger.Setup(a.Config.Env)
+	dto, ok := request.Decode[domainAuth.ConfirmCheckDto](w, r)
+
+	if !ok {
+		return
+	}
+
 	pg, err := pgsql.New(a.Storage, "master")
 
 	if err != nil {
 		log.Error("failed to init storage", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		response.Fail(w, r, response.ErrorInternal, "")
 		return
 	}
 
-	log.Info("starting database")
+	defer pg.Db.Close(r.Context())
 
-	authService := service.NewAuthService(pg)
-	b, _ := io.ReadAll(r.Body)
-	dto := domainAuth.ConfirmCheckDto{}
-	_ = json.Unmarshal(b, &dto)
+	log.Info("starting database")
 
-	_response, err := authService.ConfirmCheck(context.Background(), dto)
+	authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
 
-	if err != nil {
-		log.Error("failed to execute ConfirmCheck service", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := authService.ConfirmCheck(context.Background(), dto); err != nil {
+		rest.WriteError(w, r, log, err)
 		return
-	} else {
-		if _response == nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
 	}
 
-	w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-	w.Write(_response.CreateResponseData())
+	_response := response.Response{
+		Code:    response.ErrorEmpty,
+		Status:  response.StatusSuccess,
+		Message: "the code is relevant",
+	}
+	_response.Send(w, r)
 }
 
 // HandleAuthLogin handles resend confirm code.
@@ -491,37 +497,40 @@ func (a *Auth) AuthConfirmCheck(w http.ResponseWriter, r *http.Request) {
 // @Param section path service.SectionSend true "Resend for section"
 // @Param email body string true "Email"
 // @Success 200 {object} response.DocSuccessResponse
-// @Failure 422 {object} response.DocErrorResponse
+// @Failure 422 {object} response.DocProblemResponse
 // @Router /auth/resend/{section}/ [post]
 func (a *Auth) AuthResend(w http.ResponseWriter, r *http.Request) {
 	log := logger.Setup(a.Config.Env)
+	dto, ok := request.Decode[domainAuth.ResendDto](w, r)
+
+	if !ok {
+		return
+	}
+
 	pg, err := pgsql.New(a.Storage, "master")
 
 	if err != nil {
 		log.Error("failed to init storage", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		response.Fail(w, r, response.ErrorInternal, "")
 		return
 	}
 
+	defer pg.Db.Close(r.Context())
+
 	log.Info("starting database")
 
 	vars := mux.Vars(r)
-	authService := service.NewAuthService(pg)
-	jsond, _ := io.ReadAll(r.Body)
-
-	_response, err := authService.Resend(context.Background(), service.SectionSend(vars["section"]), jsond)
+	authService := service.NewAuthService(repository.NewStore(pg), mail.NewFromEnv(), a.Services...)
 
-	if err != nil {
-		log.Error("failed to execute Resend service", slog.Err(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	if err := authService.Resend(context.Background(), service.SectionSend(vars["section"]), dto); err != nil {
+		rest.WriteError(w, r, log, err)
 		return
-	} else {
-		if _response == nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
 	}
 
-	w.Header().Set("Content-Type", string(myhttp.ContentType_JSON))
-	w.Write(_response.CreateResponseData())
+	_response := response.Response{
+		Code:    response.ErrorEmpty,
+		Status:  response.StatusSuccess,
+		Message: "a code was sent to your email",
+	}
+	_response.Send(w, r)
 }
@@ -0,0 +1,326 @@
+package routes
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"apibgo/internal/domain"
+	domainAuth "apibgo/internal/domain/auth"
+	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/utils/response"
+	"apibgo/pkg/auth/device"
+)
+
+// Returns the token of the "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+
+	return strings.TrimSpace(token), true
+}
+
+// The tokens of the login and refresh, the cookie is set only for remade tokens
+func tokensResponse(tokens domainAuth.Tokens) response.Response {
+	_response := response.Response{
+		Code:    response.ErrorEmpty,
+		Status:  response.StatusSuccess,
+		Message: "Data is got",
+		Result: map[string]interface{}{
+			"access_token":  tokens.AccessToken,
+			"refresh_token": tokens.RefreshToken,
+		},
+	}
+
+	if !tokens.RefreshExpiresAt.IsZero() {
+		_response.Cookies = []*http.Cookie{{
+			Name:     "refresh_token",
+			Value:    tokens.RefreshToken,
+			Path:     "/",
+			HttpOnly: true,
+			Expires:  tokens.RefreshExpiresAt,
+		}}
+	}
+
+	return _response
+}
+
+func userResult(user domainUser.User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":         user.Id,
+		"email":      user.Email,
+		"name":       user.Name.String,
+		"surname":    user.Surname.String,
+		"activation": user.Activation,
+		"status":     user.ConfirmStatus,
+		"group_id":   user.GroupId,
+		"locale":     nullString(user.Locale),
+		"timezone":   nullString(user.Timezone),
+		"version":    user.Version,
+	}
+}
+
+// The string or nil of the null
+func nullString(value sql.NullString) interface{} {
+	if !value.Valid {
+		return nil
+	}
+
+	return value.String
+}
+
+// The number or nil of the null
+func nullFloat(value sql.NullFloat64) interface{} {
+	if !value.Valid {
+		return nil
+	}
+
+	return value.Float64
+}
+
+// The fields of the user which a JSON Patch may change, named as in the
+// merge patch, write-only fields like the password are absent
+func patchDocument(user domainUser.User) map[string]any {
+	return map[string]any{
+		"email":          user.Email,
+		"name":           nullString(user.Name),
+		"surname":        nullString(user.Surname),
+		"locale":         nullString(user.Locale),
+		"timezone":       nullString(user.Timezone),
+		"activation":     user.Activation,
+		"confirm_status": user.ConfirmStatus,
+		"group_id":       user.GroupId,
+	}
+}
+
+// The fields of the own profile which a JSON Patch of /users/me/ may change
+func meDocument(user domainUser.User) map[string]any {
+	return map[string]any{
+		"name":     nullString(user.Name),
+		"surname":  nullString(user.Surname),
+		"locale":   nullString(user.Locale),
+		"timezone": nullString(user.Timezone),
+	}
+}
+
+// The user with the rank and the highlighted text of the match
+func matchResult(match domainUser.Match) map[string]interface{} {
+	result := userResult(match.User)
+	result["rank"] = match.Rank
+	result["highlight"] = match.Highlight
+
+	return result
+}
+
+// The session, current is the session of the request
+func sessionResult(auth domainAuth.Auth, current bool) map[string]interface{} {
+	result := map[string]interface{}{
+		"id":   auth.Id,
+		"name": device.Name(auth.UserAgent),
+		"ip":   auth.Ip,
+		"device": map[string]string{
+			"name": auth.Device,
+			"info": strings.Join([]string{device.DetectOS(auth.UserAgent), device.DetectBrowser(auth.UserAgent)}, ","),
+		},
+		"current":   current,
+		"last_seen": nil,
+		"last_ip":   nullString(auth.LastIp),
+		"time":      auth.CreatedAt.Format("02-01-2006 15:04:05"),
+	}
+
+	if auth.Name.Valid {
+		result["name"] = auth.Name.String
+	}
+
+	if auth.LastSeenAt.Valid {
+		result["last_seen"] = auth.LastSeenAt.Time.Format("02-01-2006 15:04:05")
+	}
+
+	return result
+}
+
+// The page of a list with the Link header of the neighbour pages
+func pageResponse[T any](r *http.Request, dto domain.PageDto, page domain.Page[T], result func(T) map[string]interface{}) response.Response {
+	data := make([]map[string]interface{}, 0, len(page.Items))
+
+	for _, item := range page.Items {
+		data = append(data, result(item))
+	}
+
+	_response := response.Response{
+		Code:    response.ErrorEmpty,
+		Status:  response.StatusSuccess,
+		Message: "data is got",
+		Result: map[string]interface{}{
+			"count":       page.Total,
+			"data":        data,
+			"next_cursor": page.Next,
+		},
+	}
+
+	if links := pageLinks(r, dto, page); len(links) > 0 {
+		_response.Headers = http.Header{"Link": {strings.Join(links, ", ")}}
+	}
+
+	return _response
+}
+
+// Links of RFC 8288 to the pages. Pages of cursors link only to the first
+// and the next ones, pages of offsets link to the first, previous, next and last.
+func pageLinks[T any](r *http.Request, dto domain.PageDto, page domain.Page[T]) []string {
+	var links []string
+
+	link := func(rel string, set map[string]string) {
+		query := r.URL.Query()
+		query.Del("cursor")
+		query.Del("offset")
+
+		for name, value := range set {
+			query.Set(name, value)
+		}
+
+		target := r.URL.Path
+
+		if encoded := query.Encode(); encoded != "" {
+			target += "?" + encoded
+		}
+
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, target, rel))
+	}
+
+	if dto.Cursor != "" {
+		link("first", nil)
+
+		if page.Next != "" {
+			link("next", map[string]string{"cursor": page.Next})
+		}
+
+		return links
+	}
+
+	limit := dto.Size()
+	offset := func(n int) map[string]string {
+		if n <= 0 {
+			return nil
+		}
+
+		return map[string]string{"offset": strconv.Itoa(n)}
+	}
+
+	link("first", nil)
+
+	if dto.Offset > 0 {
+		link("prev", offset(max(dto.Offset-limit, 0)))
+	}
+
+	if dto.Offset+limit < page.Total {
+		link("next", offset(dto.Offset+limit))
+	}
+
+	if page.Total > 0 {
+		link("last", offset((page.Total-1)/limit*limit))
+	}
+
+	return links
+}
+
+// The ban, the expired_at of the ban forever is null
+func banResult(ban domainUser.Ban) map[string]interface{} {
+	var expiredAt interface{}
+
+	if ban.ExpiredAt.Valid {
+		expiredAt = ban.ExpiredAt.Time.Format("02-01-2006 15:04:05")
+	}
+
+	return map[string]interface{}{
+		"id":         ban.Id,
+		"user_id":    ban.UserId,
+		"reason_id":  ban.ReasonId,
+		"expired_at": expiredAt,
+		"created_at": ban.CreatedAt.Format("02-01-2006 15:04:05"),
+	}
+}
+
+// The login event, the device, OS and browser are of its time
+func eventResult(event domainAuth.LoginEvent) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      event.Id,
+		"kind":    event.Kind,
+		"success": event.Success,
+		"ip":      nullString(event.Ip),
+		"device": map[string]string{
+			"name":    event.Device,
+			"os":      event.Os,
+			"browser": event.Browser,
+		},
+		"time": event.CreatedAt.Format("02-01-2006 15:04:05"),
+	}
+}
+
+// The personal data of the user by the parts of the archive, the secrets
+// like the password and the tokens are absent
+func exportResult(export domainUser.Export) map[string]interface{} {
+	profile := userResult(export.User)
+	profile["created_at"] = export.User.CreatedAt.Format(time.RFC3339)
+	profile["last_activity_at"] = nil
+
+	if export.User.LastActivityAt.Valid {
+		profile["last_activity_at"] = export.User.LastActivityAt.Time.Format(time.RFC3339)
+	}
+
+	sessions := make([]map[string]interface{}, 0, len(export.Sessions))
+
+	for _, auth := range export.Sessions {
+		session := sessionResult(auth, false)
+		session["user_agent"] = auth.UserAgent
+		sessions = append(sessions, session)
+	}
+
+	logins := make([]map[string]interface{}, 0, len(export.Logins))
+
+	for _, event := range export.Logins {
+		login := eventResult(event)
+		login["user_agent"] = event.UserAgent.String
+		logins = append(logins, login)
+	}
+
+	devices := make([]map[string]interface{}, 0, len(export.Devices))
+
+	for _, device := range export.Devices {
+		devices = append(devices, map[string]interface{}{
+			"name":      device.Name,
+			"ip":        nullString(device.Ip),
+			"country":   device.Country,
+			"latitude":  nullFloat(device.Latitude),
+			"longitude": nullFloat(device.Longitude),
+			"last_seen": device.LastSeenAt.Format(time.RFC3339),
+			"time":      device.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	consents := make([]map[string]interface{}, 0, len(export.Consents))
+
+	for _, consent := range export.Consents {
+		consents = append(consents, map[string]interface{}{
+			"kind":    consent.Kind,
+			"version": consent.Version,
+			"granted": consent.Granted,
+			"ip":      consent.Ip.String,
+			"time":    consent.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	return map[string]interface{}{
+		"profile":  profile,
+		"sessions": sessions,
+		"logins":   logins,
+		"devices":  devices,
+		"consents": consents,
+	}
+}
@@ -1,18 +1,19 @@
 package routes
 
 import (
-	"context"
-	"encoding/json"
-	"io"
 	"net/http"
 	"strconv"
 
 	"apibgo/internal/config"
+	domainAuth "apibgo/internal/domain/auth"
 	domainUser "apibgo/internal/domain/user"
+	"apibgo/internal/repository"
 	"apibgo/internal/service"
 	"apibgo/internal/storage"
 	"apibgo/internal/storage/pgsql"
 	"apibgo/internal/transport/rest"
+	"apibgo/internal/utils/request"
+	"apibgo/internal/utils/response"
 	"apibgo/pkg/logger"
 	"apibgo/pkg/logger/feature/slog"
 
@@ -23,6 +24,8 @@ type User struct {
 	Config      *config.Config
 	Storage     *storage.Config
 	Middlewares []mux.MiddlewareFunc
+	// Options of the services made for the requests
+	Services []service.Option
 }
 
 func (u *User) NewHandler(r *mux.Router) {
@@ -30,77 +33,230 @@ func (u *User) NewHandler(r *mux.Router) {
 	r.HandleFunc("/users/sessions/", rest.Adapt(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log := logger.Setup(u.Config.Env)
+			actor, ok := requestActor(w, r)
+
+			if !ok {
+				return
+			}
+
+			dto, ok := request.DecodeQuery(w, r, func(dto *domainAuth.SessionDto) {
+				dto.Id = actor.UserId
+			})
+
+			if !ok {
+				return
+			}
+
 			pg, err := pgsql.New(u.Storage, "master")
 
 			if err != nil {
 				log.Error("failed to init storage", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				response.Fail(w, r, response.ErrorInternal, "")
 				return
 			}
 
+			defer pg.Db.Close(r.Context())
+
 			log.Info("starting database for sessions")
 
-			userService := service.NewUserService(pg)
-			response, err := userService.Sessions(context.Background(), r.Header["Authorization"])
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
+			auths, err := userService.Sessions(r.Context(), dto)
 
 			if err != nil {
-				log.Error("failed to execute Sessions service", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				rest.WriteError(w, r, log, err)
 				return
-			} else {
-				if response == nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(response.CreateResponseData())
+			_response := pageResponse(r, dto.PageDto, auths, func(auth domainAuth.Auth) map[string]interface{} {
+				return sessionResult(auth, int(auth.Id) == actor.SessionId)
+			})
+			_response.Send(w, r)
 		}),
 		u.Middlewares...,
 	).ServeHTTP).Methods(http.MethodGet)
 
+	// route: log out on the other devices
+	r.HandleFunc("/users/sessions/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(u.Config.Env)
+			actor, ok := requestActor(w, r)
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(u.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database for sessions")
+
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
+			destroyed, err := userService.DestroyOtherSessions(r.Context(), actor.UserId, actor.SessionId)
+
+			if err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "Other sessions successfully destroyed",
+				Result: map[string]interface{}{
+					"count": destroyed,
+				},
+			}
+			_response.Send(w, r)
+		}),
+		u.Middlewares...,
+	).ServeHTTP).Methods(http.MethodDelete)
+
+	// route: rename user session
+	r.HandleFunc("/users/sessions/{id}/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(u.Config.Env)
+			actor, ok := requestActor(w, r)
+
+			if !ok {
+				return
+			}
+
+			paramId, _ := strconv.Atoi(mux.Vars(r)["id"])
+			dto, ok := request.Decode(w, r, func(dto *domainAuth.RenameDto) {
+				dto.Id = paramId
+				dto.UserId = actor.UserId
+			})
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(u.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database for sessions")
+
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
+
+			if err := userService.RenameSession(r.Context(), dto); err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "Session successfully renamed",
+			}
+			_response.Send(w, r)
+		}),
+		u.Middlewares...,
+	).ServeHTTP).Methods(http.MethodPatch)
+
 	// route: destroy user session
 	r.HandleFunc("/users/sessions/{id}/", rest.Adapt(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log := logger.Setup(u.Config.Env)
+			actor, ok := requestActor(w, r)
+
+			if !ok {
+				return
+			}
+
 			pg, err := pgsql.New(u.Storage, "master")
 
 			if err != nil {
 				log.Error("failed to init storage", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				response.Fail(w, r, response.ErrorInternal, "")
 				return
 			}
 
+			defer pg.Db.Close(r.Context())
+
 			log.Info("starting database for sessions")
 
 			vars := mux.Vars(r)
-			userService := service.NewUserService(pg)
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
 			paramId, _ := strconv.Atoi(vars["id"])
 
-			response, err := userService.DestroySession(context.Background(), r.Header["Authorization"], paramId)
+			if err := userService.DestroySession(r.Context(), actor.UserId, paramId); err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "Session successfully destroyed",
+			}
+			_response.Send(w, r)
+		}),
+		u.Middlewares...,
+	).ServeHTTP).Methods(http.MethodDelete)
+
+	// route: search users
+	r.HandleFunc("/users/search/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(u.Config.Env)
+			dto, ok := request.DecodeQuery[domainUser.SearchDto](w, r)
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(u.Storage, "master")
 
 			if err != nil {
-				log.Error("failed to execute Sessions service", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
 				return
-			} else {
-				if response == nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
 			}
 
-			if response.HttpCode == 0 {
-				response.HttpCode = http.StatusOK
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database for search")
+
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
+			matches, err := userService.SearchUsers(r.Context(), dto)
+
+			if err != nil {
+				rest.WriteError(w, r, log, err)
+				return
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(response.HttpCode)
-			w.Write(response.CreateResponseData())
+			data := make([]map[string]interface{}, 0, len(matches))
+
+			for _, match := range matches {
+				data = append(data, matchResult(match))
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "data is got",
+				Result: map[string]interface{}{
+					"count": len(data),
+					"data":  data,
+				},
+			}
+			_response.Send(w, r)
 		}),
 		u.Middlewares...,
-	).ServeHTTP).Methods(http.MethodDelete)
+	).ServeHTTP).Methods(http.MethodGet)
 
 	// route: get a user
 	r.HandleFunc("/users/{id}/", rest.Adapt(
@@ -110,34 +266,43 @@ func (u *User) NewHandler(r *mux.Router) {
 
 			if err != nil {
 				log.Error("failed to init storage", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				response.Fail(w, r, response.ErrorInternal, "")
 				return
 			}
 
+			defer pg.Db.Close(r.Context())
+
 			log.Info("starting database")
 
 			vars := mux.Vars(r)
-			userService := service.NewUserService(pg)
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
 			paramId, _ := strconv.Atoi(vars["id"])
 			dto := domainUser.UserDto{
 				Id: paramId,
 			}
 
-			response, err := userService.GetUser(context.Background(), dto)
+			user, err := userService.GetUser(r.Context(), dto)
 
 			if err != nil {
-				log.Error("failed to execute GetUser service", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				rest.WriteError(w, r, log, err)
 				return
-			} else {
-				if response == nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(response.CreateResponseData())
+			etag := response.ETag(user.Version)
+
+			if request.NoneMatch(r, etag) {
+				response.NotModified(w, etag)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "data is got",
+				Result:  userResult(user),
+				Headers: http.Header{"ETag": {etag}},
+			}
+			_response.Send(w, r)
 		}),
 		u.Middlewares...,
 	).ServeHTTP).Methods(http.MethodGet)
@@ -146,32 +311,34 @@ func (u *User) NewHandler(r *mux.Router) {
 	r.HandleFunc("/users/", rest.Adapt(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log := logger.Setup(u.Config.Env)
+			dto, ok := request.DecodeQuery[domainUser.ListDto](w, r)
+
+			if !ok {
+				return
+			}
+
 			pg, err := pgsql.New(u.Storage, "master")
 
 			if err != nil {
 				log.Error("failed to init storage", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				response.Fail(w, r, response.ErrorInternal, "")
 				return
 			}
 
+			defer pg.Db.Close(r.Context())
+
 			log.Info("starting database")
 
-			userService := service.NewUserService(pg)
-			response, err := userService.GetUsers(context.Background())
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
+			users, err := userService.GetUsers(r.Context(), dto)
 
 			if err != nil {
-				log.Error("failed to execute GetUsers service", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				rest.WriteError(w, r, log, err)
 				return
-			} else {
-				if response == nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(response.CreateResponseData())
+			_response := pageResponse(r, dto.PageDto, users, userResult)
+			_response.Send(w, r)
 		}),
 		u.Middlewares...,
 	).ServeHTTP).Methods(http.MethodGet)
@@ -180,84 +347,106 @@ func (u *User) NewHandler(r *mux.Router) {
 	r.HandleFunc("/users/", rest.Adapt(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log := logger.Setup(u.Config.Env)
+			dto, ok := request.Decode[domainUser.CreateUserDto](w, r)
+
+			if !ok {
+				return
+			}
+
 			pg, err := pgsql.New(u.Storage, "master")
 
 			if err != nil {
 				log.Error("failed to init storage", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				response.Fail(w, r, response.ErrorInternal, "")
 				return
 			}
 
+			defer pg.Db.Close(r.Context())
+
 			log.Info("starting database")
 
-			userService := service.NewUserService(pg)
-			b, _ := io.ReadAll(r.Body)
-			dto := domainUser.CreateUserDto{}
-			_ = json.Unmarshal(b, &dto)
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
 
-			response, err := userService.CreateUser(context.Background(), dto)
+			user, err := userService.CreateUser(r.Context(), dto)
 
 			if err != nil {
-				log.Error("failed to execute CreateUser service", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				rest.WriteError(w, r, log, err)
 				return
-			} else {
-				if response == nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
 			}
 
-			if response.HttpCode == 0 {
-				response.HttpCode = http.StatusOK
+			_response := response.Response{
+				Code:     response.ErrorEmpty,
+				Status:   response.StatusSuccess,
+				Message:  "user created successfully",
+				Result:   userResult(user),
+				HttpCode: http.StatusCreated,
 			}
-
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(response.HttpCode)
-			w.Write(response.CreateResponseData())
+			_response.Send(w, r)
 		}),
 		u.Middlewares...,
 	).ServeHTTP).Methods(http.MethodPost)
 
-	// route: update a user
+	// route: patch a user
 	r.HandleFunc("/users/{id}/", rest.Adapt(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log := logger.Setup(u.Config.Env)
+			versions, ok := request.IfMatch(w, r)
+
+			if !ok {
+				return
+			}
+
 			pg, err := pgsql.New(u.Storage, "master")
 
 			if err != nil {
 				log.Error("failed to init storage", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				response.Fail(w, r, response.ErrorInternal, "")
 				return
 			}
 
+			defer pg.Db.Close(r.Context())
+
 			log.Info("starting database")
 
-			vars := mux.Vars(r)
-			userService := service.NewUserService(pg)
-			paramId, _ := strconv.Atoi(vars["id"])
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
+			paramId, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+			// The document a JSON Patch is applied to
+			current := func() (map[string]any, bool) {
+				user, err := userService.GetUser(r.Context(), domainUser.UserDto{Id: paramId})
+
+				if err != nil {
+					rest.WriteError(w, r, log, err)
+					return nil, false
+				}
+
+				return patchDocument(user), true
+			}
 
-			b, _ := io.ReadAll(r.Body)
-			dto := domainUser.UpdateUserDto{}
-			_ = json.Unmarshal(b, &dto)
+			dto, ok := request.DecodePatch(w, r, current, func(dto *domainUser.PatchUserDto) {
+				dto.Id = paramId
+				dto.Versions = versions
+			})
 
-			dto.Id = paramId
+			if !ok {
+				return
+			}
 
-			response, err := userService.UpdateUser(context.Background(), dto)
+			user, err := userService.PatchUser(r.Context(), dto)
 
 			if err != nil {
-				log.Error("failed to execute UpdateUser service", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				rest.WriteError(w, r, log, err)
 				return
-			} else {
-				if response == nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(response.CreateResponseData())
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "user data updated successfully",
+				Result:  userResult(user),
+				Headers: http.Header{"ETag": {response.ETag(user.Version)}},
+			}
+			_response.Send(w, r)
 		}),
 		u.Middlewares...,
 	).ServeHTTP).Methods(http.MethodPatch)
@@ -266,36 +455,121 @@ func (u *User) NewHandler(r *mux.Router) {
 	r.HandleFunc("/users/{id}/", rest.Adapt(
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log := logger.Setup(u.Config.Env)
+			versions, ok := request.IfMatch(w, r)
+
+			if !ok {
+				return
+			}
+
 			pg, err := pgsql.New(u.Storage, "master")
 
 			if err != nil {
 				log.Error("failed to init storage", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				response.Fail(w, r, response.ErrorInternal, "")
 				return
 			}
 
+			defer pg.Db.Close(r.Context())
+
 			log.Info("starting database")
 
 			vars := mux.Vars(r)
-			userService := service.NewUserService(pg)
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
 			paramId, _ := strconv.Atoi(vars["id"])
 
-			response, err := userService.DeleteUser(context.Background(), paramId)
+			if err := userService.DeleteUser(r.Context(), paramId, versions); err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "user deleted successfully",
+			}
+			_response.Send(w, r)
+		}),
+		u.Middlewares...,
+	).ServeHTTP).Methods(http.MethodDelete)
+
+	// route: restore a deleted user
+	r.HandleFunc("/users/{id}/restore/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(u.Config.Env)
+			pg, err := pgsql.New(u.Storage, "master")
 
 			if err != nil {
-				log.Error("failed to execute DeleteUser service", slog.Err(err))
-				w.WriteHeader(http.StatusInternalServerError)
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database")
+
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
+			paramId, _ := strconv.Atoi(mux.Vars(r)["id"])
+			user, err := userService.RestoreUser(r.Context(), paramId)
+
+			if err != nil {
+				rest.WriteError(w, r, log, err)
 				return
-			} else {
-				if response == nil {
-					w.WriteHeader(http.StatusNotFound)
-					return
-				}
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.Write(response.CreateResponseData())
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "user restored successfully",
+				Result:  userResult(user),
+				Headers: http.Header{"ETag": {response.ETag(user.Version)}},
+			}
+			_response.Send(w, r)
 		}),
 		u.Middlewares...,
-	).ServeHTTP).Methods(http.MethodDelete)
+	).ServeHTTP).Methods(http.MethodPost)
+
+	// route: ban a user
+	r.HandleFunc("/users/{id}/ban/", rest.Adapt(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log := logger.Setup(u.Config.Env)
+			paramId, _ := strconv.Atoi(mux.Vars(r)["id"])
+			dto, ok := request.Decode(w, r, func(dto *domainUser.BanDto) {
+				dto.UserId = paramId
+			})
+
+			if !ok {
+				return
+			}
+
+			pg, err := pgsql.New(u.Storage, "master")
+
+			if err != nil {
+				log.Error("failed to init storage", slog.Err(err))
+				response.Fail(w, r, response.ErrorInternal, "")
+				return
+			}
+
+			defer pg.Db.Close(r.Context())
+
+			log.Info("starting database")
+
+			userService := service.NewUserService(repository.NewStore(pg), u.Services...)
+			ban, err := userService.BanUser(r.Context(), dto)
+
+			if err != nil {
+				rest.WriteError(w, r, log, err)
+				return
+			}
+
+			_response := response.Response{
+				Code:    response.ErrorEmpty,
+				Status:  response.StatusSuccess,
+				Message: "user banned successfully",
+				Result:  banResult(ban),
+			}
+			_response.Send(w, r)
+		}),
+		u.Middlewares...,
+	).ServeHTTP).Methods(http.MethodPost)
 }
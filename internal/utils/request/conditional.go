@@ -0,0 +1,65 @@
+package request
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"apibgo/internal/domain"
+	"apibgo/internal/utils/response"
+)
+
+// IfMatch returns the versions of the If-Match header (RFC 9110) of the
+// change of a resource, none for "*" which matches any version. A missing
+// header is answered by 428, a list without a tag of a version by 412,
+// then false is returned.
+func IfMatch(w http.ResponseWriter, r *http.Request) (domain.Versions, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+
+	if header == "" {
+		response.Fail(w, r, response.ErrorPreconditionRequired, "the If-Match header with the ETag of the resource is required")
+		return nil, false
+	}
+
+	if header == "*" {
+		return nil, true
+	}
+
+	var versions domain.Versions
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		// Weak tags never match by the strong comparison of If-Match
+		version, err := strconv.Atoi(strings.Trim(tag, `"`))
+
+		if err == nil && version > 0 && response.ETag(version) == tag {
+			versions = append(versions, version)
+		}
+	}
+
+	if len(versions) == 0 {
+		response.Fail(w, r, response.ErrorPreconditionFailed, "the If-Match header doesn't match the resource")
+		return nil, false
+	}
+
+	return versions, true
+}
+
+// NoneMatch tells whether the If-None-Match header matches the entity tag
+// by the weak comparison, then the resource isn't modified for the client
+func NoneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,46 @@
+package request_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"apibgo/internal/domain"
+	"apibgo/internal/utils/request"
+)
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		versions domain.Versions
+		status   int
+	}{
+		{name: "one tag", header: `"3"`, versions: domain.Versions{3}, status: http.StatusOK},
+		{name: "any", header: "*", status: http.StatusOK},
+		{name: "list", header: `"3", "4",  "5"`, versions: domain.Versions{3, 4, 5}, status: http.StatusOK},
+		{name: "weak and foreign tags are skipped", header: `W/"2", "abc", "4"`, versions: domain.Versions{4}, status: http.StatusOK},
+		{name: "missing", status: http.StatusPreconditionRequired},
+		{name: "weak tag", header: `W/"3"`, status: http.StatusPreconditionFailed},
+		{name: "not a version", header: `"abc", "0"`, status: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/users/1/", nil)
+			r.Header.Set("If-Match", tt.header)
+			w := httptest.NewRecorder()
+
+			versions, ok := request.IfMatch(w, r)
+
+			if ok != (tt.status == http.StatusOK) || (!ok && w.Code != tt.status) {
+				t.Fatalf("ok = %v, status %d, want %d", ok, w.Code, tt.status)
+			}
+
+			if !reflect.DeepEqual(versions, tt.versions) {
+				t.Errorf("versions = %v, want %v", versions, tt.versions)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"apibgo/internal/utils/response"
+)
+
+const defaultMaxBodyBytes = 1 << 20
+
+var maxBodyBytes atomic.Int64
+
+func init() {
+	maxBodyBytes.Store(defaultMaxBodyBytes)
+}
+
+// SetMaxBodyBytes sets the limit of a request body read by Decode
+func SetMaxBodyBytes(n int64) {
+	if n <= 0 {
+		n = defaultMaxBodyBytes
+	}
+
+	maxBodyBytes.Store(n)
+}
+
+// Decode reads the JSON body of the request into T and validates it.
+// The prepare functions fill T before the validation, e.g. by path params.
+// On failure the error response is written (400, 413 or 415) and false is returned.
+func Decode[T any](w http.ResponseWriter, r *http.Request, prepare ...func(*T)) (T, bool) {
+	var dto T
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		fail(w, r, http.StatusUnsupportedMediaType, response.ErrorUnsupportedMediaType, "content type must be application/json", nil)
+		return dto, false
+	}
+
+	if !decodeBody(w, r, &dto) {
+		return dto, false
+	}
+
+	return dto, validateDto(w, r, &dto, prepare)
+}
+
+// Reads the single JSON value of the body into v, unknown fields are errors
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	body := http.MaxBytesReader(w, r.Body, maxBodyBytes.Load())
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		decodeFail(w, r, err)
+		return false
+	}
+
+	// The body must contain only one JSON value
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+
+		if errors.As(err, &maxBytesErr) {
+			decodeFail(w, r, err)
+		} else {
+			fail(w, r, http.StatusBadRequest, response.ErrorBadRequest, "request body must contain a single JSON object", nil)
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func validateDto[T any](w http.ResponseWriter, r *http.Request, dto *T, prepare []func(*T)) bool {
+	for _, fn := range prepare {
+		fn(dto)
+	}
+
+	validator := NewValidator()
+	isValid, failMessages := validator.Validate(*dto)
+
+	if !isValid {
+		fail(w, r, http.StatusBadRequest, response.ErrorValidation, "validation error", failMessages)
+		return false
+	}
+
+	return true
+}
+
+func decodeFail(w http.ResponseWriter, r *http.Request, err error) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		fail(w, r, http.StatusRequestEntityTooLarge, response.ErrorPayloadTooLarge, fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit), nil)
+	case errors.Is(err, io.EOF):
+		fail(w, r, http.StatusBadRequest, response.ErrorBadRequest, "request body must not be empty", nil)
+	case errors.As(err, &syntaxErr):
+		fail(w, r, http.StatusBadRequest, response.ErrorBadRequest, fmt.Sprintf("request body contains malformed JSON (at position %d)", syntaxErr.Offset), nil)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		fail(w, r, http.StatusBadRequest, response.ErrorBadRequest, "request body contains malformed JSON", nil)
+	case errors.As(err, &typeErr):
+		fail(w, r, http.StatusBadRequest, response.ErrorBadRequest, fmt.Sprintf("field %s must be of %s type", typeErr.Field, typeErr.Type), nil)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		fail(w, r, http.StatusBadRequest, response.ErrorBadRequest, "request body contains unknown field "+field, nil)
+	default:
+		fail(w, r, http.StatusBadRequest, response.ErrorBadRequest, err.Error(), nil)
+	}
+}
+
+func fail(w http.ResponseWriter, r *http.Request, status int, code response.Code, message string, result interface{}) {
+	_response := response.Response{
+		Code:     code,
+		Status:   response.StatusError,
+		Message:  message,
+		Result:   result,
+		HttpCode: status,
+	}
+
+	_response.Send(w, r)
+}
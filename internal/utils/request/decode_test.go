@@ -0,0 +1,80 @@
+package request_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"apibgo/internal/utils/request"
+	"apibgo/internal/utils/response"
+)
+
+type loginDto struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+	Ip       string `json:"-"`
+}
+
+func TestDecode(t *testing.T) {
+	request.SetMaxBodyBytes(64)
+	defer request.SetMaxBodyBytes(0)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        response.Code
+	}{
+		{name: "valid", contentType: "application/json", body: `{"email":"user@example.com","password":"secret"}`, status: http.StatusOK},
+		{name: "charset", contentType: "application/json; charset=utf-8", body: `{"email":"user@example.com","password":"secret"}`, status: http.StatusOK},
+		{name: "json suffix", contentType: "application/merge-patch+json", body: `{"email":"user@example.com","password":"secret"}`, status: http.StatusOK},
+		{name: "no content type", body: `{}`, status: http.StatusUnsupportedMediaType, code: response.ErrorUnsupportedMediaType},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: `email=a`, status: http.StatusUnsupportedMediaType, code: response.ErrorUnsupportedMediaType},
+		{name: "empty", contentType: "application/json", status: http.StatusBadRequest, code: response.ErrorBadRequest},
+		{name: "malformed", contentType: "application/json", body: `{"email":}`, status: http.StatusBadRequest, code: response.ErrorBadRequest},
+		{name: "truncated", contentType: "application/json", body: `{"email":"a`, status: http.StatusBadRequest, code: response.ErrorBadRequest},
+		{name: "wrong type", contentType: "application/json", body: `{"email":1}`, status: http.StatusBadRequest, code: response.ErrorBadRequest},
+		{name: "unknown field", contentType: "application/json", body: `{"email":"user@example.com","password":"secret","admin":true}`, status: http.StatusBadRequest, code: response.ErrorBadRequest},
+		{name: "hidden field", contentType: "application/json", body: `{"email":"user@example.com","password":"secret","Ip":"1.1.1.1"}`, status: http.StatusBadRequest, code: response.ErrorBadRequest},
+		{name: "two values", contentType: "application/json", body: `{"email":"user@example.com","password":"secret"} {}`, status: http.StatusBadRequest, code: response.ErrorBadRequest},
+		{name: "too large", contentType: "application/json", body: `{"email":"` + strings.Repeat("a", 64) + `@example.com","password":"secret"}`, status: http.StatusRequestEntityTooLarge, code: response.ErrorPayloadTooLarge},
+		{name: "invalid", contentType: "application/json", body: `{"email":"user"}`, status: http.StatusBadRequest, code: response.ErrorValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			dto, ok := request.Decode(w, r, func(dto *loginDto) {
+				dto.Ip = "192.0.2.1"
+			})
+
+			if ok != (tt.status == http.StatusOK) {
+				t.Fatalf("ok = %v, status %d: %s", ok, w.Code, w.Body)
+			}
+
+			if ok {
+				if dto.Email != "user@example.com" || dto.Ip != "192.0.2.1" {
+					t.Fatalf("dto = %+v", dto)
+				}
+
+				return
+			}
+
+			var problem response.Problem
+
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+
+			if w.Code != tt.status || problem.Status != tt.status || problem.Code != tt.code {
+				t.Fatalf("status = %d, problem = %+v, want %d and the code %d", w.Code, problem, tt.status, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package request
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+
+	"apibgo/internal/utils/response"
+	"apibgo/pkg/jsonpatch"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// DecodePatch reads the patch of the request into T and validates it.
+// A JSON Merge Patch (RFC 7396, application/merge-patch+json or
+// application/json) is decoded as is. A JSON Patch (RFC 6902,
+// application/json-patch+json) is applied to the document of the current
+// resource and the difference is decoded as the merge patch, removed
+// members become nulls. The current function writes its own error response.
+// On failure the error response is written and false is returned.
+func DecodePatch[T any](w http.ResponseWriter, r *http.Request, current func() (map[string]any, bool), prepare ...func(*T)) (T, bool) {
+	var dto T
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if err != nil {
+		mediaType = ""
+	}
+
+	switch mediaType {
+	case MergePatchType, "application/json":
+		if !decodeBody(w, r, &dto) {
+			return dto, false
+		}
+	case JSONPatchType:
+		merge, ok := applyPatch(w, r, current)
+
+		if !ok {
+			return dto, false
+		}
+
+		// The patched document is checked by the same rules as the merge patch
+		data, _ := json.Marshal(merge)
+		r.Body = io.NopCloser(bytes.NewReader(data))
+
+		if !decodeBody(w, r, &dto) {
+			return dto, false
+		}
+	default:
+		w.Header().Set("Accept-Patch", MergePatchType+", "+JSONPatchType)
+		fail(w, r, http.StatusUnsupportedMediaType, response.ErrorUnsupportedMediaType, "content type must be "+MergePatchType+" or "+JSONPatchType, nil)
+		return dto, false
+	}
+
+	return dto, validateDto(w, r, &dto, prepare)
+}
+
+// Applies the JSON Patch of the body to the current document and returns
+// the merge patch of the changed members
+func applyPatch(w http.ResponseWriter, r *http.Request, current func() (map[string]any, bool)) (map[string]any, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes.Load()))
+
+	if err != nil {
+		decodeFail(w, r, err)
+		return nil, false
+	}
+
+	ops, err := jsonpatch.Decode(data)
+
+	if err != nil {
+		fail(w, r, http.StatusBadRequest, response.ErrorBadRequest, err.Error(), nil)
+		return nil, false
+	}
+
+	doc, ok := current()
+
+	if !ok {
+		return nil, false
+	}
+
+	patched, err := jsonpatch.Apply(doc, ops)
+
+	if errors.Is(err, jsonpatch.ErrInvalid) {
+		fail(w, r, http.StatusBadRequest, response.ErrorBadRequest, err.Error(), nil)
+		return nil, false
+	}
+
+	if err != nil {
+		fail(w, r, http.StatusUnprocessableEntity, response.ErrorPatchFailed, err.Error(), nil)
+		return nil, false
+	}
+
+	result, ok := patched.(map[string]any)
+
+	if !ok {
+		fail(w, r, http.StatusUnprocessableEntity, response.ErrorPatchFailed, "the patched document must be an object", nil)
+		return nil, false
+	}
+
+	// The document is a copy of JSON values, so it is compared after the same round trip
+	original, _ := jsonpatch.Apply(doc, nil)
+	before, _ := original.(map[string]any)
+	merge := map[string]any{}
+
+	for name, value := range result {
+		if old, ok := before[name]; !ok || !reflect.DeepEqual(old, value) {
+			merge[name] = value
+		}
+	}
+
+	for name := range before {
+		if _, ok := result[name]; !ok {
+			merge[name] = nil
+		}
+	}
+
+	return merge, true
+}
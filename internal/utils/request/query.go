@@ -0,0 +1,117 @@
+package request
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+
+	"apibgo/internal/utils/response"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// DecodeQuery reads the query string into the fields of T with "query" tags
+// and validates T. Strings, integers, booleans, their pointers and times
+// (RFC 3339 or 2006-01-02) are supported, embedded structs are read too.
+// The prepare functions fill T before the validation, e.g. by path params.
+// On failure the validation error is written and false is returned.
+func DecodeQuery[T any](w http.ResponseWriter, r *http.Request, prepare ...func(*T)) (T, bool) {
+	var dto T
+
+	messages := map[string][]string{}
+	decodeValues(reflect.ValueOf(&dto).Elem(), r.URL.Query(), messages)
+
+	if len(messages) > 0 {
+		fail(w, r, http.StatusBadRequest, response.ErrorValidation, "validation error", messages)
+		return dto, false
+	}
+
+	return dto, validateDto(w, r, &dto, prepare)
+}
+
+func decodeValues(v reflect.Value, values url.Values, messages map[string][]string) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			decodeValues(v.Field(i), values, messages)
+			continue
+		}
+
+		name := field.Tag.Get("query")
+
+		if name == "" || !values.Has(name) {
+			continue
+		}
+
+		if err := setValue(v.Field(i), values.Get(name)); err != "" {
+			messages[name] = append(messages[name], name+" "+err)
+		}
+	}
+}
+
+// Sets the field by the raw value, the message of an error is returned
+func setValue(field reflect.Value, raw string) string {
+	if field.Kind() == reflect.Pointer {
+		value := reflect.New(field.Type().Elem())
+
+		if err := setValue(value.Elem(), raw); err != "" {
+			return err
+		}
+
+		field.Set(value)
+
+		return ""
+	}
+
+	if field.Type() == timeType {
+		t, err := time.Parse(time.RFC3339, raw)
+
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, raw)
+		}
+
+		if err != nil {
+			return "must be a date or a time in RFC 3339"
+		}
+
+		field.Set(reflect.ValueOf(t))
+
+		return ""
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, field.Type().Bits())
+
+		if err != nil {
+			return "must be an integer"
+		}
+
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, field.Type().Bits())
+
+		if err != nil {
+			return "must be a positive integer"
+		}
+
+		field.SetUint(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+
+		if err != nil {
+			return "must be true or false"
+		}
+
+		field.SetBool(b)
+	default:
+		return "is not supported"
+	}
+
+	return ""
+}
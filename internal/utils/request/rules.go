@@ -0,0 +1,129 @@
+package request
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"apibgo/pkg/auth/pswd"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Custom rules registered together with the built-in ones
+func defaultRules() []Rule {
+	return []Rule{
+		{Tag: "oneof_insensitive", Func: isOneOfInsensitive},
+		{Tag: "pwd_min", Func: passwordRule(pswd.Policy.CheckLength), Params: func(parent reflect.Value, fe validator.FieldError) map[string]string {
+			return map[string]string{"min": strconv.Itoa(pswd.CurrentPolicy().MinLength)}
+		}},
+		{Tag: "pwd_upper", Func: passwordRule(pswd.Policy.CheckUpper)},
+		{Tag: "pwd_lower", Func: passwordRule(pswd.Policy.CheckLower)},
+		{Tag: "pwd_digit", Func: passwordRule(pswd.Policy.CheckDigit)},
+		{Tag: "pwd_symbol", Func: passwordRule(pswd.Policy.CheckSymbol)},
+		{Tag: "pwd_excludes", Func: isPasswordExcludes, Params: passwordExcludesParams},
+		{Tag: "not_breached", Func: isNotBreached},
+	}
+}
+
+func defaultAliases() map[string]string {
+	return map[string]string{
+		// The password policy, the requirements are configured by pswd.SetPolicy
+		"password": "pwd_min,pwd_upper,pwd_lower,pwd_digit,pwd_symbol",
+	}
+}
+
+// Same as the "oneof" tag, but case-insensitive
+func isOneOfInsensitive(fl validator.FieldLevel) bool {
+	field := fl.Field()
+	value := ""
+
+	if field.Kind() == reflect.String {
+		value = field.String()
+	} else {
+		value = fmt.Sprint(field.Interface())
+	}
+
+	for _, item := range strings.Fields(fl.Param()) {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func passwordRule(check func(pswd.Policy, string) bool) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		return check(pswd.CurrentPolicy(), fl.Field().String())
+	}
+}
+
+// The password must not contain values of the fields listed in the param,
+// for the email also its local part is checked
+func isPasswordExcludes(fl validator.FieldLevel) bool {
+	return excludedField(reflect.Indirect(fl.Parent()), fl.Param(), fl.Field().String()) == ""
+}
+
+// The message names only the field the password contains
+func passwordExcludesParams(parent reflect.Value, fe validator.FieldError) map[string]string {
+	passwd, _ := fe.Value().(string)
+
+	if name := excludedField(parent, fe.Param(), passwd); name != "" {
+		return map[string]string{"other": fieldNames(parent, []string{name})[0]}
+	}
+
+	return nil
+}
+
+// Returns the name of the first field of the param, which value the
+// password contains, or an empty string
+func excludedField(parent reflect.Value, param string, passwd string) string {
+	passwd = strings.ToLower(passwd)
+
+	if parent.Kind() != reflect.Struct {
+		return ""
+	}
+
+	for _, name := range strings.Fields(param) {
+		field := parent.FieldByName(name)
+
+		if field.IsValid() && field.CanInterface() {
+			if value, ok := optionalValue(field).(string); ok {
+				field = reflect.ValueOf(value)
+			}
+		}
+
+		if !field.IsValid() || field.Kind() != reflect.String {
+			continue
+		}
+
+		value := strings.ToLower(strings.TrimSpace(field.String()))
+		values := []string{value}
+
+		if local, _, ok := strings.Cut(value, "@"); ok {
+			values = append(values, local)
+		}
+
+		for _, value := range values {
+			// Too short values give false positives
+			if len([]rune(value)) >= 3 && strings.Contains(passwd, value) {
+				return name
+			}
+		}
+	}
+
+	return ""
+}
+
+func isNotBreached(fl validator.FieldLevel) bool {
+	breached, err := pswd.IsBreached(fl.Field().String())
+
+	// An unreadable list must not block users
+	if err != nil {
+		return true
+	}
+
+	return !breached
+}
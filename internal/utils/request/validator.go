@@ -1,13 +1,14 @@
 package request
 
 import (
+	"errors"
 	"reflect"
-	"regexp"
 	"strings"
+	"sync"
 
+	"apibgo/internal/domain"
 	"apibgo/internal/lang"
 	"apibgo/internal/lang/sections"
-	"apibgo/pkg/utils"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -16,6 +17,40 @@ type Validator struct {
 	Messages sections.Validation
 }
 
+// Rule describes a custom validation tag. The message of the rule is taken
+// from the "validation.<tag>" key of the language files.
+type Rule struct {
+	Tag  string
+	Func validator.Func
+	// Params returns additional values for the placeholders of the message,
+	// the parent is the struct of the field
+	Params func(parent reflect.Value, fe validator.FieldError) map[string]string
+	// CallEvenIfNull runs the rule for nil values too
+	CallEvenIfNull bool
+}
+
+var (
+	validate     *validator.Validate
+	validateOnce sync.Once
+	rules        = map[string]Rule{}
+	rulesMu      sync.RWMutex
+)
+
+// Tags which parameters are names of other fields
+var fieldTags = map[string]bool{
+	"eqfield": true, "nefield": true, "gtfield": true, "gtefield": true, "ltfield": true, "ltefield": true,
+	"eqcsfield": true, "necsfield": true, "gtcsfield": true, "gtecsfield": true, "ltcsfield": true, "ltecsfield": true,
+	"fieldcontains": true, "fieldexcludes": true, "postcode_iso3166_alpha2_field": true,
+	"required_with": true, "required_with_all": true, "required_without": true, "required_without_all": true,
+	"excluded_with": true, "excluded_with_all": true, "excluded_without": true, "excluded_without_all": true,
+	"pwd_excludes": true,
+}
+
+// Tags which parameters are pairs of a field name and a value
+var conditionalTags = map[string]bool{
+	"required_if": true, "required_unless": true, "excluded_if": true, "excluded_unless": true, "skip_unless": true,
+}
+
 func NewValidator() Validator {
 	appLang, _ := lang.Get(lang.Locale())
 
@@ -24,102 +59,214 @@ func NewValidator() Validator {
 	}
 }
 
-func (v *Validator) Validate(d interface{}) (bool, []string) {
-	validate := validator.New(validator.WithRequiredStructEnabled())
-	err := validate.Struct(d)
+// RegisterRule adds a custom validation tag. Rules have to be registered
+// before the validation is used, e.g. at the start of the application.
+func RegisterRule(rule Rule) error {
+	if err := engine().RegisterValidation(rule.Tag, rule.Func, rule.CallEvenIfNull); err != nil {
+		return err
+	}
 
-	if err != nil {
-		if _, ok := err.(*validator.InvalidValidationError); ok {
-			return false, []string{err.Error()}
-		}
+	rulesMu.Lock()
+	rules[rule.Tag] = rule
+	rulesMu.Unlock()
+
+	return nil
+}
 
-		messages := []string{}
+// Validate checks the struct and returns the messages grouped by JSON names of fields
+func (v *Validator) Validate(d interface{}) (bool, map[string][]string) {
+	err := engine().Struct(d)
 
-		for _, err := range err.(validator.ValidationErrors) {
-			values := map[string]string{}
+	if err == nil {
+		return true, map[string][]string{}
+	}
+
+	var invalid *validator.InvalidValidationError
+
+	if errors.As(err, &invalid) {
+		return false, map[string][]string{"": {err.Error()}}
+	}
 
-			if len(err.Param()) > 0 {
-				values = v.getAppends(err.Tag(), err.Param())
+	messages := map[string][]string{}
+
+	for _, fe := range err.(validator.ValidationErrors) {
+		field := fieldPath(fe)
+		messages[field] = append(messages[field], v.getMessage(d, fe))
+	}
+
+	return false, messages
+}
+
+type optional interface {
+	Interface() any
+}
+
+func optionalValue(field reflect.Value) interface{} {
+	if value, ok := field.Interface().(optional); ok {
+		return value.Interface()
+	}
+
+	return nil
+}
+
+func engine() *validator.Validate {
+	validateOnce.Do(func() {
+		validate = validator.New(validator.WithRequiredStructEnabled())
+		validate.RegisterTagNameFunc(jsonName)
+		// Optional fields are validated by their values, absent and null ones are skipped
+		validate.RegisterCustomTypeFunc(optionalValue,
+			domain.Optional[string]{}, domain.Optional[bool]{}, domain.Optional[int]{}, domain.Optional[uint]{},
+		)
+
+		for _, rule := range defaultRules() {
+			if err := validate.RegisterValidation(rule.Tag, rule.Func, rule.CallEvenIfNull); err != nil {
+				panic(err)
 			}
 
-			message := v.getMessage(err.Tag(), []string{err.Field()}, values)
-			messages = append(messages, message)
+			rules[rule.Tag] = rule
 		}
 
-		// from here you can create your own error messages in whatever language you wish
-		return false, messages
-	}
+		for alias, tags := range defaultAliases() {
+			validate.RegisterAlias(alias, tags)
+		}
+	})
+
+	return validate
+}
+
+func (v *Validator) getMessage(d interface{}, fe validator.FieldError) string {
+	values := v.getAppends(d, fe)
+	values["attribute"] = fe.Field()
 
-	return true, []string{}
+	return lang.Format(v.lookup(fe), values)
 }
 
-func (v *Validator) getAppends(tag string, param string) map[string]string {
-	var keys map[string]string = map[string]string{}
-	var field reflect.Value
+func (v *Validator) lookup(fe validator.FieldError) string {
+	keys := []string{}
+	suffix := ""
 
-	vl := reflect.ValueOf(v.Messages)
-	tp := reflect.TypeOf(v.Messages)
+	switch fe.Kind() {
+	case reflect.String:
+		suffix = "_string"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		suffix = "_array"
+	}
 
-	for i := 0; i < tp.NumField(); i++ {
-		if tp.Field(i).Tag.Get("yaml") == tag {
-			field = vl.Field(i)
-			break
+	// The actual tag goes first to get the exact message of an alias
+	for _, tag := range []string{fe.ActualTag(), fe.Tag()} {
+		if suffix != "" {
+			keys = append(keys, tag+suffix)
 		}
+
+		keys = append(keys, tag)
 	}
 
-	if field.IsValid() {
-		re, _ := regexp.Compile(`:\w+`)
-		matches := re.FindAllString(field.String(), -1)
-		params := strings.Split(param, " ")
-
-		if utils.StringInSlice(":other", matches) &&
-			utils.StringInSlice(":value", matches) {
-			keys["other"] = params[0]
-			keys["value"] = params[1]
-		} else if utils.StringInSlice(":other", matches) {
-			keys["other"] = strings.Join(params, " ")
-		} else if utils.StringInSlice(":values", matches) {
-			keys["values"] = strings.Join(params, " ")
-		} else if utils.StringInSlice(":value", matches) {
-			keys["value"] = strings.Join(params, " ")
+	keys = append(keys, "default")
+
+	for _, key := range keys {
+		if msg := v.Messages[key]; msg != "" {
+			return msg
 		}
 	}
 
-	return keys
+	return fe.Error()
 }
 
-func (v *Validator) getMessage(tag string, attributes []string, values map[string]string) string {
-	var msg string
-	var field reflect.Value
+func (v *Validator) getAppends(d interface{}, fe validator.FieldError) map[string]string {
+	param := fe.Param()
+	params := strings.Fields(param)
+	parent := fieldParent(d, fe)
+	keys := map[string]string{
+		"value":  param,
+		"values": strings.Join(params, ", "),
+		"other":  param,
+	}
+
+	switch {
+	case fieldTags[fe.ActualTag()]:
+		names := fieldNames(parent, params)
+		keys["other"] = strings.Join(names, ", ")
+		keys["values"] = strings.Join(names, ", ")
+	case conditionalTags[fe.ActualTag()] && len(params) > 0:
+		keys["other"] = fieldNames(parent, params[:1])[0]
+		keys["value"] = strings.Join(params[1:], " ")
+		keys["values"] = strings.Join(params[1:], ", ")
+	}
 
-	vl := reflect.ValueOf(v.Messages)
-	tp := reflect.TypeOf(v.Messages)
+	rulesMu.RLock()
+	rule, ok := rules[fe.ActualTag()]
+	rulesMu.RUnlock()
 
-	for i := 0; i < tp.NumField(); i++ {
-		if tp.Field(i).Tag.Get("yaml") == tag {
-			field = vl.Field(i)
-			break
+	if ok && rule.Params != nil {
+		for key, value := range rule.Params(parent, fe) {
+			keys[key] = value
 		}
 	}
 
-	if field.IsValid() {
-		msg = field.String()
+	return keys
+}
+
+// Returns a path of the field without the name of the validated struct
+func fieldPath(fe validator.FieldError) string {
+	namespace := strings.SplitN(fe.Namespace(), ".", 2)
+
+	if len(namespace) == 2 {
+		return namespace[1]
+	}
+
+	return fe.Field()
+}
 
-		for _, attr := range attributes {
-			re, _ := regexp.Compile(`:attribute`)
-			msg = string(re.ReplaceAll([]byte(msg), []byte(attr)))
+// Returns the struct which has the field of the error, nested structs
+// are found by the namespace. It's invalid for the items of slices and maps.
+func fieldParent(d interface{}, fe validator.FieldError) reflect.Value {
+	parent := reflect.Indirect(reflect.ValueOf(d))
+	names := strings.Split(fe.StructNamespace(), ".")
+
+	// The first name is of the validated struct, the last one is of the field
+	for _, name := range names[1 : len(names)-1] {
+		if parent.Kind() != reflect.Struct || strings.Contains(name, "[") {
+			return reflect.Value{}
 		}
 
-		for key, val := range values {
-			re, _ := regexp.Compile(`:` + key)
-			msg = string(re.ReplaceAll([]byte(msg), []byte(val)))
+		parent = reflect.Indirect(parent.FieldByName(name))
+	}
+
+	return parent
+}
+
+// Converts names of fields of the struct to their JSON names
+func fieldNames(parent reflect.Value, names []string) []string {
+	result := make([]string, 0, len(names))
+
+	for _, name := range names {
+		if parent.Kind() == reflect.Struct {
+			if field, ok := parent.Type().FieldByName(name); ok {
+				name = strings.ToLower(name)
+
+				// Fields hidden from JSON, like the email of the user, keep their names
+				if json := jsonName(field); json != "" {
+					name = json
+				}
+			}
 		}
 
-		// for key, val := range custom {
-		// 	re, _ := regexp.Compile(`:` + key)
-		// 	msg = string(re.ReplaceAll([]byte(msg), []byte(val)))
-		// }
+		result = append(result, name)
+	}
+
+	return result
+}
+
+func jsonName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+
+	if name == "-" {
+		return ""
+	}
+
+	if name == "" {
+		return field.Name
 	}
 
-	return msg
+	return name
 }
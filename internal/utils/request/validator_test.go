@@ -0,0 +1,165 @@
+package request_test
+
+import (
+	"reflect"
+	"testing"
+
+	"apibgo/internal/domain"
+	"apibgo/internal/lang"
+	"apibgo/internal/utils/request"
+	"apibgo/pkg/auth/pswd"
+)
+
+// The validator with the messages of the language files of the repository
+func newValidator(t *testing.T, locale string) request.Validator {
+	t.Helper()
+
+	bundle, err := lang.Load("../../../langs", "en")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages, ok := bundle.Get(locale)
+
+	if !ok {
+		t.Fatalf("no %s locale", locale)
+	}
+
+	return request.Validator{Messages: messages.Validation}
+}
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type profile struct {
+	Email           string                  `json:"email" validate:"required,email"`
+	Name            string                  `json:"name" validate:"min=3"`
+	Tags            []string                `json:"tags" validate:"max=1"`
+	Age             int                     `json:"age" validate:"min=18"`
+	Sort            string                  `json:"sort" validate:"omitempty,oneof_insensitive=asc desc"`
+	Password        string                  `json:"password" validate:"omitempty"`
+	ConfirmPassword string                  `json:"confirm_password" validate:"eqfield=Password"`
+	Kind            string                  `json:"kind"`
+	Company         string                  `json:"company" validate:"required_if=Kind business"`
+	Address         address                 `json:"address"`
+	Nick            domain.Optional[string] `json:"nick" validate:"omitempty,max=5"`
+}
+
+func valid() profile {
+	return profile{Email: "user@example.com", Name: "John", Age: 20, Address: address{City: "Baku"}}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(p *profile)
+		want   map[string][]string
+	}{
+		{name: "valid", change: func(p *profile) {}, want: map[string][]string{}},
+		{name: "required", change: func(p *profile) { p.Email = "" }, want: map[string][]string{
+			"email": {"The email field is required."},
+		}},
+		{name: "string length", change: func(p *profile) { p.Name = "Jo" }, want: map[string][]string{
+			"name": {"The name must be at least 3 characters."},
+		}},
+		{name: "array length", change: func(p *profile) { p.Tags = []string{"a", "b"} }, want: map[string][]string{
+			"tags": {"The tags may not have more than 1 items."},
+		}},
+		{name: "number", change: func(p *profile) { p.Age = 10 }, want: map[string][]string{
+			"age": {"The age must be at least 18."},
+		}},
+		{name: "insensitive oneof", change: func(p *profile) { p.Sort = "DESC" }, want: map[string][]string{}},
+		{name: "oneof values", change: func(p *profile) { p.Sort = "up" }, want: map[string][]string{
+			"sort": {"The sort field does not exist in asc, desc."},
+		}},
+		{name: "other field by json name", change: func(p *profile) { p.Password = "secret"; p.ConfirmPassword = "other" }, want: map[string][]string{
+			"confirm_password": {"The confirm_password must match password."},
+		}},
+		{name: "conditional", change: func(p *profile) { p.Kind = "business" }, want: map[string][]string{
+			"company": {"The company field is required when kind is business."},
+		}},
+		{name: "nested", change: func(p *profile) { p.Address.City = "" }, want: map[string][]string{
+			"address.city": {"The city field is required."},
+		}},
+		{name: "optional value", change: func(p *profile) { p.Nick = domain.Some("toolong") }, want: map[string][]string{
+			"nick": {"The nick may not be greater than 5 characters."},
+		}},
+		{name: "several", change: func(p *profile) { p.Email = "mail"; p.Name = "Jo" }, want: map[string][]string{
+			"email": {"The email field must be a valid email address."},
+			"name":  {"The name must be at least 3 characters."},
+		}},
+	}
+
+	v := newValidator(t, "en")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.change(&p)
+
+			ok, messages := v.Validate(p)
+
+			if ok != (len(tt.want) == 0) || !reflect.DeepEqual(messages, tt.want) {
+				t.Fatalf("Validate = %v, %v, want %v", ok, messages, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateLocale(t *testing.T) {
+	p := valid()
+	p.Email = ""
+
+	v := newValidator(t, "ru")
+	_, messages := v.Validate(p)
+
+	if want := "Поле email обязательно для заполнения."; len(messages["email"]) != 1 || messages["email"][0] != want {
+		t.Fatalf("messages = %v, want %q", messages, want)
+	}
+}
+
+func TestValidateNotStruct(t *testing.T) {
+	v := newValidator(t, "en")
+
+	if ok, messages := v.Validate("string"); ok || len(messages[""]) != 1 {
+		t.Fatalf("Validate = %v, %v, want the invalid validation error", ok, messages)
+	}
+}
+
+type passwordDto struct {
+	Password string `json:"password" validate:"required,password,pwd_excludes=Email Name Surname"`
+	Email    string `json:"-"`
+	Name     string `json:"-"`
+	Surname  string `json:"-"`
+}
+
+func TestValidatePassword(t *testing.T) {
+	pswd.SetPolicy(pswd.Policy{MinLength: 8, RequireDigit: true})
+	defer pswd.SetPolicy(pswd.Policy{MinLength: 8})
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "valid", password: "n0thing-personal"},
+		{name: "length", password: "short1", want: []string{"The password must be at least 8 characters."}},
+		{name: "digit", password: "no-digits-here", want: []string{"The password must contain at least one digit."}},
+		{name: "surname", password: "ivanov-2024", want: []string{"The password must not contain your surname."}},
+		{name: "local part of the email", password: "Jsmith-2024", want: []string{"The password must not contain your email."}},
+	}
+
+	v := newValidator(t, "en")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, messages := v.Validate(passwordDto{Password: tt.password, Email: "jsmith@example.com", Name: "Jo", Surname: "Ivanov"})
+
+			if !reflect.DeepEqual(messages["password"], tt.want) {
+				t.Fatalf("messages = %v, want %v", messages["password"], tt.want)
+			}
+		})
+	}
+}
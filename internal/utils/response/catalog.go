@@ -0,0 +1,80 @@
+package response
+
+import (
+	"net/http"
+
+	"apibgo/internal/lang"
+)
+
+// Entry describes an error of the catalog. The title is translated by
+// the "errors.<slug>" key of the language files.
+type Entry struct {
+	Code Code
+	// HTTP status used when the response doesn't set its own one
+	Status int
+	// Part of the problem type URI, must be stable as the code
+	Slug string
+}
+
+var catalog = map[Code]Entry{
+	ErrorAccountActivate:        {ErrorAccountActivate, http.StatusForbidden, "account-not-activated"},
+	ErrorAccountConfirmPassword: {ErrorAccountConfirmPassword, http.StatusUnprocessableEntity, "password-mismatch"},
+	ErrorAccountExists:          {ErrorAccountExists, http.StatusConflict, "account-exists"},
+	ErrorAccountNotCreated:      {ErrorAccountNotCreated, http.StatusInternalServerError, "account-not-created"},
+	ErrorAccountAlreadyActivate: {ErrorAccountAlreadyActivate, http.StatusConflict, "account-already-activated"},
+	ErrorAccountActivateTimeout: {ErrorAccountActivateTimeout, http.StatusGone, "confirm-code-expired"},
+	ErrorAccountNotFound:        {ErrorAccountNotFound, http.StatusUnauthorized, "invalid-credentials"},
+	ErrorTokenExpired:           {ErrorTokenExpired, http.StatusUnauthorized, "token-expired"},
+	ErrorPermissionForbidden:    {ErrorPermissionForbidden, http.StatusForbidden, "forbidden"},
+	ErrorValidation:             {ErrorValidation, http.StatusBadRequest, "validation"},
+	ErrorBadRequest:             {ErrorBadRequest, http.StatusBadRequest, "bad-request"},
+	ErrorPayloadTooLarge:        {ErrorPayloadTooLarge, http.StatusRequestEntityTooLarge, "payload-too-large"},
+	ErrorUnsupportedMediaType:   {ErrorUnsupportedMediaType, http.StatusUnsupportedMediaType, "unsupported-media-type"},
+	ErrorAccountInvalidCode:     {ErrorAccountInvalidCode, http.StatusUnprocessableEntity, "invalid-confirm-code"},
+	ErrorInternal:               {ErrorInternal, http.StatusInternalServerError, "internal"},
+	ErrorUnauthorized:           {ErrorUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	ErrorNotFound:               {ErrorNotFound, http.StatusNotFound, "not-found"},
+	ErrorPatchFailed:            {ErrorPatchFailed, http.StatusUnprocessableEntity, "patch-failed"},
+	ErrorPreconditionFailed:     {ErrorPreconditionFailed, http.StatusPreconditionFailed, "precondition-failed"},
+	ErrorPreconditionRequired:   {ErrorPreconditionRequired, http.StatusPreconditionRequired, "precondition-required"},
+	ErrorLoginConfirmRequired:   {ErrorLoginConfirmRequired, http.StatusUnauthorized, "login-confirm-required"},
+	ErrorConflict:               {ErrorConflict, http.StatusConflict, "conflict"},
+	ErrorInvalidState:           {ErrorInvalidState, http.StatusConflict, "invalid-state"},
+	ErrorTooManyAttempts:        {ErrorTooManyAttempts, http.StatusTooManyRequests, "too-many-attempts"},
+	ErrorUserBanned:             {ErrorUserBanned, http.StatusForbidden, "user-banned"},
+}
+
+// Lookup returns the catalog entry of the code, unknown codes are internal errors
+func Lookup(code Code) Entry {
+	if entry, ok := catalog[code]; ok {
+		return entry
+	}
+
+	return catalog[ErrorInternal]
+}
+
+// Catalog returns all the entries, e.g. for the documentation
+func Catalog() []Entry {
+	entries := make([]Entry, 0, len(catalog))
+
+	for code := ErrorEmpty; len(entries) < len(catalog); code++ {
+		if entry, ok := catalog[code]; ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// Title returns the localized title of the error, the locale may be empty
+func (e Entry) Title(locale string) string {
+	if locale == "" {
+		locale = lang.Locale()
+	}
+
+	if title := lang.Default().T(locale, "errors."+e.Slug, nil); title != "" {
+		return title
+	}
+
+	return http.StatusText(e.Status)
+}
@@ -0,0 +1,129 @@
+package response_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"apibgo/internal/lang"
+	"apibgo/internal/utils/response"
+)
+
+func TestMain(m *testing.M) {
+	// The titles are taken from the language files of the repository
+	os.Setenv("LANG_PATH", "../../../langs")
+	os.Setenv("APP_LANG", "en")
+
+	os.Exit(m.Run())
+}
+
+func TestCatalog(t *testing.T) {
+	slugs := map[string]response.Code{}
+
+	for _, entry := range response.Catalog() {
+		if other, ok := slugs[entry.Slug]; ok {
+			t.Errorf("codes %d and %d have the same slug %q", other, entry.Code, entry.Slug)
+		}
+
+		slugs[entry.Slug] = entry.Code
+
+		if entry.Status < 400 || entry.Status > 599 {
+			t.Errorf("code %d has the status %d", entry.Code, entry.Status)
+		}
+
+		if response.Lookup(entry.Code) != entry {
+			t.Errorf("code %d isn't found by Lookup", entry.Code)
+		}
+	}
+
+	if response.Lookup(9999).Code != response.ErrorInternal {
+		t.Error("an unknown code isn't an internal error")
+	}
+}
+
+// Every error has the title in every language file
+func TestCatalogTitles(t *testing.T) {
+	for _, locale := range []string{"en", "ru"} {
+		// The locale is its own fallback, so missing keys aren't taken from others
+		bundle, err := lang.Load("../../../langs", locale)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, entry := range response.Catalog() {
+			if bundle.T(locale, "errors."+entry.Slug, nil) == "" {
+				t.Errorf("%s.yaml: no errors.%s key", locale, entry.Slug)
+			}
+		}
+	}
+}
+
+func TestSendProblem(t *testing.T) {
+	tests := []struct {
+		name     string
+		response response.Response
+		locale   string
+		status   int
+		title    string
+		errors   bool
+	}{
+		{name: "status of the catalog", response: response.Response{Code: response.ErrorNotFound, Status: response.StatusError, Message: "user 7"}, status: http.StatusNotFound, title: "Resource not found"},
+		{name: "own status", response: response.Response{Code: response.ErrorBadRequest, Status: response.StatusError, HttpCode: http.StatusRequestEntityTooLarge}, status: http.StatusRequestEntityTooLarge},
+		{name: "validation errors", response: response.Response{Code: response.ErrorValidation, Status: response.StatusError, Result: map[string][]string{"email": {"required"}}}, status: http.StatusBadRequest, errors: true},
+		{name: "locale", response: response.Response{Code: response.ErrorNotFound, Status: response.StatusError}, locale: "ru-RU,ru;q=0.9", status: http.StatusNotFound, title: "Ресурс не найден"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/7/", nil)
+			r.Header.Set("Accept-Language", tt.locale)
+			w := httptest.NewRecorder()
+
+			tt.response.Send(w, r)
+
+			var problem response.Problem
+
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatal(err)
+			}
+
+			entry := response.Lookup(tt.response.Code)
+
+			switch {
+			case w.Code != tt.status || problem.Status != tt.status:
+				t.Fatalf("status = %d, %d, want %d", w.Code, problem.Status, tt.status)
+			case w.Header().Get("Content-Type") != response.ContentTypeProblem:
+				t.Fatalf("content type = %q", w.Header().Get("Content-Type"))
+			case problem.Type != "/errors/"+entry.Slug || problem.Code != entry.Code || problem.Instance != "/users/7/":
+				t.Fatalf("problem = %+v", problem)
+			case problem.Detail != tt.response.Message:
+				t.Fatalf("detail = %q, want %q", problem.Detail, tt.response.Message)
+			case tt.title != "" && problem.Title != tt.title:
+				t.Fatalf("title = %q, want %q", problem.Title, tt.title)
+			case (problem.Errors != nil) != tt.errors:
+				t.Fatalf("errors = %v", problem.Errors)
+			}
+		})
+	}
+}
+
+func TestSendEnvelope(t *testing.T) {
+	response.SetFormat(response.FormatEnvelope, "")
+	defer response.SetFormat(response.FormatProblem, "")
+
+	w := httptest.NewRecorder()
+	response.Fail(w, httptest.NewRequest(http.MethodGet, "/", nil), response.ErrorNotFound, "user 7")
+
+	var body map[string]interface{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusNotFound || body["code"] != float64(response.ErrorNotFound) || body["status"] != "error" || body["message"] != "user 7" {
+		t.Fatalf("status = %d, body = %v", w.Code, body)
+	}
+}
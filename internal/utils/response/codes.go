@@ -1,27 +1,59 @@
 package response
 
+// Code is a stable number of an error, clients may rely on it.
+// Values must never be reused or changed, new codes are added at the end.
+type Code uint16
+
 const (
 	// When all right
-	ErrorEmpty = 0
+	ErrorEmpty Code = 0
 	// When don't activated a user account
-	ErrorAccountActivate = 1
+	ErrorAccountActivate Code = 1
 	// When don't match: password and confirm password
-	ErrorAccountConfirmPassword = 2
+	ErrorAccountConfirmPassword Code = 2
 	// When during registration, if a user account exist
-	ErrorAccountExists = 3
+	ErrorAccountExists Code = 3
 	// When don't creating a user account
-	ErrorAccountNotCreated = 4
+	ErrorAccountNotCreated Code = 4
 	// When a user account already activated
-	ErrorAccountAlreadyActivate = 5
+	ErrorAccountAlreadyActivate Code = 5
 	// When time activation out
-	ErrorAccountActivateTimeout = 6
-	// When don't match of confirm code
-	ErrorAccountInvalidCode = 6
+	ErrorAccountActivateTimeout Code = 6
 	// When not found a user account
-	ErrorAccountNotFound = 7
+	ErrorAccountNotFound Code = 7
 	// When token is expired
-	ErrorTokenExpired = 8
+	ErrorTokenExpired Code = 8
 	// When access forbidden
-	ErrorPermissionForbidden = 9
-	ErrorValidation          = 10
+	ErrorPermissionForbidden Code = 9
+	ErrorValidation          Code = 10
+	// When a request body is not a valid JSON
+	ErrorBadRequest Code = 11
+	// When a request body exceeds the limit
+	ErrorPayloadTooLarge Code = 12
+	// When a request body is not a JSON
+	ErrorUnsupportedMediaType Code = 13
+	// When don't match of confirm code (was 6 together with ErrorAccountActivateTimeout)
+	ErrorAccountInvalidCode Code = 14
+	// When something went wrong on the server side
+	ErrorInternal Code = 15
+	// When a token is missing or invalid
+	ErrorUnauthorized Code = 16
+	// When a requested resource doesn't exist
+	ErrorNotFound Code = 17
+	// When a JSON Patch can't be applied to a resource
+	ErrorPatchFailed Code = 18
+	// When a resource was changed since the client got it (If-Match)
+	ErrorPreconditionFailed Code = 19
+	// When a change of a resource has no If-Match header
+	ErrorPreconditionRequired Code = 20
+	// When a login from a new or suspicious device waits for the mailed code
+	ErrorLoginConfirmRequired Code = 21
+	// When a change conflicts with the current state of a resource
+	ErrorConflict Code = 22
+	// When the state of a resource doesn't allow the action
+	ErrorInvalidState Code = 23
+	// When the confirm code was entered wrong too many times
+	ErrorTooManyAttempts Code = 24
+	// When a banned user logs in
+	ErrorUserBanned Code = 25
 )
@@ -0,0 +1,17 @@
+package response
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// ETag is the strong entity tag of the version of a resource
+func ETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// NotModified writes 304 without a body for the conditional GET
+func NotModified(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,127 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Formats of the error responses
+const (
+	// RFC 7807 application/problem+json
+	FormatProblem = "problem"
+	// The {code, status, message, result} envelope of the first API version
+	FormatEnvelope = "envelope"
+)
+
+const ContentTypeProblem = "application/problem+json"
+
+var (
+	format   = FormatProblem
+	typeBase = "/errors/"
+	formatMu sync.RWMutex
+)
+
+// Problem is the RFC 7807 error body, "code" is an extension member
+// with the number of the catalog
+type Problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail,omitempty"`
+	Instance string      `json:"instance,omitempty"`
+	Code     Code        `json:"code"`
+	Errors   interface{} `json:"errors,omitempty"`
+}
+
+// SetFormat chooses the format of the error responses, an unknown
+// format falls back to the problem one. The base is a prefix of problem types.
+func SetFormat(name string, base string) {
+	formatMu.Lock()
+	defer formatMu.Unlock()
+
+	if name == FormatEnvelope {
+		format = FormatEnvelope
+	} else {
+		format = FormatProblem
+	}
+
+	if base != "" {
+		typeBase = base
+	}
+}
+
+func currentFormat() (string, string) {
+	formatMu.RLock()
+	defer formatMu.RUnlock()
+
+	return format, typeBase
+}
+
+// Fail writes the error of the catalog with the detail message
+// and the HTTP status of the catalog in any format
+func Fail(w http.ResponseWriter, r *http.Request, code Code, detail string) {
+	_response := Response{
+		Code:     code,
+		Status:   StatusError,
+		Message:  detail,
+		HttpCode: Lookup(code).Status,
+	}
+
+	_response.Send(w, r)
+}
+
+// NewProblem builds the problem body of the error response
+func (response *Response) NewProblem(r *http.Request) Problem {
+	_, base := currentFormat()
+	entry := Lookup(response.Code)
+	status := response.HttpCode
+
+	if status == 0 {
+		status = entry.Status
+	}
+
+	problem := Problem{
+		Type:   base + entry.Slug,
+		Title:  entry.Title(requestLocale(r)),
+		Status: status,
+		Detail: response.Message,
+		Code:   entry.Code,
+	}
+
+	if r != nil {
+		problem.Instance = r.URL.Path
+	}
+
+	if response.Code == ErrorValidation {
+		problem.Errors = response.Result
+	}
+
+	return problem
+}
+
+func (response *Response) sendProblem(w http.ResponseWriter, r *http.Request) {
+	problem := response.NewProblem(r)
+	data, _ := json.Marshal(problem)
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(problem.Status)
+	w.Write(data)
+}
+
+// The first language of the Accept-Language header
+func requestLocale(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+
+	first, _, _ := strings.Cut(r.Header.Get("Accept-Language"), ",")
+	first, _, _ = strings.Cut(first, ";")
+
+	if first = strings.TrimSpace(first); first == "*" {
+		return ""
+	}
+
+	return first
+}
@@ -22,27 +22,31 @@ const (
 )
 
 type Response struct {
-	Code     byte
-	Status   Status
-	Message  string
-	Result   interface{}
-	Cookies  []*http.Cookie
+	Code    Code
+	Status  Status
+	Message string
+	Result  interface{}
+	Cookies []*http.Cookie
+	// Headers are added to the response, e.g. Link of pages
+	Headers  http.Header
 	HttpCode int
 }
 
 type DocSuccessResponse struct {
-	Code    byte
+	Code    Code
 	Status  Status
 	Message string
 	Result  interface{}
 }
 
 type DocErrorResponse struct {
-	Code    byte
+	Code    Code
 	Status  StatusBadError
 	Message string
 }
 
+type DocProblemResponse = Problem
+
 func (response *Response) CreateResponseData() []byte {
 	if response.Result == nil {
 		marshal, _ := json.Marshal(map[string]interface{}{
@@ -63,6 +67,29 @@ func (response *Response) CreateResponseData() []byte {
 	return marshal
 }
 
+// Send writes the response data with the HttpCode status (200 by default).
+// Errors are written in the configured format, see SetFormat.
+func (response *Response) Send(w http.ResponseWriter, r *http.Request) {
+	for name, values := range response.Headers {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+
+	if format, _ := currentFormat(); format == FormatProblem && response.Status == StatusError {
+		response.sendProblem(w, r)
+		return
+	}
+
+	if response.HttpCode == 0 {
+		response.HttpCode = http.StatusOK
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.HttpCode)
+	w.Write(response.CreateResponseData())
+}
+
 func (response *Response) SetCookies(w *http.ResponseWriter, log *slog.Logger) {
 	if len(response.Cookies) > 0 {
 		for _, _cookie := range response.Cookies {
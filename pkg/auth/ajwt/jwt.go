@@ -1,6 +1,8 @@
 package ajwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"strconv"
 	"time"
@@ -8,9 +10,16 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Types of the tokens of a pair, so one can't be used for the other
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+)
+
 type Claims struct {
 	jwt.RegisteredClaims
-	UserId uint `json:"user_id"`
+	UserId uint   `json:"user_id"`
+	Type   string `json:"typ"`
 }
 
 type JWT struct {
@@ -36,9 +45,11 @@ func (j *JWT) NewPairTokens() (string, string) {
 
 	initToken := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
 		UserId: uint(j.UserId),
+		Type:   TypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(accessExpiresAt),
 			Issuer:    strconv.FormatInt(time.Now().Unix(), 10),
+			ID:        newId(),
 		},
 	})
 
@@ -46,9 +57,11 @@ func (j *JWT) NewPairTokens() (string, string) {
 
 	initToken = jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
 		UserId: uint(j.UserId),
+		Type:   TypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(refreshExpiresAt),
 			Issuer:    strconv.FormatInt(time.Now().Unix(), 10),
+			ID:        newId(),
 		},
 	})
 	refresh, _ := initToken.SignedString(signedKey)
@@ -56,6 +69,14 @@ func (j *JWT) NewPairTokens() (string, string) {
 	return access, refresh
 }
 
+// Unique id of a token (jti), tokens of the same user and second differ by it
+func newId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
 func IsJWT(tokenString string, secretKey string) (bool, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		// Don't forget to validate the alg is what you expect:
@@ -101,3 +122,25 @@ func GetClaims(tokenString string, secretKey string) (jwt.MapClaims, error) {
 
 	return claims, nil
 }
+
+// Parse returns the claims of the valid token
+func Parse(tokenString string, secretKey string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return []byte(secretKey), nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
@@ -1,109 +1,123 @@
+// Package device tells the browser, the OS and the kind of the device of
+// user agents by the rules of regexes.yaml and the client hints
 package device
 
 import (
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
 	"strings"
 )
 
-// This type for store information about browser
-type browserInfo struct {
-	name   string
-	search string
+// Names of the types in the sessions and mails
+var typeNames = map[string]string{
+	TypeDesktop: "Desktop",
+	TypeMobile:  "Mobile",
+	TypeTablet:  "Tablet",
+	TypeTV:      "TV",
+	TypeConsole: "Console",
+	TypeBot:     "Bot",
 }
 
-// This type for store information about os
-type osInfo struct {
-	name   string
-	search string
+// Name returns a friendly name of the device like "Chrome on Linux",
+// the kind of the device is used for the unknown browser or OS
+func Name(userAgent string) string {
+	return Parse(userAgent, Hints{}).Name()
 }
 
-func DetectDevice(userAgent string) string {
-	ua := strings.ToLower(userAgent)
-
-	if strings.Contains(ua, "mobile") {
-		return "Mobile"
-	} else if strings.Contains(ua, "tablet") {
-		return "Tablet"
-	} else if strings.Contains(ua, "bot") {
-		return "Bot"
-	} else {
-		return "Desktop"
+// Name returns a friendly name of the device like "Chrome on Linux",
+// the kind of the device is used for the unknown browser or OS
+func (i Info) Name() string {
+	browser, os := i.Browser.Name, i.OS.Name
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser + " on " + i.TypeName()
+	case os != "":
+		return i.TypeName() + " on " + os
 	}
+
+	return i.TypeName()
 }
 
-func DetectOS(userAgent string) string {
-	ua := strings.ToLower(userAgent)
-
-	oses := []osInfo{
-		{"Windows", "windows"},
-		{"Linux", "linux"},
-		{"macOS", "macintosh"},
-		{"macOS", "mac os"},
-		{"Android", "android"},
-		{"MIUI (Xiaomi)", "xiaomi"},
-		{"HyperOS", "hyperos"},
-		{"iOS", "iphone"},
-		{"iOS", "ipad"},
-		{"iOS", "ipod"},
+// TypeName returns the type like "Mobile"
+func (i Info) TypeName() string {
+	if name, ok := typeNames[i.Type]; ok {
+		return name
 	}
 
-	for _, o := range oses {
-		if strings.Contains(ua, o.search) {
-			versionStart := strings.Index(ua, o.search) + len(o.search)
-
-			if versionStart >= len(ua) {
-				return o.name
-			}
-
-			versionEnd := versionStart
-
-			for versionEnd < len(ua) && (ua[versionEnd] >= '0' && ua[versionEnd] <= '9' || ua[versionEnd] == '.') {
-				versionEnd++
-			}
+	return typeNames[TypeDesktop]
+}
 
-			if versionEnd > versionStart {
-				version := ua[versionStart:versionEnd]
-				return fmt.Sprintf("%s %s", o.name, version)
-			} else {
-				return o.name
-			}
-		}
+// OSName returns the OS with the version like "Windows 10"
+func (i Info) OSName() string {
+	if os := i.OS.String(); os != "" {
+		return os
 	}
 
 	return "Unknown OS"
 }
 
-func DetectBrowser(userAgent string) string {
-	ua := strings.ToLower(userAgent)
-
-	browsers := []browserInfo{
-		{"Chrome", "chrome/"},
-		{"Safari", "version/"},
-		{"Firefox", "firefox/"},
-		{"Opera", "opr/"},
-		{"Edge", "edge/"},
-		{"Brave", "brave/"},
-		{"DuckDuckGo", "duckduckgo/"},
-		{"Tor", "tor/"},
-		{"Internet Explorer", "msie"},
-		{"Internet Explorer", "trident"},
+// BrowserName returns the browser with the version like "Chrome 120.0"
+func (i Info) BrowserName() string {
+	if browser := i.Browser.String(); browser != "" {
+		return browser
 	}
 
-	// Find browser in User-Agent
-	for _, b := range browsers {
-		if strings.Contains(ua, b.search) {
-			versionStart := strings.Index(ua, b.search) + len(b.search)
-			versionEnd := versionStart
+	return "Unknown Browser"
+}
 
-			for versionEnd < len(ua) && (ua[versionEnd] >= '0' && ua[versionEnd] <= '9' || ua[versionEnd] == '.') {
-				versionEnd++
-			}
+// Fingerprint identifies the device of the user agent by the families of
+// its browser and OS without versions, the network of the address (/24 of
+// IPv4, /48 of IPv6) and the id the client keeps, it may be empty. Updates
+// of the browser don't change it, other networks do.
+func Fingerprint(userAgent string, ip string, deviceId string) string {
+	// The hints aren't sent by every request of the same browser
+	info := Parse(userAgent, Hints{})
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		info.Browser.Name,
+		info.OS.Name,
+		info.TypeName(),
+		Network(ip),
+		deviceId,
+	}, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
 
-			version := ua[versionStart:versionEnd]
+// Network returns the /24 network of IPv4 and the /48 one of IPv6 addresses,
+// invalid addresses are returned as they are
+func Network(ip string) string {
+	addr, err := netip.ParseAddr(ip)
 
-			return fmt.Sprintf("%s %s", b.name, version)
-		}
+	if err != nil {
+		return ip
 	}
 
-	return "Unknown Browser"
+	bits := 48
+
+	if addr = addr.Unmap(); addr.Is4() {
+		bits = 24
+	}
+
+	prefix, _ := addr.Prefix(bits)
+
+	return prefix.String()
+}
+
+// DetectDevice returns the type of the device like "Mobile"
+func DetectDevice(userAgent string) string {
+	return Parse(userAgent, Hints{}).TypeName()
+}
+
+// DetectOS returns the OS with the version like "Windows 10"
+func DetectOS(userAgent string) string {
+	return Parse(userAgent, Hints{}).OSName()
+}
+
+// DetectBrowser returns the browser with the version like "Chrome 120.0"
+func DetectBrowser(userAgent string) string {
+	return Parse(userAgent, Hints{}).BrowserName()
 }
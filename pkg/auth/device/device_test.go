@@ -0,0 +1,182 @@
+package device_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"apibgo/pkg/auth/device"
+
+	"gopkg.in/yaml.v3"
+)
+
+// go test ./pkg/auth/device -update rewrites the expected values of the
+// golden files by the parser, review the diff before committing it
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// A user agent with the client hints and the expected parse
+type golden struct {
+	UserAgent string            `yaml:"user_agent"`
+	Hints     map[string]string `yaml:"hints,omitempty"`
+	Browser   string            `yaml:"browser"`
+	Engine    string            `yaml:"engine"`
+	OS        string            `yaml:"os"`
+	Type      string            `yaml:"type"`
+	Vendor    string            `yaml:"vendor,omitempty"`
+	Model     string            `yaml:"model,omitempty"`
+	Bot       bool              `yaml:"bot,omitempty"`
+}
+
+func (g golden) hints() device.Hints {
+	return device.Hints{
+		Brands:          g.Hints["sec-ch-ua"],
+		FullVersionList: g.Hints["sec-ch-ua-full-version-list"],
+		Mobile:          g.Hints["sec-ch-ua-mobile"],
+		Platform:        g.Hints["sec-ch-ua-platform"],
+		PlatformVersion: g.Hints["sec-ch-ua-platform-version"],
+		Model:           g.Hints["sec-ch-ua-model"],
+	}
+}
+
+func (g golden) parsed(info device.Info) golden {
+	g.Browser, g.Engine, g.OS = info.Browser.String(), info.Engine.String(), info.OS.String()
+	g.Type, g.Vendor, g.Model, g.Bot = info.Type, info.Vendor, info.Model, info.Bot
+
+	return g
+}
+
+func TestParseGolden(t *testing.T) {
+	for _, path := range []string{"testdata/useragents.yaml", "testdata/hints.yaml"} {
+		t.Run(path, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var cases []golden
+
+			if err := yaml.Unmarshal(data, &cases); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(cases) == 0 {
+				t.Fatal("no user agents")
+			}
+
+			for i, want := range cases {
+				got := want.parsed(device.Parse(want.UserAgent, want.hints()))
+
+				if *update {
+					cases[i] = got
+					continue
+				}
+
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s\n got: %+v\nwant: %+v", want.UserAgent, got, want)
+				}
+			}
+
+			if !*update {
+				return
+			}
+
+			var out bytes.Buffer
+			encoder := yaml.NewEncoder(&out)
+			encoder.SetIndent(2)
+
+			if err := encoder.Encode(cases); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.WriteFile(path, out.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name    string
+		regexes string
+		browser string
+		err     bool
+	}{
+		{name: "custom rules", regexes: "browsers:\n  - regex: 'MyBrowser/(\\d+)'\n    name: 'My Browser'\n", browser: "My Browser 7"},
+		{name: "no rules", regexes: "{}", browser: ""},
+		{name: "invalid regex", regexes: "browsers:\n  - regex: '('\n", err: true},
+		{name: "invalid yaml", regexes: "browsers: [", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := device.Read(strings.NewReader(tt.regexes))
+
+			if tt.err {
+				if err == nil {
+					t.Fatal("no error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := parser.Parse("MyBrowser/7", device.Hints{}).Browser.String(); got != tt.browser {
+				t.Fatalf("browser = %q, want %q", got, tt.browser)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	const chrome = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	const updated = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"
+	const edge = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91"
+
+	fingerprint := device.Fingerprint(chrome, "192.0.2.10", "")
+
+	tests := []struct {
+		name      string
+		userAgent string
+		ip        string
+		deviceId  string
+		same      bool
+	}{
+		{name: "updated browser", userAgent: updated, ip: "192.0.2.10", same: true},
+		{name: "same network", userAgent: chrome, ip: "192.0.2.200", same: true},
+		{name: "other network", userAgent: chrome, ip: "192.0.3.10"},
+		{name: "other browser", userAgent: edge, ip: "192.0.2.10"},
+		{name: "device id", userAgent: chrome, ip: "192.0.2.10", deviceId: "laptop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := device.Fingerprint(tt.userAgent, tt.ip, tt.deviceId) == fingerprint; same != tt.same {
+				t.Fatalf("same = %v, want %v", same, tt.same)
+			}
+		})
+	}
+}
+
+func TestNetwork(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.10":            "192.0.2.0/24",
+		"::ffff:192.0.2.10":     "192.0.2.0/24",
+		"2001:db8:1:2::1":       "2001:db8:1::/48",
+		"not an address":        "not an address",
+		"2001:db8:abcd:12::ff1": "2001:db8:abcd::/48",
+	}
+
+	for ip, want := range tests {
+		if got := device.Network(ip); got != want {
+			t.Errorf("Network(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
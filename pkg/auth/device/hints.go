@@ -0,0 +1,196 @@
+package device
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AcceptCH lists the client hints the server asks for by the Accept-CH
+// header, browsers send only the low entropy ones without it
+const AcceptCH = "Sec-CH-UA, Sec-CH-UA-Mobile, Sec-CH-UA-Platform, Sec-CH-UA-Platform-Version, Sec-CH-UA-Model, Sec-CH-UA-Full-Version-List"
+
+// Hints are the raw values of the Sec-CH-UA* headers of Chromium browsers
+type Hints struct {
+	Brands          string
+	FullVersionList string
+	Mobile          string
+	Platform        string
+	PlatformVersion string
+	Model           string
+}
+
+// HintsOf returns the client hints of the headers of a request
+func HintsOf(header http.Header) Hints {
+	return Hints{
+		Brands:          header.Get("Sec-CH-UA"),
+		FullVersionList: header.Get("Sec-CH-UA-Full-Version-List"),
+		Mobile:          header.Get("Sec-CH-UA-Mobile"),
+		Platform:        header.Get("Sec-CH-UA-Platform"),
+		PlatformVersion: header.Get("Sec-CH-UA-Platform-Version"),
+		Model:           header.Get("Sec-CH-UA-Model"),
+	}
+}
+
+// Names of the brands of the hints, others are kept as they are
+var brandNames = map[string]string{
+	"Google Chrome":  "Chrome",
+	"Microsoft Edge": "Edge",
+	"YaBrowser":      "Yandex Browser",
+}
+
+// Names of the platforms of the hints
+var platformNames = map[string]string{
+	"Chromium OS": "Chrome OS",
+}
+
+// Replaces the values of the user agent by the hints. The reduced user
+// agent of Chromium freezes the OS versions and hides the model, the
+// hints have them.
+func (h Hints) apply(info *Info) {
+	if brand, version, ok := h.brand(); ok && !info.Bot {
+		info.Browser = Component{Name: brand, Version: version}
+	}
+
+	if chromium := findBrand(h.versionList(), "Chromium"); chromium != "" && !info.Bot {
+		info.Engine = Component{Name: "Blink", Version: chromium}
+	}
+
+	if platform := unquote(h.Platform); platform != "" && platform != "Unknown" {
+		if name, ok := platformNames[platform]; ok {
+			platform = name
+		}
+
+		if platform != info.OS.Name {
+			info.OS = Component{Name: platform}
+		}
+
+		if version := platformVersion(platform, unquote(h.PlatformVersion)); version != "" {
+			info.OS.Version = version
+		}
+	}
+
+	if model := unquote(h.Model); model != "" {
+		info.Model = model
+	}
+
+	if h.Mobile == "?1" && info.Type != TypeTablet {
+		info.Type = TypeMobile
+	}
+}
+
+// The brand the user sees: the first one which isn't Chromium or the
+// made up one which tests the parsers (GREASE)
+func (h Hints) brand() (string, string, bool) {
+	brands := h.versionList()
+
+	for _, b := range brands {
+		if b.name == "Chromium" || grease(b.name) {
+			continue
+		}
+
+		if name, ok := brandNames[b.name]; ok {
+			return name, b.version, true
+		}
+
+		return b.name, b.version, true
+	}
+
+	return "", "", false
+}
+
+// The full versions are asked by Accept-CH, the major ones are sent always
+func (h Hints) versionList() []brandVersion {
+	if h.FullVersionList != "" {
+		return parseBrands(h.FullVersionList)
+	}
+
+	return parseBrands(h.Brands)
+}
+
+type brandVersion struct {
+	name    string
+	version string
+}
+
+// Parses the list of the structured header like
+// "Chromium";v="120", "Google Chrome";v="120", "Not?A_Brand";v="99"
+func parseBrands(header string) []brandVersion {
+	var brands []brandVersion
+
+	for _, item := range splitList(header) {
+		name, params, _ := strings.Cut(item, ";")
+		b := brandVersion{name: unquote(name)}
+
+		for _, param := range strings.Split(params, ";") {
+			if key, value, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "v" {
+				b.version = unquote(value)
+			}
+		}
+
+		if b.name != "" {
+			brands = append(brands, b)
+		}
+	}
+
+	return brands
+}
+
+// Splits the list by the commas outside of the quotes
+func splitList(header string) []string {
+	var items []string
+	quoted, start := false, 0
+
+	for i, r := range header {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			items = append(items, header[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(items, header[start:])
+}
+
+func findBrand(brands []brandVersion, name string) string {
+	for _, b := range brands {
+		if b.name == name {
+			return b.version
+		}
+	}
+
+	return ""
+}
+
+// Brands like "Not?A_Brand" or "Not A(Brand" are made up to test parsers
+func grease(brand string) bool {
+	return strings.Contains(brand, "Not") && strings.Contains(brand, "Brand")
+}
+
+// The version of the platform as the user agent names it
+func platformVersion(platform string, version string) string {
+	if version == "" {
+		return ""
+	}
+
+	major, _, _ := strings.Cut(version, ".")
+	number, err := strconv.Atoi(major)
+
+	switch {
+	case platform != "Windows":
+		return strings.TrimSuffix(strings.TrimSuffix(version, ".0"), ".0")
+	case err != nil || number == 0:
+		// Windows 7, 8 and 8.1 are told by the user agent
+		return ""
+	case number >= 13:
+		return "11"
+	default:
+		return "10"
+	}
+}
+
+func unquote(value string) string {
+	return strings.Trim(strings.TrimSpace(value), `"`)
+}
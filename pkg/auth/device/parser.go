@@ -0,0 +1,241 @@
+package device
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Types of devices
+const (
+	TypeDesktop = "desktop"
+	TypeMobile  = "mobile"
+	TypeTablet  = "tablet"
+	TypeTV      = "tv"
+	TypeConsole = "console"
+	TypeBot     = "bot"
+)
+
+// Component is a browser, an engine or an OS, empty when it's unknown
+type Component struct {
+	Name    string
+	Version string
+}
+
+// String returns the name with the version like "Chrome 120.0"
+func (c Component) String() string {
+	if c.Version == "" {
+		return c.Name
+	}
+
+	return c.Name + " " + c.Version
+}
+
+// Info is the parsed user agent. Bots are named as browsers.
+type Info struct {
+	Browser Component
+	Engine  Component
+	OS      Component
+	// One of the Type* values
+	Type   string
+	Vendor string
+	Model  string
+	Bot    bool
+}
+
+// Rules of the regexes file, see regexes.yaml
+type rules struct {
+	Bots     []rule `yaml:"bots"`
+	Browsers []rule `yaml:"browsers"`
+	Engines  []rule `yaml:"engines"`
+	Oses     []rule `yaml:"oses"`
+	Devices  []rule `yaml:"devices"`
+}
+
+type rule struct {
+	Regex    string            `yaml:"regex"`
+	Name     string            `yaml:"name"`
+	Version  *string           `yaml:"version"`
+	Versions map[string]string `yaml:"versions"`
+	Type     string            `yaml:"type"`
+	Vendor   string            `yaml:"vendor"`
+	Model    string            `yaml:"model"`
+	re       *regexp.Regexp
+}
+
+// Parser finds the browser, the OS and the device of user agents by the
+// rules of a regexes file. It's safe for concurrent use.
+type Parser struct {
+	rules rules
+}
+
+//go:embed regexes.yaml
+var embedded []byte
+
+var (
+	parser   *Parser
+	parserMu sync.RWMutex
+)
+
+// The parser of the embedded regexes, they are checked by the tests
+var embeddedParser = sync.OnceValue(func() *Parser {
+	p, err := Read(bytes.NewReader(embedded))
+
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+})
+
+// Open reads the parser from a regexes file
+func Open(path string) (*Parser, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return Read(file)
+}
+
+// Read reads the parser from the YAML of the rules, every regex is compiled
+func Read(r io.Reader) (*Parser, error) {
+	var p Parser
+
+	if err := yaml.NewDecoder(r).Decode(&p.rules); err != nil {
+		return nil, fmt.Errorf("device: read regexes: %w", err)
+	}
+
+	for _, section := range [][]rule{p.rules.Bots, p.rules.Browsers, p.rules.Engines, p.rules.Oses, p.rules.Devices} {
+		for i := range section {
+			re, err := regexp.Compile(section[i].Regex)
+
+			if err != nil {
+				return nil, fmt.Errorf("device: regex %q: %w", section[i].Regex, err)
+			}
+
+			section[i].re = re
+		}
+	}
+
+	return &p, nil
+}
+
+// SetParser replaces the parser of the package functions, nil returns
+// the one of the embedded regexes
+func SetParser(p *Parser) {
+	parserMu.Lock()
+	defer parserMu.Unlock()
+
+	parser = p
+}
+
+func defaultParser() *Parser {
+	parserMu.RLock()
+	defer parserMu.RUnlock()
+
+	if parser != nil {
+		return parser
+	}
+
+	return embeddedParser()
+}
+
+// Parse parses the user agent by the parser set by SetParser
+func Parse(userAgent string, hints Hints) Info {
+	return defaultParser().Parse(userAgent, hints)
+}
+
+// Parse parses the user agent, the client hints are more exact and
+// replace the values of the user agent they have
+func (p *Parser) Parse(userAgent string, hints Hints) Info {
+	var info Info
+
+	if bot, ok := match(p.rules.Bots, userAgent); ok {
+		info.Browser = bot.component()
+		info.Bot = true
+	} else if browser, ok := match(p.rules.Browsers, userAgent); ok {
+		info.Browser = browser.component()
+	}
+
+	if engine, ok := match(p.rules.Engines, userAgent); ok {
+		info.Engine = engine.component()
+	}
+
+	if os, ok := match(p.rules.Oses, userAgent); ok {
+		info.OS = os.component()
+	}
+
+	info.Type = TypeDesktop
+
+	if device, ok := match(p.rules.Devices, userAgent); ok {
+		info.Type = device.rule.Type
+		info.Vendor = device.expand(device.rule.Vendor)
+		info.Model = device.expand(device.rule.Model)
+	}
+
+	hints.apply(&info)
+
+	if info.Bot {
+		info.Type = TypeBot
+	}
+
+	return info
+}
+
+// A rule matched by a user agent
+type matched struct {
+	rule      *rule
+	userAgent string
+	groups    []int
+}
+
+// Returns the first rule the user agent matches
+func match(section []rule, userAgent string) (matched, bool) {
+	for i := range section {
+		if groups := section[i].re.FindStringSubmatchIndex(userAgent); groups != nil {
+			return matched{rule: &section[i], userAgent: userAgent, groups: groups}, true
+		}
+	}
+
+	return matched{}, false
+}
+
+// Replaces the groups of the template, spaces around are trimmed
+func (m matched) expand(template string) string {
+	if template == "" {
+		return ""
+	}
+
+	return strings.Join(strings.Fields(string(m.rule.re.ExpandString(nil, template, m.userAgent, m.groups))), " ")
+}
+
+func (m matched) component() Component {
+	version := "${1}"
+
+	if m.rule.Version != nil {
+		version = *m.rule.Version
+	}
+
+	// Groups which didn't match are expanded to an empty string
+	c := Component{
+		Name:    m.expand(m.rule.Name),
+		Version: strings.ReplaceAll(m.expand(version), "_", "."),
+	}
+
+	if renamed, ok := m.rule.Versions[c.Version]; ok {
+		c.Version = renamed
+	}
+
+	return c
+}
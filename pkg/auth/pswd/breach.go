@@ -0,0 +1,223 @@
+package pswd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Length of the hash prefix used for a range lookup, as in the k-anonymity
+// model of the "Have I Been Pwned" range API
+const prefixLength = 5
+
+// BreachList looks up SHA-1 hashes of leaked passwords in a local copy of
+// a breached passwords list. The path is either a file sorted by hash with
+// "HASH" or "HASH:COUNT" lines, or a directory with range files named by
+// the hash prefix and containing "SUFFIX:COUNT" lines.
+// Only the range of the hash prefix is read for every lookup.
+type BreachList struct {
+	path  string
+	isDir bool
+	file  *os.File
+	size  int64
+}
+
+var (
+	breachList   *BreachList
+	breachListMu sync.RWMutex
+)
+
+func OpenBreachList(path string) (*BreachList, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &BreachList{path: path, isDir: true}, nil
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &BreachList{path: path, file: file, size: info.Size()}, nil
+}
+
+// SetBreachList replaces the list used by IsBreached, nil disables the check
+func SetBreachList(list *BreachList) {
+	breachListMu.Lock()
+	defer breachListMu.Unlock()
+
+	breachList = list
+}
+
+// IsBreached checks the password in the configured breach list
+func IsBreached(passwd string) (bool, error) {
+	breachListMu.RLock()
+	list := breachList
+	breachListMu.RUnlock()
+
+	if list == nil {
+		return false, nil
+	}
+
+	return list.Contains(passwd)
+}
+
+func (l *BreachList) Contains(passwd string) (bool, error) {
+	sum := sha1.Sum([]byte(passwd))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	if l.isDir {
+		return l.containsInRange(prefix, suffix)
+	}
+
+	return l.containsInFile(prefix, suffix)
+}
+
+func (l *BreachList) Close() error {
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
+
+func (l *BreachList) containsInRange(prefix string, suffix string) (bool, error) {
+	data, err := os.ReadFile(filepath.Join(l.path, prefix))
+
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = os.ReadFile(filepath.Join(l.path, prefix+".txt"))
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if strings.EqualFold(hashOf(string(line)), suffix) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (l *BreachList) containsInFile(prefix string, suffix string) (bool, error) {
+	// Binary search of the first line, which hash is not less than the prefix
+	lo, hi := int64(0), l.size
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		_, line, err := l.lineAt(mid)
+
+		if err != nil {
+			return false, err
+		}
+
+		if line != "" && strings.ToUpper(line[:min(prefixLength, len(line))]) < prefix {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	start, _, err := l.lineAt(lo)
+
+	if err != nil {
+		return false, err
+	}
+
+	// Reading the range of the prefix
+	for start < l.size {
+		next, line, err := l.readLine(start)
+
+		if err != nil {
+			return false, err
+		}
+
+		hash := strings.ToUpper(hashOf(line))
+
+		if !strings.HasPrefix(hash, prefix) {
+			return false, nil
+		}
+
+		if hash[prefixLength:] == suffix {
+			return true, nil
+		}
+
+		start = next
+	}
+
+	return false, nil
+}
+
+// Returns the start and the text of the first line beginning at or after the offset
+func (l *BreachList) lineAt(offset int64) (int64, string, error) {
+	if offset > 0 {
+		// Skipping the rest of the line, which contains the previous byte
+		next, _, err := l.readLine(offset - 1)
+
+		if err != nil {
+			return 0, "", err
+		}
+
+		offset = next
+	}
+
+	if offset >= l.size {
+		return l.size, "", nil
+	}
+
+	_, line, err := l.readLine(offset)
+
+	return offset, line, err
+}
+
+// Reads the line from the offset and returns the start of the next line
+func (l *BreachList) readLine(offset int64) (int64, string, error) {
+	var line []byte
+
+	buf := make([]byte, 128)
+
+	for {
+		n, err := l.file.ReadAt(buf, offset+int64(len(line)))
+
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			line = append(line, buf[:i]...)
+			return offset + int64(len(line)) + 1, strings.TrimSpace(string(line)), nil
+		}
+
+		line = append(line, buf[:n]...)
+
+		if errors.Is(err, io.EOF) {
+			return offset + int64(len(line)), strings.TrimSpace(string(line)), nil
+		}
+
+		if err != nil {
+			return 0, "", err
+		}
+	}
+}
+
+// Removes a count of occurrences from a line
+func hashOf(line string) string {
+	hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+
+	return hash
+}
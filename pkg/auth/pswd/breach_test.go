@@ -0,0 +1,149 @@
+package pswd_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"apibgo/pkg/auth/pswd"
+)
+
+func sha1Hex(passwd string) string {
+	sum := sha1.Sum([]byte(passwd))
+
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// Breached passwords and enough others to make the binary search go
+// through several lines
+func breachedHashes() ([]string, []string) {
+	breached := []string{"password", "123456", "qwerty", "Pa$$w0rd"}
+	hashes := []string{}
+
+	for _, passwd := range breached {
+		hashes = append(hashes, sha1Hex(passwd))
+	}
+
+	for i := 0; i < 500; i++ {
+		hashes = append(hashes, sha1Hex(fmt.Sprintf("filler-%d", i)))
+	}
+
+	sort.Strings(hashes)
+
+	return breached, hashes
+}
+
+func TestBreachListFile(t *testing.T) {
+	breached, hashes := breachedHashes()
+	lines := make([]string, len(hashes))
+
+	for i, hash := range hashes {
+		// Counts are optional
+		if i%2 == 0 {
+			hash += fmt.Sprintf(":%d", i+1)
+		}
+
+		lines[i] = hash
+	}
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	testBreachList(t, path, breached)
+}
+
+func TestBreachListDir(t *testing.T) {
+	breached, hashes := breachedHashes()
+	dir := t.TempDir()
+	ranges := map[string][]string{}
+
+	for _, hash := range hashes {
+		ranges[hash[:5]] = append(ranges[hash[:5]], hash[5:]+":3")
+	}
+
+	i := 0
+
+	for prefix, lines := range ranges {
+		// Both names of the range files are read
+		name := prefix
+
+		if i%2 == 0 {
+			name += ".txt"
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		i++
+	}
+
+	testBreachList(t, dir, breached)
+}
+
+func testBreachList(t *testing.T, path string, breached []string) {
+	t.Helper()
+
+	list, err := pswd.OpenBreachList(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer list.Close()
+
+	tests := map[string]bool{
+		"correct horse battery staple": false,
+		"Password":                     false,
+		"":                             false,
+	}
+
+	for _, passwd := range breached {
+		tests[passwd] = true
+	}
+
+	for passwd, want := range tests {
+		if got, err := list.Contains(passwd); err != nil || got != want {
+			t.Errorf("Contains(%q) = %v, %v, want %v", passwd, got, err, want)
+		}
+	}
+}
+
+func TestIsBreached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+
+	if err := os.WriteFile(path, []byte(sha1Hex("password")+":10\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := pswd.OpenBreachList(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer list.Close()
+
+	if breached, _ := pswd.IsBreached("password"); breached {
+		t.Fatal("breached without a list")
+	}
+
+	pswd.SetBreachList(list)
+	defer pswd.SetBreachList(nil)
+
+	if breached, _ := pswd.IsBreached("password"); !breached {
+		t.Fatal("not breached by the list")
+	}
+
+	if _, err := pswd.OpenBreachList(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("no error of a missing list")
+	}
+}
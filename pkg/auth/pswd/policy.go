@@ -0,0 +1,60 @@
+package pswd
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Policy describes requirements to a new password
+type Policy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+var (
+	policy   = Policy{MinLength: 8}
+	policyMu sync.RWMutex
+)
+
+// SetPolicy replaces the policy used by the validation of passwords
+func SetPolicy(p Policy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+
+	policy = p
+}
+
+func CurrentPolicy() Policy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+
+	return policy
+}
+
+func (p Policy) CheckLength(passwd string) bool {
+	return len([]rune(passwd)) >= p.MinLength
+}
+
+func (p Policy) CheckUpper(passwd string) bool {
+	return !p.RequireUpper || strings.IndexFunc(passwd, unicode.IsUpper) >= 0
+}
+
+func (p Policy) CheckLower(passwd string) bool {
+	return !p.RequireLower || strings.IndexFunc(passwd, unicode.IsLower) >= 0
+}
+
+func (p Policy) CheckDigit(passwd string) bool {
+	return !p.RequireDigit || strings.IndexFunc(passwd, unicode.IsDigit) >= 0
+}
+
+func (p Policy) CheckSymbol(passwd string) bool {
+	return !p.RequireSymbol || strings.IndexFunc(passwd, isSymbol) >= 0
+}
+
+func isSymbol(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r)
+}
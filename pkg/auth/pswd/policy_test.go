@@ -0,0 +1,39 @@
+package pswd_test
+
+import (
+	"testing"
+
+	"apibgo/pkg/auth/pswd"
+)
+
+func TestPolicy(t *testing.T) {
+	strict := pswd.Policy{MinLength: 8, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		name   string
+		policy pswd.Policy
+		passwd string
+		check  func(pswd.Policy, string) bool
+		want   bool
+	}{
+		{name: "long enough", policy: strict, passwd: "abcdefgh", check: pswd.Policy.CheckLength, want: true},
+		{name: "too short", policy: strict, passwd: "abcdefg", check: pswd.Policy.CheckLength},
+		{name: "runes are counted", policy: strict, passwd: "пароль12", check: pswd.Policy.CheckLength, want: true},
+		{name: "upper", policy: strict, passwd: "abcD", check: pswd.Policy.CheckUpper, want: true},
+		{name: "no upper", policy: strict, passwd: "abcd", check: pswd.Policy.CheckUpper},
+		{name: "cyrillic upper", policy: strict, passwd: "Пароль", check: pswd.Policy.CheckUpper, want: true},
+		{name: "no lower", policy: strict, passwd: "ABCD", check: pswd.Policy.CheckLower},
+		{name: "digit", policy: strict, passwd: "abc1", check: pswd.Policy.CheckDigit, want: true},
+		{name: "no digit", policy: strict, passwd: "abcd", check: pswd.Policy.CheckDigit},
+		{name: "symbol", policy: strict, passwd: "ab$d", check: pswd.Policy.CheckSymbol, want: true},
+		{name: "space is a symbol", policy: strict, passwd: "ab d", check: pswd.Policy.CheckSymbol, want: true},
+		{name: "no symbol", policy: strict, passwd: "abcd", check: pswd.Policy.CheckSymbol},
+		{name: "not required", policy: pswd.Policy{}, passwd: "abcd", check: pswd.Policy.CheckSymbol, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.check(tt.policy, tt.passwd); got != tt.want {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,13 +1,240 @@
 package pswd
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
 
-func HashPassword(passwd string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.DefaultCost)
-	return string(bytes), err
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms of the password hashing
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// ErrUnknownHash is returned for values which are not a hash in
+// the PHC string format, e.g. a password stored as plain text
+var ErrUnknownHash = errors.New("pswd: unknown hash format")
+
+type Argon2Params struct {
+	// Memory in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Hasher makes hashes in the PHC string format:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+//	$2a$10$<salt and hash>
+type Hasher struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+func DefaultHasher() Hasher {
+	return Hasher{
+		Algorithm: Argon2id,
+		Argon2: Argon2Params{
+			Memory:      64 * 1024,
+			Iterations:  3,
+			Parallelism: 2,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+		BcryptCost: bcrypt.DefaultCost,
+	}
+}
+
+// Validate checks the hasher makes hashes, the parameters argon2 panics on
+// and the costs bcrypt rejects are errors
+func (h Hasher) Validate() error {
+	switch h.Algorithm {
+	case Argon2id:
+		if h.Argon2.KeyLength == 0 {
+			return errors.New("pswd: argon2 key length must be positive")
+		}
+
+		return h.Argon2.check()
+	case Bcrypt:
+		if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("pswd: bcrypt cost must be from %d to %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("pswd: unsupported algorithm %q", h.Algorithm)
+}
+
+// The time, the threads and the memory the hash is made with
+func (p Argon2Params) check() error {
+	switch {
+	case p.Iterations == 0:
+		return errors.New("pswd: argon2 iterations must be positive")
+	case p.Parallelism == 0:
+		return errors.New("pswd: argon2 parallelism must be positive")
+	case p.Memory < 8*uint32(p.Parallelism):
+		return errors.New("pswd: argon2 memory must be at least 8 KiB per thread")
+	}
+
+	return nil
+}
+
+func (h Hasher) Hash(passwd string) (string, error) {
+	switch h.Algorithm {
+	case Argon2id:
+		p := h.Argon2
+		salt := make([]byte, p.SaltLength)
+
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+
+		key := argon2.IDKey([]byte(passwd), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+
+		return fmt.Sprintf(
+			"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			Argon2id, argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	case Bcrypt:
+		bytes, err := bcrypt.GenerateFromPassword([]byte(passwd), h.BcryptCost)
+		return string(bytes), err
+	}
+
+	return "", fmt.Errorf("pswd: unsupported algorithm %q", h.Algorithm)
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+func (h Hasher) Verify(passwd, encoded string) (bool, bool, error) {
+	switch algorithmOf(encoded) {
+	case Argon2id:
+		p, salt, key, err := decodeArgon2(encoded)
+
+		if err != nil {
+			return false, false, err
+		}
+
+		other := argon2.IDKey([]byte(passwd), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+
+		return true, h.NeedsRehash(encoded), nil
+	case Bcrypt:
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(passwd))
+
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+
+		if err != nil {
+			return false, false, err
+		}
+
+		return true, h.NeedsRehash(encoded), nil
+	}
+
+	return false, false, ErrUnknownHash
+}
+
+// NeedsRehash reports whether the hash was made by another algorithm or parameters
+func (h Hasher) NeedsRehash(encoded string) bool {
+	algorithm := algorithmOf(encoded)
+
+	if algorithm != h.Algorithm {
+		return true
+	}
+
+	switch algorithm {
+	case Argon2id:
+		p, salt, key, err := decodeArgon2(encoded)
+
+		return err != nil ||
+			p.Memory != h.Argon2.Memory ||
+			p.Iterations != h.Argon2.Iterations ||
+			p.Parallelism != h.Argon2.Parallelism ||
+			uint32(len(salt)) != h.Argon2.SaltLength ||
+			uint32(len(key)) != h.Argon2.KeyLength
+	case Bcrypt:
+		cost, err := bcrypt.Cost([]byte(encoded))
+
+		return err != nil || cost != h.BcryptCost
+	}
+
+	return true
+}
+
+func algorithmOf(encoded string) string {
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) < 3 || parts[0] != "" {
+		return ""
+	}
+
+	switch parts[1] {
+	case Argon2id:
+		return Argon2id
+	case "2a", "2b", "2y":
+		return Bcrypt
+	}
+
+	return ""
+}
+
+func decodeArgon2(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	var version int
+
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) != 6 {
+		return p, nil, nil, ErrUnknownHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("pswd: unsupported argon2 version: %s", parts[2])
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("pswd: invalid argon2 parameters: %w", err)
+	}
+
+	// The parameters are of the stored value, argon2 panics on some of them
+	if err := p.check(); err != nil {
+		return p, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("pswd: invalid argon2 salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("pswd: invalid argon2 hash: %w", err)
+	}
+
+	// Any password matches an empty hash
+	if len(key) == 0 {
+		return p, nil, nil, errors.New("pswd: empty argon2 hash")
+	}
+
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
 }
@@ -0,0 +1,153 @@
+package pswd_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"apibgo/pkg/auth/pswd"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast
+func argon2Hasher(iterations uint32) pswd.Hasher {
+	h := pswd.DefaultHasher()
+	h.Argon2.Memory = 1024
+	h.Argon2.Iterations = iterations
+	h.Argon2.Parallelism = 1
+
+	return h
+}
+
+func bcryptHasher(cost int) pswd.Hasher {
+	return pswd.Hasher{Algorithm: pswd.Bcrypt, BcryptCost: cost}
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher pswd.Hasher
+		prefix string
+	}{
+		{name: "argon2id", hasher: argon2Hasher(1), prefix: "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{name: "bcrypt", hasher: bcryptHasher(bcrypt.MinCost), prefix: "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.hasher.Hash("secret")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Fatalf("hash = %q, want the prefix %q", hash, tt.prefix)
+			}
+
+			// Salts differ
+			if other, _ := tt.hasher.Hash("secret"); other == hash {
+				t.Fatal("the same hash of the password twice")
+			}
+
+			if ok, rehash, err := tt.hasher.Verify("secret", hash); !ok || rehash || err != nil {
+				t.Fatalf("Verify = %v, %v, %v, want a valid hash without a rehash", ok, rehash, err)
+			}
+
+			if ok, _, err := tt.hasher.Verify("Secret", hash); ok || err != nil {
+				t.Fatalf("Verify of a wrong password = %v, %v", ok, err)
+			}
+		})
+	}
+
+	if _, err := (pswd.Hasher{Algorithm: "md5"}).Hash("secret"); err == nil {
+		t.Fatal("no error of an unsupported algorithm")
+	}
+}
+
+func TestVerifyRehash(t *testing.T) {
+	argon2Hash, _ := argon2Hasher(1).Hash("secret")
+	bcryptHash, _ := bcryptHasher(bcrypt.MinCost).Hash("secret")
+
+	tests := []struct {
+		name   string
+		hasher pswd.Hasher
+		hash   string
+		rehash bool
+	}{
+		{name: "same parameters", hasher: argon2Hasher(1), hash: argon2Hash},
+		{name: "other iterations", hasher: argon2Hasher(2), hash: argon2Hash, rehash: true},
+		{name: "other key length", hasher: func() pswd.Hasher { h := argon2Hasher(1); h.Argon2.KeyLength = 64; return h }(), hash: argon2Hash, rehash: true},
+		{name: "bcrypt to argon2id", hasher: argon2Hasher(1), hash: bcryptHash, rehash: true},
+		{name: "argon2id to bcrypt", hasher: bcryptHasher(bcrypt.MinCost), hash: argon2Hash, rehash: true},
+		{name: "other cost", hasher: bcryptHasher(bcrypt.MinCost + 1), hash: bcryptHash, rehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash, err := tt.hasher.Verify("secret", tt.hash)
+
+			if !ok || err != nil || rehash != tt.rehash {
+				t.Fatalf("Verify = %v, %v, %v, want a rehash %v", ok, rehash, err, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+		err  error
+	}{
+		{name: "plain text", hash: "secret", err: pswd.ErrUnknownHash},
+		{name: "unknown algorithm", hash: "$md5$abc", err: pswd.ErrUnknownHash},
+		{name: "missing parts", hash: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdA", err: pswd.ErrUnknownHash},
+		{name: "other version", hash: "$argon2id$v=16$m=1024,t=1,p=1$c2FsdHNhbHQ$a2V5"},
+		{name: "broken salt", hash: "$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5"},
+		{name: "zero iterations", hash: "$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHQ$a2V5"},
+		{name: "zero parallelism", hash: "$argon2id$v=19$m=1024,t=1,p=0$c2FsdHNhbHQ$a2V5"},
+		{name: "too little memory", hash: "$argon2id$v=19$m=7,t=1,p=1$c2FsdHNhbHQ$a2V5"},
+		{name: "empty hash", hash: "$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHQ$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, _, err := argon2Hasher(1).Verify("secret", tt.hash)
+
+			if ok || err == nil || (tt.err != nil && !errors.Is(err, tt.err)) {
+				t.Fatalf("Verify = %v, %v, want the error %v", ok, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*pswd.Hasher)
+		valid  bool
+	}{
+		{name: "default", change: func(h *pswd.Hasher) {}, valid: true},
+		{name: "bcrypt", change: func(h *pswd.Hasher) { h.Algorithm = pswd.Bcrypt }, valid: true},
+		{name: "unknown algorithm", change: func(h *pswd.Hasher) { h.Algorithm = "md5" }},
+		{name: "zero iterations", change: func(h *pswd.Hasher) { h.Argon2.Iterations = 0 }},
+		{name: "zero parallelism", change: func(h *pswd.Hasher) { h.Argon2.Parallelism = 0 }},
+		{name: "zero key length", change: func(h *pswd.Hasher) { h.Argon2.KeyLength = 0 }},
+		{name: "too little memory", change: func(h *pswd.Hasher) { h.Argon2.Memory = 8 }},
+		{name: "low cost", change: func(h *pswd.Hasher) { h.Algorithm = pswd.Bcrypt; h.BcryptCost = bcrypt.MinCost - 1 }},
+		{name: "high cost", change: func(h *pswd.Hasher) { h.Algorithm = pswd.Bcrypt; h.BcryptCost = bcrypt.MaxCost + 1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := pswd.DefaultHasher()
+			tt.change(&h)
+
+			if err := h.Validate(); (err == nil) != tt.valid {
+				t.Fatalf("Validate = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
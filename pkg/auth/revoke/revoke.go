@@ -0,0 +1,74 @@
+package revoke
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps the ids (jti) of the revoked tokens until the tokens expire
+type Store interface {
+	// Revoke marks the token as revoked for the ttl, the rest of its lifetime
+	Revoke(ctx context.Context, id string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// Memory is the store of one process, instances behind a balancer don't
+// see the tokens revoked by each other
+type Memory struct {
+	mu      sync.RWMutex
+	expires map[string]time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{expires: map[string]time.Time{}}
+}
+
+func (m *Memory) Revoke(ctx context.Context, id string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	// The expired tokens are dropped on writes, so reads stay cheap
+	for key, expires := range m.expires {
+		if !expires.After(now) {
+			delete(m.expires, key)
+		}
+	}
+
+	m.expires[id] = now.Add(ttl)
+
+	return nil
+}
+
+func (m *Memory) IsRevoked(ctx context.Context, id string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	expires, ok := m.expires[id]
+
+	return ok && expires.After(time.Now()), nil
+}
+
+// Redis is the store shared by the instances, the keys expire with the tokens
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+func (r *Redis) Revoke(ctx context.Context, id string, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+id, 1, ttl).Err()
+}
+
+func (r *Redis) IsRevoked(ctx context.Context, id string) (bool, error) {
+	count, err := r.client.Exists(ctx, r.prefix+id).Result()
+
+	return count > 0, err
+}
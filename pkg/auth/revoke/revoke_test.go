@@ -0,0 +1,37 @@
+package revoke_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"apibgo/pkg/auth/revoke"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	store := revoke.NewMemory()
+
+	if err := store.Revoke(ctx, "expired", -time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Revoke(ctx, "revoked", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id      string
+		revoked bool
+	}{
+		{id: "revoked", revoked: true},
+		{id: "expired", revoked: false},
+		{id: "unknown", revoked: false},
+	}
+
+	for _, tt := range tests {
+		if revoked, err := store.IsRevoked(ctx, tt.id); err != nil || revoked != tt.revoked {
+			t.Errorf("%s: revoked = %v, %v, want %v", tt.id, revoked, err, tt.revoked)
+		}
+	}
+}
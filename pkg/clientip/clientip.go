@@ -0,0 +1,222 @@
+// Package clientip finds the address of the client of requests behind
+// proxies. The header the proxies write, Forwarded (RFC 7239) or
+// X-Forwarded-For, is read from the right and every hop added by a trusted
+// proxy is skipped. The other header is ignored, so clients can't forge
+// their address by sending the headers themselves.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// Headers the proxies write the hops to
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded"
+)
+
+// Proxies are the networks of the trusted proxies, like load balancers,
+// and the header they write
+type Proxies struct {
+	Networks []netip.Prefix
+	Header   string
+}
+
+// ParseProxies parses the CIDRs of the proxies, single addresses are
+// networks of one address. The header is X-Forwarded-For when it's empty.
+func ParseProxies(cidrs []string, header string) (Proxies, error) {
+	proxies := Proxies{Networks: make([]netip.Prefix, 0, len(cidrs))}
+
+	switch {
+	case header == "" || strings.EqualFold(header, HeaderXForwardedFor):
+		proxies.Header = HeaderXForwardedFor
+	case strings.EqualFold(header, HeaderForwarded):
+		proxies.Header = HeaderForwarded
+	default:
+		return Proxies{}, fmt.Errorf("clientip: unknown header %q", header)
+	}
+
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+
+			if err != nil {
+				return Proxies{}, fmt.Errorf("clientip: proxy %q: %w", cidr, err)
+			}
+
+			addr = addr.Unmap()
+			proxies.Networks = append(proxies.Networks, netip.PrefixFrom(addr, addr.BitLen()))
+
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+
+		if err != nil {
+			return Proxies{}, fmt.Errorf("clientip: proxy %q: %w", cidr, err)
+		}
+
+		proxies.Networks = append(proxies.Networks, prefix.Masked())
+	}
+
+	return proxies, nil
+}
+
+// Trusted reports whether the address is of a trusted proxy
+func (p Proxies) Trusted(addr netip.Addr) bool {
+	for _, prefix := range p.Networks {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resolve returns the address of the client of the request from the peer
+// address and the headers. Hops are taken from the right while the
+// current one is a trusted proxy, an unknown or obfuscated hop stops at
+// the proxy which added it. The peer is returned as it is when it isn't an
+// address, like the one of a unix socket.
+func (p Proxies) Resolve(remoteAddr string, header http.Header) string {
+	client, ok := parseNode(remoteAddr)
+
+	if !ok {
+		return remoteAddr
+	}
+
+	chain := p.forwardedFor(header)
+
+	for i := len(chain) - 1; i >= 0 && p.Trusted(client); i-- {
+		hop, ok := parseNode(chain[i])
+
+		if !ok {
+			break
+		}
+
+		client = hop
+	}
+
+	return client.String()
+}
+
+// The for= nodes of the Forwarded header or the X-Forwarded-For list,
+// whichever the proxies write. Both are in the order of the hops.
+func (p Proxies) forwardedFor(header http.Header) []string {
+	var nodes []string
+
+	if p.Header != HeaderForwarded {
+		for _, value := range header.Values(HeaderXForwardedFor) {
+			nodes = append(nodes, strings.Split(value, ",")...)
+		}
+
+		return nodes
+	}
+
+	for _, value := range header.Values(HeaderForwarded) {
+		for _, element := range splitList(value, ',') {
+			for _, pair := range splitList(element, ';') {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+
+				if strings.EqualFold(key, "for") {
+					nodes = append(nodes, value)
+				}
+			}
+		}
+	}
+
+	return nodes
+}
+
+// Splits the header by the separator outside of the quotes
+func splitList(header string, sep rune) []string {
+	var items []string
+	quoted, start := false, 0
+
+	for i, r := range header {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == sep && !quoted:
+			items = append(items, header[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(items, header[start:])
+}
+
+// Parses a node like 192.0.2.60, 192.0.2.60:4711, 2001:db8::17 or
+// "[2001:db8::17]:4711", the port and the zone are dropped
+func parseNode(node string) (netip.Addr, bool) {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	} else {
+		node = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	}
+
+	addr, err := netip.ParseAddr(node)
+
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addr.Unmap().WithZone(""), true
+}
+
+var (
+	trusted   Proxies
+	trustedMu sync.RWMutex
+)
+
+// SetTrusted sets the proxies of the package functions, without them the
+// headers are ignored and the peer address is the client
+func SetTrusted(proxies Proxies) {
+	trustedMu.Lock()
+	defer trustedMu.Unlock()
+
+	trusted = proxies
+}
+
+// Resolve returns the address of the client of the request by the
+// proxies set by SetTrusted
+func Resolve(r *http.Request) string {
+	trustedMu.RLock()
+	defer trustedMu.RUnlock()
+
+	return trusted.Resolve(r.RemoteAddr, r.Header)
+}
+
+type ipKey struct{}
+
+// WithIp returns the context of the request of the client with the address
+func WithIp(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ipKey{}, ip)
+}
+
+// FromContext returns the address of the client stored by WithIp
+func FromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(ipKey{}).(string)
+
+	return ip, ok
+}
+
+// FromRequest returns the address stored in the context of the request,
+// it's resolved when the request didn't pass the middleware
+func FromRequest(r *http.Request) string {
+	if ip, ok := FromContext(r.Context()); ok {
+		return ip
+	}
+
+	return Resolve(r)
+}
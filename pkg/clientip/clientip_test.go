@@ -0,0 +1,109 @@
+package clientip_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"apibgo/pkg/clientip"
+)
+
+func TestResolve(t *testing.T) {
+	cidrs := []string{"10.0.0.0/8", "2001:db8:ffff::/48", "192.0.2.1"}
+	proxies := map[string]clientip.Proxies{}
+
+	for _, header := range []string{clientip.HeaderXForwardedFor, clientip.HeaderForwarded} {
+		p, err := clientip.ParseProxies(cidrs, header)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		proxies[header] = p
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		// The header the proxies write, X-Forwarded-For when it's empty
+		proxies string
+		ip      string
+	}{
+		{name: "direct client", remoteAddr: "203.0.113.7:52100", ip: "203.0.113.7"},
+		{name: "direct ipv6 client", remoteAddr: "[2001:db8:1::7]:52100", ip: "2001:db8:1::7"},
+		{name: "zone", remoteAddr: "[fe80::1%eth0]:52100", ip: "fe80::1"},
+		{name: "untrusted peer with the header", remoteAddr: "203.0.113.7:52100", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, ip: "203.0.113.7"},
+		{name: "x-forwarded-for", remoteAddr: "10.0.0.2:443", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, ip: "198.51.100.1"},
+		{name: "forged hop", remoteAddr: "10.0.0.2:443", header: http.Header{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.0.0.3"}}, ip: "198.51.100.1"},
+		{name: "several headers", remoteAddr: "10.0.0.2:443", header: http.Header{"X-Forwarded-For": {"1.1.1.1", "198.51.100.1"}}, ip: "198.51.100.1"},
+		{name: "single trusted address", remoteAddr: "192.0.2.1:443", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, ip: "198.51.100.1"},
+		{name: "only proxies", remoteAddr: "10.0.0.2:443", header: http.Header{"X-Forwarded-For": {"10.0.0.4, 10.0.0.3"}}, ip: "10.0.0.4"},
+		{name: "ipv6 x-forwarded-for", remoteAddr: "[2001:db8:ffff::1]:443", header: http.Header{"X-Forwarded-For": {"2001:db8:1::7"}}, ip: "2001:db8:1::7"},
+		{name: "mapped ipv4", remoteAddr: "[::ffff:10.0.0.2]:443", header: http.Header{"X-Forwarded-For": {"::ffff:198.51.100.1"}}, ip: "198.51.100.1"},
+		{name: "invalid hop", remoteAddr: "10.0.0.2:443", header: http.Header{"X-Forwarded-For": {"198.51.100.1, garbage"}}, ip: "10.0.0.2"},
+		{name: "forwarded", remoteAddr: "10.0.0.2:443", header: http.Header{"Forwarded": {"for=198.51.100.1;proto=https;by=10.0.0.2"}}, proxies: clientip.HeaderForwarded, ip: "198.51.100.1"},
+		{name: "forwarded ipv6 with port", remoteAddr: "10.0.0.2:443", header: http.Header{"Forwarded": {`for="[2001:db8:cafe::17]:4711"`}}, proxies: clientip.HeaderForwarded, ip: "2001:db8:cafe::17"},
+		{name: "forwarded chain", remoteAddr: "10.0.0.2:443", header: http.Header{"Forwarded": {`for=1.1.1.1, For="198.51.100.1:80";proto=http, for=10.0.0.3`}}, proxies: clientip.HeaderForwarded, ip: "198.51.100.1"},
+		{name: "forwarded unknown", remoteAddr: "10.0.0.2:443", header: http.Header{"Forwarded": {"for=unknown"}}, proxies: clientip.HeaderForwarded, ip: "10.0.0.2"},
+		{name: "forwarded obfuscated", remoteAddr: "10.0.0.2:443", header: http.Header{"Forwarded": {"for=_hidden, for=10.0.0.3"}}, proxies: clientip.HeaderForwarded, ip: "10.0.0.3"},
+		{name: "forwarded ignores x-forwarded-for", remoteAddr: "10.0.0.2:443", header: http.Header{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"198.51.100.2"}}, proxies: clientip.HeaderForwarded, ip: "198.51.100.1"},
+		{name: "x-forwarded-for ignores forwarded", remoteAddr: "10.0.0.2:443", header: http.Header{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"198.51.100.2"}}, ip: "198.51.100.2"},
+		{name: "forwarded without the header", remoteAddr: "10.0.0.2:443", header: http.Header{"X-Forwarded-For": {"198.51.100.2"}}, proxies: clientip.HeaderForwarded, ip: "10.0.0.2"},
+		{name: "no port", remoteAddr: "203.0.113.7", ip: "203.0.113.7"},
+		{name: "unix socket", remoteAddr: "@", ip: "@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.proxies
+
+			if header == "" {
+				header = clientip.HeaderXForwardedFor
+			}
+
+			if ip := proxies[header].Resolve(tt.remoteAddr, tt.header); ip != tt.ip {
+				t.Fatalf("ip = %q, want %q", ip, tt.ip)
+			}
+		})
+	}
+}
+
+func TestParseProxies(t *testing.T) {
+	tests := []struct {
+		cidrs  []string
+		header string
+		err    bool
+	}{
+		{cidrs: nil},
+		{cidrs: []string{"10.0.0.0/8", " 2001:db8::/32 ", "::ffff:192.0.2.1", "192.0.2.1"}},
+		{cidrs: []string{"10.0.0.0/8"}, header: "forwarded"},
+		{cidrs: []string{"10.0.0.0/8"}, header: "X-Real-IP", err: true},
+		{cidrs: []string{"10.0.0.0/33"}, err: true},
+		{cidrs: []string{"load-balancer"}, err: true},
+	}
+
+	for _, tt := range tests {
+		if _, err := clientip.ParseProxies(tt.cidrs, tt.header); (err != nil) != tt.err {
+			t.Errorf("%v %q: err = %v, want error %v", tt.cidrs, tt.header, err, tt.err)
+		}
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.2:443"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	// Without the trusted proxies the peer is the client
+	if ip := clientip.FromRequest(r); ip != "10.0.0.2" {
+		t.Fatalf("ip = %q, want the peer", ip)
+	}
+
+	r = r.WithContext(clientip.WithIp(context.Background(), "198.51.100.9"))
+
+	if ip := clientip.FromRequest(r); ip != "198.51.100.9" {
+		t.Fatalf("ip = %q, want the one of the context", ip)
+	}
+}
@@ -0,0 +1,148 @@
+// Package geoip finds the location of addresses by a local CSV file of
+// ranges, like the free DB-IP "IP to City Lite" one with the columns
+// ip_start, ip_end, continent, country, stateprov, city, latitude, longitude.
+// Files of the country only (ip_start, ip_end, country) are read too.
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Location of an address, the coordinates are absent in country files
+type Location struct {
+	Country   string
+	City      string
+	Latitude  float64
+	Longitude float64
+	// Whether the coordinates are known
+	Located bool
+}
+
+type ipRange struct {
+	start    netip.Addr
+	end      netip.Addr
+	location Location
+}
+
+// DB is the ranges sorted by their start, it's read once and safe
+// for concurrent lookups
+type DB struct {
+	ranges []ipRange
+}
+
+// Open reads the CSV file of the path
+func Open(path string) (*DB, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return Read(file)
+}
+
+// Read reads the ranges of the CSV, lines which aren't ranges like
+// a header are skipped
+func Read(r io.Reader) (*DB, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	db := &DB{}
+
+	for {
+		record, err := reader.Read()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record) < 3 {
+			continue
+		}
+
+		start, err1 := netip.ParseAddr(record[0])
+		end, err2 := netip.ParseAddr(record[1])
+
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		if start.Unmap().Compare(end.Unmap()) > 0 {
+			return nil, fmt.Errorf("geoip: range %s-%s ends before its start", record[0], record[1])
+		}
+
+		db.ranges = append(db.ranges, ipRange{start: start.Unmap(), end: end.Unmap(), location: location(record)})
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].start.Less(db.ranges[j].start) })
+
+	return db, nil
+}
+
+// The location of the record of the city or the country format
+func location(record []string) Location {
+	if len(record) < 8 {
+		return Location{Country: record[2]}
+	}
+
+	latitude, err1 := strconv.ParseFloat(record[6], 64)
+	longitude, err2 := strconv.ParseFloat(record[7], 64)
+
+	return Location{
+		Country:   record[3],
+		City:      record[5],
+		Latitude:  latitude,
+		Longitude: longitude,
+		Located:   err1 == nil && err2 == nil,
+	}
+}
+
+// Lookup returns the location of the address, false for unknown
+// and invalid addresses
+func (db *DB) Lookup(ip string) (Location, bool) {
+	addr, err := netip.ParseAddr(ip)
+
+	if db == nil || err != nil {
+		return Location{}, false
+	}
+
+	addr = addr.Unmap()
+
+	// The last range which starts at the address or before it
+	i := sort.Search(len(db.ranges), func(i int) bool { return addr.Less(db.ranges[i].start) }) - 1
+
+	if i < 0 || db.ranges[i].end.Less(addr) {
+		return Location{}, false
+	}
+
+	return db.ranges[i].location, true
+}
+
+// Radius of the Earth in kilometers
+const earthRadius = 6371.0
+
+// Distance returns the great-circle distance between the locations in kilometers
+func Distance(a Location, b Location) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := rad(b.Latitude - a.Latitude)
+	dLon := rad(b.Longitude - a.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,55 @@
+package geoip_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"apibgo/pkg/geoip"
+)
+
+const cities = `ip_start,ip_end,continent,country,stateprov,city,latitude,longitude
+10.0.0.0,10.0.0.255,EU,RU,Moscow,Moscow,55.7558,37.6173
+10.0.2.0,10.0.2.255,NA,US,California,San Francisco,37.7749,-122.4194
+2001:db8::,2001:db8::ffff,EU,DE,Berlin,Berlin,52.52,13.405
+`
+
+func TestLookup(t *testing.T) {
+	db, err := geoip.Read(strings.NewReader(cities))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip      string
+		country string
+		found   bool
+	}{
+		{ip: "10.0.0.7", country: "RU", found: true},
+		{ip: "10.0.2.255", country: "US", found: true},
+		{ip: "::ffff:10.0.0.1", country: "RU", found: true},
+		{ip: "2001:db8::1", country: "DE", found: true},
+		{ip: "10.0.1.1"},
+		{ip: "9.255.255.255"},
+		{ip: "not an address"},
+	}
+
+	for _, tt := range tests {
+		location, found := db.Lookup(tt.ip)
+
+		if found != tt.found || location.Country != tt.country {
+			t.Errorf("%s: %q, %v, want %q, %v", tt.ip, location.Country, found, tt.country, tt.found)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	moscow := geoip.Location{Latitude: 55.7558, Longitude: 37.6173}
+	berlin := geoip.Location{Latitude: 52.52, Longitude: 13.405}
+
+	// About 1610 km
+	if distance := geoip.Distance(moscow, berlin); math.Abs(distance-1610) > 20 {
+		t.Fatalf("distance = %.0f km, want about 1610", distance)
+	}
+}
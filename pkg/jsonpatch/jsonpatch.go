@@ -0,0 +1,319 @@
+// Package jsonpatch applies JSON Patch documents (RFC 6902) addressed
+// by JSON Pointers (RFC 6901) to values decoded by encoding/json.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	// The patch isn't a valid JSON Patch document
+	ErrInvalid = errors.New("jsonpatch: invalid patch")
+	// A path of the patch doesn't exist in the document
+	ErrPath = errors.New("jsonpatch: path not found")
+	// A "test" operation failed
+	ErrTestFailed = errors.New("jsonpatch: test failed")
+)
+
+type Operation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from,omitempty"`
+	// Nil when the member is absent, "null" for the JSON null
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Decode reads the operations of the patch and checks their members
+func Decode(data []byte) ([]Operation, error) {
+	var ops []Operation
+
+	if err := json.Unmarshal(data, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("%w: operation %d has no value", ErrInvalid, i)
+			}
+		case "move", "copy":
+			// The whole document as the source is treated as an absent member
+			if op.From == "" {
+				return nil, fmt.Errorf("%w: operation %d has no from", ErrInvalid, i)
+			}
+
+			if _, err := parsePointer(op.From); err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %s", ErrInvalid, i, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("%w: operation %d has unknown op %q", ErrInvalid, i, op.Op)
+		}
+
+		if _, err := parsePointer(op.Path); err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %s", ErrInvalid, i, err)
+		}
+	}
+
+	return ops, nil
+}
+
+// Apply applies the operations to a copy of the document. The document
+// is made of maps, slices and scalars as encoding/json decodes into any.
+func Apply(doc any, ops []Operation) (any, error) {
+	doc, err := clone(doc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		if doc, err = apply(doc, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func apply(doc any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		var value any
+
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			if doc, err = remove(doc, path); err != nil {
+				return nil, err
+			}
+
+			return add(doc, path, value)
+		}
+
+		current, err := get(doc, path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+
+		return doc, nil
+	case "remove":
+		return remove(doc, path)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalid, err)
+		}
+
+		value, err := get(doc, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			if value, err = clone(value); err != nil {
+				return nil, err
+			}
+
+			return add(doc, path, value)
+		}
+
+		// A value can't be moved into itself
+		if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+			return nil, fmt.Errorf("%w: %q is a child of %q", ErrInvalid, op.Path, op.From)
+		}
+
+		if doc, err = remove(doc, from); err != nil {
+			return nil, err
+		}
+
+		return add(doc, path, value)
+	}
+
+	return nil, fmt.Errorf("%w: unknown op %q", ErrInvalid, op.Op)
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+
+			if !ok {
+				return nil, ErrPath
+			}
+
+			doc = value
+		case []any:
+			i, err := index(token, len(node)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			doc = node[i]
+		default:
+			return nil, ErrPath
+		}
+	}
+
+	return doc, nil
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = value
+
+			return node, nil
+		case []any:
+			if token == "-" {
+				return append(node, value), nil
+			}
+
+			i, err := index(token, len(node))
+
+			if err != nil {
+				return nil, err
+			}
+
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+
+			return node, nil
+		}
+
+		return nil, ErrPath
+	})
+}
+
+func remove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	return update(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, ErrPath
+			}
+
+			delete(node, token)
+
+			return node, nil
+		case []any:
+			i, err := index(token, len(node)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return append(node[:i], node[i+1:]...), nil
+		}
+
+		return nil, ErrPath
+	})
+}
+
+// Changes the parent of the last token of the path by the function and
+// puts the changed parent back, slices can be reallocated by appending
+func update(doc any, path []string, change func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return change(doc, path[0])
+	}
+
+	child, err := get(doc, path[:1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	if child, err = update(child, path[1:], change); err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]any:
+		node[path[0]] = child
+	case []any:
+		i, _ := index(path[0], len(node)-1)
+		node[i] = child
+	}
+
+	return doc, nil
+}
+
+// The index of an array element, at most the max
+func index(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+
+	// Leading zeros and signs are not allowed
+	if err != nil || i < 0 || i > max || strconv.Itoa(i) != token {
+		return 0, ErrPath
+	}
+
+	return i, nil
+}
+
+// The unescaped tokens of the pointer, the empty pointer is the whole document
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("pointer %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func clone(value any) (any, error) {
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var copied any
+	err = json.Unmarshal(data, &copied)
+
+	return copied, err
+}
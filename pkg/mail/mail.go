@@ -2,10 +2,17 @@ package mail
 
 import (
 	"log"
+	"os"
+	"strconv"
 
 	"github.com/wneessen/go-mail"
 )
 
+// Sender sends HTML messages, Mailer is the SMTP one
+type Sender interface {
+	SendMail(to []string, subject string, message string) bool
+}
+
 type Mailer struct {
 	SmtpHost     string
 	SmtpPort     int
@@ -13,6 +20,18 @@ type Mailer struct {
 	SmtpPassword string
 }
 
+// NewFromEnv returns the SMTP mailer configured by SMTP_* variables
+func NewFromEnv() *Mailer {
+	smtpPort, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
+
+	return &Mailer{
+		SmtpHost:     os.Getenv("SMTP_HOST"),
+		SmtpPort:     smtpPort,
+		SmtpUser:     os.Getenv("SMTP_USER"),
+		SmtpPassword: os.Getenv("SMTP_PASSWORD"),
+	}
+}
+
 func (mailer *Mailer) SendMail(to []string, subject string, message string) bool {
 	m := mail.NewMsg()
 
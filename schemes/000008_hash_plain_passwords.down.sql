@@ -0,0 +1,2 @@
+-- Hashed passwords can't be turned back into plain text
+SELECT 1;
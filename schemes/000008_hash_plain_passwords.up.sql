@@ -0,0 +1,9 @@
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+-- Passwords stored as plain text (e.g. the quest user) are hashed by bcrypt,
+-- such hashes are remade by the configured algorithm after a successful login
+UPDATE users SET password = crypt(password, gen_salt('bf', 10))
+  WHERE password NOT LIKE '$argon2id$%'
+    AND password NOT LIKE '$2a$%'
+    AND password NOT LIKE '$2b$%'
+    AND password NOT LIKE '$2y$%';
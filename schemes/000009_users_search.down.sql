@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_surname_trgm_idx;
+DROP INDEX IF EXISTS users_name_trgm_idx;
+DROP INDEX IF EXISTS users_email_trgm_idx;
+DROP INDEX IF EXISTS users_search_vector_idx;
+
+ALTER TABLE users DROP COLUMN IF EXISTS search_vector;
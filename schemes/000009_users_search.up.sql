@@ -0,0 +1,14 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Words of the email, name and surname for the full-text search
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector
+  GENERATED ALWAYS AS (
+    to_tsvector('simple', coalesce(email, '') || ' ' || coalesce(name, '') || ' ' || coalesce(surname, ''))
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS users_search_vector_idx ON users USING GIN (search_vector);
+
+-- Trigrams serve ILIKE '%part%' and the similarity of misspelled words
+CREATE INDEX IF NOT EXISTS users_email_trgm_idx ON users USING GIN (email gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_name_trgm_idx ON users USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_surname_trgm_idx ON users USING GIN (surname gin_trgm_ops);
@@ -0,0 +1,2 @@
+-- The version of a user is increased by every update, it's the ETag of the user
+ALTER TABLE users ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
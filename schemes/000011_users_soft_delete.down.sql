@@ -0,0 +1,10 @@
+-- Without the column the deleted users would be alive again, so they are removed
+DELETE FROM auths WHERE user_id IN (SELECT id FROM users WHERE deleted_at IS NOT NULL);
+DELETE FROM blocked_users WHERE user_id IN (SELECT id FROM users WHERE deleted_at IS NOT NULL);
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS users_deleted_at_idx;
+DROP INDEX IF EXISTS users_email_key;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
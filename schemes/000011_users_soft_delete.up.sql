@@ -0,0 +1,6 @@
+-- Deleted users are kept until the purge, their emails can be registered again
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP(0) DEFAULT NULL;
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (email) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS consents;
+
+ALTER TABLE users DROP COLUMN IF EXISTS anonymized_at;
@@ -0,0 +1,16 @@
+-- Personal data of users deleted longer than the grace period ago is anonymized
+ALTER TABLE users ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP(0) DEFAULT NULL;
+
+CREATE TABLE IF NOT EXISTS consents (
+  id SERIAL,
+  user_id BIGINT NOT NULL,
+  kind VARCHAR(32) NOT NULL,
+  version VARCHAR(16) NOT NULL,
+  granted BOOLEAN NOT NULL,
+  ip VARCHAR(64) DEFAULT NULL,
+  created_at TIMESTAMP(0) NOT NULL,
+  CONSTRAINT consents_pkey PRIMARY KEY (id),
+  CONSTRAINT consents_user_id_fk FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS consents_user_id_key ON consents(user_id);
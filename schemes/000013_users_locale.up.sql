@@ -0,0 +1,3 @@
+-- Preferences of users, null is the default of the application
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locale VARCHAR(35) DEFAULT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) DEFAULT NULL;
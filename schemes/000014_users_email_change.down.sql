@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS email_revert_token;
+ALTER TABLE users DROP COLUMN IF EXISTS previous_email;
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
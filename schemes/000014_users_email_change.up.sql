@@ -0,0 +1,5 @@
+-- A new email waits for the confirm code in pending_email. The replaced
+-- email can revert the change by the token, only its SHA-256 is kept.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email VARCHAR(150) DEFAULT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS previous_email VARCHAR(150) DEFAULT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_revert_token CHAR(64) DEFAULT NULL;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS auths_access_token_key;
+DROP INDEX IF EXISTS auths_user_id_key;
+
+ALTER TABLE auths DROP COLUMN IF EXISTS last_ip;
+ALTER TABLE auths DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE auths DROP COLUMN IF EXISTS name;
@@ -0,0 +1,7 @@
+-- Users name their sessions, the last seen time and address are updated by requests
+ALTER TABLE auths ADD COLUMN IF NOT EXISTS name VARCHAR(50) DEFAULT NULL;
+ALTER TABLE auths ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMP(0) DEFAULT NULL;
+ALTER TABLE auths ADD COLUMN IF NOT EXISTS last_ip VARCHAR(64) DEFAULT NULL;
+
+CREATE INDEX IF NOT EXISTS auths_user_id_key ON auths(user_id);
+CREATE INDEX IF NOT EXISTS auths_access_token_key ON auths(access_token);
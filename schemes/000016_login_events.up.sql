@@ -0,0 +1,17 @@
+-- Logins, refreshes and logouts of users, the rows are only appended
+CREATE TABLE IF NOT EXISTS login_events (
+  id BIGSERIAL,
+  user_id BIGINT NOT NULL,
+  kind VARCHAR(16) NOT NULL,
+  success BOOLEAN NOT NULL,
+  ip VARCHAR(64) DEFAULT NULL,
+  device VARCHAR(30) NOT NULL DEFAULT '',
+  os VARCHAR(64) NOT NULL DEFAULT '',
+  browser VARCHAR(64) NOT NULL DEFAULT '',
+  user_agent TEXT DEFAULT NULL,
+  created_at TIMESTAMP(0) NOT NULL,
+  CONSTRAINT login_events_pkey PRIMARY KEY (id),
+  CONSTRAINT login_events_user_id_fk FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS login_events_user_id_key ON login_events(user_id, id);
@@ -0,0 +1,17 @@
+-- Devices users logged in from, a device is known by the fingerprint of
+-- its browser, OS, network and the id the client sent
+CREATE TABLE IF NOT EXISTS known_devices (
+  id BIGSERIAL,
+  user_id BIGINT NOT NULL,
+  fingerprint CHAR(64) NOT NULL,
+  name VARCHAR(255) NOT NULL DEFAULT '',
+  ip VARCHAR(64) DEFAULT NULL,
+  country VARCHAR(2) NOT NULL DEFAULT '',
+  latitude DOUBLE PRECISION DEFAULT NULL,
+  longitude DOUBLE PRECISION DEFAULT NULL,
+  last_seen_at TIMESTAMP(0) NOT NULL,
+  created_at TIMESTAMP(0) NOT NULL,
+  CONSTRAINT known_devices_pkey PRIMARY KEY (id),
+  CONSTRAINT known_devices_user_id_fk FOREIGN KEY (user_id) REFERENCES users(id),
+  CONSTRAINT known_devices_fingerprint_key UNIQUE (user_id, fingerprint)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS email_revert_expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS confirm_attempts;
@@ -0,0 +1,4 @@
+-- Failed attempts of the current confirm code, the code is dropped after too
+-- many of them. The token reverting a changed email works until it expires.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS confirm_attempts SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_revert_expires_at TIMESTAMP(0) DEFAULT NULL;